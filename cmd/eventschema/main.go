@@ -0,0 +1,34 @@
+// Command eventschema writes the JSON schema of every event in the catalog,
+// one file per type and version. Run it through go generate after changing a
+// payload type:
+//
+//	go generate ./internal/core/domain/events
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
+
+func main() {
+	out := flag.String("out", "api/events", "directory to write the schemas to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		log.Fatalf("failed to create %s: %v", *out, err)
+	}
+	for _, payload := range domainevents.Catalog() {
+		schema, err := domainevents.Schema(payload)
+		if err != nil {
+			log.Fatalf("failed to render the schema of %s: %v", payload.EventType(), err)
+		}
+		path := filepath.Join(*out, domainevents.SchemaFileName(payload))
+		if err := os.WriteFile(path, schema, 0o644); err != nil {
+			log.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+}
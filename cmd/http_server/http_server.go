@@ -8,9 +8,6 @@ import (
 	"os"
 	"time"
 
-	awsCfg "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-
 	"github.com/golang-auth/internal/adapters/config"
 	"github.com/golang-auth/internal/adapters/logging"
 	"github.com/golang-auth/internal/adapters/messaging"
@@ -81,30 +78,19 @@ func LoadComponents() (ports.Logger, *postgre.Client, *redis.Client, ports.Event
 	})
 	logger.Info("Successful redis connection")
 
-	// AWS Message Broker
-	awsConfig, err := config.NewAWSConfig()
+	// Message broker
+	messagingConfig, err := config.NewMessagingConfig()
 	if err != nil {
-		logger.Error("Failed to load AWS config from Viper", "error", err)
+		logger.Error("Failed to load messaging config", "error", err)
 		os.Exit(1)
 	}
 
-	// Load AWS SDK Configuration (reads credentials from .env or Env Vars automatically)
-	ctx := context.Background()
-	awsSDKCfg, err := awsCfg.LoadDefaultConfig(ctx,
-		awsCfg.WithRegion(awsConfig.Region),
-	)
+	publisher, err := messaging.NewEventPublisher(context.Background(), messagingConfig, logger)
 	if err != nil {
-		logger.Error("Failed to load AWS SDK default config", "error", err)
+		logger.Error("Failed to create event publisher", "adapter", messagingConfig.Adapter, "error", err)
 		os.Exit(1)
 	}
-
-	// Create SQS Client
-	sqsClient := sqs.NewFromConfig(awsSDKCfg)
-
-	// Initialize the SQS Adapter
-	publisher := messaging.NewSQSAdapter(sqsClient, awsConfig.QueueURL, logger)
-
-	logger.Info("Successful AWS SQS initialization", "region", awsConfig.Region)
+	logger.Info("Successful message broker initialization", "adapter", messagingConfig.Adapter)
 
 	// Load JWT keys
 	jwtKeys, err := config.NewJWTConfig(logger)
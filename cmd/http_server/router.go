@@ -2,10 +2,12 @@ package httpserver
 
 import (
 	"net/http"
-	"time"
+	"net/netip"
 
+	"github.com/golang-auth/internal/adapters/config"
 	http_hanlder "github.com/golang-auth/internal/adapters/handlers/http"
 	"github.com/golang-auth/internal/adapters/handlers/http/middleware"
+	"github.com/golang-auth/internal/adapters/repository"
 	"github.com/golang-auth/internal/adapters/repository/postgre"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,21 +29,67 @@ func MapBusinessRoutes(
 	logger ports.Logger,
 	rdb *redis.Client,
 	userService ports.UserUseCase,
+	jwtKeys *config.JWTTokenKeys,
+	rateLimitConfig *config.RateLimitConfig,
+	trustedProxies []netip.Prefix,
+	clientIPHeader string,
 ) http.Handler {
 	mux := http.NewServeMux()
+	authenticate := middleware.Authenticate(logger, jwtKeys)
+	guardSession := middleware.SessionGuard(logger, userService)
+	requireAdmin := middleware.RequireRole("admin")
+	rateLimiter := middleware.NewRateLimiter(logger, repository.NewRedisRateLimiter(rdb, logger), rateLimitConfig)
+
+	// Routes get the rate limit policies configured for their pattern. On
+	// protected routes the limit runs after authentication, so it can count per user,
+	// and after the session anomaly check.
+	public := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, rateLimiter.Route(pattern, handler))
+	}
+	protected := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, authenticate(guardSession(rateLimiter.Route(pattern, handler))))
+	}
 
 	userHandler := http_hanlder.NewUserHandler(userService, logger)
-	mux.HandleFunc("POST /v1/register", userHandler.Register)
-	mux.HandleFunc("GET /v1/register/verify", userHandler.VerifyUserEmail)
-	mux.HandleFunc("POST /v1/register/resend-verification-token", userHandler.ResendVerificationToken)
+	jwksHandler := http_hanlder.NewJWKSHandler(jwtKeys, logger)
+	public("GET /.well-known/jwks.json", jwksHandler.ServeJWKS)
+
+	public("POST /v1/register", userHandler.Register)
+	public("GET /v1/register/verify", userHandler.VerifyUserEmail)
+	public("POST /v1/register/verify-code", userHandler.VerifyEmailCode)
+	public("POST /v1/register/resend-verification-token", userHandler.ResendVerificationToken)
+
+	public("POST /v1/password/forgot", userHandler.ForgotPassword)
+	public("POST /v1/password/reset", userHandler.ResetPassword)
+
+	public("POST /v1/login", userHandler.Login)
+	public("POST /v1/login/mfa", userHandler.LoginMFA)
+	public("POST /v1/login/magic-link", userHandler.RequestMagicLink)
+	public("GET /v1/login/magic-link/consume", userHandler.ConfirmMagicLink)
+	public("POST /v1/login/magic-link/consume", userHandler.ConsumeMagicLink)
+	public("POST /v1/login/passkey/begin", userHandler.BeginPasskeyLogin)
+	public("POST /v1/login/passkey/finish", userHandler.FinishPasskeyLogin)
+	public("POST /v1/auth/refresh", userHandler.RefreshSession)
+	protected("POST /v1/logout", http.HandlerFunc(userHandler.Logout))
+	protected("POST /v1/account/mfa/totp", http.HandlerFunc(userHandler.EnrollTOTP))
+	protected("POST /v1/account/mfa/totp/confirm", http.HandlerFunc(userHandler.ConfirmTOTP))
+	protected("POST /v1/account/mfa/recovery-codes", http.HandlerFunc(userHandler.RegenerateRecoveryCodes))
+	protected("POST /v1/account/passkeys/register/begin", http.HandlerFunc(userHandler.BeginPasskeyRegistration))
+	protected("POST /v1/account/passkeys/register/finish", http.HandlerFunc(userHandler.FinishPasskeyRegistration))
+	protected("GET /v1/account/sessions", http.HandlerFunc(userHandler.ListSessions))
+	protected("DELETE /v1/account/sessions/{id}", http.HandlerFunc(userHandler.RevokeSession))
+	protected("POST /v1/account/sessions/revoke-others", http.HandlerFunc(userHandler.RevokeOtherSessions))
+	protected("GET /v1/account/activity", http.HandlerFunc(userHandler.ListActivity))
+	protected("POST /v1/account/password", http.HandlerFunc(userHandler.ChangePassword))
+	protected("DELETE /v1/account/delete", http.HandlerFunc(userHandler.DeleteAccount))
 
-	mux.HandleFunc("POST /v1/login", userHandler.Login)
-	mux.HandleFunc("POST /v1/logout", userHandler.Logout)
-	mux.HandleFunc("DELETE /v1/account/delete", userHandler.DeleteAccount)
+	protected("POST /v1/admin/users/{id}/unlock", requireAdmin(http.HandlerFunc(userHandler.UnlockAccount)))
 	middlewares := []Middleware{
-		middleware.LoggingMiddleware(logger),                   // 3. Log everything (including blocks)
-		middleware.IPRateLimiter(logger, rdb, 10, time.Minute), // 2. Then check limit
-		// middleware.RecoveryMiddleware(logger),               // 1. Catch panics first
+		middleware.LoggingMiddleware(logger),                // 5. Log everything (including blocks)
+		rateLimiter.Global(),                                // 4. Then check limit
+		middleware.ClientIP(trustedProxies, clientIPHeader), // 3. Resolve the client IP for everything after
+		middleware.TraceID(),                                // 2. Trace the request through to its events
+		// middleware.RecoveryMiddleware(logger), // 1. Catch panics first
 	}
 	return ApplyMiddleware(mux, middlewares...)
 }
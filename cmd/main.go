@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"io"
 	"os/signal"
 	"syscall"
 
@@ -21,7 +22,6 @@ func main() {
 	defer memguard.Purge()
 
 	logger, client, rdb, publisher, jwtKeys := httpserver.LoadComponents()
-	_ = jwtKeys
 
 	defer func() {
 		logger.Info("Closing infrastructure connections...")
@@ -31,6 +31,11 @@ func main() {
 		if err := rdb.Close(); err != nil {
 			logger.Error("Redis close error", "error", err)
 		}
+		if closer, ok := publisher.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Error("Message broker close error", "error", err)
+			}
+		}
 		logger.Info("Done")
 	}()
 
@@ -38,12 +43,54 @@ func main() {
 	httpConfig := config.NewHttpConfig()
 	logger.Info("Successfully loaded HTTP Server config")
 
+	authConfig, err := config.NewAuthConfig()
+	if err != nil {
+		logger.Fatal("Error while loading auth config", "error", err)
+	}
+
+	rateLimitConfig, err := config.NewRateLimitConfig()
+	if err != nil {
+		logger.Fatal("Error while loading rate limit config", "error", err)
+	}
+
+	outboxConfig, err := config.NewOutboxConfig()
+	if err != nil {
+		logger.Fatal("Error while loading outbox config", "error", err)
+	}
+
+	trustedProxies, err := config.TrustedProxies()
+	if err != nil {
+		logger.Fatal("Error while loading trusted proxies", "error", err)
+	}
+	clientIPHeader, err := config.ClientIPHeader()
+	if err != nil {
+		logger.Fatal("Error while loading the client IP header", "error", err)
+	}
+
 	reg := prometheus.NewRegistry()
 
-	userRepo := repository.NewUserRepository(client.DB, logger)
-	userService := service.NewUserService(userRepo, logger, publisher, jwtKeys)
+	// Pick up rotated JWT keys without a restart
+	go jwtKeys.WatchKeys(ctx, config.JWTReloadInterval())
+
+	userRepo := repository.NewUserRepository(client.DB, logger, outboxConfig)
+	challengeStore := repository.NewRedisChallengeStore(rdb, logger)
+	userService := service.NewUserService(userRepo, logger, jwtKeys, authConfig, challengeStore)
+
+	// Relay the events committed to the outbox to the broker
+	outboxRelay := service.NewOutboxRelay(userRepo, publisher, logger, outboxConfig)
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		outboxRelay.Run(ctx)
+	}()
+	// Deferred after the connection cleanup, so the relay stops before the
+	// publisher and the database it works on are closed
+	defer func() {
+		stop()
+		<-relayDone
+	}()
 
-	mapBusinessHandler := httpserver.MapBusinessRoutes(logger, rdb, userService)
+	mapBusinessHandler := httpserver.MapBusinessRoutes(logger, rdb, userService, jwtKeys, rateLimitConfig, trustedProxies, clientIPHeader)
 	mapManagementRoutes := httpserver.MapManagementRoutes(logger, client, reg)
 	errChan := make(chan error, 1)
 
@@ -0,0 +1,483 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/awnumar/memguard"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+var ErrMFAKeyMissing = errors.New("MFA_ENCRYPTION_KEY must be a base64 encoded 32 byte key")
+
+// AuthConfig groups the settings of the authentication flows in UserSerivce.
+type AuthConfig struct {
+	MFA               *MFAConfig
+	WebAuthn          *WebAuthnConfig
+	EmailVerification *EmailVerificationConfig
+	Lockout           *LockoutConfig
+	Sessions          *SessionConfig
+	SessionAnomaly    *SessionAnomalyConfig
+}
+
+func NewAuthConfig() (*AuthConfig, error) {
+	mfa, err := NewMFAConfig()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := NewSessionConfig()
+	if err != nil {
+		return nil, err
+	}
+	anomaly, err := NewSessionAnomalyConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := anomaly.DeriveNetworkKey(mfa); err != nil {
+		return nil, err
+	}
+	emailVerification, err := NewEmailVerificationConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &AuthConfig{
+		MFA:               mfa,
+		WebAuthn:          NewWebAuthnConfig(),
+		EmailVerification: emailVerification,
+		Lockout:           NewLockoutConfig(),
+		Sessions:          sessions,
+		SessionAnomaly:    anomaly,
+	}, nil
+}
+
+// SessionConfig caps the concurrent sessions of a user. RoleMaxSessions
+// overrides MaxSessions for users with that role; with several such roles the
+// highest limit wins. Strategy is one of the ports.SessionLimit* values.
+type SessionConfig struct {
+	MaxSessions     int
+	RoleMaxSessions map[string]int
+	Strategy        string
+	IdleTimeout     time.Duration
+}
+
+func NewSessionConfig() (*SessionConfig, error) {
+	cfg := &SessionConfig{
+		MaxSessions:     viper.GetInt("sessions.maxSessions"),
+		RoleMaxSessions: map[string]int{},
+		Strategy:        viper.GetString("sessions.strategy"),
+		IdleTimeout:     viper.GetDuration("sessions.idleTimeout"),
+	}
+	for role := range viper.GetStringMap("sessions.roleMaxSessions") {
+		limit := viper.GetInt("sessions.roleMaxSessions." + role)
+		if limit <= 0 {
+			return nil, fmt.Errorf("sessions.roleMaxSessions.%s must be a positive number", role)
+		}
+		cfg.RoleMaxSessions[role] = limit
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = 5
+	}
+	if cfg.Strategy == "" {
+		cfg.Strategy = ports.SessionLimitReject
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 24 * time.Hour
+	}
+	switch cfg.Strategy {
+	case ports.SessionLimitReject, ports.SessionLimitEvictOldest, ports.SessionLimitEvictIdle:
+	default:
+		return nil, fmt.Errorf("unknown session limit strategy %q", cfg.Strategy)
+	}
+	return cfg, nil
+}
+
+// LimitFor returns the session limit of a user with the given roles.
+func (c *SessionConfig) LimitFor(roles []string) ports.SessionLimit {
+	max, overridden := 0, false
+	for _, role := range roles {
+		if limit, ok := c.RoleMaxSessions[role]; ok && (!overridden || limit > max) {
+			max, overridden = limit, true
+		}
+	}
+	if !overridden {
+		max = c.MaxSessions
+	}
+	return ports.SessionLimit{Max: max, Strategy: c.Strategy, IdleTimeout: c.IdleTimeout}
+}
+
+// SessionAnomalyConfig decides what happens when a session is used from
+// another network or user agent than it was last seen with. Addresses sharing
+// the first IPv4Prefix / IPv6Prefix bits count as the same network, so a
+// client moving around its ISP's pool isn't flagged. Action is one of the
+// ports.SessionAnomaly* values. A session that keeps running alerts its owner
+// at most once per AlertInterval.
+type SessionAnomalyConfig struct {
+	Action        string
+	IPv4Prefix    int
+	IPv6Prefix    int
+	AlertInterval time.Duration
+
+	// Keys NetworkHash. It only hides which network a token was issued to,
+	// so it is kept in plain memory rather than an enclave.
+	networkKey []byte
+}
+
+func NewSessionAnomalyConfig() (*SessionAnomalyConfig, error) {
+	cfg := &SessionAnomalyConfig{
+		Action:        viper.GetString("sessions.anomaly.action"),
+		IPv4Prefix:    viper.GetInt("sessions.anomaly.ipv4Prefix"),
+		IPv6Prefix:    viper.GetInt("sessions.anomaly.ipv6Prefix"),
+		AlertInterval: viper.GetDuration("sessions.anomaly.alertInterval"),
+	}
+	if cfg.Action == "" {
+		cfg.Action = ports.SessionAnomalyLog
+	}
+	if cfg.AlertInterval <= 0 {
+		cfg.AlertInterval = time.Hour
+	}
+	// A prefix of 0 is valid: every address is the same network, so only the
+	// user agent is watched
+	if !viper.IsSet("sessions.anomaly.ipv4Prefix") {
+		cfg.IPv4Prefix = 24
+	}
+	if !viper.IsSet("sessions.anomaly.ipv6Prefix") {
+		cfg.IPv6Prefix = 64
+	}
+	switch cfg.Action {
+	case ports.SessionAnomalyLog, ports.SessionAnomalyReauth, ports.SessionAnomalyRevoke:
+	default:
+		return nil, fmt.Errorf("unknown session anomaly action %q", cfg.Action)
+	}
+	if cfg.IPv4Prefix < 0 || cfg.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("sessions.anomaly.ipv4Prefix must be between 0 and 32")
+	}
+	if cfg.IPv6Prefix < 0 || cfg.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("sessions.anomaly.ipv6Prefix must be between 0 and 128")
+	}
+	return cfg, nil
+}
+
+// DeriveNetworkKey sets the key of NetworkHash, derived from the MFA key.
+func (c *SessionAnomalyConfig) DeriveNetworkKey(mfa *MFAConfig) error {
+	key, err := mfa.deriveKey("session client network")
+	if err != nil {
+		return err
+	}
+	c.networkKey = key
+	return nil
+}
+
+// NetworkHash returns the hex HMAC-SHA256 of the network ip belongs to, as
+// SameNetwork draws it. Access tokens carry it instead of the address, so a
+// token doesn't disclose where it was issued. It is empty for an empty ip.
+func (c *SessionAnomalyConfig) NetworkHash(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	network := ip
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		addr = addr.Unmap()
+		bits := c.IPv6Prefix
+		if addr.Is4() {
+			bits = c.IPv4Prefix
+		}
+		if prefix, err := addr.Prefix(bits); err == nil {
+			network = prefix.String()
+		}
+	}
+	mac := hmac.New(sha256.New, c.networkKey)
+	mac.Write([]byte(network))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SameNetwork reports whether two client addresses belong to the same
+// network. Addresses that don't parse only match themselves.
+func (c *SessionAnomalyConfig) SameNetwork(a, b string) bool {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	ipA, ipB = ipA.Unmap(), ipB.Unmap()
+	if ipA.Is4() != ipB.Is4() {
+		return false
+	}
+	bits := c.IPv6Prefix
+	if ipA.Is4() {
+		bits = c.IPv4Prefix
+	}
+	prefix, err := ipA.Prefix(bits)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(ipB)
+}
+
+// LockoutConfig throttles password guessing per account. The first
+// FreeAttempts failures cost nothing; each one after that makes the account
+// wait BaseDelay, doubled per failure up to MaxDelay. At Threshold failures
+// the account is locked for LockDuration. A successful login or an admin
+// unlock starts over.
+type LockoutConfig struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Threshold    int
+	LockDuration time.Duration
+}
+
+func NewLockoutConfig() *LockoutConfig {
+	cfg := &LockoutConfig{
+		FreeAttempts: viper.GetInt("lockout.freeAttempts"),
+		BaseDelay:    viper.GetDuration("lockout.baseDelay"),
+		MaxDelay:     viper.GetDuration("lockout.maxDelay"),
+		Threshold:    viper.GetInt("lockout.threshold"),
+		LockDuration: viper.GetDuration("lockout.lockDuration"),
+	}
+	if cfg.FreeAttempts <= 0 {
+		cfg.FreeAttempts = 3
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = time.Second
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	if cfg.Threshold <= cfg.FreeAttempts {
+		cfg.Threshold = cfg.FreeAttempts + 7
+	}
+	if cfg.LockDuration <= 0 {
+		cfg.LockDuration = 15 * time.Minute
+	}
+	return cfg
+}
+
+// EmailVerificationConfig picks how new accounts prove their email: "link"
+// emails a token to click, "code" a short numeric code to type in. DefaultMode
+// applies when the request doesn't ask for one; there is no per-client
+// default, since callers aren't identified.
+type EmailVerificationConfig struct {
+	DefaultMode     string
+	CodeTTL         time.Duration
+	MaxCodeAttempts int
+}
+
+func NewEmailVerificationConfig() (*EmailVerificationConfig, error) {
+	cfg := &EmailVerificationConfig{
+		DefaultMode:     viper.GetString("emailVerification.defaultMode"),
+		CodeTTL:         viper.GetDuration("emailVerification.codeTTL"),
+		MaxCodeAttempts: viper.GetInt("emailVerification.maxCodeAttempts"),
+	}
+	if cfg.DefaultMode == "" {
+		cfg.DefaultMode = "link"
+	}
+	if cfg.DefaultMode != "link" && cfg.DefaultMode != "code" {
+		return nil, fmt.Errorf("unknown email verification mode %q", cfg.DefaultMode)
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 10 * time.Minute
+	}
+	if cfg.MaxCodeAttempts <= 0 {
+		cfg.MaxCodeAttempts = 5
+	}
+	return cfg, nil
+}
+
+// WebAuthnConfig describes the relying party passkeys are bound to. RPID is
+// the domain the credentials are scoped to; Origins are the exact origins the
+// browser may report in clientDataJSON.
+type WebAuthnConfig struct {
+	RPID         string
+	RPName       string
+	Origins      []string
+	ChallengeTTL time.Duration
+}
+
+func NewWebAuthnConfig() *WebAuthnConfig {
+	cfg := &WebAuthnConfig{
+		RPID:         viper.GetString("webauthn.rpID"),
+		RPName:       viper.GetString("webauthn.rpName"),
+		Origins:      viper.GetStringSlice("webauthn.origins"),
+		ChallengeTTL: viper.GetDuration("webauthn.challengeTTL"),
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = "localhost"
+	}
+	if cfg.RPName == "" {
+		cfg.RPName = "golang-auth"
+	}
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{"http://localhost:8080"}
+	}
+	if cfg.ChallengeTTL <= 0 {
+		cfg.ChallengeTTL = 5 * time.Minute
+	}
+	return cfg
+}
+
+// RelyingParty returns the go-webauthn relying party for the settings.
+// Passkeys are discoverable and always require user verification, which is
+// what lets them stand in for both factors; the attestation is not asked for,
+// any authenticator model is accepted.
+func (c *WebAuthnConfig) RelyingParty() (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: c.ChallengeTTL, TimeoutUVD: c.ChallengeTTL}
+	return webauthn.New(&webauthn.Config{
+		RPID:                  c.RPID,
+		RPDisplayName:         c.RPName,
+		RPOrigins:             c.Origins,
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// MFAConfig holds the TOTP settings and the key that encrypts TOTP secrets at
+// rest. The key lives in a memguard enclave and is only opened to encrypt or
+// decrypt a secret.
+type MFAConfig struct {
+	Issuer               string
+	ChallengeTTL         time.Duration
+	MaxChallengeAttempts int
+	key                  *memguard.Enclave
+}
+
+func NewMFAConfig() (*MFAConfig, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("MFA_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, ErrMFAKeyMissing
+	}
+
+	issuer := viper.GetString("mfa.issuer")
+	if issuer == "" {
+		issuer = "golang-auth"
+	}
+	challengeTTL := viper.GetDuration("mfa.challengeTTL")
+	if challengeTTL <= 0 {
+		challengeTTL = 5 * time.Minute
+	}
+	maxAttempts := viper.GetInt("mfa.maxChallengeAttempts")
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+
+	return NewMFAConfigWithKey(key, issuer, challengeTTL, maxAttempts), nil
+}
+
+// NewMFAConfigWithKey seals key into an enclave; key is wiped by memguard.
+func NewMFAConfigWithKey(key []byte, issuer string, challengeTTL time.Duration, maxAttempts int) *MFAConfig {
+	return &MFAConfig{
+		Issuer:               issuer,
+		ChallengeTTL:         challengeTTL,
+		MaxChallengeAttempts: maxAttempts,
+		key:                  memguard.NewEnclave(key),
+	}
+}
+
+// EncryptSecret seals a TOTP secret with AES-256-GCM. The user ID is bound as
+// additional data, so a ciphertext copied to another user's row won't decrypt.
+func (c *MFAConfig) EncryptSecret(userID uuid.UUID, secret []byte) ([]byte, error) {
+	return sealWithKey(c.key, "MFA", secret, userID[:])
+}
+
+// DecryptSecret reverses EncryptSecret.
+func (c *MFAConfig) DecryptSecret(userID uuid.UUID, ciphertext []byte) ([]byte, error) {
+	return openWithKey(c.key, "MFA", ciphertext, userID[:])
+}
+
+// HashRecoveryCode returns the hex HMAC-SHA256 a recovery code is stored and
+// looked up as. Codes are random, so a keyed hash is enough to keep a leaked
+// table useless, and checking one costs nothing next to bcrypt. The MAC key is
+// derived from the MFA key and the user ID is bound like in EncryptSecret.
+func (c *MFAConfig) HashRecoveryCode(userID uuid.UUID, code string) (string, error) {
+	macKey, err := c.deriveKey("mfa recovery code")
+	if err != nil {
+		return "", err
+	}
+	defer clear(macKey)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(userID[:])
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// deriveKey returns a key for label, derived from the MFA key so no other
+// secret has to be configured.
+func (c *MFAConfig) deriveKey(label string) ([]byte, error) {
+	buf, err := c.key.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MFA key enclave: %w", err)
+	}
+	defer buf.Destroy()
+
+	derive := hmac.New(sha256.New, buf.Bytes())
+	derive.Write([]byte(label))
+	return derive.Sum(nil), nil
+}
+
+// sealWithKey encrypts plaintext with AES-256-GCM under the enclave key and
+// prefixes the random nonce. name only labels errors.
+func sealWithKey(key *memguard.Enclave, name string, plaintext, additionalData []byte) ([]byte, error) {
+	aead, destroy, err := openAEAD(key, name)
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// openWithKey reverses sealWithKey.
+func openWithKey(key *memguard.Enclave, name string, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, destroy, err := openAEAD(key, name)
+	if err != nil {
+		return nil, err
+	}
+	defer destroy()
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s ciphertext too short", name)
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
+
+func openAEAD(key *memguard.Enclave, name string) (cipher.AEAD, func(), error) {
+	buf, err := key.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s key enclave: %w", name, err)
+	}
+	block, err := aes.NewCipher(buf.Bytes())
+	if err != nil {
+		buf.Destroy()
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		buf.Destroy()
+		return nil, nil, err
+	}
+	return aead, buf.Destroy, nil
+}
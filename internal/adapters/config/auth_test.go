@@ -0,0 +1,227 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/spf13/viper"
+)
+
+func TestNewSessionConfig(t *testing.T) {
+	load := func(t *testing.T, yaml string) (*SessionConfig, error) {
+		t.Helper()
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		viper.SetConfigType("yaml")
+		if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+			t.Fatalf("failed to read yaml: %v", err)
+		}
+		return NewSessionConfig()
+	}
+
+	t.Run("Limits per role", func(t *testing.T) {
+		cfg, err := load(t, `
+sessions:
+  maxSessions: 5
+  roleMaxSessions:
+    admin: 2
+    support: 3
+  strategy: "evict_idle"
+  idleTimeout: "2h"
+`)
+		if err != nil {
+			t.Fatalf("NewSessionConfig() error: %v", err)
+		}
+
+		tests := []struct {
+			roles []string
+			want  int
+		}{
+			{nil, 5},
+			{[]string{"user"}, 5},
+			{[]string{"admin"}, 2},
+			{[]string{"admin", "support"}, 3},
+		}
+		for _, tt := range tests {
+			limit := cfg.LimitFor(tt.roles)
+			if limit.Max != tt.want || limit.Strategy != ports.SessionLimitEvictIdle || limit.IdleTimeout != 2*time.Hour {
+				t.Errorf("LimitFor(%v) = %+v, want max %d", tt.roles, limit, tt.want)
+			}
+		}
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := load(t, `http: {}`)
+		if err != nil {
+			t.Fatalf("NewSessionConfig() error: %v", err)
+		}
+		if limit := cfg.LimitFor(nil); limit.Max != 5 || limit.Strategy != ports.SessionLimitReject {
+			t.Errorf("unexpected default limit: %+v", limit)
+		}
+	})
+
+	t.Run("Unknown strategy", func(t *testing.T) {
+		if _, err := load(t, "sessions:\n  strategy: \"evict_random\"\n"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("Invalid role limit", func(t *testing.T) {
+		if _, err := load(t, "sessions:\n  roleMaxSessions:\n    admin: 0\n"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestNewSessionAnomalyConfig(t *testing.T) {
+	load := func(t *testing.T, yaml string) (*SessionAnomalyConfig, error) {
+		t.Helper()
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		viper.SetConfigType("yaml")
+		if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+			t.Fatalf("failed to read yaml: %v", err)
+		}
+		return NewSessionAnomalyConfig()
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := load(t, `http: {}`)
+		if err != nil {
+			t.Fatalf("NewSessionAnomalyConfig() error: %v", err)
+		}
+		if cfg.Action != ports.SessionAnomalyLog || cfg.IPv4Prefix != 24 || cfg.IPv6Prefix != 64 || cfg.AlertInterval != time.Hour {
+			t.Errorf("unexpected defaults: %+v", cfg)
+		}
+	})
+
+	t.Run("Same network", func(t *testing.T) {
+		cfg, err := load(t, `
+sessions:
+  anomaly:
+    action: "revoke"
+    ipv4Prefix: 24
+    ipv6Prefix: 48
+`)
+		if err != nil {
+			t.Fatalf("NewSessionAnomalyConfig() error: %v", err)
+		}
+
+		tests := []struct {
+			a, b string
+			want bool
+		}{
+			{"198.51.100.1", "198.51.100.200", true},
+			{"198.51.100.1", "198.51.101.1", false},
+			{"::ffff:198.51.100.1", "198.51.100.9", true},
+			{"2001:db8:1:2::1", "2001:db8:1:ffff::1", true},
+			{"2001:db8:1::1", "2001:db8:2::1", false},
+			{"198.51.100.1", "2001:db8::1", false},
+			{"unknown", "unknown", true},
+		}
+		for _, tt := range tests {
+			if got := cfg.SameNetwork(tt.a, tt.b); got != tt.want {
+				t.Errorf("SameNetwork(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("Prefix 0 ignores the address", func(t *testing.T) {
+		cfg, err := load(t, `
+sessions:
+  anomaly:
+    ipv4Prefix: 0
+`)
+		if err != nil {
+			t.Fatalf("NewSessionAnomalyConfig() error: %v", err)
+		}
+		if !cfg.SameNetwork("198.51.100.1", "203.0.113.1") {
+			t.Error("expected every IPv4 address to be the same network")
+		}
+	})
+
+	t.Run("Network hash", func(t *testing.T) {
+		cfg, err := load(t, `http: {}`)
+		if err != nil {
+			t.Fatalf("NewSessionAnomalyConfig() error: %v", err)
+		}
+		if err := cfg.DeriveNetworkKey(NewMFAConfigWithKey(make([]byte, 32), "test", time.Minute, 5)); err != nil {
+			t.Fatalf("DeriveNetworkKey() error: %v", err)
+		}
+
+		hash := cfg.NetworkHash("198.51.100.1")
+		if hash == "" || strings.Contains(hash, "198.51") {
+			t.Fatalf("expected an opaque hash, got %q", hash)
+		}
+		if cfg.NetworkHash("198.51.100.200") != hash || cfg.NetworkHash("::ffff:198.51.100.9") != hash {
+			t.Error("expected addresses of one network to hash alike")
+		}
+		if cfg.NetworkHash("198.51.101.1") == hash {
+			t.Error("expected another network to hash differently")
+		}
+		if cfg.NetworkHash("") != "" {
+			t.Error("expected no hash without an address")
+		}
+
+		other := *cfg
+		if err := other.DeriveNetworkKey(NewMFAConfigWithKey(bytes.Repeat([]byte{1}, 32), "test", time.Minute, 5)); err != nil {
+			t.Fatalf("DeriveNetworkKey() error: %v", err)
+		}
+		if other.NetworkHash("198.51.100.1") == hash {
+			t.Error("expected the hash to depend on the key")
+		}
+	})
+
+	for name, yaml := range map[string]string{
+		"Unknown action":   "sessions:\n  anomaly:\n    action: \"block\"\n",
+		"Prefix too large": "sessions:\n  anomaly:\n    ipv4Prefix: 33\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := load(t, yaml); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewEmailVerificationConfig(t *testing.T) {
+	load := func(t *testing.T, yaml string) (*EmailVerificationConfig, error) {
+		t.Helper()
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		viper.SetConfigType("yaml")
+		if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+			t.Fatalf("failed to read yaml: %v", err)
+		}
+		return NewEmailVerificationConfig()
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := load(t, `http: {}`)
+		if err != nil {
+			t.Fatalf("NewEmailVerificationConfig() error: %v", err)
+		}
+		if cfg.DefaultMode != "link" || cfg.CodeTTL != 10*time.Minute || cfg.MaxCodeAttempts != 5 {
+			t.Errorf("unexpected defaults: %+v", cfg)
+		}
+	})
+
+	t.Run("Code mode", func(t *testing.T) {
+		cfg, err := load(t, "emailVerification:\n  defaultMode: \"code\"\n")
+		if err != nil {
+			t.Fatalf("NewEmailVerificationConfig() error: %v", err)
+		}
+		if cfg.DefaultMode != "code" {
+			t.Errorf("got mode %q, want code", cfg.DefaultMode)
+		}
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		if _, err := load(t, "emailVerification:\n  defaultMode: \"sms\"\n"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
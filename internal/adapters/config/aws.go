@@ -6,14 +6,18 @@ import (
 	"github.com/spf13/viper"
 )
 
+// AWSConfig points the SQS publisher at its queue. Endpoint overrides the
+// SQS endpoint, e.g. to run against a local emulator; empty uses AWS.
 type AWSConfig struct {
 	Region   string
 	QueueURL string
+	Endpoint string
 }
 
 func NewAWSConfig() (*AWSConfig, error) {
 	region := viper.GetString("aws.region")
 	queueURL := viper.GetString("aws.sqs.queue_url")
+	endpoint := viper.GetString("aws.sqs.endpoint")
 
 	if region == "" || queueURL == "" {
 		return nil, errors.New("AWS region and SQS queue URL must be provided in config")
@@ -22,5 +26,6 @@ func NewAWSConfig() (*AWSConfig, error) {
 	return &AWSConfig{
 		Region:   region,
 		QueueURL: queueURL,
+		Endpoint: endpoint,
 	}, nil
 }
@@ -1,6 +1,12 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/spf13/viper"
+)
 
 type httpConfig struct {
 	http_management_addr string
@@ -20,3 +26,50 @@ func (c *httpConfig) HttpManagementAddr() string {
 func (c *httpConfig) HttpBusinessAddr() string {
 	return c.http_business_addr
 }
+
+// Headers a trusted proxy can pass the client IP in
+const (
+	ClientIPHeaderForwarded     = "Forwarded" // RFC 7239
+	ClientIPHeaderXForwardedFor = "X-Forwarded-For"
+	ClientIPHeaderXRealIP       = "X-Real-Ip"
+)
+
+// ClientIPHeader parses http.clientIPHeader, the one header the trusted
+// proxies write the client IP to. Only that header is read; a client could
+// send any of the others and the proxy would pass them on untouched.
+func ClientIPHeader() (string, error) {
+	header := strings.TrimSpace(viper.GetString("http.clientIPHeader"))
+	if header == "" {
+		return ClientIPHeaderXForwardedFor, nil
+	}
+	for _, known := range []string{ClientIPHeaderForwarded, ClientIPHeaderXForwardedFor, ClientIPHeaderXRealIP} {
+		if strings.EqualFold(header, known) {
+			return known, nil
+		}
+	}
+	return "", fmt.Errorf("unknown client IP header %q", header)
+}
+
+// TrustedProxies parses http.trustedProxies, the load balancers and proxies
+// whose forwarding headers are believed. Entries are CIDRs; a bare IP is a
+// single host.
+func TrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range viper.GetStringSlice("http.trustedProxies") {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
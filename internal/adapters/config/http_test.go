@@ -0,0 +1,31 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestClientIPHeader(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", ClientIPHeaderXForwardedFor, false},
+		{"forwarded", ClientIPHeaderForwarded, false},
+		{"X-Real-IP", ClientIPHeaderXRealIP, false},
+		{"CF-Connecting-IP", "", true},
+	}
+
+	for _, tt := range tests {
+		viper.Reset()
+		t.Cleanup(viper.Reset)
+		viper.Set("http.clientIPHeader", tt.value)
+
+		got, err := ClientIPHeader()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ClientIPHeader() with %q = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"sort"
+)
+
+// JSONWebKey is the public part of a signing key as described in RFC 7517.
+// N/E are set for RSA keys, Crv/X/Y for EC keys and Crv/X for OKP keys.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of every key in the ring, retired keys still in
+// their grace period included, so consumers can verify any token we issued.
+func (j *JWTTokenKeys) JWKS() (JSONWebKeySet, error) {
+	j.mu.RLock()
+	keys := make([]*signingKey, 0, len(j.keys))
+	for _, key := range j.keys {
+		keys = append(keys, key)
+	}
+	j.mu.RUnlock()
+
+	sort.Slice(keys, func(a, b int) bool { return keys[a].kid < keys[b].kid })
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		jwk, err := jsonWebKey(key.kid, key.method, key.public)
+		if err != nil {
+			return JSONWebKeySet{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
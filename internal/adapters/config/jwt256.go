@@ -1,104 +1,234 @@
 package config
 
 import (
+	"crypto"
 	"crypto/rsa"
+	"errors"
+	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/awnumar/memguard"
 	"github.com/golang-auth/internal/core/ports" // Verify this matches your module path
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/spf13/viper"
 )
 
+var (
+	ErrUnknownKID      = errors.New("token signed with an unknown key id")
+	ErrMissingIssuedAt = errors.New("token has no iat claim")
+)
+
+// JWTTokenKeys is the key ring used to sign and verify access tokens. One key
+// is active for signing, the others only verify tokens they signed earlier.
 type JWTTokenKeys struct {
-	kid      string
-	public   *memguard.Enclave
-	private  *memguard.Enclave
-	logger   ports.Logger
-	Duration time.Duration
+	mu          sync.RWMutex
+	keys        map[string]*signingKey
+	active      string
+	dir         string
+	settings    func() KeyRingSettings
+	gracePeriod time.Duration
+	logger      ports.Logger
+	Duration    time.Duration
+	Issuer      string
+	Audience    []string
 }
 
 func NewJWTConfig(logger ports.Logger) (*JWTTokenKeys, error) {
-	KID := viper.GetString("jwt.KID")
-	pubPathRel := viper.GetString("jwt.pubPath")
-	privPathRel := viper.GetString("jwt.privPath")
+	keysDir := viper.GetString("jwt.keysDir")
+	gracePeriod := viper.GetDuration("jwt.rotation.retirementGracePeriod")
 	minute := viper.GetInt("jwt.durationInMinute")
 	duration := time.Duration(minute) * time.Minute
 
 	// Resolve absolute paths based on current working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, err
+	if !filepath.IsAbs(keysDir) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		keysDir = filepath.Join(wd, keysDir)
 	}
-	pubPath := filepath.Join(wd, pubPathRel)
-	privPath := filepath.Join(wd, privPathRel)
 
-	// Read key files into temporary heap memory
-	privRaw, err := os.ReadFile(privPath)
-	if err != nil {
-		return nil, err
+	// Read on every reload so the active key can be switched at runtime
+	settings := func() KeyRingSettings {
+		return KeyRingSettings{
+			ActiveKID:  viper.GetString("jwt.activeKID"),
+			Algorithms: viper.GetStringMapString("jwt.algorithms"),
+		}
 	}
-	pubRaw, err := os.ReadFile(pubPath)
+
+	keys, err := NewJWTTokenKeys(keysDir, settings, gracePeriod, logger)
 	if err != nil {
 		return nil, err
 	}
+	keys.Duration = duration
+	keys.Issuer = viper.GetString("jwt.issuer")
+	keys.Audience = viper.GetStringSlice("jwt.audience")
+	return keys, nil
+}
+
+// JWTReloadInterval is how often the key directory is re-read for rotations.
+func JWTReloadInterval() time.Duration {
+	if interval := viper.GetDuration("jwt.rotation.reloadInterval"); interval > 0 {
+		return interval
+	}
+	return time.Minute
+}
 
-	// Move keys into secure memguard enclaves
+// NewJWTTokenKeys loads the key ring from dir. The plain-text file contents are
+// wiped as soon as the private keys are parsed.
+func NewJWTTokenKeys(dir string, settings func() KeyRingSettings, gracePeriod time.Duration, logger ports.Logger) (*JWTTokenKeys, error) {
 	keys := &JWTTokenKeys{
-		kid:      KID,
-		public:   memguard.NewEnclave(pubRaw),
-		private:  memguard.NewEnclave(privRaw),
-		logger:   logger,
-		Duration: duration,
+		dir:         dir,
+		settings:    settings,
+		gracePeriod: gracePeriod,
+		logger:      logger,
+	}
+	if err := keys.Reload(); err != nil {
+		return nil, err
 	}
+	return keys, nil
+}
 
-	// Zero out the plain-text slices immediately
-	scrubByteSlice(privRaw)
-	scrubByteSlice(pubRaw)
+// AccessTokenClaims is the payload of the access tokens issued by this service.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
 
-	return keys, nil
+	// The client the token was issued to, for session anomaly checks. Both
+	// are hashes: the token is readable by anyone holding it.
+	ClientNetworkHash   string `json:"cnh,omitempty"`
+	ClientUserAgentHash string `json:"cuh,omitempty"`
+}
+
+// TokenClaims describes the caller an access token is issued for.
+// Custom claims are added as top level claims; they cannot override the
+// registered ones set by SignToken.
+type TokenClaims struct {
+	TokenID   string
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Roles     []string
+	Scopes    []string
+	Custom    map[string]interface{}
+
+	ClientNetworkHash   string
+	ClientUserAgentHash string
+}
+
+var reservedClaims = map[string]struct{}{
+	"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {},
+	"sid": {}, "roles": {}, "scope": {}, "cnh": {}, "cuh": {},
 }
 
-func (j *JWTTokenKeys) SignToken(jti string) (string, error) {
-	claims := jwt.MapClaims{
-		"jti": jti,
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Add(j.Duration).Unix(),
+func (j *JWTTokenKeys) SignToken(tc TokenClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range tc.Custom {
+		if _, reserved := reservedClaims[name]; reserved {
+			return "", fmt.Errorf("custom claim %q overrides a reserved claim", name)
+		}
+		claims[name] = value
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	token.Header["kid"] = j.kid
+	claims["jti"] = tc.TokenID
+	claims["sub"] = tc.UserID.String()
+	claims["sid"] = tc.SessionID.String()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(j.Duration).Unix()
+	if j.Issuer != "" {
+		claims["iss"] = j.Issuer
+	}
+	if len(j.Audience) > 0 {
+		claims["aud"] = j.Audience
+	}
+	if len(tc.Roles) > 0 {
+		claims["roles"] = tc.Roles
+	}
+	if len(tc.Scopes) > 0 {
+		claims["scope"] = strings.Join(tc.Scopes, " ")
+	}
+	if tc.ClientNetworkHash != "" {
+		claims["cnh"] = tc.ClientNetworkHash
+	}
+	if tc.ClientUserAgentHash != "" {
+		claims["cuh"] = tc.ClientUserAgentHash
+	}
 
-	// Access the protected buffer
-	lockedBuf, err := j.private.Open()
+	signed, err := j.sign(claims)
+	if errors.Is(err, errKeyWiped) {
+		// A reload rotated the key out between the lookup and the signature
+		signed, err = j.sign(claims)
+	}
 	if err != nil {
-		j.logger.Error("Failed to open private key enclave", "error", err)
 		return "", err
 	}
-	// Wipes the PEM bytes as soon as signing is finished
-	defer lockedBuf.Destroy()
+	return signed, nil
+}
 
-	// Parse RSA Private Key into heap
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(lockedBuf.Bytes())
+func (j *JWTTokenKeys) sign(claims jwt.MapClaims) (string, error) {
+	signer, err := j.activeKey()
 	if err != nil {
-		j.logger.Error("Failed to parse private key from PEM", "error", err)
+		j.logger.Error("No active JWT signing key", "error", err)
 		return "", err
 	}
 
-	// Generate signed string
-	tokenString, err := token.SignedString(key)
-	if err != nil {
-		return "", err
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.kid
+
+	var signed string
+	err = signer.withSigner(func(private crypto.Signer) error {
+		signed, err = token.SignedString(private)
+		return err
+	})
+	return signed, err
+}
+
+// VerifyToken checks the signature, kid, exp, nbf and iat of an access token,
+// and iss/aud when they are configured, and returns its claims.
+func (j *JWTTokenKeys) VerifyToken(tokenString string) (*AccessTokenClaims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(SupportedAlgorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if j.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(j.Issuer))
+	}
+	if len(j.Audience) > 0 {
+		opts = append(opts, jwt.WithAudience(j.Audience...))
 	}
 
-	// Wipe the RSA object's math bits from the heap
-	scrubRSAPrivateKey(key)
+	claims := &AccessTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, j.verificationKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IssuedAt == nil {
+		return nil, ErrMissingIssuedAt
+	}
+	return claims, nil
+}
 
-	return tokenString, nil
+func (j *JWTTokenKeys) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := j.lookup(kid)
+	if !ok {
+		return nil, ErrUnknownKID
+	}
+	// The key decides the algorithm, never the token header
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrAlgorithmKeyMismatch
+	}
+	return key.public, nil
 }
 
 // --- Internal Security Helpers ---
@@ -0,0 +1,271 @@
+package config_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestJWTTokenKeys_SignAndVerify(t *testing.T) {
+	keys := testutil.NewTestJWTKeys(t)
+	keys.Issuer = "https://issuer.test"
+	keys.Audience = []string{"api"}
+
+	userID, sessionID := uuid.New(), uuid.New()
+	token, err := keys.SignToken(config.TokenClaims{
+		TokenID:   "jti-1",
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     []string{"admin"},
+		Scopes:    []string{"profile:read", "profile:write"},
+		Custom:    map[string]interface{}{"tenant": "acme"},
+
+		ClientNetworkHash:   "network-hash",
+		ClientUserAgentHash: "ua-hash",
+	})
+	if err != nil {
+		t.Fatalf("SignToken() error: %v", err)
+	}
+
+	claims, err := keys.VerifyToken(token)
+	if err != nil {
+		t.Fatalf("VerifyToken() error: %v", err)
+	}
+	if claims.Subject != userID.String() || claims.SessionID != sessionID.String() {
+		t.Errorf("unexpected sub/sid: %s/%s", claims.Subject, claims.SessionID)
+	}
+	if claims.Issuer != "https://issuer.test" || len(claims.Audience) != 1 || claims.Audience[0] != "api" {
+		t.Errorf("unexpected iss/aud: %s/%v", claims.Issuer, claims.Audience)
+	}
+	if claims.NotBefore == nil || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		t.Errorf("expected nbf, iat and exp to be set")
+	}
+	if claims.Scope != "profile:read profile:write" || len(claims.Roles) != 1 {
+		t.Errorf("unexpected scope/roles: %q/%v", claims.Scope, claims.Roles)
+	}
+	if claims.ClientNetworkHash != "network-hash" || claims.ClientUserAgentHash != "ua-hash" {
+		t.Errorf("unexpected client claims: %q/%q", claims.ClientNetworkHash, claims.ClientUserAgentHash)
+	}
+
+	t.Run("Rejects another audience", func(t *testing.T) {
+		keys.Audience = []string{"other"}
+		defer func() { keys.Audience = []string{"api"} }()
+		if _, err := keys.VerifyToken(token); err == nil {
+			t.Error("expected audience mismatch to be rejected")
+		}
+	})
+
+	t.Run("Custom claims cannot override registered ones", func(t *testing.T) {
+		_, err := keys.SignToken(config.TokenClaims{UserID: userID, Custom: map[string]interface{}{"sub": "someone-else"}})
+		if err == nil {
+			t.Error("expected reserved custom claim to be rejected")
+		}
+	})
+}
+
+func TestJWTTokenKeys_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteTestJWTKey(t, dir, "v1")
+
+	active := "v1"
+	keys, err := config.NewJWTTokenKeys(dir, func() config.KeyRingSettings { return config.KeyRingSettings{ActiveKID: active} }, 200*time.Millisecond, &testutil.NoopLogger{})
+	if err != nil {
+		t.Fatalf("NewJWTTokenKeys() error: %v", err)
+	}
+	keys.Duration = time.Minute
+
+	sign := func() string {
+		t.Helper()
+		token, err := keys.SignToken(config.TokenClaims{TokenID: "jti", UserID: uuid.New(), SessionID: uuid.New()})
+		if err != nil {
+			t.Fatalf("SignToken() error: %v", err)
+		}
+		return token
+	}
+	kidOf := func(token string) string {
+		t.Helper()
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatalf("ParseUnverified() error: %v", err)
+		}
+		return parsed.Header["kid"].(string)
+	}
+	kids := func() []string {
+		set, err := keys.JWKS()
+		if err != nil {
+			t.Fatalf("JWKS() error: %v", err)
+		}
+		var out []string
+		for _, k := range set.Keys {
+			out = append(out, k.Kid)
+		}
+		return out
+	}
+
+	oldToken := sign()
+
+	// Publish v2 and make it active
+	testutil.WriteTestJWTKey(t, dir, "v2")
+	active = "v2"
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if kid := kidOf(sign()); kid != "v2" {
+		t.Errorf("expected new tokens to be signed with v2, got %s", kid)
+	}
+	if got := kids(); !slices.Equal(got, []string{"v1", "v2"}) {
+		t.Errorf("expected both keys in JWKS, got %v", got)
+	}
+
+	// Remove v1: it keeps verifying during the grace period
+	if err := os.Remove(filepath.Join(dir, "v1.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if _, err := keys.VerifyToken(oldToken); err != nil {
+		t.Errorf("expected retired key to verify during grace period: %v", err)
+	}
+
+	// ...and is dropped once the grace period is over
+	time.Sleep(250 * time.Millisecond)
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if _, err := keys.VerifyToken(oldToken); err == nil {
+		t.Error("expected token of a dropped key to be rejected")
+	}
+	if got := kids(); !slices.Equal(got, []string{"v2"}) {
+		t.Errorf("expected only v2 in JWKS, got %v", got)
+	}
+
+	// Activating a key that is not in the directory keeps the current one
+	active = "v3"
+	if err := keys.Reload(); !errors.Is(err, config.ErrNoActiveKey) {
+		t.Errorf("expected ErrNoActiveKey, got %v", err)
+	}
+	if kid := kidOf(sign()); kid != "v2" {
+		t.Errorf("expected v2 to stay active, got %s", kid)
+	}
+}
+
+func TestJWTTokenKeys_Algorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		key      crypto.Signer
+		override string
+		wantAlg  string
+		wantKty  string
+	}{
+		{"RSA defaults to RS256", rsaKey, "", "RS256", "RSA"},
+		{"RSA with PS256 override", rsaKey, "PS256", "PS256", "RSA"},
+		{"P-256 uses ES256", ecKey, "", "ES256", "EC"},
+		{"Ed25519 uses EdDSA", edKey, "", "EdDSA", "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			testutil.WriteTestSigningKey(t, dir, "k1", tt.key)
+
+			settings := func() config.KeyRingSettings {
+				return config.KeyRingSettings{ActiveKID: "k1", Algorithms: map[string]string{"k1": tt.override}}
+			}
+			keys, err := config.NewJWTTokenKeys(dir, settings, time.Hour, &testutil.NoopLogger{})
+			if err != nil {
+				t.Fatalf("NewJWTTokenKeys() error: %v", err)
+			}
+			keys.Duration = time.Minute
+
+			token, err := keys.SignToken(config.TokenClaims{TokenID: "jti", UserID: uuid.New(), SessionID: uuid.New()})
+			if err != nil {
+				t.Fatalf("SignToken() error: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified() error: %v", err)
+			}
+			if parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("expected alg %s, got %s", tt.wantAlg, parsed.Method.Alg())
+			}
+			if _, err := keys.VerifyToken(token); err != nil {
+				t.Errorf("VerifyToken() error: %v", err)
+			}
+
+			set, err := keys.JWKS()
+			if err != nil {
+				t.Fatalf("JWKS() error: %v", err)
+			}
+			if len(set.Keys) != 1 || set.Keys[0].Kty != tt.wantKty || set.Keys[0].Alg != tt.wantAlg {
+				t.Errorf("unexpected JWKS: %+v", set.Keys)
+			}
+		})
+	}
+
+	t.Run("Override must match the key type", func(t *testing.T) {
+		dir := t.TempDir()
+		testutil.WriteTestSigningKey(t, dir, "k1", ecKey)
+
+		settings := func() config.KeyRingSettings {
+			return config.KeyRingSettings{ActiveKID: "k1", Algorithms: map[string]string{"k1": "RS256"}}
+		}
+		_, err := config.NewJWTTokenKeys(dir, settings, time.Hour, &testutil.NoopLogger{})
+		if !errors.Is(err, config.ErrAlgorithmKeyMismatch) {
+			t.Errorf("expected ErrAlgorithmKeyMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Rejects a token whose header picks another algorithm", func(t *testing.T) {
+		dir := t.TempDir()
+		testutil.WriteTestSigningKey(t, dir, "k1", rsaKey)
+
+		settings := func() config.KeyRingSettings {
+			return config.KeyRingSettings{ActiveKID: "k1", Algorithms: map[string]string{"k1": "PS256"}}
+		}
+		keys, err := config.NewJWTTokenKeys(dir, settings, time.Hour, &testutil.NoopLogger{})
+		if err != nil {
+			t.Fatalf("NewJWTTokenKeys() error: %v", err)
+		}
+
+		now := time.Now()
+		forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub": uuid.NewString(), "iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		})
+		forged.Header["kid"] = "k1"
+		token, err := forged.SignedString(rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := keys.VerifyToken(token); !errors.Is(err, config.ErrAlgorithmKeyMismatch) {
+			t.Errorf("expected ErrAlgorithmKeyMismatch, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnsupportedKey       = errors.New("unsupported key type")
+	ErrAlgorithmKeyMismatch = errors.New("signing algorithm does not match the key type")
+)
+
+// SupportedAlgorithms lists the JWS algorithms the key ring can sign with.
+var SupportedAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodPS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// parsePrivateKey accepts PKCS#1 RSA, SEC 1 EC and PKCS#8 (RSA, EC, Ed25519)
+// PEM blocks.
+func parsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+}
+
+// parsePublicKey accepts PKIX ("PUBLIC KEY") and PKCS#1 ("RSA PUBLIC KEY") PEM
+// blocks. Older key files store PKIX bytes under the RSA header, so both
+// encodings are tried.
+func parsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+}
+
+// signingMethodFor picks the algorithm for a key. The key type decides unless
+// an override is configured; RSA keys default to RS256 and may use PS256.
+func signingMethodFor(pub crypto.PublicKey, override string) (jwt.SigningMethod, error) {
+	var method jwt.SigningMethod
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+		if override == jwt.SigningMethodPS256.Alg() {
+			method = jwt.SigningMethodPS256
+		}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: only P-256 ECDSA keys are supported", ErrUnsupportedKey)
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+
+	if override != "" && override != method.Alg() {
+		return nil, fmt.Errorf("%w: %s for %T", ErrAlgorithmKeyMismatch, override, pub)
+	}
+	return method, nil
+}
+
+// jsonWebKey encodes the public key fields of RFC 7518 section 6 / RFC 8037.
+func jsonWebKey(kid string, method jwt.SigningMethod, pub crypto.PublicKey) (JSONWebKey, error) {
+	jwk := JSONWebKey{Use: "sig", Alg: method.Alg(), Kid: kid}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(k.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		ecdhKey, err := k.ECDH()
+		if err != nil {
+			return JSONWebKey{}, err
+		}
+		// Uncompressed point: 0x04 || X || Y, both padded to the curve size
+		point := ecdhKey.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = encode(point[1 : 1+size])
+		jwk.Y = encode(point[1+size:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(k)
+	default:
+		return JSONWebKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	return jwk, nil
+}
+
+// scrubPrivateKey wipes the secret parts of a parsed key once it leaves the ring.
+func scrubPrivateKey(key crypto.Signer) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		scrubRSAPrivateKey(k)
+	case *ecdsa.PrivateKey:
+		zeroBigInt(k.D)
+	case ed25519.PrivateKey:
+		scrubByteSlice(k)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...interface{}) {}
+func (noopLogger) Info(string, ...interface{})  {}
+func (noopLogger) Warn(string, ...interface{})  {}
+func (noopLogger) Error(string, ...interface{}) {}
+func (noopLogger) Fatal(string, ...interface{}) {}
+
+func writeKeyFile(t *testing.T, dir, kid string) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+privateKeySuffix), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTTokenKeys_PrivateKeyLifetime(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "v1")
+	writeKeyFile(t, dir, "v2")
+
+	keys, err := NewJWTTokenKeys(dir, func() KeyRingSettings { return KeyRingSettings{ActiveKID: "v1"} }, time.Hour, noopLogger{})
+	if err != nil {
+		t.Fatalf("NewJWTTokenKeys() error: %v", err)
+	}
+	v1, v2 := keys.keys["v1"].private, keys.keys["v2"].private
+
+	t.Run("Unchanged files keep the parsed key", func(t *testing.T) {
+		if err := keys.Reload(); err != nil {
+			t.Fatalf("Reload() error: %v", err)
+		}
+		if keys.keys["v1"].private != v1 || v1.signer == nil {
+			t.Error("expected v1 to be reused as is")
+		}
+	})
+
+	t.Run("Replaced file wipes the old key", func(t *testing.T) {
+		writeKeyFile(t, dir, "v1")
+		if err := keys.Reload(); err != nil {
+			t.Fatalf("Reload() error: %v", err)
+		}
+		if v1.signer != nil {
+			t.Error("expected the replaced key to be wiped")
+		}
+		if keys.keys["v1"].private.signer == nil {
+			t.Error("expected the new key to be parsed")
+		}
+	})
+
+	t.Run("Retired key is wiped", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(dir, "v2"+privateKeySuffix)); err != nil {
+			t.Fatal(err)
+		}
+		if err := keys.Reload(); err != nil {
+			t.Fatalf("Reload() error: %v", err)
+		}
+		if _, ok := keys.keys["v2"]; !ok {
+			t.Fatal("expected v2 to stay in the ring during the grace period")
+		}
+		if v2.signer != nil {
+			t.Error("expected the retired key to be wiped")
+		}
+	})
+
+	t.Run("Failed reload leaves the ring as it was", func(t *testing.T) {
+		writeKeyFile(t, dir, "v3")
+		if err := os.WriteFile(filepath.Join(dir, "v4"+privateKeySuffix), []byte("not a key"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(filepath.Join(dir, "v4"+privateKeySuffix))
+
+		current := keys.keys
+		loaded, err := keys.readKeyDir(nil)
+		if err == nil {
+			t.Fatalf("expected readKeyDir to fail, got %v", loaded)
+		}
+		if keys.keys["v1"].private.signer == nil || len(keys.keys) != len(current) {
+			t.Error("expected the ring to be left as it was")
+		}
+	})
+}
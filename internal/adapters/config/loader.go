@@ -22,6 +22,8 @@ func InitConfig() error {
 		}
 		return err
 	}
+	// Values read lazily (e.g. jwt.activeKID) follow edits to the config file
+	viper.WatchConfig()
 
 	if err := godotenv.Load(); err != nil {
 		slog.Warn("No .env file found, proceeding with environment variables")
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Message broker adapters, see MessagingConfig.
+const (
+	MessagingAdapterSQS   = "sqs"
+	MessagingAdapterKafka = "kafka"
+	MessagingAdapterNATS  = "nats"
+	MessagingAdapterSMTP  = "smtp"
+	MessagingAdapterLog   = "log"
+)
+
+// TLS modes of the SMTP connection, see SMTPConfig.
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+// MessagingConfig picks the broker domain events are published to. Only the
+// settings of the chosen adapter are loaded, so e.g. a Kafka deployment
+// needs no AWS settings. "smtp" mails the events users have to act on
+// straight from the service instead of handing them to a broker. "log" only
+// writes events to the logs, for local development.
+type MessagingConfig struct {
+	Adapter string
+	SQS     *AWSConfig
+	Kafka   *KafkaConfig
+	NATS    *NATSConfig
+	SMTP    *SMTPConfig
+}
+
+// KafkaConfig points the Kafka publisher at its topic. Events are keyed by
+// user ID, so one user's events land on one partition and stay in order.
+// Events larger than MaxMessageBytes are rejected rather than retried.
+type KafkaConfig struct {
+	Brokers         []string
+	Topic           string
+	MaxMessageBytes int
+}
+
+// NATSConfig points the NATS JetStream publisher at its stream. Events go to
+// "<SubjectPrefix>.<partition>.<event type>", where the partition is derived
+// from the user ID, so a consumer per partition sees each user's events in
+// order. CreateStream creates or updates Stream on startup to capture
+// "<SubjectPrefix>.>"; leave it off when the stream is managed elsewhere.
+type NATSConfig struct {
+	URL           string
+	Stream        string
+	SubjectPrefix string
+	Partitions    int
+	CreateStream  bool
+}
+
+// SMTPConfig points the mailer at its SMTP server. The password comes from
+// SMTP_PASSWORD. Mails are rendered from the templates of Locale, falling
+// back to "en"; TemplateDir, laid out as <locale>/<mail>.{html,txt}.tmpl,
+// overrides the built-in ones file by file. Links hold a "{token}"
+// placeholder for the emailed token.
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	From        string
+	TLS         string
+	Timeout     time.Duration
+	AppName     string
+	Locale      string
+	TemplateDir string
+	Links       MailLinks
+}
+
+type MailLinks struct {
+	VerifyEmail   string
+	ResetPassword string
+	MagicLink     string
+}
+
+func NewMessagingConfig() (*MessagingConfig, error) {
+	cfg := &MessagingConfig{Adapter: viper.GetString("messaging.adapter")}
+	if cfg.Adapter == "" {
+		// Deployments from before the setting existed publish to SQS
+		cfg.Adapter = MessagingAdapterSQS
+	}
+
+	var err error
+	switch cfg.Adapter {
+	case MessagingAdapterSQS:
+		cfg.SQS, err = NewAWSConfig()
+	case MessagingAdapterKafka:
+		cfg.Kafka, err = newKafkaConfig()
+	case MessagingAdapterNATS:
+		cfg.NATS, err = newNATSConfig()
+	case MessagingAdapterSMTP:
+		cfg.SMTP, err = newSMTPConfig()
+	case MessagingAdapterLog:
+	default:
+		err = fmt.Errorf("unknown messaging adapter %q, want sqs, kafka, nats, smtp or log", cfg.Adapter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func newKafkaConfig() (*KafkaConfig, error) {
+	cfg := &KafkaConfig{
+		Brokers:         viper.GetStringSlice("messaging.kafka.brokers"),
+		Topic:           viper.GetString("messaging.kafka.topic"),
+		MaxMessageBytes: viper.GetInt("messaging.kafka.maxMessageBytes"),
+	}
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, errors.New("Kafka brokers and topic must be provided in config")
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		// The broker's default message.max.bytes
+		cfg.MaxMessageBytes = 1 << 20
+	}
+	return cfg, nil
+}
+
+func newNATSConfig() (*NATSConfig, error) {
+	cfg := &NATSConfig{
+		URL:           viper.GetString("messaging.nats.url"),
+		Stream:        viper.GetString("messaging.nats.stream"),
+		SubjectPrefix: viper.GetString("messaging.nats.subjectPrefix"),
+		Partitions:    viper.GetInt("messaging.nats.partitions"),
+		CreateStream:  viper.GetBool("messaging.nats.createStream"),
+	}
+	if cfg.URL == "" || cfg.Stream == "" {
+		return nil, errors.New("NATS URL and stream must be provided in config")
+	}
+	if cfg.SubjectPrefix == "" {
+		cfg.SubjectPrefix = "auth.events"
+	}
+	if cfg.Partitions <= 0 {
+		cfg.Partitions = 1
+	}
+	return cfg, nil
+}
+
+func newSMTPConfig() (*SMTPConfig, error) {
+	cfg := &SMTPConfig{
+		Host:        viper.GetString("messaging.smtp.host"),
+		Port:        viper.GetInt("messaging.smtp.port"),
+		Username:    viper.GetString("messaging.smtp.username"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		From:        viper.GetString("messaging.smtp.from"),
+		TLS:         viper.GetString("messaging.smtp.tls"),
+		Timeout:     viper.GetDuration("messaging.smtp.timeout"),
+		AppName:     viper.GetString("messaging.smtp.appName"),
+		Locale:      viper.GetString("messaging.smtp.locale"),
+		TemplateDir: viper.GetString("messaging.smtp.templateDir"),
+		Links: MailLinks{
+			VerifyEmail:   viper.GetString("messaging.smtp.links.verifyEmail"),
+			ResetPassword: viper.GetString("messaging.smtp.links.resetPassword"),
+			MagicLink:     viper.GetString("messaging.smtp.links.magicLink"),
+		},
+	}
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, errors.New("SMTP host and from address must be provided in config")
+	}
+	if cfg.Links.VerifyEmail == "" || cfg.Links.ResetPassword == "" || cfg.Links.MagicLink == "" {
+		return nil, errors.New("SMTP links for email verification, password reset and magic links must be provided in config")
+	}
+
+	switch cfg.TLS {
+	case "":
+		cfg.TLS = SMTPTLSStartTLS
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q, want starttls, tls or none", cfg.TLS)
+	}
+	if cfg.Port <= 0 {
+		cfg.Port = 587
+		if cfg.TLS == SMTPTLSImplicit {
+			cfg.Port = 465
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = "golang-auth"
+	}
+	if cfg.Locale == "" {
+		cfg.Locale = "en"
+	}
+	return cfg, nil
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func loadMessagingYAML(t *testing.T, yaml string) (*MessagingConfig, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatalf("failed to read yaml: %v", err)
+	}
+	return NewMessagingConfig()
+}
+
+func TestNewMessagingConfig(t *testing.T) {
+	t.Run("Defaults to SQS", func(t *testing.T) {
+		cfg, err := loadMessagingYAML(t, `
+aws:
+  region: "eu-west-1"
+  sqs:
+    queue_url: "https://sqs.eu-west-1.amazonaws.com/123/events"
+`)
+		if err != nil {
+			t.Fatalf("NewMessagingConfig() error: %v", err)
+		}
+		if cfg.Adapter != MessagingAdapterSQS || cfg.SQS == nil || cfg.SQS.Region != "eu-west-1" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("Loads Kafka without AWS settings", func(t *testing.T) {
+		cfg, err := loadMessagingYAML(t, `
+messaging:
+  adapter: "kafka"
+  kafka:
+    brokers: ["kafka-1:9092", "kafka-2:9092"]
+    topic: "auth-events"
+`)
+		if err != nil {
+			t.Fatalf("NewMessagingConfig() error: %v", err)
+		}
+		if cfg.SQS != nil || cfg.Kafka == nil || len(cfg.Kafka.Brokers) != 2 || cfg.Kafka.MaxMessageBytes != 1<<20 {
+			t.Errorf("unexpected config: %+v", cfg.Kafka)
+		}
+	})
+
+	t.Run("Loads NATS with defaults", func(t *testing.T) {
+		cfg, err := loadMessagingYAML(t, `
+messaging:
+  adapter: "nats"
+  nats:
+    url: "nats://localhost:4222"
+    stream: "AUTH_EVENTS"
+`)
+		if err != nil {
+			t.Fatalf("NewMessagingConfig() error: %v", err)
+		}
+		want := NATSConfig{URL: "nats://localhost:4222", Stream: "AUTH_EVENTS", SubjectPrefix: "auth.events", Partitions: 1}
+		if cfg.NATS == nil || *cfg.NATS != want {
+			t.Errorf("unexpected config: %+v", cfg.NATS)
+		}
+	})
+
+	t.Run("Loads SMTP with defaults and the password from the environment", func(t *testing.T) {
+		t.Setenv("SMTP_PASSWORD", "secret")
+		cfg, err := loadMessagingYAML(t, `
+messaging:
+  adapter: "smtp"
+  smtp:
+    host: "smtp.example.com"
+    from: "no-reply@example.com"
+    tls: "tls"
+    links:
+      verifyEmail: "https://auth.example.com/verify?token={token}"
+      resetPassword: "https://app.example.com/reset?token={token}"
+      magicLink: "https://auth.example.com/magic?token={token}"
+`)
+		if err != nil {
+			t.Fatalf("NewMessagingConfig() error: %v", err)
+		}
+		if cfg.SMTP == nil || cfg.SMTP.Port != 465 || cfg.SMTP.Password != "secret" || cfg.SMTP.Locale != "en" || cfg.SMTP.Timeout != 10*time.Second {
+			t.Errorf("unexpected config: %+v", cfg.SMTP)
+		}
+	})
+
+	t.Run("Rejects incomplete and unknown adapters", func(t *testing.T) {
+		for name, yaml := range map[string]string{
+			"kafka without topic": "messaging:\n  adapter: kafka\n  kafka:\n    brokers: [\"localhost:9092\"]\n",
+			"nats without stream": "messaging:\n  adapter: nats\n  nats:\n    url: \"nats://localhost:4222\"\n",
+			"smtp without links":  "messaging:\n  adapter: smtp\n  smtp:\n    host: localhost\n    from: a@example.com\n",
+			"unknown adapter":     "messaging:\n  adapter: rabbitmq\n",
+		} {
+			if _, err := loadMessagingYAML(t, yaml); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/awnumar/memguard"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+var ErrOutboxKeyMissing = errors.New("OUTBOX_ENCRYPTION_KEY must be a base64 encoded 32 byte key")
+
+// OutboxConfig drives the relay that hands outbox events to the message
+// broker. A failed event is retried after BaseBackoff, doubling up to
+// MaxBackoff, and dead-lettered after MaxAttempts. A claimed event that is
+// neither dispatched nor rescheduled within Lease, e.g. because the instance
+// died, is picked up again. Payloads carry raw tokens and are sealed at rest
+// with a key that lives in a memguard enclave.
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+	key          *memguard.Enclave
+}
+
+func NewOutboxConfig() (*OutboxConfig, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("OUTBOX_ENCRYPTION_KEY"))
+	if err != nil || len(key) != 32 {
+		return nil, ErrOutboxKeyMissing
+	}
+	return NewOutboxConfigWithKey(key), nil
+}
+
+// NewOutboxConfigWithKey reads the relay settings and seals key into an
+// enclave; key is wiped by memguard.
+func NewOutboxConfigWithKey(key []byte) *OutboxConfig {
+	cfg := &OutboxConfig{
+		PollInterval: viper.GetDuration("outbox.pollInterval"),
+		BatchSize:    viper.GetInt("outbox.batchSize"),
+		MaxAttempts:  viper.GetInt("outbox.maxAttempts"),
+		BaseBackoff:  viper.GetDuration("outbox.baseBackoff"),
+		MaxBackoff:   viper.GetDuration("outbox.maxBackoff"),
+		Lease:        viper.GetDuration("outbox.lease"),
+		key:          memguard.NewEnclave(key),
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.BaseBackoff {
+		cfg.MaxBackoff = max(5*time.Minute, cfg.BaseBackoff)
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	return cfg
+}
+
+// Backoff is how long an event waits after its attempts-th failed dispatch.
+func (c *OutboxConfig) Backoff(attempts int) time.Duration {
+	delay := c.BaseBackoff
+	for i := 1; i < attempts && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxBackoff)
+}
+
+// SealPayload encrypts an event payload with AES-256-GCM. The event ID is
+// bound as additional data, so a payload copied to another row won't open.
+func (c *OutboxConfig) SealPayload(eventID uuid.UUID, payload []byte) ([]byte, error) {
+	return sealWithKey(c.key, "outbox", payload, eventID[:])
+}
+
+// OpenPayload reverses SealPayload.
+func (c *OutboxConfig) OpenPayload(eventID uuid.UUID, sealed []byte) ([]byte, error) {
+	return openWithKey(c.key, "outbox", sealed, eventID[:])
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewOutboxConfig(t *testing.T) {
+	t.Run("Key required", func(t *testing.T) {
+		for _, key := range []string{"", "not base64", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+			t.Setenv("OUTBOX_ENCRYPTION_KEY", key)
+			if _, err := NewOutboxConfig(); !errors.Is(err, ErrOutboxKeyMissing) {
+				t.Errorf("key %q: expected ErrOutboxKeyMissing, got %v", key, err)
+			}
+		}
+	})
+
+	t.Run("Payload round trip", func(t *testing.T) {
+		t.Setenv("OUTBOX_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+		cfg, err := NewOutboxConfig()
+		if err != nil {
+			t.Fatalf("NewOutboxConfig() error: %v", err)
+		}
+
+		eventID, payload := uuid.New(), []byte(`{"token":"raw"}`)
+		sealed, err := cfg.SealPayload(eventID, payload)
+		if err != nil {
+			t.Fatalf("SealPayload() error: %v", err)
+		}
+		if bytes.Contains(sealed, payload) {
+			t.Fatal("sealed payload contains the plaintext")
+		}
+		opened, err := cfg.OpenPayload(eventID, sealed)
+		if err != nil || !bytes.Equal(opened, payload) {
+			t.Fatalf("OpenPayload() = %q, %v", opened, err)
+		}
+		if _, err := cfg.OpenPayload(uuid.New(), sealed); err == nil {
+			t.Error("payload opened under another event ID")
+		}
+	})
+}
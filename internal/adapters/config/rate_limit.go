@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/spf13/viper"
+)
+
+// What a rate limit policy counts requests by.
+const (
+	RateLimitKeyIP    = "ip"
+	RateLimitKeyEmail = "email" // the "email" field of a JSON body
+	RateLimitKeyUser  = "user"  // the authenticated user, protected routes only
+)
+
+// RateLimitPolicy limits the requests to Route per Key. FailOpen lets
+// requests through when the limiter is unavailable; without it they are
+// refused with 503.
+type RateLimitPolicy struct {
+	ports.RateLimit `mapstructure:",squash"`
+	Route           string `mapstructure:"route"`
+	Key             string `mapstructure:"key"`
+	FailOpen        bool   `mapstructure:"failOpen"`
+}
+
+// RateLimitConfig holds the policy every request goes through and the extra
+// policies of single routes. A route may have several, e.g. one per IP and
+// one per email; a request must pass all of them.
+type RateLimitConfig struct {
+	Default RateLimitPolicy   `mapstructure:"default"`
+	Routes  []RateLimitPolicy `mapstructure:"routes"`
+}
+
+func NewRateLimitConfig() (*RateLimitConfig, error) {
+	cfg := &RateLimitConfig{
+		Default: RateLimitPolicy{
+			RateLimit: ports.RateLimit{Algorithm: ports.RateLimitSlidingWindow, Limit: 100, Window: time.Minute},
+			Key:       RateLimitKeyIP,
+			FailOpen:  true,
+		},
+	}
+	if err := viper.UnmarshalKey("rateLimit", cfg); err != nil {
+		return nil, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+
+	cfg.Default.Route = ""
+	if err := cfg.Default.validate(); err != nil {
+		return nil, fmt.Errorf("default rate limit: %w", err)
+	}
+	for i := range cfg.Routes {
+		policy := &cfg.Routes[i]
+		if policy.Route == "" {
+			return nil, fmt.Errorf("rate limit policy without a route")
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("rate limit of %q: %w", policy.Route, err)
+		}
+	}
+	return cfg, nil
+}
+
+// ForRoute returns the policies of a route pattern as registered on the mux,
+// e.g. "POST /v1/login".
+func (c *RateLimitConfig) ForRoute(route string) []RateLimitPolicy {
+	var policies []RateLimitPolicy
+	for _, policy := range c.Routes {
+		if policy.Route == route {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+func (p *RateLimitPolicy) validate() error {
+	if p.Algorithm == "" {
+		p.Algorithm = ports.RateLimitSlidingWindow
+	}
+	if p.Key == "" {
+		p.Key = RateLimitKeyIP
+	}
+	switch {
+	case p.Algorithm != ports.RateLimitSlidingWindow && p.Algorithm != ports.RateLimitTokenBucket:
+		return fmt.Errorf("unknown algorithm %q", p.Algorithm)
+	case !slices.Contains([]string{RateLimitKeyIP, RateLimitKeyEmail, RateLimitKeyUser}, p.Key):
+		return fmt.Errorf("unknown key %q", p.Key)
+	case p.Limit <= 0 || p.Window < time.Millisecond:
+		return fmt.Errorf("limit and window must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/spf13/viper"
+)
+
+func loadRateLimitYAML(t *testing.T, yaml string) (*RateLimitConfig, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatalf("failed to read yaml: %v", err)
+	}
+	return NewRateLimitConfig()
+}
+
+func TestNewRateLimitConfig(t *testing.T) {
+	t.Run("Parses default and route policies", func(t *testing.T) {
+		cfg, err := loadRateLimitYAML(t, `
+rateLimit:
+  default:
+    limit: 50
+    window: "30s"
+    failOpen: true
+  routes:
+    - route: "POST /v1/login"
+      limit: 5
+      window: "5m"
+      key: "email"
+    - route: "POST /v1/login"
+      algorithm: "token_bucket"
+      limit: 10
+      window: "1m"
+    - route: "POST /v1/register"
+      limit: 3
+      window: "10m"
+`)
+		if err != nil {
+			t.Fatalf("NewRateLimitConfig() error: %v", err)
+		}
+
+		wantDefault := ports.RateLimit{Algorithm: ports.RateLimitSlidingWindow, Limit: 50, Window: 30 * time.Second}
+		if cfg.Default.RateLimit != wantDefault || cfg.Default.Key != RateLimitKeyIP || !cfg.Default.FailOpen {
+			t.Errorf("unexpected default policy: %+v", cfg.Default)
+		}
+
+		login := cfg.ForRoute("POST /v1/login")
+		if len(login) != 2 {
+			t.Fatalf("expected 2 login policies, got %d", len(login))
+		}
+		if login[0].Key != RateLimitKeyEmail || login[0].Window != 5*time.Minute || login[0].FailOpen {
+			t.Errorf("unexpected email policy: %+v", login[0])
+		}
+		if login[1].Algorithm != ports.RateLimitTokenBucket || login[1].Key != RateLimitKeyIP {
+			t.Errorf("unexpected token bucket policy: %+v", login[1])
+		}
+		if len(cfg.ForRoute("POST /v1/logout")) != 0 {
+			t.Error("expected no policies for an unconfigured route")
+		}
+	})
+
+	t.Run("Defaults without a section", func(t *testing.T) {
+		cfg, err := loadRateLimitYAML(t, `http: {}`)
+		if err != nil {
+			t.Fatalf("NewRateLimitConfig() error: %v", err)
+		}
+		if cfg.Default.Limit != 100 || cfg.Default.Window != time.Minute || len(cfg.Routes) != 0 {
+			t.Errorf("unexpected defaults: %+v", cfg)
+		}
+	})
+
+	invalid := map[string]string{
+		"Unknown algorithm": `{route: "POST /v1/login", algorithm: "leaky", limit: 1, window: "1m"}`,
+		"Unknown key":       `{route: "POST /v1/login", key: "cookie", limit: 1, window: "1m"}`,
+		"No limit":          `{route: "POST /v1/login", window: "1m"}`,
+		"No route":          `{limit: 1, window: "1m"}`,
+	}
+	for name, policy := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadRateLimitYAML(t, "rateLimit:\n  routes:\n    - "+policy+"\n"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
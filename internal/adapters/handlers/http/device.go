@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang-auth/internal/adapters/handlers/http/middleware"
+)
+
+const (
+	// DeviceNameHeader lets clients label their session, e.g. "Work laptop".
+	// Without it the device is named after the User-Agent.
+	DeviceNameHeader = "X-Device-Name"
+
+	maxDeviceNameLength = 64
+)
+
+// sessionClient returns the user agent and device name recorded on a new
+// session.
+func sessionClient(r *http.Request) (string, string) {
+	userAgent := middleware.UserAgentOf(r)
+	if label := deviceLabel(r.Header.Get(DeviceNameHeader)); label != "" {
+		return userAgent, label
+	}
+	return userAgent, deviceName(userAgent)
+}
+
+// deviceLabel cleans up a label chosen by the client; it ends up in the UI,
+// so control characters are dropped.
+func deviceLabel(label string) string {
+	label = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, label)
+	return truncate(strings.TrimSpace(label), maxDeviceNameLength)
+}
+
+type userAgentToken struct {
+	token string
+	name  string
+}
+
+// Checked in order: many browsers also claim to be the ones below them,
+// e.g. Edge sends "Chrome/" and "Safari/" as well.
+var userAgentBrowsers = []userAgentToken{
+	{"EdgiOS/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"Edg/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Opera", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+	{"okhttp/", "OkHttp"},
+	{"Go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python Requests"},
+}
+
+var userAgentSystems = []userAgentToken{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"iPod", "iPod"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Ubuntu", "Ubuntu"},
+	{"Fedora", "Fedora"},
+	{"Linux", "Linux"},
+	{"FreeBSD", "FreeBSD"},
+}
+
+// deviceName turns a User-Agent into a name like "Chrome on macOS". It only
+// looks for well known tokens, so it needs no database and unknown agents
+// come back as "".
+func deviceName(userAgent string) string {
+	browser := matchUserAgent(userAgent, userAgentBrowsers)
+	system := matchUserAgent(userAgent, userAgentSystems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	}
+	return system
+}
+
+func matchUserAgent(userAgent string, candidates []userAgentToken) string {
+	for _, candidate := range candidates {
+		if strings.Contains(userAgent, candidate.token) {
+			return candidate.name
+		}
+	}
+	return ""
+}
+
+func truncate(s string, maxRunes int) string {
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	return string([]rune(s)[:maxRunes])
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-auth/internal/adapters/handlers/http/middleware"
+)
+
+func TestDeviceName_Unit(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51", "Edge on Windows"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1", "Safari on iPhone"},
+		{"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1", "Chrome on iPad"},
+		{"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36", "Samsung Internet on Android"},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", "Firefox on Ubuntu"},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", "Chrome on ChromeOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 OPR/109.0.0.0", "Opera on Windows"},
+		{"curl/8.5.0", "curl"},
+		{"SomeEmbeddedDevice/1.0", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := deviceName(tt.userAgent); got != tt.want {
+			t.Errorf("deviceName(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestSessionClient_Unit(t *testing.T) {
+	const chromeOnMac = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name          string
+		userAgent     string
+		label         string
+		wantUserAgent string
+		wantDevice    string
+	}{
+		{"Named after the user agent", chromeOnMac, "", chromeOnMac, "Chrome on macOS"},
+		{"Client label wins", chromeOnMac, "  Work laptop ", chromeOnMac, "Work laptop"},
+		{"Control characters are dropped", chromeOnMac, "Work\x00\nlaptop", chromeOnMac, "Worklaptop"},
+		{"Blank label falls back", chromeOnMac, " \t", chromeOnMac, "Chrome on macOS"},
+		{"Long label is cut", chromeOnMac, strings.Repeat("é", 100), chromeOnMac, strings.Repeat("é", maxDeviceNameLength)},
+		{"Long user agent is cut", strings.Repeat("a", 1000), "", strings.Repeat("a", middleware.MaxUserAgentLength), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/login", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			if tt.label != "" {
+				req.Header.Set(DeviceNameHeader, tt.label)
+			}
+
+			userAgent, device := sessionClient(req)
+			if userAgent != tt.wantUserAgent || device != tt.wantDevice {
+				t.Errorf("sessionClient() = %q, %q; want %q, %q", userAgent, device, tt.wantUserAgent, tt.wantDevice)
+			}
+		})
+	}
+}
@@ -1,12 +1,28 @@
 package http
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateUserRequest lets the client pick how the email is verified: "link"
+// for browsers, "code" for apps where the user types the code in. Empty uses
+// the server default.
 type CreateUserRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8,max=62"`
+	Email            string `json:"email" validate:"required,email"`
+	Password         string `json:"password" validate:"required,min=8,max=62"`
+	VerificationMode string `json:"verification_mode" validate:"omitempty,oneof=link code"`
 }
 
 type ResendVerificationRequest struct {
+	Email            string `json:"email" validate:"required,email"`
+	VerificationMode string `json:"verification_mode" validate:"omitempty,oneof=link code"`
+}
+
+type VerifyEmailCodeRequest struct {
 	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
 }
 
 type LoginRequest struct {
@@ -14,6 +30,143 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=8,max=62"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkConsumeRequest struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=62"`
+}
+
+// ChangePasswordRequest applies the registration rules to the new password.
+// KeepCurrentSession keeps the caller signed in; every other session is revoked.
+type ChangePasswordRequest struct {
+	CurrentPassword    string `json:"current_password" validate:"required"`
+	NewPassword        string `json:"new_password" validate:"required,min=8,max=62"`
+	KeepCurrentSession bool   `json:"keep_current_session"`
+}
+
+// MFALoginRequest takes either a TOTP code or a recovery code.
+type MFALoginRequest struct {
+	Challenge    string `json:"challenge" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// PasskeyRegistrationRequest is a PublicKeyCredential from
+// navigator.credentials.create() with its binary fields base64url encoded.
+type PasskeyRegistrationRequest struct {
+	Name     string `json:"name" validate:"max=64"`
+	RawID    string `json:"rawId" validate:"required"`
+	Type     string `json:"type" validate:"eq=public-key"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AttestationObject string `json:"attestationObject" validate:"required"`
+	} `json:"response"`
+}
+
+// PasskeyLoginRequest is a PublicKeyCredential from navigator.credentials.get().
+type PasskeyLoginRequest struct {
+	RawID    string `json:"rawId" validate:"required"`
+	Type     string `json:"type" validate:"eq=public-key"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData string `json:"authenticatorData" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type passkeyRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type passkeyUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type passkeyCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type passkeyCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type passkeyAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// PasskeyCreationOptionsResponse is PublicKeyCredentialCreationOptionsJSON,
+// ready for PublicKeyCredential.parseCreationOptionsFromJSON().
+type PasskeyCreationOptionsResponse struct {
+	RP                     passkeyRelyingParty           `json:"rp"`
+	User                   passkeyUser                   `json:"user"`
+	Challenge              string                        `json:"challenge"`
+	PubKeyCredParams       []passkeyCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	ExcludeCredentials     []passkeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection passkeyAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                        `json:"attestation"`
+}
+
+// PasskeyRequestOptionsResponse is PublicKeyCredentialRequestOptionsJSON.
+type PasskeyRequestOptionsResponse struct {
+	Challenge        string                        `json:"challenge"`
+	RPID             string                        `json:"rpId"`
+	Timeout          int64                         `json:"timeout"`
+	AllowCredentials []passkeyCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                        `json:"userVerification"`
+}
+
+// SessionResponse is one entry of the active devices list.
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// ActivityEventResponse is one entry of the security history.
+type ActivityEventResponse struct {
+	ID        uuid.UUID  `json:"id"`
+	SessionID *uuid.UUID `json:"session_id,omitempty"`
+	EventType string     `json:"event_type"`
+	OldValue  string     `json:"old_value,omitempty"`
+	NewValue  string     `json:"new_value,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ActivityResponse is one page of the security history.
+type ActivityResponse struct {
+	Events     []ActivityEventResponse `json:"events"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
 // type DeleteAccountRequest struct {
 // 	Email string `json:"email" validate:"required,email"`
 // }
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+type JWKSHandler struct {
+	keys   *config.JWTTokenKeys
+	logger ports.Logger
+}
+
+func NewJWKSHandler(keys *config.JWTTokenKeys, logger ports.Logger) *JWKSHandler {
+	return &JWKSHandler{
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+// ServeJWKS publishes the public signing keys for downstream token consumers.
+func (h *JWKSHandler) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.keys.JWKS()
+	if err != nil {
+		h.logger.Error(domain.LogHttpHandler, "Failed to build JWKS", "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// Short cache so consumers pick up newly published keys well before they sign anything
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
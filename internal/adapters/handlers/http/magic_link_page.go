@@ -0,0 +1,65 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/golang-auth/internal/core/domain"
+)
+
+// magicLinkPage is what the emailed link opens. Mail scanners and link
+// previews fetch links on their own, so the GET only shows a button; the
+// token is spent by the POST it submits.
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+button { font-size: 1rem; padding: .6rem 1.4rem; cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>Sign in</h1>
+<p>Continue to sign in with the link from your email. The link works only once.</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+type magicLinkPageData struct {
+	Action string
+	Token  string
+}
+
+// ConfirmMagicLink renders the page that submits the emailed token to
+// ConsumeMagicLink. It never touches the token itself.
+func (h *UserHandler) ConfirmMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.writeJSONError(w, http.StatusBadRequest, "Login token is required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The token is in the URL: keep it out of Referer headers, and don't let
+	// another site frame the page to get the button clicked
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(http.StatusOK)
+	if err := magicLinkPage.Execute(w, magicLinkPageData{Action: r.URL.Path, Token: token}); err != nil {
+		h.logger.Error(domain.LogHttpHandler, "Failed to render magic link page", "error", err)
+	}
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller, taken from a verified access token.
+type Principal struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	TokenID   string
+	Roles     []string
+	Scopes    []string
+
+	// The client the access token was issued to, empty for older tokens
+	ClientNetworkHash   string
+	ClientUserAgentHash string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by Authenticate.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticate verifies the access token from the "Authorization: Bearer"
+// header, or the access_token cookie as a fallback, and puts the resulting
+// Principal into the request context. Requests without a valid token are
+// rejected with 401.
+func Authenticate(logger ports.Logger, keys *config.JWTTokenKeys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := bearerToken(r)
+			if raw == "" {
+				writeUnauthorized(w, "Missing access token")
+				return
+			}
+
+			claims, err := keys.VerifyToken(raw)
+			if err != nil {
+				logger.Debug("Rejected access token", "error", err, "path", r.URL.Path)
+				writeUnauthorized(w, "Invalid or expired access token")
+				return
+			}
+
+			userID, err := uuid.Parse(claims.Subject)
+			if err != nil {
+				writeUnauthorized(w, "Invalid access token subject")
+				return
+			}
+			sessionID, err := uuid.Parse(claims.SessionID)
+			if err != nil {
+				writeUnauthorized(w, "Invalid access token session")
+				return
+			}
+
+			principal := &Principal{
+				UserID:    userID,
+				SessionID: sessionID,
+				TokenID:   claims.ID,
+				Roles:     claims.Roles,
+				Scopes:    strings.Fields(claims.Scope),
+
+				ClientNetworkHash:   claims.ClientNetworkHash,
+				ClientUserAgentHash: claims.ClientUserAgentHash,
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireRole lets through only principals holding role. It must run after
+// Authenticate; callers without the role get 403.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "Missing access token")
+				return
+			}
+			if !principal.HasRole(role) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Insufficient role"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie("access_token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys := testutil.NewTestJWTKeys(t)
+	otherKeys := testutil.NewTestJWTKeys(t)
+	userID, sessionID := uuid.New(), uuid.New()
+
+	claims := config.TokenClaims{TokenID: "jti", UserID: userID, SessionID: sessionID, Roles: []string{"admin"}}
+
+	valid, err := keys.SignToken(claims)
+	if err != nil {
+		t.Fatalf("SignToken() error: %v", err)
+	}
+	forged, err := otherKeys.SignToken(claims)
+	if err != nil {
+		t.Fatalf("SignToken() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "Missing token",
+			prepare:        func(r *http.Request) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Valid bearer token",
+			prepare:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+valid) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Valid cookie token",
+			prepare:        func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: valid}) },
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Token signed by another key",
+			prepare:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+forged) },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Garbage token",
+			prepare:        func(r *http.Request) { r.Header.Set("Authorization", "Bearer not.a.jwt") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Principal
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = PrincipalFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.prepare(req)
+			w := httptest.NewRecorder()
+
+			Authenticate(&testutil.NoopLogger{}, keys)(next).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus == http.StatusOK && (got == nil || got.UserID != userID || got.SessionID != sessionID || !got.HasRole("admin")) {
+				t.Errorf("unexpected principal: %+v", got)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      *Principal
+		expectedStatus int
+	}{
+		{"No principal", nil, http.StatusUnauthorized},
+		{"Missing role", &Principal{UserID: uuid.New(), Roles: []string{"user"}}, http.StatusForbidden},
+		{"Has role", &Principal{UserID: uuid.New(), Roles: []string{"user", "admin"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+
+			RequireRole("admin")(next).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang-auth/internal/adapters/config"
+)
+
+type clientIPKey struct{}
+
+// ClientIP resolves the address of the client and stores it in the request
+// context, see ClientIPOf. header, one of the config.ClientIPHeader* names,
+// is the header the proxies write the client IP to. It is only read when the
+// connection comes from one of the trusted proxies; anyone else could set it
+// to whatever they like.
+func ClientIP(trustedProxies []netip.Prefix, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedProxies, header)
+			next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), ip)))
+		})
+	}
+}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPOf returns the client address resolved by ClientIP, or the peer
+// address of the connection when the middleware didn't run.
+func ClientIPOf(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok && ip != "" {
+		return ip
+	}
+	if addr, ok := remoteAddr(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// MaxUserAgentLength caps the user agent stored on sessions.
+const MaxUserAgentLength = 512
+
+// UserAgentOf returns the user agent of the request the way sessions record
+// it: trimmed and cut to MaxUserAgentLength runes.
+func UserAgentOf(r *http.Request) string {
+	userAgent := strings.TrimSpace(r.UserAgent())
+	if utf8.RuneCountInString(userAgent) <= MaxUserAgentLength {
+		return userAgent
+	}
+	return string([]rune(userAgent)[:MaxUserAgentLength])
+}
+
+// resolveClientIP walks the forwarding chain in header from the nearest hop
+// back and returns the first address that isn't a trusted proxy. Other
+// forwarding headers are ignored: the proxy passes on whatever the client
+// put in them.
+func resolveClientIP(r *http.Request, trustedProxies []netip.Prefix, header string) string {
+	peer, ok := remoteAddr(r)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !isTrustedProxy(peer, trustedProxies) {
+		return peer.String()
+	}
+
+	var chain []string
+	switch header {
+	case config.ClientIPHeaderForwarded:
+		chain = forwardedFor(r.Header.Values(header))
+	case config.ClientIPHeaderXForwardedFor:
+		for _, value := range r.Header.Values(header) {
+			chain = append(chain, strings.Split(value, ",")...)
+		}
+	case config.ClientIPHeaderXRealIP:
+		chain = r.Header.Values(header)
+	}
+
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			// An obfuscated or broken hop: nothing before it can be trusted
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the for= parameters of Forwarded headers, in order.
+func forwardedFor(headers []string) []string {
+	var chain []string
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(name, "for") {
+					chain = append(chain, value)
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseForwardedAddr accepts an IP with or without a port, quoted or not and
+// in brackets for IPv6, as both header formats allow.
+func parseForwardedAddr(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
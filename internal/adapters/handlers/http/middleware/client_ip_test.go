@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/golang-auth/internal/adapters/config"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "Direct connection",
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Headers from an untrusted peer are ignored",
+			remoteAddr: "203.0.113.7:51234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For through a trusted proxy",
+			remoteAddr: "10.0.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed entries left of the first untrusted hop are skipped",
+			remoteAddr: "10.0.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.0.0.9"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Repeated X-Forwarded-For headers",
+			remoteAddr: "10.0.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1", "10.0.0.9"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Chain of only trusted proxies",
+			remoteAddr: "10.0.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.1.1.1, 10.0.0.9"}},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "Broken hop stops the walk",
+			remoteAddr: "10.0.0.5:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1, garbage, 10.0.0.9"}},
+			want:       "10.0.0.9",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.0.0.5:80",
+			header:     config.ClientIPHeaderXRealIP,
+			headers:    map[string][]string{"X-Real-Ip": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "X-Real-IP set by the client is overridden by the proxy",
+			remoteAddr: "10.0.0.5:80",
+			header:     config.ClientIPHeaderXRealIP,
+			headers:    map[string][]string{"X-Real-Ip": {"1.2.3.4", "198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.5:80",
+			header:     config.ClientIPHeaderForwarded,
+			headers:    map[string][]string{"Forwarded": {`for=198.51.100.2;proto=https, for="10.0.0.9:8080"`}},
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "Only the configured header is read",
+			remoteAddr: "10.0.0.5:80",
+			headers: map[string][]string{
+				"Forwarded":       {"for=1.2.3.4"},
+				"X-Real-Ip":       {"1.2.3.5"},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:       "Other headers don't stand in for a missing one",
+			remoteAddr: "10.0.0.5:80",
+			header:     config.ClientIPHeaderForwarded,
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4"}},
+			want:       "10.0.0.5",
+		},
+		{
+			name:       "Forwarded with a bracketed IPv6 and port",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			header:     config.ClientIPHeaderForwarded,
+			headers:    map[string][]string{"Forwarded": {`For="[2001:db8:cafe::17]:4711"`}},
+			want:       "2001:db8:cafe::17",
+		},
+		{
+			name:       "Obfuscated Forwarded identifier",
+			remoteAddr: "10.0.0.5:80",
+			header:     config.ClientIPHeaderForwarded,
+			headers:    map[string][]string{"Forwarded": {"for=_hidden"}},
+			want:       "10.0.0.5",
+		},
+		{
+			name:       "IPv4-mapped IPv6 peer",
+			remoteAddr: "[::ffff:10.0.0.5]:80",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIPOf(r)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+
+			header := tt.header
+			if header == "" {
+				header = config.ClientIPHeaderXForwardedFor
+			}
+			ClientIP(trusted, header)(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("expected client IP %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Falls back to the peer without the middleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+		if got := ClientIPOf(req); got != "203.0.113.7" {
+			t.Errorf("expected 203.0.113.7, got %s", got)
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	domainevents "github.com/golang-auth/internal/core/domain/events"
 	"github.com/golang-auth/internal/core/ports"
 )
 
@@ -32,8 +33,9 @@ func LoggingMiddleware(logger ports.Logger) func(http.Handler) http.Handler {
 				slog.String("path", r.URL.Path),
 				slog.Int("status", rw.statusCode),
 				slog.Duration("latency", time.Since(start)),
-				slog.String("ip", r.RemoteAddr),
+				slog.String("ip", ClientIPOf(r)),
 				slog.String("user_agent", r.UserAgent()),
+				slog.String("trace_id", domainevents.TraceIDFrom(r.Context())),
 			)
 		})
 	}
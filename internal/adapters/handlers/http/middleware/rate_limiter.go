@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// Bodies larger than this are not searched for an email to limit by.
+const maxRateLimitBodySize = 1 << 20
+
+// RateLimiter enforces the rate limit policies of the config. Every request
+// goes through the default policy, see Global, and routes can add their own,
+// see Route.
+type RateLimiter struct {
+	logger  ports.Logger
+	limiter ports.RateLimiter
+	cfg     *config.RateLimitConfig
+}
+
+func NewRateLimiter(logger ports.Logger, limiter ports.RateLimiter, cfg *config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		logger:  logger,
+		limiter: limiter,
+		cfg:     cfg,
+	}
+}
+
+// Global applies the default policy to every request.
+func (rl *RateLimiter) Global() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return rl.handler("default", []config.RateLimitPolicy{rl.cfg.Default}, next)
+	}
+}
+
+// Route applies the policies configured for route, the pattern the handler is
+// registered under. Policies keyed by user need the principal, so on
+// protected routes Route goes inside Authenticate.
+func (rl *RateLimiter) Route(route string, next http.Handler) http.Handler {
+	policies := rl.cfg.ForRoute(route)
+	if len(policies) == 0 {
+		return next
+	}
+	return rl.handler(route, policies, next)
+}
+
+func (rl *RateLimiter) handler(scope string, policies []config.RateLimitPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every policy is checked in one call, so a request refused by one of
+		// them isn't counted against the others
+		checks := make([]ports.RateLimitCheck, 0, len(policies))
+		keys := make([]string, 0, len(policies))
+		failOpen := true
+		for _, policy := range policies {
+			subject, ok := rateLimitSubject(r, policy.Key)
+			if !ok {
+				continue
+			}
+			checks = append(checks, ports.RateLimitCheck{Key: scope + ":" + policy.Key + ":" + subject, Limit: policy.RateLimit})
+			keys = append(keys, policy.Key)
+			failOpen = failOpen && policy.FailOpen
+		}
+		if len(checks) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		results, err := rl.limiter.Allow(r.Context(), checks)
+		if err != nil {
+			// Open only when every policy involved may be skipped
+			rl.logger.Error(domain.LogHttpHandler, "Rate limiter unavailable", "error", err, "scope", scope, "fail_open", failOpen)
+			if failOpen {
+				next.ServeHTTP(w, r)
+				return
+			}
+			writeJSONError(w, http.StatusServiceUnavailable, "Service temporarily unavailable")
+			return
+		}
+
+		// A refused request reports the policy that holds it back longest,
+		// an allowed one the policy closest to its limit
+		var refused, tightest *ports.RateLimitResult
+		for i := range results {
+			res := &results[i]
+			if !res.Allowed {
+				rl.logger.Warn(domain.LogHttpHandler, "Rate limit exceeded", "scope", scope, "key", keys[i])
+				if refused == nil || res.RetryAfter > refused.RetryAfter {
+					refused = res
+				}
+				continue
+			}
+			if tightest == nil || res.Remaining < tightest.Remaining {
+				tightest = res
+			}
+		}
+
+		if refused != nil {
+			setRateLimitHeaders(w, refused)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(refused.RetryAfter)))
+			writeJSONError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		setRateLimitHeaders(w, tightest)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitSubject returns what a request is counted by. It is false when
+// the request doesn't carry it, e.g. no email in the body; such requests are
+// not limited by that policy.
+func rateLimitSubject(r *http.Request, key string) (string, bool) {
+	switch key {
+	case config.RateLimitKeyIP:
+		return ClientIPOf(r), true
+	case config.RateLimitKeyUser:
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			return "", false
+		}
+		return principal.UserID.String(), true
+	case config.RateLimitKeyEmail:
+		email := bodyEmail(r)
+		return email, email != ""
+	}
+	return "", false
+}
+
+// bodyEmail reads the "email" field of a JSON body and puts the body back
+// for the handler.
+func bodyEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRateLimitBodySize))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers of the IETF draft, with
+// the reset in seconds.
+func setRateLimitHeaders(w http.ResponseWriter, res *ports.RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+// countingLimiter is a fixed window without expiry, enough to check which
+// keys the middleware counts. Like the real limiter it counts a request
+// against all of its keys or none.
+type countingLimiter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	err    error
+}
+
+func (l *countingLimiter) Allow(ctx context.Context, checks []ports.RateLimitCheck) ([]ports.RateLimitResult, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	results := make([]ports.RateLimitResult, len(checks))
+	all := true
+	for i, check := range checks {
+		if l.counts[check.Key] >= check.Limit.Limit {
+			results[i] = ports.RateLimitResult{Limit: check.Limit.Limit, Reset: check.Limit.Window, RetryAfter: 1500 * time.Millisecond}
+			all = false
+			continue
+		}
+		results[i] = ports.RateLimitResult{Allowed: true, Limit: check.Limit.Limit, Remaining: check.Limit.Limit - l.counts[check.Key], Reset: check.Limit.Window}
+	}
+	if all {
+		for i, check := range checks {
+			l.counts[check.Key]++
+			results[i].Remaining--
+		}
+	}
+	return results, nil
+}
+
+func newCountingLimiter() *countingLimiter {
+	return &countingLimiter{counts: make(map[string]int)}
+}
+
+func rateLimitPolicy(route, key string, limit int, failOpen bool) config.RateLimitPolicy {
+	return config.RateLimitPolicy{
+		RateLimit: ports.RateLimit{Algorithm: ports.RateLimitSlidingWindow, Limit: limit, Window: time.Minute},
+		Route:     route,
+		Key:       key,
+		FailOpen:  failOpen,
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	const route = "POST /v1/login"
+	var gotBody string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func(handler http.Handler, ip, body string, principal *Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/login", bytes.NewBufferString(body))
+		req.RemoteAddr = ip + ":4242"
+		if principal != nil {
+			req = req.WithContext(WithPrincipal(req.Context(), principal))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Limits per IP with headers", func(t *testing.T) {
+		cfg := &config.RateLimitConfig{Default: rateLimitPolicy("", config.RateLimitKeyIP, 2, true)}
+		handler := NewRateLimiter(&testutil.NoopLogger{}, newCountingLimiter(), cfg).Global()(next)
+
+		rr := send(handler, "10.0.0.1", "", nil)
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != "1" || rr.Header().Get("RateLimit-Reset") != "60" {
+			t.Errorf("unexpected first response %d: %v", rr.Code, rr.Header())
+		}
+		send(handler, "10.0.0.1", "", nil)
+
+		rr = send(handler, "10.0.0.1", "", nil)
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "2" || rr.Header().Get("RateLimit-Remaining") != "0" {
+			t.Errorf("expected 429 with Retry-After 2, got %d: %v", rr.Code, rr.Header())
+		}
+		if rr := send(handler, "10.0.0.2", "", nil); rr.Code != http.StatusOK {
+			t.Errorf("expected another IP to pass, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Limits per email and keeps the body", func(t *testing.T) {
+		cfg := &config.RateLimitConfig{Routes: []config.RateLimitPolicy{rateLimitPolicy(route, config.RateLimitKeyEmail, 1, true)}}
+		handler := NewRateLimiter(&testutil.NoopLogger{}, newCountingLimiter(), cfg).Route(route, next)
+
+		body := `{"email": "User@Gmail.com", "password": "secret"}`
+		if rr := send(handler, "10.0.0.1", body, nil); rr.Code != http.StatusOK || gotBody != body {
+			t.Fatalf("expected the body to reach the handler, got %d: %q", rr.Code, gotBody)
+		}
+		// Same account from another IP and in another case
+		if rr := send(handler, "10.0.0.2", `{"email": "user@gmail.com"}`, nil); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 for the same email, got %d", rr.Code)
+		}
+		if rr := send(handler, "10.0.0.1", `{"email": "other@gmail.com"}`, nil); rr.Code != http.StatusOK {
+			t.Errorf("expected another email to pass, got %d", rr.Code)
+		}
+		if rr := send(handler, "10.0.0.1", `not json`, nil); rr.Code != http.StatusOK {
+			t.Errorf("expected a body without email to skip the policy, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Limits per user", func(t *testing.T) {
+		cfg := &config.RateLimitConfig{Routes: []config.RateLimitPolicy{rateLimitPolicy(route, config.RateLimitKeyUser, 1, true)}}
+		handler := NewRateLimiter(&testutil.NoopLogger{}, newCountingLimiter(), cfg).Route(route, next)
+		principal := &Principal{UserID: uuid.New()}
+
+		send(handler, "10.0.0.1", "", principal)
+		if rr := send(handler, "10.0.0.2", "", principal); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 for the same user, got %d", rr.Code)
+		}
+		if rr := send(handler, "10.0.0.1", "", &Principal{UserID: uuid.New()}); rr.Code != http.StatusOK {
+			t.Errorf("expected another user to pass, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Refused requests don't use up the other policies", func(t *testing.T) {
+		cfg := &config.RateLimitConfig{Routes: []config.RateLimitPolicy{
+			rateLimitPolicy(route, config.RateLimitKeyIP, 3, true),
+			rateLimitPolicy(route, config.RateLimitKeyEmail, 1, true),
+		}}
+		limiter := newCountingLimiter()
+		handler := NewRateLimiter(&testutil.NoopLogger{}, limiter, cfg).Route(route, next)
+
+		send(handler, "10.0.0.1", `{"email": "user@gmail.com"}`, nil)
+		for range 3 {
+			if rr := send(handler, "10.0.0.1", `{"email": "user@gmail.com"}`, nil); rr.Code != http.StatusTooManyRequests || rr.Header().Get("RateLimit-Limit") != "1" {
+				t.Fatalf("expected the email policy to refuse, got %d: %v", rr.Code, rr.Header())
+			}
+		}
+		if got := limiter.counts[route+":"+config.RateLimitKeyIP+":10.0.0.1"]; got != 1 {
+			t.Errorf("expected only the allowed request counted per IP, got %d", got)
+		}
+		if rr := send(handler, "10.0.0.1", `{"email": "other@gmail.com"}`, nil); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "0" {
+			t.Errorf("expected another email to pass with the tightest policy reported, got %d: %v", rr.Code, rr.Header())
+		}
+	})
+
+	t.Run("Routes without policies are untouched", func(t *testing.T) {
+		cfg := &config.RateLimitConfig{Routes: []config.RateLimitPolicy{rateLimitPolicy(route, config.RateLimitKeyIP, 1, true)}}
+		handler := NewRateLimiter(&testutil.NoopLogger{}, newCountingLimiter(), cfg).Route("POST /v1/register", next)
+
+		send(handler, "10.0.0.1", "", nil)
+		if rr := send(handler, "10.0.0.1", "", nil); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("expected no limit, got %d: %v", rr.Code, rr.Header())
+		}
+	})
+
+	t.Run("Limiter down", func(t *testing.T) {
+		down := &countingLimiter{err: errors.New("connection refused")}
+		for _, failOpen := range []bool{true, false} {
+			cfg := &config.RateLimitConfig{Default: rateLimitPolicy("", config.RateLimitKeyIP, 1, failOpen)}
+			handler := NewRateLimiter(&testutil.NoopLogger{}, down, cfg).Global()(next)
+
+			want := http.StatusServiceUnavailable
+			if failOpen {
+				want = http.StatusOK
+			}
+			if rr := send(handler, "10.0.0.1", "", nil); rr.Code != want {
+				t.Errorf("failOpen=%v: expected %d, got %d", failOpen, want, rr.Code)
+			}
+		}
+	})
+}
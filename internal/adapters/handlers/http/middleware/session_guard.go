@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// SessionGuard hands every authenticated request to the session anomaly
+// check, so a token used from another network or browser than its session is
+// caught. It must run after Authenticate. Requests the anomaly policy refuses
+// get 401 and have to sign in again.
+func SessionGuard(logger ports.Logger, guard ports.SessionGuard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				writeUnauthorized(w, "Missing access token")
+				return
+			}
+
+			err := guard.CheckSessionClient(r.Context(), &ports.SessionClientCheck{
+				UserID:             principal.UserID,
+				SessionID:          principal.SessionID,
+				TokenNetworkHash:   principal.ClientNetworkHash,
+				TokenUserAgentHash: principal.ClientUserAgentHash,
+				IPAddress:          ClientIPOf(r),
+				UserAgent:          UserAgentOf(r),
+			})
+			if err != nil {
+				if errors.Is(err, domain.ErrSessionAnomaly) || errors.Is(err, domain.ErrSessionExpired) {
+					writeUnauthorized(w, err.Error())
+					return
+				}
+				logger.Error(domain.LogHttpHandler, "Session check failed", "error", err, "session_id", principal.SessionID)
+				writeJSONError(w, http.StatusInternalServerError, "Could not verify the session")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+type guardFunc func(ctx context.Context, check *ports.SessionClientCheck) error
+
+func (f guardFunc) CheckSessionClient(ctx context.Context, check *ports.SessionClientCheck) error {
+	return f(ctx, check)
+}
+
+func TestSessionGuard(t *testing.T) {
+	principal := &Principal{UserID: uuid.New(), SessionID: uuid.New(), ClientNetworkHash: "network-hash", ClientUserAgentHash: "hash"}
+
+	tests := []struct {
+		name           string
+		principal      *Principal
+		guardErr       error
+		expectedStatus int
+	}{
+		{"No principal", nil, nil, http.StatusUnauthorized},
+		{"Allowed", principal, nil, http.StatusOK},
+		{"Anomaly", principal, domain.ErrSessionAnomaly, http.StatusUnauthorized},
+		{"Session gone", principal, domain.ErrSessionExpired, http.StatusUnauthorized},
+		{"Check failed", principal, errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *ports.SessionClientCheck
+			guard := guardFunc(func(ctx context.Context, check *ports.SessionClientCheck) error {
+				got = check
+				return tt.guardErr
+			})
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			handler := SessionGuard(&testutil.NoopLogger{}, guard)(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/account/me", nil)
+			req.Header.Set("User-Agent", "  curl/8.5.0 ")
+			req = req.WithContext(WithClientIP(req.Context(), "203.0.113.5"))
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.principal == nil {
+				return
+			}
+			if got.SessionID != principal.SessionID || got.TokenNetworkHash != "network-hash" || got.TokenUserAgentHash != "hash" ||
+				got.IPAddress != "203.0.113.5" || got.UserAgent != "curl/8.5.0" {
+				t.Errorf("unexpected check: %+v", got)
+			}
+		})
+	}
+}
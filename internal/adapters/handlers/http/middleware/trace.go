@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
+
+// TraceIDHeader echoes the trace ID of a request back to the client.
+const TraceIDHeader = "X-Trace-Id"
+
+// TraceID stores the trace ID of the request in its context, so the events
+// it raises can be tied back to it. The ID comes from a W3C traceparent
+// header when the caller sent a valid one, otherwise a new one is made up.
+func TraceID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceID, ok := traceIDFromParent(r.Header.Get("traceparent"))
+			if !ok {
+				traceID = newTraceID()
+			}
+			w.Header().Set(TraceIDHeader, traceID)
+			next.ServeHTTP(w, r.WithContext(domainevents.WithTraceID(r.Context(), traceID)))
+		})
+	}
+}
+
+// traceIDFromParent returns the trace-id field of a traceparent header,
+// "00-<trace-id>-<parent-id>-<flags>". An all zero trace-id is invalid.
+func traceIDFromParent(header string) (string, bool) {
+	fields := strings.Split(strings.TrimSpace(header), "-")
+	if len(fields) < 4 || len(fields[1]) != 32 {
+		return "", false
+	}
+	traceID := strings.ToLower(fields[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return traceID, true
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		want        string // "" for a generated ID
+	}{
+		{
+			name:        "Trace ID of the caller",
+			traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			want:        "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{name: "No traceparent"},
+		{name: "Malformed traceparent", traceparent: "00-not-a-trace-01"},
+		{name: "All zero trace ID", traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := TraceID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = domainevents.TraceIDFrom(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if len(got) != 32 || (tt.want != "" && got != tt.want) {
+				t.Errorf("trace ID = %q, want %q", got, tt.want)
+			}
+			if rec.Header().Get(TraceIDHeader) != got {
+				t.Errorf("%s header = %q, want %q", TraceIDHeader, rec.Header().Get(TraceIDHeader), got)
+			}
+		})
+	}
+}
@@ -1,12 +1,17 @@
 package http
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/golang-auth/internal/adapters/handlers/http/middleware"
 	"github.com/golang-auth/internal/core/domain"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/google/uuid"
@@ -14,6 +19,8 @@ import (
 
 var validate = validator.New()
 
+const refreshTokenCookiePath = "/v1/auth/refresh"
+
 type UserHandler struct {
 	userService ports.UserUseCase
 	logger      ports.Logger
@@ -43,7 +50,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.userService.Register(ctx, req.Email, req.Password); err != nil {
+	if err := h.userService.Register(ctx, req.Email, req.Password, req.VerificationMode); err != nil {
 		h.mapErrorToResponse(w, err)
 		return
 	}
@@ -78,6 +85,35 @@ func (h *UserHandler) VerifyUserEmail(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *UserHandler) VerifyEmailCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req VerifyEmailCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.VerifyEmailCode(ctx, req.Email, req.Code); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "user account verified successfully",
+	})
+}
+
 func (h *UserHandler) ResendVerificationToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
@@ -96,7 +132,7 @@ func (h *UserHandler) ResendVerificationToken(w http.ResponseWriter, r *http.Req
 	}
 
 	ctx := r.Context()
-	if err := h.userService.ResendEmailVerificationToken(ctx, req.Email); err != nil {
+	if err := h.userService.ResendEmailVerificationToken(ctx, req.Email, req.VerificationMode); err != nil {
 		h.mapErrorToResponse(w, err)
 		return
 	}
@@ -108,6 +144,69 @@ func (h *UserHandler) ResendVerificationToken(w http.ResponseWriter, r *http.Req
 	})
 }
 
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Valid email is required")
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.ForgotPassword(ctx, req.Email); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	// Same answer whether or not the account exists
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account with that email exists, a password reset link has been sent.",
+	})
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.ResetPassword(ctx, req.Token, req.Password); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	// Every session was revoked, including the caller's
+	h.clearCookie(w, "access_token", "/")
+	h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password has been reset, please log in again",
+	})
+}
+
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
@@ -119,60 +218,108 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
+	userAgent, device := sessionClient(r)
 	loginRequest := ports.LoginRequest{
 		Email:     req.Email,
 		Password:  req.Password,
-		IPAddress: "0.0.0.0",
-		UserAgent: "Agent",
-		Device:    "iPad",
+		IPAddress: middleware.ClientIPOf(r),
+		UserAgent: userAgent,
+		Device:    device,
 	}
 	res, err := h.userService.Login(ctx, &loginRequest)
 	if err != nil {
 		h.mapErrorToResponse(w, err)
 		return
 	}
+	h.writeLoginResponse(w, res)
+}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "UserID",
-		Value:    res.UserID.String(),
-		Expires:  res.RefreshTokenExpiresAt,
-		HttpOnly: true,
-		Secure:   false,
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-	})
+func (h *UserHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "SessionID",
-		Value:    res.SessionID.String(),
-		Expires:  res.AccessTokenExpiresAt,
-		HttpOnly: true,
-		Secure:   false,
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
-	})
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Valid email is required")
+		return
+	}
 
-	// Set Access Token Cookie (Short-lived)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "access_token",
-		Value:    res.AccessToken,
-		Expires:  res.AccessTokenExpiresAt,
-		HttpOnly: true,
-		Secure:   true, // Set to false only if developing on localhost without HTTPS
-		Path:     "/",
-		SameSite: http.SameSiteLaxMode,
+	ctx := r.Context()
+	if err := h.userService.RequestMagicLink(ctx, req.Email); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	// Same answer whether or not the account exists
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account with that email exists, a login link has been sent.",
 	})
+}
 
-	// Set Refresh Token Cookie (Long-lived)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "refresh_token",
-		Value:    res.RefreshToken,
-		Expires:  res.RefreshTokenExpiresAt,
-		HttpOnly: true,
-		Secure:   true,
-		Path:     "/auth/refresh", // Optional: Only send this cookie to the refresh endpoint
-		SameSite: http.SameSiteLaxMode,
+// ConsumeMagicLink trades the token for a login. It takes the form posted by
+// the ConfirmMagicLink page as well as a JSON body from an app's own page.
+func (h *UserHandler) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var token string
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req MagicLinkConsumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		token = req.Token
+	} else {
+		token = r.PostFormValue("token")
+	}
+	if token == "" {
+		h.writeJSONError(w, http.StatusBadRequest, "Login token is required")
+		return
+	}
+
+	ctx := r.Context()
+	userAgent, device := sessionClient(r)
+	res, err := h.userService.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{
+		Token:     token,
+		IPAddress: middleware.ClientIPOf(r),
+		UserAgent: userAgent,
+		Device:    device,
 	})
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+	h.writeLoginResponse(w, res)
+}
+
+// writeLoginResponse finishes a first-factor login: it either sets the session
+// cookies or hands back the MFA challenge.
+func (h *UserHandler) writeLoginResponse(w http.ResponseWriter, res *ports.LoginResponse) {
+	// MFA users get no session yet, only a challenge for POST /v1/login/mfa
+	if res.MFAChallenge != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":              "MFA code required",
+			"mfa_required":         true,
+			"challenge":            res.MFAChallenge,
+			"challenge_expires_at": res.MFAChallengeExpiresAt,
+		})
+		return
+	}
+
+	h.setTokenCookies(w, res)
 
 	// Return success response (usually excluding the tokens from the JSON body for security)
 	w.Header().Set("Content-Type", "application/json")
@@ -182,120 +329,755 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	cookie, err := r.Cookie("SessionID")
-	if err != nil {
-		h.writeJSONError(w, http.StatusUnauthorized, "No active session found")
+	var req MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
-	sessionID, err := uuid.Parse(cookie.Value)
-	if err != nil {
-		h.writeJSONError(w, http.StatusBadRequest, "Invalid session format")
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
 		return
 	}
 
 	ctx := r.Context()
-	err = h.userService.Logout(ctx, sessionID)
+	userAgent, device := sessionClient(r)
+	res, err := h.userService.LoginWithMFA(ctx, &ports.MFALoginRequest{
+		Challenge:    req.Challenge,
+		Code:         req.Code,
+		RecoveryCode: req.RecoveryCode,
+		IPAddress:    middleware.ClientIPOf(r),
+		UserAgent:    userAgent,
+		Device:       device,
+	})
 	if err != nil {
-		h.logger.Debug("error SNIOAB", err)
 		h.mapErrorToResponse(w, err)
 		return
 	}
 
-	h.clearCookie(w, "UserID", "/")
-	h.clearCookie(w, "SessionID", "/")
-	h.clearCookie(w, "access_token", "/")
-	h.clearCookie(w, "refresh_token", "/auth/refresh")
+	h.setTokenCookies(w, res)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Successfully logged out",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Login successful",
 	})
 }
 
-func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
+func (h *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	cookieUserID, err := r.Cookie("UserID")
-	if err != nil {
-		h.writeJSONError(w, http.StatusUnauthorized, "No user ID found from cookie")
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
 		return
 	}
-	userID, err := uuid.Parse(cookieUserID.Value)
+
+	ctx := r.Context()
+	enrollment, err := h.userService.EnrollTOTP(ctx, principal.UserID)
 	if err != nil {
-		h.writeJSONError(w, http.StatusBadRequest, "Invalid user id format")
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      enrollment.Secret,
+		"otpauth_uri": enrollment.URI,
+		"message":     "Scan the code with an authenticator app and confirm it with the first code",
+	})
+}
+
+func (h *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req TOTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "A 6 digit code is required")
 		return
 	}
 
 	ctx := r.Context()
-	if err := h.userService.DeleteAccount(ctx, userID); err != nil {
+	recoveryCodes, err := h.userService.ConfirmTOTP(ctx, principal.UserID, req.Code)
+	if err != nil {
 		h.mapErrorToResponse(w, err)
 		return
 	}
 
-	h.clearCookie(w, "UserID", "/")
-	h.clearCookie(w, "SessionID", "/")
-	h.clearCookie(w, "access_token", "/")
-	h.clearCookie(w, "refresh_token", "/auth/refresh")
-
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Account and all associated sessions have been successfully deleted",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "MFA enabled. Store the recovery codes somewhere safe, they are only shown once",
+		"recovery_codes": recoveryCodes,
 	})
 }
 
-// Helper to clear cookies
-func (h *UserHandler) clearCookie(w http.ResponseWriter, name, path string) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     name,
-		Value:    "",
-		Path:     path,
-		MaxAge:   -1, // Tells browser to delete immediately
-		HttpOnly: true,
-		Secure:   true,
-		Expires:  time.Unix(0, 0),
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx := r.Context()
+	recoveryCodes, err := h.userService.RegenerateRecoveryCodes(ctx, principal.UserID)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Recovery codes regenerated, the previous codes no longer work",
+		"recovery_codes": recoveryCodes,
 	})
 }
 
-func (h *UserHandler) writeJSONError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	if message != "" {
-		json.NewEncoder(w).Encode(map[string]string{"error": message})
+func (h *UserHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
 	}
-}
 
-func (h *UserHandler) mapErrorToResponse(w http.ResponseWriter, err error) {
-	switch {
-	// 409 Conflict
-	case errors.Is(err, domain.ErrUserAlreadyExists):
-		h.writeJSONError(w, http.StatusConflict, domain.ErrUserAlreadyExists.Error())
-	case errors.Is(err, domain.ErrUserAlreadyVerified):
-		h.writeJSONError(w, http.StatusConflict, domain.ErrUserAlreadyVerified.Error())
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
 
-	// 403 Forbidden
-	case errors.Is(err, domain.ErrUserNotVerified):
-		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserNotVerified.Error())
-	case errors.Is(err, domain.ErrUserAccountBanned):
-		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserAccountBanned.Error())
-	case errors.Is(err, domain.ErrUserAccountSuspended):
-		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserAccountSuspended.Error())
-	case errors.Is(err, domain.ErrTooManyUserSessions):
-		h.writeJSONError(w, http.StatusForbidden, domain.ErrTooManyUserSessions.Error())
+	ctx := r.Context()
+	options, err := h.userService.BeginPasskeyRegistration(ctx, principal.UserID)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	exclude := make([]passkeyCredentialDescriptor, 0, len(options.ExcludeCredentialIDs))
+	for _, id := range options.ExcludeCredentialIDs {
+		exclude = append(exclude, passkeyCredentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)})
+	}
+	params := make([]passkeyCredentialParameter, 0, len(options.Algorithms))
+	for _, alg := range options.Algorithms {
+		params = append(params, passkeyCredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"publicKey": PasskeyCreationOptionsResponse{
+			RP: passkeyRelyingParty{ID: options.RPID, Name: options.RPName},
+			User: passkeyUser{
+				ID:          base64.RawURLEncoding.EncodeToString(options.UserHandle),
+				Name:        options.UserName,
+				DisplayName: options.UserName,
+			},
+			Challenge:          base64.RawURLEncoding.EncodeToString(options.Challenge),
+			PubKeyCredParams:   params,
+			Timeout:            options.Timeout.Milliseconds(),
+			ExcludeCredentials: exclude,
+			AuthenticatorSelection: passkeyAuthenticatorSelection{
+				ResidentKey:        "required",
+				RequireResidentKey: true,
+				UserVerification:   "required",
+			},
+			Attestation: "none",
+		},
+	})
+}
+
+func (h *UserHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req PasskeyRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
+		return
+	}
+
+	registration := ports.PasskeyRegistration{Name: req.Name}
+	var errs [3]error
+	registration.CredentialID, errs[0] = decodeBase64URL(req.RawID)
+	registration.ClientDataJSON, errs[1] = decodeBase64URL(req.Response.ClientDataJSON)
+	registration.AttestationObject, errs[2] = decodeBase64URL(req.Response.AttestationObject)
+	if err := errors.Join(errs[:]...); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Credential fields must be base64url encoded")
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.FinishPasskeyRegistration(ctx, principal.UserID, &registration); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Passkey registered",
+	})
+}
+
+func (h *UserHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx := r.Context()
+	options, err := h.userService.BeginPasskeyLogin(ctx)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"publicKey": PasskeyRequestOptionsResponse{
+			Challenge:        base64.RawURLEncoding.EncodeToString(options.Challenge),
+			RPID:             options.RPID,
+			Timeout:          options.Timeout.Milliseconds(),
+			AllowCredentials: []passkeyCredentialDescriptor{},
+			UserVerification: "required",
+		},
+	})
+}
+
+func (h *UserHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req PasskeyLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
+		return
+	}
+
+	userAgent, device := sessionClient(r)
+	login := ports.PasskeyLoginRequest{
+		IPAddress: middleware.ClientIPOf(r),
+		UserAgent: userAgent,
+		Device:    device,
+	}
+	var errs [5]error
+	login.CredentialID, errs[0] = decodeBase64URL(req.RawID)
+	login.ClientDataJSON, errs[1] = decodeBase64URL(req.Response.ClientDataJSON)
+	login.AuthenticatorData, errs[2] = decodeBase64URL(req.Response.AuthenticatorData)
+	login.Signature, errs[3] = decodeBase64URL(req.Response.Signature)
+	login.UserHandle, errs[4] = decodeBase64URL(req.Response.UserHandle)
+	if err := errors.Join(errs[:]...); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Credential fields must be base64url encoded")
+		return
+	}
+
+	ctx := r.Context()
+	res, err := h.userService.FinishPasskeyLogin(ctx, &login)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	h.setTokenCookies(w, res)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Login successful",
+	})
+}
+
+func (h *UserHandler) RefreshSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil || cookie.Value == "" {
+		h.writeJSONError(w, http.StatusUnauthorized, "No refresh token found")
+		return
+	}
+
+	ctx := r.Context()
+	userAgent, _ := sessionClient(r)
+	res, err := h.userService.RefreshSession(ctx, cookie.Value, middleware.ClientIPOf(r), userAgent)
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) || errors.Is(err, domain.ErrSessionExpired) || errors.Is(err, domain.ErrSessionAnomaly) {
+			h.clearCookie(w, "access_token", "/")
+			h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+		}
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	h.setTokenCookies(w, res)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Session refreshed",
+	})
+}
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "No active session found")
+		return
+	}
+
+	ctx := r.Context()
+	err := h.userService.Logout(ctx, principal.SessionID)
+	if err != nil {
+		h.logger.Debug(domain.LogHttpHandler, "Logout failed", "error", err, "session_id", principal.SessionID)
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	h.clearCookie(w, "access_token", "/")
+	h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Successfully logged out",
+	})
+}
+
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx := r.Context()
+	sessions, err := h.userService.ListSessions(ctx, principal.UserID, principal.SessionID)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	res := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastActive: session.LastActive,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.Current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": res,
+	})
+}
+
+// ListActivity pages through the caller's security history, newest first.
+// Query parameters: limit (1-100, default 20) and cursor from the previous page.
+func (h *UserHandler) ListActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			h.writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx := r.Context()
+	page, err := h.userService.ListActivity(ctx, principal.UserID, query.Get("cursor"), limit)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	events := make([]ActivityEventResponse, 0, len(page.Events))
+	for _, event := range page.Events {
+		res := ActivityEventResponse{
+			ID:        event.ID,
+			EventType: event.EventType,
+			OldValue:  event.OldValue,
+			NewValue:  event.NewValue,
+			CreatedAt: event.CreatedAt,
+		}
+		if event.SessionID != uuid.Nil {
+			sessionID := event.SessionID
+			res.SessionID = &sessionID
+		}
+		events = append(events, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ActivityResponse{
+		Events:     events,
+		NextCursor: page.NextCursor,
+	})
+}
+
+func (h *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid session id")
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.RevokeSession(ctx, principal.UserID, sessionID); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	// Revoking the current session is a logout
+	if sessionID == principal.SessionID {
+		h.clearCookie(w, "access_token", "/")
+		h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Session revoked",
+	})
+}
+
+func (h *UserHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx := r.Context()
+	revoked, err := h.userService.RevokeOtherSessions(ctx, principal.UserID, principal.SessionID)
+	if err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Other sessions revoked",
+		"revoked": revoked,
+	})
+}
+
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Missing or invalid required fields "+err.Error())
+		return
+	}
+
+	keepSessionID := uuid.Nil
+	if req.KeepCurrentSession {
+		keepSessionID = principal.SessionID
+	}
+
+	ctx := r.Context()
+	if err := h.userService.ChangePassword(ctx, principal.UserID, req.CurrentPassword, req.NewPassword, keepSessionID); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	if !req.KeepCurrentSession {
+		h.clearCookie(w, "access_token", "/")
+		h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed successfully",
+	})
+}
+
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.DeleteAccount(ctx, principal.UserID); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	h.clearCookie(w, "access_token", "/")
+	h.clearCookie(w, "refresh_token", refreshTokenCookiePath)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account and all associated sessions have been successfully deleted",
+	})
+}
+
+// UnlockAccount lifts a login lockout early. The route is for admins only.
+func (h *UserHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		h.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeJSONError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.userService.UnlockAccount(ctx, principal.UserID, userID); err != nil {
+		h.mapErrorToResponse(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account unlocked",
+	})
+}
+
+// Helper to set the access and refresh token cookies
+func (h *UserHandler) setTokenCookies(w http.ResponseWriter, res *ports.LoginResponse) {
+	// Set Access Token Cookie (Short-lived)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "access_token",
+		Value:    res.AccessToken,
+		Expires:  res.AccessTokenExpiresAt,
+		HttpOnly: true,
+		Secure:   true, // Set to false only if developing on localhost without HTTPS
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// Set Refresh Token Cookie (Long-lived)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    res.RefreshToken,
+		Expires:  res.RefreshTokenExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		Path:     refreshTokenCookiePath, // Only send this cookie to the refresh endpoint
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Helper to clear cookies
+func (h *UserHandler) clearCookie(w http.ResponseWriter, name, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     path,
+		MaxAge:   -1, // Tells browser to delete immediately
+		HttpOnly: true,
+		Secure:   true,
+		Expires:  time.Unix(0, 0),
+	})
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers and
+// WebAuthn libraries differ on it.
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+func (h *UserHandler) writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if message != "" {
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+	}
+}
+
+func (h *UserHandler) mapErrorToResponse(w http.ResponseWriter, err error) {
+	// Throttled requests say when to come back, rounded up to whole seconds
+	var retry *domain.RetryAfterError
+	if errors.As(err, &retry) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryAfter.Seconds()))))
+	}
+
+	switch {
+	// 409 Conflict
+	case errors.Is(err, domain.ErrUserAlreadyExists):
+		h.writeJSONError(w, http.StatusConflict, domain.ErrUserAlreadyExists.Error())
+	case errors.Is(err, domain.ErrUserAlreadyVerified):
+		h.writeJSONError(w, http.StatusConflict, domain.ErrUserAlreadyVerified.Error())
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		h.writeJSONError(w, http.StatusConflict, domain.ErrMFAAlreadyEnabled.Error())
+	case errors.Is(err, domain.ErrPasskeyAlreadyRegistered):
+		h.writeJSONError(w, http.StatusConflict, domain.ErrPasskeyAlreadyRegistered.Error())
+
+	// 403 Forbidden
+	case errors.Is(err, domain.ErrUserNotVerified):
+		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserNotVerified.Error())
+	case errors.Is(err, domain.ErrUserAccountBanned):
+		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserAccountBanned.Error())
+	case errors.Is(err, domain.ErrUserAccountSuspended):
+		h.writeJSONError(w, http.StatusForbidden, domain.ErrUserAccountSuspended.Error())
+	case errors.Is(err, domain.ErrTooManyUserSessions):
+		h.writeJSONError(w, http.StatusForbidden, domain.ErrTooManyUserSessions.Error())
+	case errors.Is(err, domain.ErrIncorrectPassword):
+		h.writeJSONError(w, http.StatusForbidden, domain.ErrIncorrectPassword.Error())
+
+	// 401 Unauthorized
+	case errors.Is(err, domain.ErrInvalidMagicLink):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidMagicLink.Error())
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidCredentials.Error())
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidMFACode.Error())
+	case errors.Is(err, domain.ErrMFACodeReused):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrMFACodeReused.Error())
+	case errors.Is(err, domain.ErrInvalidMFAChallenge):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidMFAChallenge.Error())
+	case errors.Is(err, domain.ErrMFAChallengeExpired):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrMFAChallengeExpired.Error())
+	case errors.Is(err, domain.ErrInvalidPasskeyAssertion):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidPasskeyAssertion.Error())
+	case errors.Is(err, domain.ErrPasskeyCloned):
+		// Same answer as any bad assertion; the clone is only logged
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidPasskeyAssertion.Error())
+	case errors.Is(err, domain.ErrInvalidRefreshToken):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrInvalidRefreshToken.Error())
+	case errors.Is(err, domain.ErrRefreshTokenReused):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrRefreshTokenReused.Error())
+	case errors.Is(err, domain.ErrSessionExpired):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrSessionExpired.Error())
+	case errors.Is(err, domain.ErrSessionAnomaly):
+		h.writeJSONError(w, http.StatusUnauthorized, domain.ErrSessionAnomaly.Error())
 
 	// 404 Not Found
 	case errors.Is(err, domain.ErrNotFound):
 		h.writeJSONError(w, http.StatusNotFound, domain.ErrNotFound.Error())
+	case errors.Is(err, domain.ErrSessionNotFound):
+		h.writeJSONError(w, http.StatusNotFound, domain.ErrSessionNotFound.Error())
 
 	// 500 Internal Server Errors
 	case errors.Is(err, domain.ErrDatabaseInternalError):
@@ -316,6 +1098,10 @@ func (h *UserHandler) mapErrorToResponse(w http.ResponseWriter, err error) {
 		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidEmail.Error())
 	case errors.Is(err, domain.ErrTokenExpired):
 		h.writeJSONError(w, http.StatusBadRequest, domain.ErrTokenExpired.Error())
+	case errors.Is(err, domain.ErrInvalidVerificationCode):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidVerificationCode.Error())
+	case errors.Is(err, domain.ErrInvalidVerificationMode):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidVerificationMode.Error())
 	case errors.Is(err, domain.ErrTokenNotFound):
 		h.writeJSONError(w, http.StatusInternalServerError, domain.ErrTokenNotFound.Error())
 	case errors.Is(err, domain.ErrUserNotFound):
@@ -324,12 +1110,30 @@ func (h *UserHandler) mapErrorToResponse(w http.ResponseWriter, err error) {
 		h.writeJSONError(w, http.StatusBadRequest, domain.ErrUsedToken.Error())
 	case errors.Is(err, domain.ErrInvaidPassword):
 		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvaidPassword.Error())
-	// case errors.Is(err, domain.ErrSessionNotFound):
-	// 	h.writeJSONError(w, http.StatusBadRequest, domain.ErrSessionNotFound.Error())
+	case errors.Is(err, domain.ErrInvalidResetToken):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidResetToken.Error())
+	case errors.Is(err, domain.ErrPasswordUnchanged):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrPasswordUnchanged.Error())
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrMFANotEnrolled.Error())
+	case errors.Is(err, domain.ErrMFANotEnabled):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrMFANotEnabled.Error())
+	case errors.Is(err, domain.ErrInvalidPasskeyChallenge):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidPasskeyChallenge.Error())
+	case errors.Is(err, domain.ErrInvalidPasskeyAttestation):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidPasskeyAttestation.Error())
+	case errors.Is(err, domain.ErrUnsupportedPasskey):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrUnsupportedPasskey.Error())
+	case errors.Is(err, domain.ErrInvalidActivityCursor):
+		h.writeJSONError(w, http.StatusBadRequest, domain.ErrInvalidActivityCursor.Error())
 
 	// 429
 	case errors.Is(err, domain.ErrTooManyRequests):
 		h.writeJSONError(w, http.StatusTooManyRequests, domain.ErrTooManyRequests.Error())
+	case errors.Is(err, domain.ErrVerificationCodeLocked):
+		h.writeJSONError(w, http.StatusTooManyRequests, domain.ErrVerificationCodeLocked.Error())
+	case errors.Is(err, domain.ErrLoginThrottled):
+		h.writeJSONError(w, http.StatusTooManyRequests, domain.ErrLoginThrottled.Error())
 
 	// 500 Internal Server Error (The Default)
 	default:
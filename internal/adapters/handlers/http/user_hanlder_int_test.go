@@ -40,8 +40,8 @@ func TestUserHandler_Register_Integration(t *testing.T) {
 	}
 
 	// Setup real layers with the global DB
-	repo := repository.NewUserRepository(globalDB, &testutil.NoopLogger{})
-	svc := service.NewUserService(repo, &testutil.NoopLogger{}, &testutil.NoPublisher{}, &config.JWTTokenKeys{})
+	repo := repository.NewUserRepository(globalDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+	svc := service.NewUserService(repo, &testutil.NoopLogger{}, &config.JWTTokenKeys{}, testutil.NewTestAuthConfig(t), nil)
 	handler := NewUserHandler(svc, &testutil.NoopLogger{})
 
 	t.Run("Integration: Successful Registration and Duplicate Check", func(t *testing.T) {
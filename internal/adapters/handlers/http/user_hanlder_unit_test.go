@@ -6,8 +6,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golang-auth/internal/adapters/handlers/http/middleware"
 	"github.com/golang-auth/internal/core/domain"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/golang-auth/internal/testutil"
@@ -16,38 +19,143 @@ import (
 
 // Mock Service
 type mockUserService struct {
-	registerFn                   func(ctx context.Context, email, password string) error
+	registerFn                   func(ctx context.Context, email, password, mode string) error
 	verifyUserEmail              func(ctx context.Context, token string) error
-	resendEmailVerificationToken func(ctx context.Context, email string) error
+	verifyEmailCode              func(ctx context.Context, email, code string) error
+	resendEmailVerificationToken func(ctx context.Context, email, mode string) error
+	forgotPassword               func(ctx context.Context, email string) error
+	resetPassword                func(ctx context.Context, token, newPassword string) error
 	login                        func(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error)
+	loginWithMFA                 func(ctx context.Context, req *ports.MFALoginRequest) (*ports.LoginResponse, error)
+	requestMagicLink             func(ctx context.Context, email string) error
+	loginWithMagicLink           func(ctx context.Context, req *ports.MagicLinkLoginRequest) (*ports.LoginResponse, error)
+	refreshSession               func(ctx context.Context, refreshToken, ipAddress, userAgent string) (*ports.LoginResponse, error)
+	enrollTOTP                   func(ctx context.Context, userID uuid.UUID) (*ports.TOTPEnrollment, error)
+	confirmTOTP                  func(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	regenerateRecoveryCodes      func(ctx context.Context, userID uuid.UUID) ([]string, error)
+	beginPasskeyRegistration     func(ctx context.Context, userID uuid.UUID) (*ports.PasskeyCreationOptions, error)
+	finishPasskeyRegistration    func(ctx context.Context, userID uuid.UUID, req *ports.PasskeyRegistration) error
+	beginPasskeyLogin            func(ctx context.Context) (*ports.PasskeyRequestOptions, error)
+	finishPasskeyLogin           func(ctx context.Context, req *ports.PasskeyLoginRequest) (*ports.LoginResponse, error)
 	logout                       func(ctx context.Context, session_id uuid.UUID) error
+	changePassword               func(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error
 	deleteAccount                func(ctx context.Context, user_id uuid.UUID) error
+	listSessions                 func(ctx context.Context, userID, currentSessionID uuid.UUID) ([]ports.SessionInfo, error)
+	listActivity                 func(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ports.ActivityPage, error)
+	checkSessionClient           func(ctx context.Context, check *ports.SessionClientCheck) error
+	revokeSession                func(ctx context.Context, userID, sessionID uuid.UUID) error
+	revokeOtherSessions          func(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error)
+	unlockAccount                func(ctx context.Context, adminID, userID uuid.UUID) error
 }
 
-func (m *mockUserService) Register(ctx context.Context, email, password string) error {
-	return m.registerFn(ctx, email, password)
+func (m *mockUserService) Register(ctx context.Context, email, password, mode string) error {
+	return m.registerFn(ctx, email, password, mode)
 }
 
 func (m *mockUserService) VerifyUserEmail(ctx context.Context, token string) error {
 	return m.verifyUserEmail(ctx, token)
 }
 
-func (m *mockUserService) ResendEmailVerificationToken(ctx context.Context, email string) error {
-	return m.resendEmailVerificationToken(ctx, email)
+func (m *mockUserService) VerifyEmailCode(ctx context.Context, email, code string) error {
+	return m.verifyEmailCode(ctx, email, code)
+}
+
+func (m *mockUserService) ResendEmailVerificationToken(ctx context.Context, email, mode string) error {
+	return m.resendEmailVerificationToken(ctx, email, mode)
+}
+
+func (m *mockUserService) ForgotPassword(ctx context.Context, email string) error {
+	return m.forgotPassword(ctx, email)
+}
+
+func (m *mockUserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	return m.resetPassword(ctx, token, newPassword)
 }
 
 func (m *mockUserService) Login(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error) {
 	return m.login(ctx, req)
 }
 
+func (m *mockUserService) LoginWithMFA(ctx context.Context, req *ports.MFALoginRequest) (*ports.LoginResponse, error) {
+	return m.loginWithMFA(ctx, req)
+}
+
+func (m *mockUserService) RequestMagicLink(ctx context.Context, email string) error {
+	return m.requestMagicLink(ctx, email)
+}
+
+func (m *mockUserService) LoginWithMagicLink(ctx context.Context, req *ports.MagicLinkLoginRequest) (*ports.LoginResponse, error) {
+	return m.loginWithMagicLink(ctx, req)
+}
+
+func (m *mockUserService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*ports.TOTPEnrollment, error) {
+	return m.enrollTOTP(ctx, userID)
+}
+
+func (m *mockUserService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	return m.confirmTOTP(ctx, userID, code)
+}
+
+func (m *mockUserService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	return m.regenerateRecoveryCodes(ctx, userID)
+}
+
+func (m *mockUserService) BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*ports.PasskeyCreationOptions, error) {
+	return m.beginPasskeyRegistration(ctx, userID)
+}
+
+func (m *mockUserService) FinishPasskeyRegistration(ctx context.Context, userID uuid.UUID, req *ports.PasskeyRegistration) error {
+	return m.finishPasskeyRegistration(ctx, userID, req)
+}
+
+func (m *mockUserService) BeginPasskeyLogin(ctx context.Context) (*ports.PasskeyRequestOptions, error) {
+	return m.beginPasskeyLogin(ctx)
+}
+
+func (m *mockUserService) FinishPasskeyLogin(ctx context.Context, req *ports.PasskeyLoginRequest) (*ports.LoginResponse, error) {
+	return m.finishPasskeyLogin(ctx, req)
+}
+
+func (m *mockUserService) RefreshSession(ctx context.Context, refreshToken, ipAddress, userAgent string) (*ports.LoginResponse, error) {
+	return m.refreshSession(ctx, refreshToken, ipAddress, userAgent)
+}
+
 func (m *mockUserService) Logout(ctx context.Context, session_id uuid.UUID) error {
 	return m.logout(ctx, session_id)
 }
 
+func (m *mockUserService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error {
+	return m.changePassword(ctx, userID, currentPassword, newPassword, keepSessionID)
+}
+
 func (m *mockUserService) DeleteAccount(ctx context.Context, user_id uuid.UUID) error {
 	return m.deleteAccount(ctx, user_id)
 }
 
+func (m *mockUserService) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]ports.SessionInfo, error) {
+	return m.listSessions(ctx, userID, currentSessionID)
+}
+
+func (m *mockUserService) CheckSessionClient(ctx context.Context, check *ports.SessionClientCheck) error {
+	return m.checkSessionClient(ctx, check)
+}
+
+func (m *mockUserService) ListActivity(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ports.ActivityPage, error) {
+	return m.listActivity(ctx, userID, cursor, limit)
+}
+
+func (m *mockUserService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	return m.revokeSession(ctx, userID, sessionID)
+}
+
+func (m *mockUserService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error) {
+	return m.revokeOtherSessions(ctx, userID, currentSessionID)
+}
+
+func (m *mockUserService) UnlockAccount(ctx context.Context, adminID, userID uuid.UUID) error {
+	return m.unlockAccount(ctx, adminID, userID)
+}
+
 func TestUserHandler_Register_Unit(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -73,6 +181,26 @@ func TestUserHandler_Register_Unit(t *testing.T) {
 			mockReturn:     domain.ErrUserAlreadyExists,
 			expectedStatus: http.StatusConflict,
 		},
+		{
+			name: "Code verification mode",
+			payload: map[string]string{
+				"email":             "app@gmail.com",
+				"password":          "password123",
+				"verification_mode": "code",
+			},
+			mockReturn:     nil,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "Unknown verification mode",
+			payload: map[string]string{
+				"email":             "app@gmail.com",
+				"password":          "password123",
+				"verification_mode": "sms",
+			},
+			mockReturn:     nil,
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "Invalid JSON Payload",
 			payload:        "not-a-json",
@@ -85,7 +213,7 @@ func TestUserHandler_Register_Unit(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// 1. Setup Mock
 			mockSvc := &mockUserService{
-				registerFn: func(ctx context.Context, email, password string) error {
+				registerFn: func(ctx context.Context, email, password, mode string) error {
 					return tt.mockReturn
 				},
 			}
@@ -112,3 +240,840 @@ func TestUserHandler_Register_Unit(t *testing.T) {
 		})
 	}
 }
+
+func TestUserHandler_VerifyEmailCode_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		mockReturn     error
+		expectedStatus int
+	}{
+		{"Correct code", map[string]string{"email": "app@gmail.com", "code": "123456"}, nil, http.StatusOK},
+		{"Code is not 6 digits", map[string]string{"email": "app@gmail.com", "code": "12345a"}, nil, http.StatusBadRequest},
+		{"Wrong code", map[string]string{"email": "app@gmail.com", "code": "123456"}, domain.ErrInvalidVerificationCode, http.StatusBadRequest},
+		{"Locked code", map[string]string{"email": "app@gmail.com", "code": "123456"}, domain.ErrVerificationCodeLocked, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				verifyEmailCode: func(ctx context.Context, email, code string) error {
+					return tt.mockReturn
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/register/verify-code", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			handler.VerifyEmailCode(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_RefreshSession_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		cookie         *http.Cookie
+		mockReturn     error
+		expectedStatus int
+		expectCleared  bool
+	}{
+		{
+			name:           "Missing refresh cookie",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Successful refresh",
+			cookie:         &http.Cookie{Name: "refresh_token", Value: "token"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Reused refresh token",
+			cookie:         &http.Cookie{Name: "refresh_token", Value: "token"},
+			mockReturn:     domain.ErrRefreshTokenReused,
+			expectedStatus: http.StatusUnauthorized,
+			expectCleared:  true,
+		},
+		{
+			name:           "Refresh from an unrecognized client",
+			cookie:         &http.Cookie{Name: "refresh_token", Value: "token"},
+			mockReturn:     domain.ErrSessionAnomaly,
+			expectedStatus: http.StatusUnauthorized,
+			expectCleared:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				refreshSession: func(ctx context.Context, refreshToken, ipAddress, userAgent string) (*ports.LoginResponse, error) {
+					if tt.mockReturn != nil {
+						return nil, tt.mockReturn
+					}
+					return &ports.LoginResponse{RefreshToken: "new", AccessToken: "jwt"}, nil
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/auth/refresh", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+
+			handler.RefreshSession(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			cleared := false
+			for _, c := range w.Result().Cookies() {
+				if c.Name == "refresh_token" && c.MaxAge < 0 {
+					cleared = true
+				}
+			}
+			if cleared != tt.expectCleared {
+				t.Errorf("expected refresh cookie cleared = %v, got %v", tt.expectCleared, cleared)
+			}
+		})
+	}
+}
+
+func TestUserHandler_ResetPassword_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        interface{}
+		mockReturn     error
+		expectedStatus int
+	}{
+		{
+			name:           "Successful reset",
+			payload:        map[string]string{"token": "reset-token", "password": "new-password"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Password too short",
+			payload:        map[string]string{"token": "reset-token", "password": "short"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid token",
+			payload:        map[string]string{"token": "bogus", "password": "new-password"},
+			mockReturn:     domain.ErrInvalidResetToken,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Token already used",
+			payload:        map[string]string{"token": "reset-token", "password": "new-password"},
+			mockReturn:     domain.ErrUsedToken,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				resetPassword: func(ctx context.Context, token, newPassword string) error {
+					return tt.mockReturn
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/password/reset", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			handler.ResetPassword(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && len(rr.Result().Cookies()) != 2 {
+				t.Errorf("expected the token cookies to be cleared")
+			}
+		})
+	}
+}
+
+func TestUserHandler_ForgotPassword_Unit(t *testing.T) {
+	called := false
+	mockSvc := &mockUserService{
+		forgotPassword: func(ctx context.Context, email string) error {
+			called = true
+			return nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	body, _ := json.Marshal(map[string]string{"email": "someone@gmail.com"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/password/forgot", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.ForgotPassword(rr, req)
+
+	if rr.Code != http.StatusAccepted || !called {
+		t.Errorf("expected 202 and a service call, got %d (called=%v)", rr.Code, called)
+	}
+}
+
+func TestUserHandler_ChangePassword_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		payload        map[string]interface{}
+		mockReturn     error
+		wantKeep       uuid.UUID
+		expectedStatus int
+		wantCleared    bool
+	}{
+		{
+			name:           "Revokes every session",
+			payload:        map[string]interface{}{"current_password": "old-password", "new_password": "new-password"},
+			wantKeep:       uuid.Nil,
+			expectedStatus: http.StatusOK,
+			wantCleared:    true,
+		},
+		{
+			name:           "Keeps the current session",
+			payload:        map[string]interface{}{"current_password": "old-password", "new_password": "new-password", "keep_current_session": true},
+			wantKeep:       principal.SessionID,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "New password fails registration rules",
+			payload:        map[string]interface{}{"current_password": "old-password", "new_password": "short"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Wrong current password",
+			payload:        map[string]interface{}{"current_password": "wrong", "new_password": "new-password"},
+			mockReturn:     domain.ErrIncorrectPassword,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				changePassword: func(ctx context.Context, userID uuid.UUID, current, newPassword string, keep uuid.UUID) error {
+					if userID != principal.UserID || keep != tt.wantKeep {
+						t.Errorf("unexpected call: user=%s keep=%s", userID, keep)
+					}
+					return tt.mockReturn
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/account/password", bytes.NewBuffer(body))
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+			rr := httptest.NewRecorder()
+
+			handler.ChangePassword(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if cleared := len(rr.Result().Cookies()) == 2; cleared != tt.wantCleared {
+				t.Errorf("cookies cleared = %v, want %v", cleared, tt.wantCleared)
+			}
+		})
+	}
+
+	t.Run("Requires authentication", func(t *testing.T) {
+		handler := NewUserHandler(&mockUserService{}, &testutil.NoopLogger{})
+		req := httptest.NewRequest(http.MethodPost, "/v1/account/password", bytes.NewBufferString(`{}`))
+		rr := httptest.NewRecorder()
+
+		handler.ChangePassword(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rr.Code)
+		}
+	})
+}
+
+func TestUserHandler_ListSessions_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+	mockSvc := &mockUserService{
+		listSessions: func(ctx context.Context, userID, currentSessionID uuid.UUID) ([]ports.SessionInfo, error) {
+			if userID != principal.UserID || currentSessionID != principal.SessionID {
+				t.Errorf("unexpected call: user=%s session=%s", userID, currentSessionID)
+			}
+			return []ports.SessionInfo{
+				{ID: principal.SessionID, Device: "Chrome on macOS", IPAddress: "198.51.100.1", Current: true},
+				{ID: uuid.New(), Device: "Safari on iPhone", IPAddress: "198.51.100.2"},
+			}, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/account/sessions", nil)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+	rr := httptest.NewRecorder()
+
+	handler.ListSessions(rr, req)
+
+	var res struct {
+		Sessions []SessionResponse `json:"sessions"`
+	}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || len(res.Sessions) != 2 {
+		t.Fatalf("unexpected response %d: %+v", rr.Code, res)
+	}
+	if !res.Sessions[0].Current || res.Sessions[0].Device != "Chrome on macOS" || res.Sessions[1].Current {
+		t.Errorf("unexpected sessions: %+v", res.Sessions)
+	}
+}
+
+func TestUserHandler_RevokeSession_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+	other := uuid.New()
+
+	tests := []struct {
+		name           string
+		id             string
+		mockErr        error
+		expectedStatus int
+		wantCleared    bool
+	}{
+		{"Revokes another device", other.String(), nil, http.StatusOK, false},
+		{"Revoking the current session logs out", principal.SessionID.String(), nil, http.StatusOK, true},
+		{"Session of someone else", other.String(), domain.ErrSessionNotFound, http.StatusNotFound, false},
+		{"Invalid session id", "not-a-uuid", nil, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				revokeSession: func(ctx context.Context, userID, sessionID uuid.UUID) error {
+					if userID != principal.UserID || sessionID.String() != tt.id {
+						t.Errorf("unexpected call: user=%s session=%s", userID, sessionID)
+					}
+					return tt.mockErr
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodDelete, "/v1/account/sessions/"+tt.id, nil)
+			req.SetPathValue("id", tt.id)
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+			rr := httptest.NewRecorder()
+
+			handler.RevokeSession(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if cleared := len(rr.Result().Cookies()) == 2; cleared != tt.wantCleared {
+				t.Errorf("cookies cleared = %v, want %v", cleared, tt.wantCleared)
+			}
+		})
+	}
+}
+
+func TestUserHandler_RevokeOtherSessions_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+	mockSvc := &mockUserService{
+		revokeOtherSessions: func(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error) {
+			if userID != principal.UserID || currentSessionID != principal.SessionID {
+				t.Errorf("unexpected call: user=%s session=%s", userID, currentSessionID)
+			}
+			return 3, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/account/sessions/revoke-others", nil)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+	rr := httptest.NewRecorder()
+
+	handler.RevokeOtherSessions(rr, req)
+
+	var res map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res["revoked"] != float64(3) {
+		t.Errorf("unexpected response %d: %v", rr.Code, res)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("expected the current session to stay signed in")
+	}
+}
+
+func TestUserHandler_ListActivity_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		query          string
+		mockErr        error
+		expectedStatus int
+		wantLimit      int
+	}{
+		{"First page", "", nil, http.StatusOK, 0},
+		{"Explicit limit and cursor", "?limit=5&cursor=abc", nil, http.StatusOK, 5},
+		{"Invalid limit", "?limit=zero", nil, http.StatusBadRequest, 0},
+		{"Negative limit", "?limit=-1", nil, http.StatusBadRequest, 0},
+		{"Invalid cursor", "?cursor=abc", domain.ErrInvalidActivityCursor, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				listActivity: func(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ports.ActivityPage, error) {
+					if userID != principal.UserID || limit != tt.wantLimit {
+						t.Errorf("unexpected call: user=%s limit=%d", userID, limit)
+					}
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					return &ports.ActivityPage{
+						Events: []ports.ActivityEvent{
+							{ID: uuid.New(), SessionID: principal.SessionID, EventType: "LOGIN", NewValue: "ip=198.51.100.1"},
+							{ID: uuid.New(), EventType: "ACCOUNT_UNLOCKED"},
+						},
+						NextCursor: "next",
+					}, nil
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/account/activity"+tt.query, nil)
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+			rr := httptest.NewRecorder()
+
+			handler.ListActivity(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var res ActivityResponse
+			json.NewDecoder(rr.Body).Decode(&res)
+			if len(res.Events) != 2 || res.NextCursor != "next" {
+				t.Fatalf("unexpected response: %+v", res)
+			}
+			if res.Events[0].SessionID == nil || *res.Events[0].SessionID != principal.SessionID || res.Events[1].SessionID != nil {
+				t.Errorf("unexpected session IDs: %+v", res.Events)
+			}
+		})
+	}
+}
+
+func TestUserHandler_Login_MFAChallenge_Unit(t *testing.T) {
+	mockSvc := &mockUserService{
+		login: func(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error) {
+			return &ports.LoginResponse{MFAChallenge: "challenge-token", MFAChallengeExpiresAt: time.Now().Add(5 * time.Minute)}, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	body, _ := json.Marshal(map[string]string{"email": "user@gmail.com", "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.Login(rr, req)
+
+	var res map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res["mfa_required"] != true || res["challenge"] != "challenge-token" {
+		t.Errorf("unexpected response %d: %v", rr.Code, res)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("expected no session cookies before the second factor")
+	}
+}
+
+func TestUserHandler_Login_SessionClient_Unit(t *testing.T) {
+	var got *ports.LoginRequest
+	mockSvc := &mockUserService{
+		login: func(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error) {
+			got = req
+			return &ports.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	body, _ := json.Marshal(map[string]string{"email": "user@gmail.com", "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/login", bytes.NewBuffer(body))
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0")
+	req = req.WithContext(middleware.WithClientIP(req.Context(), "198.51.100.1"))
+	rr := httptest.NewRecorder()
+
+	handler.Login(rr, req)
+
+	if got == nil || got.IPAddress != "198.51.100.1" || got.UserAgent != req.UserAgent() || got.Device != "Firefox on Linux" {
+		t.Errorf("expected the client of the request on the session, got %+v", got)
+	}
+}
+
+func TestUserHandler_Login_Throttled_Unit(t *testing.T) {
+	mockSvc := &mockUserService{
+		login: func(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error) {
+			return nil, &domain.RetryAfterError{Err: domain.ErrLoginThrottled, RetryAfter: 1500 * time.Millisecond}
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	body, _ := json.Marshal(map[string]string{"email": "user@gmail.com", "password": "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/v1/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.Login(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After rounded up to 2, got %q", got)
+	}
+}
+
+func TestUserHandler_UnlockAccount_Unit(t *testing.T) {
+	admin := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New(), Roles: []string{"admin"}}
+	target := uuid.New()
+
+	tests := []struct {
+		name           string
+		id             string
+		mockErr        error
+		expectedStatus int
+	}{
+		{"Unlocks the account", target.String(), nil, http.StatusOK},
+		{"Invalid user id", "not-a-uuid", nil, http.StatusBadRequest},
+		{"Unknown user", target.String(), domain.ErrUserNotFound, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				unlockAccount: func(ctx context.Context, adminID, userID uuid.UUID) error {
+					if adminID != admin.UserID || userID != target {
+						t.Errorf("unexpected call: admin=%s user=%s", adminID, userID)
+					}
+					return tt.mockErr
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/users/"+tt.id+"/unlock", nil)
+			req.SetPathValue("id", tt.id)
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), admin))
+			rr := httptest.NewRecorder()
+
+			handler.UnlockAccount(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserHandler_LoginMFA_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		mockErr        error
+		expectedStatus int
+	}{
+		{"Valid code", map[string]string{"challenge": "c", "code": "123456"}, nil, http.StatusOK},
+		{"Code is not 6 digits", map[string]string{"challenge": "c", "code": "12ab56"}, nil, http.StatusBadRequest},
+		{"Wrong code", map[string]string{"challenge": "c", "code": "123456"}, domain.ErrInvalidMFACode, http.StatusUnauthorized},
+		{"Replayed code", map[string]string{"challenge": "c", "code": "123456"}, domain.ErrMFACodeReused, http.StatusUnauthorized},
+		{"Expired challenge", map[string]string{"challenge": "c", "code": "123456"}, domain.ErrMFAChallengeExpired, http.StatusUnauthorized},
+		{"Valid recovery code", map[string]string{"challenge": "c", "recovery_code": "abcde-fghij"}, nil, http.StatusOK},
+		{"Neither code given", map[string]string{"challenge": "c"}, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				loginWithMFA: func(ctx context.Context, req *ports.MFALoginRequest) (*ports.LoginResponse, error) {
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					return &ports.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/login/mfa", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			handler.LoginMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && len(rr.Result().Cookies()) != 2 {
+				t.Error("expected the session cookies to be set")
+			}
+		})
+	}
+}
+
+func TestUserHandler_RequestMagicLink_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        map[string]string
+		expectedStatus int
+	}{
+		{"Valid email", map[string]string{"email": "someone@gmail.com"}, http.StatusAccepted},
+		{"Invalid email", map[string]string{"email": "someone"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				requestMagicLink: func(ctx context.Context, email string) error { return nil },
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/login/magic-link", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			handler.RequestMagicLink(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestUserHandler_ConfirmMagicLink_Unit(t *testing.T) {
+	mockSvc := &mockUserService{
+		loginWithMagicLink: func(ctx context.Context, req *ports.MagicLinkLoginRequest) (*ports.LoginResponse, error) {
+			t.Error("opening the link must not spend the token")
+			return nil, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	t.Run("Renders a form posting the token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/login/magic-link/consume?token=raw%22%3E", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ConfirmMagicLink(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, `method="post" action="/v1/login/magic-link/consume"`) {
+			t.Errorf("expected a form posting back to the link, got %s", body)
+		}
+		if !strings.Contains(body, `value="raw&#34;&gt;"`) {
+			t.Errorf("expected the token to be escaped into the form, got %s", body)
+		}
+		if rr.Header().Get("Referrer-Policy") != "no-referrer" {
+			t.Error("expected the token to be kept out of Referer headers")
+		}
+		if len(rr.Result().Cookies()) != 0 {
+			t.Error("expected no session cookies")
+		}
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ConfirmMagicLink(rr, httptest.NewRequest(http.MethodGet, "/v1/login/magic-link/consume", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestUserHandler_ConsumeMagicLink_Unit(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		mockRes        *ports.LoginResponse
+		mockErr        error
+		expectedStatus int
+		expectCookies  bool
+	}{
+		{"Missing token", "application/x-www-form-urlencoded", "", nil, nil, http.StatusBadRequest, false},
+		{"Valid link from the form", "application/x-www-form-urlencoded", "token=raw", &ports.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil, http.StatusOK, true},
+		{"Valid link as JSON", "application/json", `{"token":"raw"}`, &ports.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil, http.StatusOK, true},
+		{"MFA challenge", "application/x-www-form-urlencoded", "token=raw", &ports.LoginResponse{MFAChallenge: "challenge-token"}, nil, http.StatusOK, false},
+		{"Invalid link", "application/x-www-form-urlencoded", "token=raw", nil, domain.ErrInvalidMagicLink, http.StatusUnauthorized, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				loginWithMagicLink: func(ctx context.Context, req *ports.MagicLinkLoginRequest) (*ports.LoginResponse, error) {
+					if req.Token != "raw" {
+						t.Errorf("unexpected token %q", req.Token)
+					}
+					return tt.mockRes, tt.mockErr
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/login/magic-link/consume", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+
+			handler.ConsumeMagicLink(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if got := len(rr.Result().Cookies()) == 2; got != tt.expectCookies {
+				t.Errorf("session cookies set = %v, want %v", got, tt.expectCookies)
+			}
+		})
+	}
+}
+
+func TestUserHandler_RegenerateRecoveryCodes_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+
+	tests := []struct {
+		name           string
+		mockErr        error
+		expectedStatus int
+	}{
+		{"Success", nil, http.StatusOK},
+		{"MFA not enabled", domain.ErrMFANotEnabled, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				regenerateRecoveryCodes: func(ctx context.Context, userID uuid.UUID) ([]string, error) {
+					if userID != principal.UserID {
+						t.Errorf("expected user %s, got %s", principal.UserID, userID)
+					}
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					return []string{"abcde-fghij"}, nil
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/account/mfa/recovery-codes", nil)
+			req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+			rr := httptest.NewRecorder()
+
+			handler.RegenerateRecoveryCodes(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && rr.Header().Get("Cache-Control") != "no-store" {
+				t.Error("expected recovery codes to be served with Cache-Control: no-store")
+			}
+		})
+	}
+}
+
+func TestUserHandler_BeginPasskeyRegistration_Unit(t *testing.T) {
+	principal := &middleware.Principal{UserID: uuid.New(), SessionID: uuid.New()}
+	mockSvc := &mockUserService{
+		beginPasskeyRegistration: func(ctx context.Context, userID uuid.UUID) (*ports.PasskeyCreationOptions, error) {
+			return &ports.PasskeyCreationOptions{
+				Challenge:            []byte{0xfb, 0xff},
+				RPID:                 "localhost",
+				RPName:               "golang-auth",
+				UserHandle:           userID[:],
+				UserName:             "user@gmail.com",
+				Algorithms:           []int64{-7},
+				ExcludeCredentialIDs: [][]byte{{0x01}},
+				Timeout:              time.Minute,
+			}, nil
+		},
+	}
+	handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/account/passkeys/register/begin", nil)
+	req = req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+	rr := httptest.NewRecorder()
+
+	handler.BeginPasskeyRegistration(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var res struct {
+		PublicKey PasskeyCreationOptionsResponse `json:"publicKey"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	options := res.PublicKey
+	if options.Challenge != "-_8" || options.Timeout != 60000 || options.AuthenticatorSelection.UserVerification != "required" {
+		t.Errorf("unexpected options %+v", options)
+	}
+	if len(options.ExcludeCredentials) != 1 || options.ExcludeCredentials[0].ID != "AQ" {
+		t.Errorf("expected the credential to be excluded base64url encoded, got %+v", options.ExcludeCredentials)
+	}
+}
+
+func TestUserHandler_FinishPasskeyLogin_Unit(t *testing.T) {
+	validResponse := map[string]string{
+		"clientDataJSON":    "e30",
+		"authenticatorData": "AAAA",
+		"signature":         "AQID",
+		"userHandle":        "",
+	}
+	tests := []struct {
+		name           string
+		payload        map[string]interface{}
+		mockErr        error
+		expectedStatus int
+	}{
+		{"Valid assertion", map[string]interface{}{"rawId": "AQ", "type": "public-key", "response": validResponse}, nil, http.StatusOK},
+		{"Padded base64url is accepted", map[string]interface{}{"rawId": "AQ==", "type": "public-key", "response": validResponse}, nil, http.StatusOK},
+		{"Not base64url", map[string]interface{}{"rawId": "A+Q/", "type": "public-key", "response": validResponse}, nil, http.StatusBadRequest},
+		{"Wrong credential type", map[string]interface{}{"rawId": "AQ", "type": "password", "response": validResponse}, nil, http.StatusBadRequest},
+		{"Invalid assertion", map[string]interface{}{"rawId": "AQ", "type": "public-key", "response": validResponse}, domain.ErrInvalidPasskeyAssertion, http.StatusUnauthorized},
+		{"Cloned passkey", map[string]interface{}{"rawId": "AQ", "type": "public-key", "response": validResponse}, domain.ErrPasskeyCloned, http.StatusUnauthorized},
+		{"Expired challenge", map[string]interface{}{"rawId": "AQ", "type": "public-key", "response": validResponse}, domain.ErrInvalidPasskeyChallenge, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockUserService{
+				finishPasskeyLogin: func(ctx context.Context, req *ports.PasskeyLoginRequest) (*ports.LoginResponse, error) {
+					if tt.mockErr != nil {
+						return nil, tt.mockErr
+					}
+					if !bytes.Equal(req.CredentialID, []byte{0x01}) || !bytes.Equal(req.Signature, []byte{1, 2, 3}) {
+						t.Errorf("unexpected decoded request %+v", req)
+					}
+					return &ports.LoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil
+				},
+			}
+			handler := NewUserHandler(mockSvc, &testutil.NoopLogger{})
+
+			body, _ := json.Marshal(tt.payload)
+			req := httptest.NewRequest(http.MethodPost, "/v1/login/passkey/finish", bytes.NewBuffer(body))
+			rr := httptest.NewRecorder()
+
+			handler.FinishPasskeyLogin(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && len(rr.Result().Cookies()) != 2 {
+				t.Error("expected the session cookies to be set")
+			}
+		})
+	}
+}
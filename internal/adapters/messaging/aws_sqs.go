@@ -2,49 +2,192 @@ package messaging
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
 	"github.com/golang-auth/internal/core/ports"
 )
 
+// SQS takes at most ten messages per SendMessageBatch call
+const maxBatchSize = 10
+
+// Error codes of SQS that blame the message itself. Anything else, e.g.
+// throttling, an outage, expired credentials or a missing queue, is fixed by
+// waiting or by an operator, so the event is kept for a retry.
+var rejectedMessageCodes = map[string]bool{
+	"InvalidMessageContents": true,
+	"InvalidAttributeName":   true,
+	"InvalidAttributeValue":  true,
+	"InvalidParameterValue":  true,
+}
+
 type SQSAdapter struct {
 	client   *sqs.Client
 	queueURL string
+	fifo     bool
 	logger   ports.Logger
 }
 
+// NewSQSClient builds an SQS client from the default AWS credential chain,
+// pointed at cfg.Endpoint when one is set.
+func NewSQSClient(ctx context.Context, cfg *config.AWSConfig) (*sqs.Client, error) {
+	sdkConfig, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS SDK config: %w", err)
+	}
+	return sqs.NewFromConfig(sdkConfig, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	}), nil
+}
+
+// NewSQSAdapter publishes to queueURL. A FIFO queue, named "*.fifo", gets a
+// message group per user, so each user's events stay in order, and the event
+// ID as deduplication ID.
 func NewSQSAdapter(client *sqs.Client, queueURL string, logger ports.Logger) ports.EventPublisher {
 	return &SQSAdapter{
 		client:   client,
 		queueURL: queueURL,
+		fifo:     strings.HasSuffix(queueURL, ".fifo"),
 		logger:   logger,
 	}
 }
 
-func (a *SQSAdapter) PublishUserRegistered(ctx context.Context, email string, token string) error {
-	payload := map[string]string{
-		"email": email,
-		"token": token,
-		"event": "user.registered",
+func (a *SQSAdapter) Publish(ctx context.Context, event domainevents.Event) error {
+	msg, err := a.newMessage(event)
+	if err != nil {
+		return err
 	}
 
-	body, err := json.Marshal(payload)
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(a.queueURL),
+		MessageBody:       msg.MessageBody,
+		MessageAttributes: msg.MessageAttributes,
+	}
+	if a.fifo {
+		input.MessageGroupId = msg.MessageGroupId
+		input.MessageDeduplicationId = msg.MessageDeduplicationId
+	}
+	if _, err := a.client.SendMessage(ctx, input); err != nil {
+		return classifySendError(err)
+	}
+	a.logger.Debug(domain.LogMessaging, "Event sent to SQS", "type", event.Type)
+	return nil
+}
+
+// PublishBatch sends events in batches of ten. A batch that fails as a whole
+// fails every event in it; otherwise each event gets its own result.
+func (a *SQSAdapter) PublishBatch(ctx context.Context, events []domainevents.Event) []error {
+	errs := make([]error, len(events))
+	for start := 0; start < len(events); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(events))
+		a.publishBatch(ctx, events[start:end], errs[start:end])
+	}
+	return errs
+}
+
+func (a *SQSAdapter) publishBatch(ctx context.Context, events []domainevents.Event, errs []error) {
+	entries := make([]types.SendMessageBatchRequestEntry, 0, len(events))
+	for i, event := range events {
+		entry, err := a.newMessage(event)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		// Entry IDs only have to be unique within the call
+		entry.Id = aws.String(strconv.Itoa(i))
+		if !a.fifo {
+			entry.MessageGroupId, entry.MessageDeduplicationId = nil, nil
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	out, err := a.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(a.queueURL),
+		Entries:  entries,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal SQS message: %w", err)
+		err = classifySendError(err)
+		for _, entry := range entries {
+			errs[entryIndex(entry.Id)] = err
+		}
+		return
+	}
+	for _, failed := range out.Failed {
+		i := entryIndex(failed.Id)
+		if i < 0 || i >= len(errs) {
+			continue
+		}
+		errs[i] = classifyBatchFailure(failed)
 	}
-	_ = body
-	a.logger.Info("SQS Message: ", token)
-	// _, err = a.client.SendMessage(ctx, &sqs.SendMessageInput{
-	// 	QueueUrl:    aws.String(a.queueURL),
-	// 	MessageBody: aws.String(string(body)),
-	// 	// Optional: Add MessageAttributes for filtering
-	// })
+	a.logger.Debug(domain.LogMessaging, "Event batch sent to SQS", "sent", len(out.Successful), "failed", len(out.Failed))
+}
 
-	// if err != nil {
-	// 	return fmt.Errorf("failed to send message to SQS: %w", err)
-	// }
+// newMessage renders an event as a batch entry; single sends copy its fields.
+func (a *SQSAdapter) newMessage(event domainevents.Event) (types.SendMessageBatchRequestEntry, error) {
+	body, err := encodeEvent(event)
+	if err != nil {
+		return types.SendMessageBatchRequestEntry{}, err
+	}
 
-	return nil
+	return types.SendMessageBatchRequestEntry{
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			headerEventType:    {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+			headerEventVersion: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(event.SchemaVersion))},
+		},
+		// The user ID stays out of the group ID, which shows up in AWS tooling
+		MessageGroupId: aws.String(hashHex(event.UserID.String())),
+		// A redelivered event keeps its ID
+		MessageDeduplicationId: aws.String(event.ID.String()),
+	}, nil
+}
+
+// classifySendError marks a failed call as rejected when SQS blamed the
+// message; the SDK has already retried throttling and server errors.
+func classifySendError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && rejectedMessageCodes[apiErr.ErrorCode()] {
+		return fmt.Errorf("%w: %w", domain.ErrEventRejected, err)
+	}
+	return fmt.Errorf("failed to send message to SQS: %w", err)
+}
+
+// classifyBatchFailure marks a failed entry as rejected when SQS reports it as
+// the sender's fault or with a code that blames the message.
+func classifyBatchFailure(failed types.BatchResultErrorEntry) error {
+	err := fmt.Errorf("SQS refused message: %s: %s", aws.ToString(failed.Code), aws.ToString(failed.Message))
+	if failed.SenderFault || rejectedMessageCodes[aws.ToString(failed.Code)] {
+		return fmt.Errorf("%w: %w", domain.ErrEventRejected, err)
+	}
+	return err
+}
+
+func entryIndex(id *string) int {
+	i, err := strconv.Atoi(aws.ToString(id))
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+func hashHex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,408 @@
+package messaging
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+// sqsMessage is a message as the stand-in received it.
+type sqsMessage struct {
+	Id                     string
+	MessageBody            string
+	MessageAttributes      map[string]struct{ DataType, StringValue string }
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+// sqsStandIn speaks the SendMessage and SendMessageBatch calls of the SQS
+// JSON protocol. Like SQS, a FIFO queue drops a message whose deduplication
+// ID it has already seen.
+type sqsStandIn struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queue    []sqsMessage
+	seen     map[string]bool
+	batches  int
+	failWith string                                          // error code of the next call
+	failure  func(msg sqsMessage) (code string, sender bool) // per entry of a batch
+}
+
+func newSQSStandIn(t *testing.T) *sqsStandIn {
+	s := &sqsStandIn{seen: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sqsStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+
+	if code := s.failWith; code != "" {
+		s.failWith = ""
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#" + code, "message": "stand-in failure"})
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSQS.SendMessage":
+		var msg sqsMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		json.NewEncoder(w).Encode(map[string]string{"MessageId": s.enqueue(msg), "MD5OfMessageBody": md5Hex(msg.MessageBody)})
+	case "AmazonSQS.SendMessageBatch":
+		var in struct{ Entries []sqsMessage }
+		json.NewDecoder(r.Body).Decode(&in)
+		s.batches++
+		out := struct {
+			Successful []map[string]string
+			Failed     []map[string]any
+		}{Successful: []map[string]string{}, Failed: []map[string]any{}}
+		for _, msg := range in.Entries {
+			if s.failure != nil {
+				if code, sender := s.failure(msg); code != "" {
+					out.Failed = append(out.Failed, map[string]any{"Id": msg.Id, "Code": code, "Message": "stand-in failure", "SenderFault": sender})
+					continue
+				}
+			}
+			out.Successful = append(out.Successful, map[string]string{"Id": msg.Id, "MessageId": s.enqueue(msg), "MD5OfMessageBody": md5Hex(msg.MessageBody)})
+		}
+		json.NewEncoder(w).Encode(out)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#UnsupportedOperation"})
+	}
+}
+
+func (s *sqsStandIn) enqueue(msg sqsMessage) string {
+	if id := msg.MessageDeduplicationId; id != "" {
+		if s.seen[id] {
+			return uuid.NewString()
+		}
+		s.seen[id] = true
+	}
+	s.queue = append(s.queue, msg)
+	return uuid.NewString()
+}
+
+func (s *sqsStandIn) messages() []sqsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sqsMessage(nil), s.queue...)
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestSQSAdapter(t *testing.T, standIn *sqsStandIn, queueURL string) *SQSAdapter {
+	t.Helper()
+	return NewSQSAdapter(newTestSQSClient(t, standIn.URL), queueURL, &testutil.NoopLogger{}).(*SQSAdapter)
+}
+
+func newTestSQSClient(t *testing.T, endpoint string) *sqs.Client {
+	t.Helper()
+	// Keep the developer's AWS profile out of the test
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	client, err := NewSQSClient(context.Background(), &config.AWSConfig{Region: "us-east-1", Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("NewSQSClient() error: %v", err)
+	}
+	return client
+}
+
+func TestSQSAdapter(t *testing.T) {
+	ctx := context.Background()
+	const standardQueue = "http://sqs.local/000000000000/auth-events"
+	const fifoQueue = "http://sqs.local/000000000000/auth-events.fifo"
+
+	t.Run("Sends the event with its type and version", func(t *testing.T) {
+		standIn := newSQSStandIn(t)
+		adapter := newTestSQSAdapter(t, standIn, standardQueue)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.VerificationCodeRequested{Email: "user@example.com", Code: "123456"})
+		if err := adapter.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+		messages := standIn.messages()
+		if len(messages) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(messages))
+		}
+		msg := messages[0]
+		var body domainevents.Event
+		if err := json.Unmarshal([]byte(msg.MessageBody), &body); err != nil {
+			t.Fatalf("body is not an event: %v", err)
+		}
+		if body.ID != event.ID || body.UserID != event.UserID || body.Data != event.Data {
+			t.Errorf("unexpected body: %+v", body)
+		}
+		if attr := msg.MessageAttributes["event_type"]; attr.DataType != "String" || attr.StringValue != domainevents.TypeVerificationCodeRequested {
+			t.Errorf("unexpected event_type attribute: %+v", attr)
+		}
+		if attr := msg.MessageAttributes["event_version"]; attr.DataType != "Number" || attr.StringValue != strconv.Itoa(event.SchemaVersion) {
+			t.Errorf("unexpected event_version attribute: %+v", attr)
+		}
+		if msg.MessageGroupId != "" || msg.MessageDeduplicationId != "" {
+			t.Error("a standard queue must not get FIFO IDs")
+		}
+	})
+
+	t.Run("FIFO queue groups by user and drops duplicates", func(t *testing.T) {
+		standIn := newSQSStandIn(t)
+		adapter := newTestSQSAdapter(t, standIn, fifoQueue)
+		userID := uuid.New()
+
+		// A retried publish of the same event
+		reset := domainevents.New(ctx, userID, domainevents.PasswordResetRequested{Email: "user@example.com", Token: "reset-token"})
+		for range 2 {
+			if err := adapter.Publish(ctx, *reset); err != nil {
+				t.Fatalf("Publish() error: %v", err)
+			}
+		}
+		// The same body in another event is not a duplicate
+		for range 2 {
+			magicLink := domainevents.New(ctx, userID, domainevents.MagicLinkRequested{Email: "user@example.com", Token: "magic-token"})
+			if err := adapter.Publish(ctx, *magicLink); err != nil {
+				t.Fatalf("Publish() error: %v", err)
+			}
+		}
+
+		messages := standIn.messages()
+		if len(messages) != 3 {
+			t.Fatalf("expected the duplicate to be dropped, got %d messages", len(messages))
+		}
+		if messages[0].MessageGroupId == "" || messages[0].MessageGroupId != messages[2].MessageGroupId {
+			t.Errorf("expected one group per user, got %q and %q", messages[0].MessageGroupId, messages[2].MessageGroupId)
+		}
+		if strings.Contains(messages[0].MessageGroupId, userID.String()) {
+			t.Error("the group ID must not reveal the user ID")
+		}
+	})
+
+	t.Run("Batches ten events per call", func(t *testing.T) {
+		standIn := newSQSStandIn(t)
+		adapter := newTestSQSAdapter(t, standIn, fifoQueue)
+
+		events := make([]domainevents.Event, 23)
+		for i := range events {
+			events[i] = *domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: fmt.Sprintf("user%d@example.com", i), Token: uuid.NewString()})
+		}
+		for i, err := range adapter.PublishBatch(ctx, events) {
+			if err != nil {
+				t.Errorf("event %d: %v", i, err)
+			}
+		}
+		if standIn.batches != 3 {
+			t.Errorf("expected 3 batch calls, got %d", standIn.batches)
+		}
+		messages := standIn.messages()
+		if len(messages) != len(events) {
+			t.Fatalf("expected %d messages, got %d", len(events), len(messages))
+		}
+		for i, msg := range messages {
+			if !strings.Contains(msg.MessageBody, events[i].Data.(domainevents.UserRegistered).Token) || msg.MessageDeduplicationId != events[i].ID.String() {
+				t.Errorf("message %d out of order or without dedup ID: %+v", i, msg)
+			}
+		}
+	})
+
+	t.Run("Classifies failed entries", func(t *testing.T) {
+		standIn := newSQSStandIn(t)
+		adapter := newTestSQSAdapter(t, standIn, standardQueue)
+		standIn.failure = func(msg sqsMessage) (string, bool) {
+			switch {
+			case strings.Contains(msg.MessageBody, "bad"):
+				return "InvalidMessageContents", true
+			case strings.Contains(msg.MessageBody, "busy"):
+				return "InternalError", false
+			case strings.Contains(msg.MessageBody, "blamed"):
+				return "UnlistedCode", true
+			}
+			return "", false
+		}
+
+		magicLink := func(token string) domainevents.Event {
+			return *domainevents.New(ctx, uuid.New(), domainevents.MagicLinkRequested{Email: "user@example.com", Token: token})
+		}
+		errs := adapter.PublishBatch(ctx, []domainevents.Event{
+			magicLink("good"),
+			magicLink("bad"),
+			magicLink("busy"),
+			{ID: uuid.New(), Type: "user.unknown", UserID: uuid.New()},
+			magicLink("blamed"),
+		})
+		if errs[0] != nil {
+			t.Errorf("good event: %v", errs[0])
+		}
+		if !errors.Is(errs[1], domain.ErrEventRejected) {
+			t.Errorf("invalid contents should be rejected, got %v", errs[1])
+		}
+		if errs[2] == nil || errors.Is(errs[2], domain.ErrEventRejected) {
+			t.Errorf("a server error should be retryable, got %v", errs[2])
+		}
+		if !errors.Is(errs[3], domain.ErrEventRejected) {
+			t.Errorf("unknown event should be rejected, got %v", errs[3])
+		}
+		if !errors.Is(errs[4], domain.ErrEventRejected) {
+			t.Errorf("a sender fault should be rejected whatever the code, got %v", errs[4])
+		}
+		if len(standIn.messages()) != 1 {
+			t.Errorf("expected only the good event to arrive, got %d", len(standIn.messages()))
+		}
+	})
+
+	t.Run("Classifies failed calls", func(t *testing.T) {
+		standIn := newSQSStandIn(t)
+		adapter := newTestSQSAdapter(t, standIn, standardQueue)
+
+		standIn.failWith = "InvalidMessageContents"
+		registered := domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: "user@example.com", Token: "token"})
+		if err := adapter.Publish(ctx, *registered); !errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("invalid contents should be rejected, got %v", err)
+		}
+
+		standIn.failWith = "QueueDoesNotExist"
+		errs := adapter.PublishBatch(ctx, []domainevents.Event{
+			*domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: "a@example.com", Token: "a"}),
+			*domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: "b@example.com", Token: "b"}),
+		})
+		for i, err := range errs {
+			if err == nil || errors.Is(err, domain.ErrEventRejected) {
+				t.Errorf("event %d: a missing queue should be retryable, got %v", i, err)
+			}
+		}
+	})
+}
+
+// TestSQSAdapter_ElasticMQ runs the adapter against a real SQS implementation
+// rather than the stand-in above.
+func TestSQSAdapter_ElasticMQ(t *testing.T) {
+	endpoint := testutil.SetupTestElasticMQ(t)
+	client := newTestSQSClient(t, endpoint)
+	ctx := context.Background()
+
+	createQueue := func(t *testing.T, name string) string {
+		t.Helper()
+		input := &sqs.CreateQueueInput{QueueName: aws.String(name)}
+		if strings.HasSuffix(name, ".fifo") {
+			input.Attributes = map[string]string{"FifoQueue": "true"}
+		}
+		out, err := client.CreateQueue(ctx, input)
+		if err != nil {
+			t.Fatalf("CreateQueue() error: %v", err)
+		}
+		return aws.ToString(out.QueueUrl)
+	}
+	receive := func(t *testing.T, queueURL string, n int) []types.Message {
+		t.Helper()
+		var messages []types.Message
+		for attempt := 0; len(messages) < n && attempt < 10; attempt++ {
+			out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:                    aws.String(queueURL),
+				MaxNumberOfMessages:         10,
+				MessageAttributeNames:       []string{"All"},
+				MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+				WaitTimeSeconds:             1,
+			})
+			if err != nil {
+				t.Fatalf("ReceiveMessage() error: %v", err)
+			}
+			messages = append(messages, out.Messages...)
+		}
+		if len(messages) != n {
+			t.Fatalf("expected %d messages, got %d", n, len(messages))
+		}
+		return messages
+	}
+
+	t.Run("Sends the event with its type and version", func(t *testing.T) {
+		queueURL := createQueue(t, "auth-events")
+		adapter := NewSQSAdapter(client, queueURL, &testutil.NoopLogger{})
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.VerificationCodeRequested{Email: "user@example.com", Code: "123456"})
+		if err := adapter.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+
+		msg := receive(t, queueURL, 1)[0]
+		var body domainevents.Event
+		if err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &body); err != nil {
+			t.Fatalf("body is not an event: %v", err)
+		}
+		if body.ID != event.ID || body.Data != event.Data {
+			t.Errorf("unexpected body: %+v", body)
+		}
+		if attr := msg.MessageAttributes["event_type"]; aws.ToString(attr.StringValue) != domainevents.TypeVerificationCodeRequested {
+			t.Errorf("unexpected event_type attribute: %+v", attr)
+		}
+		if attr := msg.MessageAttributes["event_version"]; aws.ToString(attr.StringValue) != strconv.Itoa(event.SchemaVersion) {
+			t.Errorf("unexpected event_version attribute: %+v", attr)
+		}
+	})
+
+	t.Run("FIFO batches keep order and drop duplicates", func(t *testing.T) {
+		queueURL := createQueue(t, "auth-events.fifo")
+		adapter := NewSQSAdapter(client, queueURL, &testutil.NoopLogger{}).(*SQSAdapter)
+		userID := uuid.New()
+
+		events := make([]domainevents.Event, 12)
+		for i := range events {
+			events[i] = *domainevents.New(ctx, userID, domainevents.MagicLinkRequested{Email: "user@example.com", Token: fmt.Sprintf("token-%02d", i)})
+		}
+		for i, err := range adapter.PublishBatch(ctx, events) {
+			if err != nil {
+				t.Fatalf("event %d: %v", i, err)
+			}
+		}
+		// A relay retrying an event it already sent
+		if err := adapter.Publish(ctx, events[0]); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+
+		messages := receive(t, queueURL, len(events))
+		for i, msg := range messages {
+			if !strings.Contains(aws.ToString(msg.Body), events[i].Data.(domainevents.MagicLinkRequested).Token) {
+				t.Errorf("message %d out of order: %s", i, aws.ToString(msg.Body))
+			}
+			if msg.Attributes["MessageDeduplicationId"] != events[i].ID.String() {
+				t.Errorf("message %d: unexpected deduplication ID %q", i, msg.Attributes["MessageDeduplicationId"])
+			}
+		}
+	})
+
+	t.Run("Missing queue is retryable", func(t *testing.T) {
+		adapter := NewSQSAdapter(client, endpoint+"/000000000000/missing", &testutil.NoopLogger{})
+		event := domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: "user@example.com", Token: "token"})
+		if err := adapter.Publish(ctx, *event); err == nil || errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("a missing queue should be retryable, got %v", err)
+		}
+	})
+}
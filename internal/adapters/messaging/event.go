@@ -0,0 +1,30 @@
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
+
+// Names of the message attributes, or headers, every adapter sets so that
+// consumers can route an event without decoding its body.
+const (
+	headerEventType    = "event_type"
+	headerEventVersion = "event_version"
+	headerEventID      = "event_id"
+)
+
+// encodeEvent renders an event as a message body: the whole event, JSON
+// encoded. The body never goes to the logs, it carries the emailed tokens.
+func encodeEvent(event domainevents.Event) ([]byte, error) {
+	if event.Data == nil || event.Data.EventType() != event.Type {
+		return nil, fmt.Errorf("%w: %q without matching data", domain.ErrEventRejected, event.Type)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return body, nil
+}
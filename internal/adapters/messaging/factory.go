@@ -0,0 +1,40 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// NewEventPublisher builds the publisher of the adapter picked in cfg. The
+// Kafka and NATS publishers hold connections and implement io.Closer.
+func NewEventPublisher(ctx context.Context, cfg *config.MessagingConfig, logger ports.Logger) (ports.EventPublisher, error) {
+	switch cfg.Adapter {
+	case config.MessagingAdapterSQS:
+		client, err := NewSQSClient(ctx, cfg.SQS)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQSAdapter(client, cfg.SQS.QueueURL, logger), nil
+	case config.MessagingAdapterKafka:
+		return NewKafkaAdapter(cfg.Kafka, logger), nil
+	case config.MessagingAdapterNATS:
+		adapter, err := NewNATSAdapter(ctx, cfg.NATS, logger)
+		if err != nil {
+			return nil, err
+		}
+		return adapter, nil
+	case config.MessagingAdapterSMTP:
+		mailer, err := NewSMTPMailer(cfg.SMTP, logger)
+		if err != nil {
+			return nil, err
+		}
+		return mailer, nil
+	case config.MessagingAdapterLog:
+		return NewLogAdapter(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown messaging adapter %q", cfg.Adapter)
+	}
+}
@@ -0,0 +1,154 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/segmentio/kafka-go"
+)
+
+// Room left in a record for its framing on top of the key, value and headers
+const kafkaRecordOverhead = 64
+
+// Error codes of Kafka that blame the record itself. Anything else, e.g. a
+// leader election, an outage or a missing topic, is fixed by waiting or by an
+// operator, so the event is kept for a retry.
+var rejectedKafkaErrors = []error{
+	kafka.InvalidMessage,
+	kafka.InvalidMessageSize,
+	kafka.MessageSizeTooLarge,
+	kafka.RecordListTooLarge,
+	kafka.InvalidRecord,
+}
+
+type KafkaAdapter struct {
+	writer          *kafka.Writer
+	maxMessageBytes int
+	logger          ports.Logger
+}
+
+// NewKafkaAdapter publishes to cfg.Topic, keyed by user ID. The keys are
+// spread with murmur2 like the Java client does, so every producer of the
+// topic puts a user's events on the same partition.
+func NewKafkaAdapter(cfg *config.KafkaConfig, logger ports.Logger) *KafkaAdapter {
+	return &KafkaAdapter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Murmur2Balancer{},
+			RequiredAcks: kafka.RequireAll,
+			// The relay already sends its events in batches
+			BatchTimeout: 10 * time.Millisecond,
+			BatchBytes:   int64(cfg.MaxMessageBytes),
+		},
+		maxMessageBytes: cfg.MaxMessageBytes,
+		logger:          logger,
+	}
+}
+
+func (a *KafkaAdapter) Publish(ctx context.Context, event domainevents.Event) error {
+	msg, err := a.newMessage(event)
+	if err != nil {
+		return err
+	}
+	if err := a.writer.WriteMessages(ctx, msg); err != nil {
+		var writeErrs kafka.WriteErrors
+		if errors.As(err, &writeErrs) && len(writeErrs) == 1 {
+			err = writeErrs[0]
+		}
+		return classifyKafkaError(err)
+	}
+	a.logger.Debug(domain.LogMessaging, "Event sent to Kafka", "type", event.Type)
+	return nil
+}
+
+// PublishBatch writes events in one call. The writer retries on its own and
+// reports per event; an error that isn't per event fails them all.
+func (a *KafkaAdapter) PublishBatch(ctx context.Context, events []domainevents.Event) []error {
+	errs := make([]error, len(events))
+	msgs := make([]kafka.Message, 0, len(events))
+	indexes := make([]int, 0, len(events))
+	for i, event := range events {
+		msg, err := a.newMessage(event)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		msgs = append(msgs, msg)
+		indexes = append(indexes, i)
+	}
+	if len(msgs) == 0 {
+		return errs
+	}
+
+	err := a.writer.WriteMessages(ctx, msgs...)
+	var writeErrs kafka.WriteErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &writeErrs) && len(writeErrs) == len(msgs):
+		for j, writeErr := range writeErrs {
+			if writeErr != nil {
+				errs[indexes[j]] = classifyKafkaError(writeErr)
+			}
+		}
+	default:
+		err = classifyKafkaError(err)
+		for _, i := range indexes {
+			errs[i] = err
+		}
+		return errs
+	}
+	a.logger.Debug(domain.LogMessaging, "Event batch sent to Kafka", "sent", len(msgs)-writeErrs.Count(), "failed", writeErrs.Count())
+	return errs
+}
+
+// Close flushes and closes the writer.
+func (a *KafkaAdapter) Close() error {
+	return a.writer.Close()
+}
+
+func (a *KafkaAdapter) newMessage(event domainevents.Event) (kafka.Message, error) {
+	body, err := encodeEvent(event)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	msg := kafka.Message{
+		Key:   []byte(event.UserID.String()),
+		Value: body,
+		Headers: []kafka.Header{
+			{Key: headerEventType, Value: []byte(event.Type)},
+			{Key: headerEventVersion, Value: []byte(strconv.Itoa(event.SchemaVersion))},
+			{Key: headerEventID, Value: []byte(event.ID.String())},
+		},
+		Time: event.OccurredAt,
+	}
+
+	// The writer fails a whole call on a record over its limit, so the record
+	// is turned away here instead
+	size := kafkaRecordOverhead + len(msg.Key) + len(msg.Value)
+	for _, header := range msg.Headers {
+		size += len(header.Key) + len(header.Value)
+	}
+	if size > a.maxMessageBytes {
+		return kafka.Message{}, fmt.Errorf("%w: %q of %d bytes exceeds the limit of %d", domain.ErrEventRejected, event.Type, size, a.maxMessageBytes)
+	}
+	return msg, nil
+}
+
+// classifyKafkaError marks a failed write as rejected when Kafka blamed the
+// record; the writer has already retried everything else.
+func classifyKafkaError(err error) error {
+	for _, rejected := range rejectedKafkaErrors {
+		if errors.Is(err, rejected) {
+			return fmt.Errorf("%w: %w", domain.ErrEventRejected, err)
+		}
+	}
+	return fmt.Errorf("failed to write message to Kafka: %w", err)
+}
@@ -0,0 +1,181 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+func createKafkaTopic(t *testing.T, brokers []string, topic string, partitions int) {
+	t.Helper()
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		t.Fatalf("failed to dial kafka: %v", err)
+	}
+	defer conn.Close()
+
+	// Topics are created on the controller
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatalf("failed to find kafka controller: %v", err)
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		t.Fatalf("failed to dial kafka controller: %v", err)
+	}
+	defer controllerConn.Close()
+
+	if err := controllerConn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: partitions, ReplicationFactor: 1}); err != nil {
+		t.Fatalf("failed to create topic: %v", err)
+	}
+}
+
+// readKafkaMessages reads the first n messages of the topic, across its
+// partitions.
+func readKafkaMessages(t *testing.T, brokers []string, topic string, n int) []kafka.Message {
+	t.Helper()
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: "test-" + uuid.NewString(),
+		// Start at the beginning of each partition
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     100 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	messages := make([]kafka.Message, 0, n)
+	for len(messages) < n {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			t.Fatalf("read %d of %d messages: %v", len(messages), n, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func kafkaHeader(msg kafka.Message, key string) string {
+	for _, header := range msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaAdapter(t *testing.T) {
+	brokers := testutil.SetupTestKafka(t)
+	ctx := context.Background()
+
+	newAdapter := func(t *testing.T, topic string, partitions int) *KafkaAdapter {
+		t.Helper()
+		createKafkaTopic(t, brokers, topic, partitions)
+		adapter := NewKafkaAdapter(&config.KafkaConfig{Brokers: brokers, Topic: topic, MaxMessageBytes: 1 << 20}, &testutil.NoopLogger{})
+		t.Cleanup(func() { adapter.Close() })
+		return adapter
+	}
+
+	t.Run("Sends the event keyed by user with its headers", func(t *testing.T) {
+		adapter := newAdapter(t, "events-single", 1)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.VerificationCodeRequested{Email: "user@example.com", Code: "123456"})
+		if err := adapter.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+
+		msg := readKafkaMessages(t, brokers, "events-single", 1)[0]
+		if string(msg.Key) != event.UserID.String() {
+			t.Errorf("expected the user ID as key, got %q", msg.Key)
+		}
+		var body domainevents.Event
+		if err := json.Unmarshal(msg.Value, &body); err != nil {
+			t.Fatalf("value is not an event: %v", err)
+		}
+		if body.ID != event.ID || body.Data != event.Data {
+			t.Errorf("unexpected value: %+v", body)
+		}
+		if kafkaHeader(msg, "event_type") != domainevents.TypeVerificationCodeRequested ||
+			kafkaHeader(msg, "event_version") != strconv.Itoa(event.SchemaVersion) ||
+			kafkaHeader(msg, "event_id") != event.ID.String() {
+			t.Errorf("unexpected headers: %+v", msg.Headers)
+		}
+	})
+
+	t.Run("Keeps a user's events on one partition in order", func(t *testing.T) {
+		adapter := newAdapter(t, "events-partitioned", 6)
+
+		users := make([]uuid.UUID, 4)
+		for i := range users {
+			users[i] = uuid.New()
+		}
+		var events []domainevents.Event
+		for round := range 5 {
+			for _, userID := range users {
+				events = append(events, *domainevents.New(ctx, userID, domainevents.UserRegistered{Email: "user@example.com", Token: strconv.Itoa(round)}))
+			}
+		}
+		for i, err := range adapter.PublishBatch(ctx, events) {
+			if err != nil {
+				t.Fatalf("event %d: %v", i, err)
+			}
+		}
+
+		partitions := make(map[string]int)
+		rounds := make(map[string]int)
+		for _, msg := range readKafkaMessages(t, brokers, "events-partitioned", len(events)) {
+			user := string(msg.Key)
+			if partition, ok := partitions[user]; ok && partition != msg.Partition {
+				t.Errorf("user %s spread over partitions %d and %d", user, partition, msg.Partition)
+			}
+			partitions[user] = msg.Partition
+
+			var body domainevents.Event
+			if err := json.Unmarshal(msg.Value, &body); err != nil {
+				t.Fatalf("value is not an event: %v", err)
+			}
+			if token := body.Data.(domainevents.UserRegistered).Token; token != strconv.Itoa(rounds[user]) {
+				t.Errorf("user %s: expected round %d, got %s", user, rounds[user], token)
+			}
+			rounds[user]++
+		}
+		if len(partitions) != len(users) {
+			t.Errorf("expected events of %d users, got %d", len(users), len(partitions))
+		}
+	})
+
+	t.Run("Rejects oversized and unknown events", func(t *testing.T) {
+		createKafkaTopic(t, brokers, "events-small", 1)
+		adapter := NewKafkaAdapter(&config.KafkaConfig{Brokers: brokers, Topic: "events-small", MaxMessageBytes: 1024}, &testutil.NoopLogger{})
+		t.Cleanup(func() { adapter.Close() })
+
+		errs := adapter.PublishBatch(ctx, []domainevents.Event{
+			*domainevents.New(ctx, uuid.New(), domainevents.MagicLinkRequested{Email: "user@example.com", Token: "good"}),
+			*domainevents.New(ctx, uuid.New(), domainevents.MagicLinkRequested{Email: "user@example.com", Token: strings.Repeat("x", 2048)}),
+			{ID: uuid.New(), Type: "user.unknown", UserID: uuid.New()},
+		})
+		if errs[0] != nil {
+			t.Errorf("good event: %v", errs[0])
+		}
+		if !errors.Is(errs[1], domain.ErrEventRejected) {
+			t.Errorf("oversized event should be rejected, got %v", errs[1])
+		}
+		if !errors.Is(errs[2], domain.ErrEventRejected) {
+			t.Errorf("unknown event should be rejected, got %v", errs[2])
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// LogAdapter only writes events to the logs, for running without a broker.
+// The data is left out, it carries the emailed tokens.
+type LogAdapter struct {
+	logger ports.Logger
+}
+
+func NewLogAdapter(logger ports.Logger) *LogAdapter {
+	return &LogAdapter{logger: logger}
+}
+
+func (a *LogAdapter) Publish(ctx context.Context, event domainevents.Event) error {
+	if _, err := encodeEvent(event); err != nil {
+		return err
+	}
+	a.logger.Info(domain.LogMessaging, "Event published",
+		"type", event.Type,
+		"version", event.SchemaVersion,
+		"event_id", event.ID,
+		"user_id", event.UserID,
+		"trace_id", event.TraceID,
+	)
+	return nil
+}
@@ -0,0 +1,204 @@
+package messaging
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
+
+//go:embed templates/mail
+var builtinMailTemplates embed.FS
+
+// Locale whose templates stand in for the ones a locale lacks
+const fallbackLocale = "en"
+
+// Mails the SMTP mailer sends. Each is a <name>.txt.tmpl, which also defines
+// the "subject" template, and a <name>.html.tmpl per locale.
+const (
+	mailVerification    = "verification"
+	mailPasswordReset   = "password_reset"
+	mailMagicLink       = "magic_link"
+	mailPasswordChanged = "password_changed"
+	mailSessionAnomaly  = "session_anomaly"
+	mailAccountDeleted  = "account_deleted"
+)
+
+var mailNames = []string{
+	mailVerification,
+	mailPasswordReset,
+	mailMagicLink,
+	mailPasswordChanged,
+	mailSessionAnomaly,
+	mailAccountDeleted,
+}
+
+// mailData is what the templates get. Data is the payload of the event, for
+// the fields only one mail needs.
+type mailData struct {
+	AppName    string
+	Email      string
+	Link       string
+	Code       string
+	OccurredAt time.Time
+	Data       domainevents.Payload
+}
+
+type mailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+type mailTemplates map[string]mailTemplate
+
+// loadMailTemplates parses every mail of locale. A file is looked up in dir,
+// when set, before the built-in templates, and in the fallback locale when
+// neither has it, so an override only needs the files it changes.
+func loadMailTemplates(dir, locale string) (mailTemplates, error) {
+	builtin, err := fs.Sub(builtinMailTemplates, "templates/mail")
+	if err != nil {
+		return nil, err
+	}
+	sources := []fs.FS{builtin}
+	if dir != "" {
+		sources = []fs.FS{os.DirFS(dir), builtin}
+	}
+	locales := []string{locale}
+	if locale != fallbackLocale {
+		locales = append(locales, fallbackLocale)
+	}
+
+	templates := make(mailTemplates, len(mailNames))
+	for _, name := range mailNames {
+		textSource, err := readMailTemplate(sources, locales, name+".txt.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		text, err := texttemplate.New(name).Parse(textSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s text template: %w", name, err)
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("%s text template defines no subject", name)
+		}
+
+		htmlSource, err := readMailTemplate(sources, locales, name+".html.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		html, err := htmltemplate.New(name).Parse(htmlSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s HTML template: %w", name, err)
+		}
+		templates[name] = mailTemplate{text: text, html: html}
+	}
+	return templates, nil
+}
+
+func readMailTemplate(sources []fs.FS, locales []string, file string) (string, error) {
+	for _, locale := range locales {
+		for _, source := range sources {
+			content, err := fs.ReadFile(source, path.Join(locale, file))
+			if err == nil {
+				return string(content), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("failed to read mail template %s: %w", file, err)
+			}
+		}
+	}
+	return "", fmt.Errorf("mail template %s not found for locale %s", file, strings.Join(locales, " or "))
+}
+
+// render runs the mail's templates, returning its subject and both bodies.
+func (t mailTemplates) render(name string, data mailData) (subject, text, html string, err error) {
+	tmpl, ok := t[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown mail %q", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := tmpl.text.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err := tmpl.html.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render %s HTML: %w", name, err)
+	}
+	return subject, text, buf.String(), nil
+}
+
+// mailHeader is the envelope part of a mail; From and To are formatted
+// addresses.
+type mailHeader struct {
+	From      string
+	To        string
+	Subject   string
+	Date      time.Time
+	MessageID string
+}
+
+// composeMail builds a multipart/alternative message holding both bodies,
+// quoted-printable encoded so that any text passes a 7 bit server.
+func composeMail(header mailHeader, text, html string) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	for _, field := range [][2]string{
+		{"From", header.From},
+		{"To", header.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", header.Subject)},
+		{"Date", header.Date.Format(time.RFC1123Z)},
+		{"Message-ID", header.MessageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()})},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", field[0], field[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
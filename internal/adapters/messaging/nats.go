@@ -0,0 +1,155 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// JetStream refuses a message over the max_msg_size of the stream with this
+// code; the client checks the max_payload of the server by itself.
+const natsErrMessageTooLarge jetstream.ErrorCode = 10054
+
+type NATSAdapter struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	stream        string
+	subjectPrefix string
+	partitions    uint32
+	logger        ports.Logger
+}
+
+// NewNATSAdapter connects to cfg.URL and publishes to cfg.Stream, creating
+// the stream first when cfg.CreateStream is set. The connection keeps
+// reconnecting on its own; publishes fail meanwhile and are retried by the
+// relay.
+func NewNATSAdapter(ctx context.Context, cfg *config.NATSConfig, logger ports.Logger) (*NATSAdapter, error) {
+	conn, err := nats.Connect(cfg.URL, nats.Name("golang-auth"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	if cfg.CreateStream {
+		_, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.SubjectPrefix + ".>"},
+			Storage:  jetstream.FileStorage,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create NATS stream %q: %w", cfg.Stream, err)
+		}
+	}
+
+	return &NATSAdapter{
+		conn:          conn,
+		js:            js,
+		stream:        cfg.Stream,
+		subjectPrefix: cfg.SubjectPrefix,
+		partitions:    uint32(cfg.Partitions),
+		logger:        logger,
+	}, nil
+}
+
+func (a *NATSAdapter) Publish(ctx context.Context, event domainevents.Event) error {
+	msg, err := a.newMessage(event)
+	if err != nil {
+		return err
+	}
+	if _, err := a.js.PublishMsg(ctx, msg, jetstream.WithExpectStream(a.stream)); err != nil {
+		return classifyNATSError(err)
+	}
+	a.logger.Debug(domain.LogMessaging, "Event sent to NATS", "type", event.Type)
+	return nil
+}
+
+// PublishBatch sends every event without waiting, then collects the acks.
+// Events whose ack hasn't come when ctx ends fail with its error.
+func (a *NATSAdapter) PublishBatch(ctx context.Context, events []domainevents.Event) []error {
+	errs := make([]error, len(events))
+	futures := make([]jetstream.PubAckFuture, len(events))
+	for i, event := range events {
+		msg, err := a.newMessage(event)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		futures[i], err = a.js.PublishMsgAsync(msg, jetstream.WithExpectStream(a.stream))
+		if err != nil {
+			errs[i] = classifyNATSError(err)
+		}
+	}
+
+	sent := 0
+	for i, future := range futures {
+		if future == nil {
+			continue
+		}
+		select {
+		case <-future.Ok():
+			sent++
+		case err := <-future.Err():
+			errs[i] = classifyNATSError(err)
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("failed to publish message to NATS: %w", ctx.Err())
+		}
+	}
+	a.logger.Debug(domain.LogMessaging, "Event batch sent to NATS", "sent", sent, "failed", len(events)-sent)
+	return errs
+}
+
+// Close sends what is still buffered and closes the connection.
+func (a *NATSAdapter) Close() error {
+	return a.conn.Drain()
+}
+
+// newMessage addresses an event to the partition of its user. The event ID
+// goes into Nats-Msg-Id, so the stream drops a redelivered event within its
+// duplicate window.
+func (a *NATSAdapter) newMessage(event domainevents.Event) (*nats.Msg, error) {
+	body, err := encodeEvent(event)
+	if err != nil {
+		return nil, err
+	}
+	msg := nats.NewMsg(a.subject(event))
+	msg.Data = body
+	msg.Header.Set(jetstream.MsgIDHeader, event.ID.String())
+	msg.Header.Set(headerEventType, event.Type)
+	msg.Header.Set(headerEventVersion, strconv.Itoa(event.SchemaVersion))
+	msg.Header.Set(headerEventID, event.ID.String())
+	return msg, nil
+}
+
+// subject is "<prefix>.<partition>.<event type>". The partition is an FNV-1a
+// hash of the user ID, so it stays put as long as the partition count does.
+func (a *NATSAdapter) subject(event domainevents.Event) string {
+	h := fnv.New32a()
+	h.Write([]byte(event.UserID.String()))
+	partition := h.Sum32() % a.partitions
+	return a.subjectPrefix + "." + strconv.FormatUint(uint64(partition), 10) + "." + event.Type
+}
+
+// classifyNATSError marks a failed publish as rejected when it's down to the
+// message; no responders, timeouts and a missing stream are all retried.
+func classifyNATSError(err error) error {
+	var apiErr *jetstream.APIError
+	if errors.Is(err, nats.ErrMaxPayload) || errors.Is(err, nats.ErrBadSubject) ||
+		errors.As(err, &apiErr) && apiErr.ErrorCode == natsErrMessageTooLarge {
+		return fmt.Errorf("%w: %w", domain.ErrEventRejected, err)
+	}
+	return fmt.Errorf("failed to publish message to NATS: %w", err)
+}
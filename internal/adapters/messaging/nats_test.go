@@ -0,0 +1,134 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// fetchNATSMessages reads the first n messages of the stream in order.
+func fetchNATSMessages(t *testing.T, js jetstream.JetStream, stream string, n int) []jetstream.Msg {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	consumer, err := js.OrderedConsumer(ctx, stream, jetstream.OrderedConsumerConfig{})
+	if err != nil {
+		t.Fatalf("failed to create consumer: %v", err)
+	}
+	batch, err := consumer.Fetch(n, jetstream.FetchMaxWait(5*time.Second))
+	if err != nil {
+		t.Fatalf("failed to fetch messages: %v", err)
+	}
+	var messages []jetstream.Msg
+	for msg := range batch.Messages() {
+		messages = append(messages, msg)
+	}
+	if len(messages) != n {
+		t.Fatalf("expected %d messages, got %d", n, len(messages))
+	}
+	return messages
+}
+
+func TestNATSAdapter(t *testing.T) {
+	url := testutil.SetupTestNATS(t)
+	ctx := context.Background()
+
+	newAdapter := func(t *testing.T, stream string, partitions int) *NATSAdapter {
+		t.Helper()
+		adapter, err := NewNATSAdapter(ctx, &config.NATSConfig{
+			URL:           url,
+			Stream:        stream,
+			SubjectPrefix: "auth." + stream,
+			Partitions:    partitions,
+			CreateStream:  true,
+		}, &testutil.NoopLogger{})
+		if err != nil {
+			t.Fatalf("NewNATSAdapter() error: %v", err)
+		}
+		t.Cleanup(func() { adapter.Close() })
+		return adapter
+	}
+
+	t.Run("Sends the event to the user's partition with its headers", func(t *testing.T) {
+		adapter := newAdapter(t, "SINGLE", 4)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.VerificationCodeRequested{Email: "user@example.com", Code: "123456"})
+		if err := adapter.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+
+		msg := fetchNATSMessages(t, adapter.js, "SINGLE", 1)[0]
+		if msg.Subject() != adapter.subject(*event) {
+			t.Errorf("unexpected subject %q", msg.Subject())
+		}
+		var body domainevents.Event
+		if err := json.Unmarshal(msg.Data(), &body); err != nil {
+			t.Fatalf("data is not an event: %v", err)
+		}
+		if body.ID != event.ID || body.Data != event.Data {
+			t.Errorf("unexpected data: %+v", body)
+		}
+		headers := msg.Headers()
+		if headers.Get("event_type") != domainevents.TypeVerificationCodeRequested ||
+			headers.Get("event_version") != strconv.Itoa(event.SchemaVersion) ||
+			headers.Get(jetstream.MsgIDHeader) != event.ID.String() {
+			t.Errorf("unexpected headers: %+v", headers)
+		}
+	})
+
+	t.Run("Keeps a user on one partition and drops redeliveries", func(t *testing.T) {
+		adapter := newAdapter(t, "PARTITIONED", 4)
+		userID := uuid.New()
+
+		registered := domainevents.New(ctx, userID, domainevents.UserRegistered{Email: "user@example.com", Token: "token"})
+		verified := domainevents.New(ctx, userID, domainevents.UserVerified{Method: "link"})
+		// The relay resends the first event after a lost ack
+		for i, err := range adapter.PublishBatch(ctx, []domainevents.Event{*registered, *verified, *registered}) {
+			if err != nil {
+				t.Fatalf("event %d: %v", i, err)
+			}
+		}
+
+		messages := fetchNATSMessages(t, adapter.js, "PARTITIONED", 2)
+		partition := func(subject string) string {
+			return subject[len("auth.PARTITIONED."):][:1]
+		}
+		if partition(messages[0].Subject()) != partition(messages[1].Subject()) {
+			t.Errorf("user spread over %q and %q", messages[0].Subject(), messages[1].Subject())
+		}
+		if messages[0].Headers().Get("event_id") != registered.ID.String() || messages[1].Headers().Get("event_id") != verified.ID.String() {
+			t.Error("expected the events in order without the duplicate")
+		}
+	})
+
+	t.Run("Rejects unknown events", func(t *testing.T) {
+		adapter := newAdapter(t, "UNKNOWN", 1)
+		err := adapter.Publish(ctx, domainevents.Event{ID: uuid.New(), Type: "user.unknown", UserID: uuid.New()})
+		if !errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("unknown event should be rejected, got %v", err)
+		}
+	})
+
+	t.Run("A missing stream is retryable", func(t *testing.T) {
+		adapter, err := NewNATSAdapter(ctx, &config.NATSConfig{URL: url, Stream: "MISSING", SubjectPrefix: "auth.missing", Partitions: 1}, &testutil.NoopLogger{})
+		if err != nil {
+			t.Fatalf("NewNATSAdapter() error: %v", err)
+		}
+		t.Cleanup(func() { adapter.Close() })
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.AccountDeleted{Email: "user@example.com"})
+		if err := adapter.Publish(ctx, *event); err == nil || errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("expected a retryable error, got %v", err)
+		}
+	})
+}
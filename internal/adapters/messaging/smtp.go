@@ -0,0 +1,283 @@
+package messaging
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// SMTPMailer delivers the events a user has to see as mails: verification,
+// password reset and magic links, and the security alerts. Other events have
+// no mail and count as sent.
+//
+// The mailer keeps no queue of its own: an event stays in the outbox until
+// its mail is accepted, so a server that is down, throttling or answering
+// with a 4xx code gets the event again with the relay's backoff. A 5xx
+// answer to the recipient or the message is final and dead-letters the
+// event.
+type SMTPMailer struct {
+	cfg       *config.SMTPConfig
+	from      *mail.Address
+	templates mailTemplates
+	logger    ports.Logger
+}
+
+// NewSMTPMailer loads the templates of cfg.Locale up front, so that a broken
+// template stops the service from starting rather than every mail.
+func NewSMTPMailer(cfg *config.SMTPConfig, logger ports.Logger) (*SMTPMailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP from address %q: %w", cfg.From, err)
+	}
+	templates, err := loadMailTemplates(cfg.TemplateDir, cfg.Locale)
+	if err != nil {
+		return nil, err
+	}
+	return &SMTPMailer{cfg: cfg, from: from, templates: templates, logger: logger}, nil
+}
+
+// outgoingMail is a rendered mail and the index of its event.
+type outgoingMail struct {
+	index int
+	to    string
+	msg   []byte
+}
+
+func (m *SMTPMailer) Publish(ctx context.Context, event domainevents.Event) error {
+	return m.PublishBatch(ctx, []domainevents.Event{event})[0]
+}
+
+// PublishBatch sends the mails of events over one connection.
+func (m *SMTPMailer) PublishBatch(ctx context.Context, events []domainevents.Event) []error {
+	errs := make([]error, len(events))
+	var mails []outgoingMail
+	for i, event := range events {
+		if _, err := encodeEvent(event); err != nil {
+			errs[i] = err
+			continue
+		}
+		out, ok, err := m.newMail(event)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if !ok {
+			m.logger.Debug(domain.LogMessaging, "Event has no mail", "type", event.Type)
+			continue
+		}
+		out.index = i
+		mails = append(mails, out)
+	}
+	if len(mails) == 0 {
+		return errs
+	}
+
+	client, conn, err := m.dial(ctx)
+	if err != nil {
+		for _, out := range mails {
+			errs[out.index] = err
+		}
+		return errs
+	}
+	defer client.Close()
+
+	sent := 0
+	for j, out := range mails {
+		if err := conn.SetDeadline(m.deadline(ctx)); err != nil || ctx.Err() != nil {
+			err = fmt.Errorf("failed to send mail: %w", errors.Join(err, ctx.Err()))
+			for _, rest := range mails[j:] {
+				errs[rest.index] = err
+			}
+			return errs
+		}
+		if err := m.send(client, out); err != nil {
+			errs[out.index] = err
+			// A refused mail leaves a transaction open; a connection that
+			// can't reset is lost for the rest as well
+			if resetErr := client.Reset(); resetErr != nil {
+				resetErr = fmt.Errorf("failed to send mail: %w", resetErr)
+				for _, rest := range mails[j+1:] {
+					errs[rest.index] = resetErr
+				}
+				return errs
+			}
+			continue
+		}
+		sent++
+	}
+	client.Quit()
+	m.logger.Debug(domain.LogMessaging, "Mails sent over SMTP", "sent", sent, "failed", len(mails)-sent)
+	return errs
+}
+
+// newMail renders the mail of an event; ok is false for events without one.
+func (m *SMTPMailer) newMail(event domainevents.Event) (out outgoingMail, ok bool, err error) {
+	data := mailData{AppName: m.cfg.AppName, OccurredAt: event.OccurredAt, Data: event.Data}
+	var name string
+	switch payload := event.Data.(type) {
+	case domainevents.UserRegistered:
+		name, data.Email, data.Link = mailVerification, payload.Email, mailLink(m.cfg.Links.VerifyEmail, payload.Token)
+	case domainevents.VerificationCodeRequested:
+		name, data.Email, data.Code = mailVerification, payload.Email, payload.Code
+	case domainevents.PasswordResetRequested:
+		name, data.Email, data.Link = mailPasswordReset, payload.Email, mailLink(m.cfg.Links.ResetPassword, payload.Token)
+	case domainevents.MagicLinkRequested:
+		name, data.Email, data.Link = mailMagicLink, payload.Email, mailLink(m.cfg.Links.MagicLink, payload.Token)
+	case domainevents.PasswordChanged:
+		name, data.Email = mailPasswordChanged, payload.Email
+	case domainevents.SessionAnomalyDetected:
+		name, data.Email = mailSessionAnomaly, payload.Email
+	case domainevents.AccountDeleted:
+		name, data.Email = mailAccountDeleted, payload.Email
+	default:
+		return outgoingMail{}, false, nil
+	}
+
+	to, err := mail.ParseAddress(data.Email)
+	if err != nil {
+		return outgoingMail{}, false, fmt.Errorf("%w: %q has no valid recipient: %w", domain.ErrEventRejected, event.Type, err)
+	}
+	subject, text, html, err := m.templates.render(name, data)
+	if err != nil {
+		// The templates are checked on startup, so it's down to the data
+		return outgoingMail{}, false, fmt.Errorf("%w: %w", domain.ErrEventRejected, err)
+	}
+	msg, err := composeMail(mailHeader{
+		From:    m.from.String(),
+		To:      to.String(),
+		Subject: subject,
+		Date:    event.OccurredAt,
+		// A mail sent again for a redelivered event can be recognized
+		MessageID: "<" + event.ID.String() + "@" + addressDomain(m.from.Address) + ">",
+	}, text, html)
+	if err != nil {
+		return outgoingMail{}, false, fmt.Errorf("failed to compose mail: %w", err)
+	}
+	return outgoingMail{to: to.Address, msg: msg}, true, nil
+}
+
+// dial connects and, as configured, secures and authenticates the session.
+// Everything that can go wrong here is down to the server or the settings,
+// so the errors are all retryable.
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, net.Conn, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if m.cfg.TLS == config.SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: m.tlsConfig()}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if err := conn.SetDeadline(m.deadline(ctx)); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	if err := m.startSession(client); err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+func (m *SMTPMailer) startSession(client *smtp.Client) error {
+	if hostname, err := os.Hostname(); err == nil {
+		if err := client.Hello(hostname); err != nil {
+			return fmt.Errorf("SMTP server refused HELO: %w", err)
+		}
+	}
+	if m.cfg.TLS == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server doesn't offer STARTTLS")
+		}
+		if err := client.StartTLS(m.tlsConfig()); err != nil {
+			return fmt.Errorf("failed to start TLS with SMTP server: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *SMTPMailer) send(client *smtp.Client, out outgoingMail) error {
+	// A refused sender is a setting to fix, not a reason to drop the event
+	if err := client.Mail(m.from.Address); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	if err := client.Rcpt(out.to); err != nil {
+		return classifySMTPError("recipient", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classifySMTPError("message", err)
+	}
+	if _, err := w.Write(out.msg); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTPError("message", err)
+	}
+	return nil
+}
+
+func (m *SMTPMailer) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: m.cfg.Host, MinVersion: tls.VersionTLS12}
+}
+
+// deadline bounds each exchange with the server by the timeout, or ctx when
+// it ends first.
+func (m *SMTPMailer) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(m.cfg.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// classifySMTPError marks a refused recipient or message as rejected when the
+// reply is permanent (5xx); 4xx replies ask to try again later.
+func classifySMTPError(what string, err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: SMTP server refused %s: %w", domain.ErrEventRejected, what, err)
+	}
+	return fmt.Errorf("SMTP server refused %s: %w", what, err)
+}
+
+// mailLink puts the token, query escaped, into a link pattern.
+func mailLink(pattern, token string) string {
+	return strings.ReplaceAll(pattern, "{token}", url.QueryEscape(token))
+}
+
+func addressDomain(address string) string {
+	_, host, _ := strings.Cut(address, "@")
+	return host
+}
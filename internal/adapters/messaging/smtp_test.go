@@ -0,0 +1,436 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+// smtpMessage is a mail as the stand-in received it.
+type smtpMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// smtpStandIn speaks enough SMTP for net/smtp. Like a real server, it refuses
+// a recipient whose address contains "bounce" for good and one that contains
+// "busy" for now.
+type smtpStandIn struct {
+	net.Listener
+
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &smtpStandIn{Listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 stand-in ESMTP")
+
+	var current smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 stand-in")
+		case "MAIL":
+			current = smtpMessage{From: arg}
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			switch {
+			case strings.Contains(arg, "bounce"):
+				text.PrintfLine("550 5.1.1 no such user")
+			case strings.Contains(arg, "busy"):
+				text.PrintfLine("451 4.3.0 try again later")
+			default:
+				current.To = append(current.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				text.PrintfLine("250 OK")
+			}
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			current = smtpMessage{}
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func newTestSMTPConfig(host string, port int) *config.SMTPConfig {
+	return &config.SMTPConfig{
+		Host:    host,
+		Port:    port,
+		From:    "golang-auth <no-reply@example.com>",
+		TLS:     config.SMTPTLSNone,
+		Timeout: 5 * time.Second,
+		AppName: "golang-auth",
+		Locale:  "en",
+		Links: config.MailLinks{
+			VerifyEmail:   "https://auth.example.com/verify?token={token}",
+			ResetPassword: "https://app.example.com/reset?token={token}",
+			MagicLink:     "https://auth.example.com/magic?token={token}",
+		},
+	}
+}
+
+func newTestSMTPMailer(t *testing.T, standIn *smtpStandIn) *SMTPMailer {
+	t.Helper()
+	addr := standIn.Addr().(*net.TCPAddr)
+	mailer, err := NewSMTPMailer(newTestSMTPConfig("127.0.0.1", addr.Port), &testutil.NoopLogger{})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error: %v", err)
+	}
+	return mailer
+}
+
+// readMail parses a received mail into its header and decoded bodies.
+func readMail(t *testing.T, data []byte) (mail.Header, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("invalid mail: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q (%v)", mediaType, err)
+	}
+
+	bodies := make(map[string]string)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid part: %v", err)
+		}
+		// The reader decodes quoted-printable parts on its own
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("invalid part body: %v", err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		bodies[contentType] = string(body)
+	}
+	return msg.Header, bodies["text/plain"], bodies["text/html"]
+}
+
+func TestSMTPMailer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Mails a verification link to the user", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		mailer := newTestSMTPMailer(t, standIn)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.UserRegistered{Email: "user@example.com", Token: "a+b/c"})
+		if err := mailer.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+		received := standIn.received()
+		if len(received) != 1 {
+			t.Fatalf("expected 1 mail, got %d", len(received))
+		}
+		if received[0].From != "FROM:<no-reply@example.com>" || len(received[0].To) != 1 || received[0].To[0] != "user@example.com" {
+			t.Errorf("unexpected envelope: %+v", received[0])
+		}
+
+		header, text, html := readMail(t, received[0].Data)
+		decoder := new(mime.WordDecoder)
+		subject, _ := decoder.DecodeHeader(header.Get("Subject"))
+		if subject != "Verify your email for golang-auth" {
+			t.Errorf("unexpected subject %q", subject)
+		}
+		if header.Get("Message-Id") != "<"+event.ID.String()+"@example.com>" {
+			t.Errorf("unexpected Message-ID %q", header.Get("Message-Id"))
+		}
+		const link = "https://auth.example.com/verify?token=a%2Bb%2Fc"
+		if !strings.Contains(text, link) || !strings.Contains(html, `href="`+link+`"`) {
+			t.Errorf("expected the escaped link in both bodies:\n%s\n%s", text, html)
+		}
+	})
+
+	t.Run("Mails a security alert", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		mailer := newTestSMTPMailer(t, standIn)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.SessionAnomalyDetected{
+			Email:     "user@example.com",
+			SessionID: uuid.New(),
+			Action:    "revoke",
+			IPChanged: true, PreviousIP: "198.51.100.1", IPAddress: "203.0.113.7",
+		})
+		if err := mailer.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+		received := standIn.received()
+		if len(received) != 1 {
+			t.Fatalf("expected 1 mail, got %d", len(received))
+		}
+		_, text, html := readMail(t, received[0].Data)
+		for _, body := range []string{text, html} {
+			if !strings.Contains(body, "203.0.113.7") || !strings.Contains(body, "signed that session out") {
+				t.Errorf("unexpected alert:\n%s", body)
+			}
+		}
+	})
+
+	t.Run("Events without a mail count as sent", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		mailer := newTestSMTPMailer(t, standIn)
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.LoggedIn{SessionID: uuid.New(), Method: domainevents.LoginMethodPassword})
+		if err := mailer.Publish(ctx, *event); err != nil {
+			t.Fatalf("Publish() error: %v", err)
+		}
+		if len(standIn.received()) != 0 {
+			t.Error("expected no mail")
+		}
+	})
+
+	t.Run("Classifies refused mails", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		mailer := newTestSMTPMailer(t, standIn)
+
+		reset := func(email string) domainevents.Event {
+			return *domainevents.New(ctx, uuid.New(), domainevents.PasswordResetRequested{Email: email, Token: "token"})
+		}
+		errs := mailer.PublishBatch(ctx, []domainevents.Event{
+			reset("first@example.com"),
+			reset("bounce@example.com"),
+			reset("busy@example.com"),
+			reset("not an address"),
+			{ID: uuid.New(), Type: "user.unknown", UserID: uuid.New()},
+			reset("last@example.com"),
+		})
+		if errs[0] != nil || errs[5] != nil {
+			t.Errorf("good mails: %v, %v", errs[0], errs[5])
+		}
+		if !errors.Is(errs[1], domain.ErrEventRejected) {
+			t.Errorf("a permanent refusal should be rejected, got %v", errs[1])
+		}
+		if errs[2] == nil || errors.Is(errs[2], domain.ErrEventRejected) {
+			t.Errorf("a temporary refusal should be retryable, got %v", errs[2])
+		}
+		if !errors.Is(errs[3], domain.ErrEventRejected) || !errors.Is(errs[4], domain.ErrEventRejected) {
+			t.Errorf("invalid events should be rejected, got %v, %v", errs[3], errs[4])
+		}
+		if len(standIn.received()) != 2 {
+			t.Errorf("expected the good mails to arrive over the same connection, got %d", len(standIn.received()))
+		}
+	})
+
+	t.Run("An unreachable server is retryable", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		mailer := newTestSMTPMailer(t, standIn)
+		standIn.Close()
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.AccountDeleted{Email: "user@example.com"})
+		if err := mailer.Publish(ctx, *event); err == nil || errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("expected a retryable error, got %v", err)
+		}
+	})
+
+	t.Run("A server without STARTTLS is refused", func(t *testing.T) {
+		standIn := newSMTPStandIn(t)
+		cfg := newTestSMTPConfig("127.0.0.1", standIn.Addr().(*net.TCPAddr).Port)
+		cfg.TLS = config.SMTPTLSStartTLS
+		mailer, err := NewSMTPMailer(cfg, &testutil.NoopLogger{})
+		if err != nil {
+			t.Fatalf("NewSMTPMailer() error: %v", err)
+		}
+
+		event := domainevents.New(ctx, uuid.New(), domainevents.AccountDeleted{Email: "user@example.com"})
+		if err := mailer.Publish(ctx, *event); err == nil || errors.Is(err, domain.ErrEventRejected) {
+			t.Errorf("expected a retryable error, got %v", err)
+		}
+		if len(standIn.received()) != 0 {
+			t.Error("no mail may go out in the clear")
+		}
+	})
+}
+
+func TestLoadMailTemplates(t *testing.T) {
+	data := mailData{AppName: "golang-auth", Code: "123456", OccurredAt: time.Now()}
+
+	t.Run("Overrides and missing locales fall back file by file", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(dir, "fr"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		override := `{{define "subject"}}Vérifiez votre adresse{{end}}Votre code : {{.Code}}`
+		if err := os.WriteFile(filepath.Join(dir, "fr", "verification.txt.tmpl"), []byte(override), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		templates, err := loadMailTemplates(dir, "fr")
+		if err != nil {
+			t.Fatalf("loadMailTemplates() error: %v", err)
+		}
+		subject, text, html, err := templates.render(mailVerification, data)
+		if err != nil {
+			t.Fatalf("render() error: %v", err)
+		}
+		if subject != "Vérifiez votre adresse" || text != "Votre code : 123456" {
+			t.Errorf("expected the override, got %q and %q", subject, text)
+		}
+		if !strings.Contains(html, "Enter this code") {
+			t.Errorf("expected the built-in HTML, got %q", html)
+		}
+	})
+
+	t.Run("Every mail is built in", func(t *testing.T) {
+		templates, err := loadMailTemplates("", "de")
+		if err != nil {
+			t.Fatalf("loadMailTemplates() error: %v", err)
+		}
+		if len(templates) != len(mailNames) {
+			t.Errorf("expected %d mails, got %d", len(mailNames), len(templates))
+		}
+	})
+
+	t.Run("A text template needs a subject", func(t *testing.T) {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "en"), 0o755)
+		os.WriteFile(filepath.Join(dir, "en", "magic_link.txt.tmpl"), []byte("{{.Link}}"), 0o644)
+		if _, err := loadMailTemplates(dir, "en"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestSMTPMailer_MailHog(t *testing.T) {
+	mailhog := testutil.SetupTestMailHog(t)
+	ctx := context.Background()
+
+	mailer, err := NewSMTPMailer(newTestSMTPConfig(mailhog.SMTPHost, mailhog.SMTPPort), &testutil.NoopLogger{})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer() error: %v", err)
+	}
+	events := []domainevents.Event{
+		*domainevents.New(ctx, uuid.New(), domainevents.PasswordResetRequested{Email: "reset@example.com", Token: "reset-token"}),
+		*domainevents.New(ctx, uuid.New(), domainevents.PasswordChanged{Email: "changed@example.com", Reason: domainevents.PasswordChangedByReset}),
+	}
+	for i, err := range mailer.PublishBatch(ctx, events) {
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+	}
+
+	resp, err := http.Get(mailhog.APIURL + "/api/v2/messages")
+	if err != nil {
+		t.Fatalf("failed to query mailhog: %v", err)
+	}
+	defer resp.Body.Close()
+	var inbox struct {
+		Total int
+		Items []struct {
+			Raw struct {
+				To   []string
+				Data string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inbox); err != nil {
+		t.Fatalf("invalid mailhog response: %v", err)
+	}
+	if inbox.Total != len(events) {
+		t.Fatalf("expected %d mails, got %d", len(events), inbox.Total)
+	}
+
+	byRecipient := make(map[string]string)
+	for _, item := range inbox.Items {
+		_, text, _ := readMail(t, []byte(item.Raw.Data))
+		byRecipient[strings.Join(item.Raw.To, ",")] = text
+	}
+	if !strings.Contains(byRecipient["reset@example.com"], "https://app.example.com/reset?token=reset-token") {
+		t.Errorf("unexpected reset mail: %q", byRecipient["reset@example.com"])
+	}
+	if !strings.Contains(byRecipient["changed@example.com"], "was reset") {
+		t.Errorf("unexpected alert: %q", byRecipient["changed@example.com"])
+	}
+}
+
+// The quoted-printable writer wraps long lines; make sure links survive it.
+func TestComposeMail_LongLink(t *testing.T) {
+	link := "https://auth.example.com/verify?token=" + strings.Repeat("x", 200)
+	msg, err := composeMail(mailHeader{From: "a@example.com", To: "b@example.com", Subject: "Grüße", Date: time.Now(), MessageID: "<id@example.com>"}, link+"\n", "<a href=\""+link+"\">x</a>")
+	if err != nil {
+		t.Fatalf("composeMail() error: %v", err)
+	}
+	_, body, _ := strings.Cut(string(msg), "\r\n\r\n")
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("body line over 76 characters: %q", line)
+		}
+	}
+	header, text, _ := readMail(t, msg)
+	if strings.TrimSpace(text) != link {
+		t.Errorf("link did not survive encoding: %q", text)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject")); subject != "Grüße" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/redis/go-redis/v9"
+)
+
+const challengeKeyPrefix = "challenge:"
+
+// RedisChallengeStore keeps challenges in Redis and lets them expire there.
+type RedisChallengeStore struct {
+	rdb    *redis.Client
+	logger ports.Logger
+}
+
+func NewRedisChallengeStore(rdb *redis.Client, logger ports.Logger) *RedisChallengeStore {
+	return &RedisChallengeStore{
+		rdb:    rdb,
+		logger: logger,
+	}
+}
+
+func (store *RedisChallengeStore) Save(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := store.rdb.Set(ctx, challengeKeyPrefix+key, value, ttl).Err(); err != nil {
+		store.logger.Error(domain.LogRepository, "Failed to store challenge", "error", err)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// Take uses GETDEL, so two concurrent requests can never redeem the same challenge.
+func (store *RedisChallengeStore) Take(ctx context.Context, key string) ([]byte, error) {
+	value, err := store.rdb.GetDel(ctx, challengeKeyPrefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, domain.ErrNotFound
+		}
+		store.logger.Error(domain.LogRepository, "Failed to read challenge", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return value, nil
+}
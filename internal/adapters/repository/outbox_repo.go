@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	repooutbox "github.com/golang-auth/internal/adapters/repository/postgre/persistency/outbox"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createOutboxEvent stores event in tx, so it commits or rolls back with the
+// change that raised it. The payload is the whole event as it is published,
+// sealed with the outbox key. A nil event is a no-op.
+func (repo *UserRepository) createOutboxEvent(ctx context.Context, tx *gorm.DB, event *domainevents.Event) error {
+	if event == nil {
+		return nil
+	}
+	plain, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	payload, err := repo.sealer.SealPayload(event.ID, plain)
+	clear(plain)
+	if err != nil {
+		return err
+	}
+	return gorm.G[repooutbox.OutboxEvent](tx).Create(ctx, &repooutbox.OutboxEvent{
+		ID:        event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+	})
+}
+
+// ClaimOutboxEvents leases up to limit due events to the caller, oldest
+// first, and counts the attempt. Rows claimed by a concurrent relay are
+// skipped rather than waited for. The lease pushes next_attempt_at out, so an
+// event whose relay dies is claimed again once the lease runs out.
+func (repo *UserRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ports.OutboxEvent, error) {
+	leaseID := uuid.New()
+	var claimed []repooutbox.OutboxEvent
+
+	due := repo.db.Model(&repooutbox.OutboxEvent{}).
+		Select("id").
+		Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+		Order("next_attempt_at, created_at").
+		Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	err := repo.db.WithContext(ctx).Model(&claimed).
+		Clauses(clause.Returning{}).
+		Where("id IN (?)", due).
+		Updates(map[string]interface{}{
+			"lease_id":        leaseID,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": time.Now().Add(lease),
+		}).Error
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to claim outbox events", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+
+	events := make([]ports.OutboxEvent, 0, len(claimed))
+	for _, row := range claimed {
+		event := ports.OutboxEvent{LeaseID: leaseID, Attempts: row.Attempts}
+		if err := repo.openOutboxPayload(row, &event.Event); err != nil {
+			// Left without data for the relay to dead-letter
+			repo.logger.Error(domain.LogRepository, "Undecodable outbox payload", "error", err, "event_id", row.ID)
+			event.Event = domainevents.Event{}
+		}
+		event.ID, event.Type = row.ID, row.EventType
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (repo *UserRepository) openOutboxPayload(row repooutbox.OutboxEvent, event *domainevents.Event) error {
+	plain, err := repo.sealer.OpenPayload(row.ID, row.Payload)
+	if err != nil {
+		return err
+	}
+	defer clear(plain)
+	return json.Unmarshal(plain, event)
+}
+
+// MarkOutboxEventDispatched closes an event for good and drops its payload.
+func (repo *UserRepository) MarkOutboxEventDispatched(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID) error {
+	return repo.releaseOutboxEvent(ctx, eventID, leaseID, map[string]interface{}{
+		"status":        "dispatched",
+		"payload":       nil,
+		"last_error":    nil,
+		"dispatched_at": time.Now(),
+	})
+}
+
+// RescheduleOutboxEvent hands a failed event back for another attempt at retryAt.
+func (repo *UserRepository) RescheduleOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, retryAt time.Time, lastError string) error {
+	return repo.releaseOutboxEvent(ctx, eventID, leaseID, map[string]interface{}{
+		"next_attempt_at": retryAt,
+		"last_error":      lastError,
+	})
+}
+
+// DeadLetterOutboxEvent gives up on an event. The payload is dropped like on
+// dispatch, since its tokens must not outlive the event; the row stays with
+// its type and last error for an operator to look into.
+func (repo *UserRepository) DeadLetterOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, lastError string) error {
+	return repo.releaseOutboxEvent(ctx, eventID, leaseID, map[string]interface{}{
+		"status":     "dead",
+		"payload":    nil,
+		"last_error": lastError,
+	})
+}
+
+// releaseOutboxEvent applies updates to a pending event and ends the lease,
+// but only while leaseID still holds it.
+func (repo *UserRepository) releaseOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, updates map[string]interface{}) error {
+	updates["lease_id"] = nil
+	result := repo.db.WithContext(ctx).Model(&repooutbox.OutboxEvent{}).
+		Where("id = ? AND lease_id = ? AND status = ?", eventID, leaseID, "pending").
+		Updates(updates)
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to update outbox event", "error", result.Error, "event_id", eventID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrOutboxLeaseLost
+	}
+	return nil
+}
@@ -6,9 +6,12 @@ import (
 	"os"
 
 	"ariga.io/atlas-provider-gorm/gormschema"
+	repooutbox "github.com/golang-auth/internal/adapters/repository/postgre/persistency/outbox"
 	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	repousermfa "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_mfa"
 	usersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
 	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
@@ -25,7 +28,13 @@ func main() {
 		&repouser.UserCredentials{},
 		&usersessions.UserSessions{},
 		&usersessions.AuditUserSessions{},
+		&usersessions.RefreshTokenHistory{},
 		&userverification.UserVerification{},
+		&repousermfa.UserMFATOTP{},
+		&repousermfa.MFAChallenge{},
+		&repousermfa.UserMFARecoveryCode{},
+		&repouserwebauthn.WebAuthnCredential{},
+		&repooutbox.OutboxEvent{},
 	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to load gorm schema: %v\n", err)
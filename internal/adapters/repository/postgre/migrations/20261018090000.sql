@@ -0,0 +1,15 @@
+-- Create index "idx_user_sessions_token" to table: "user_sessions"
+CREATE UNIQUE INDEX "idx_user_sessions_token" ON "user_sessions" ("token");
+-- Create "refresh_token_history" table
+CREATE TABLE "refresh_token_history" (
+  "id" uuid NOT NULL DEFAULT gen_random_uuid(),
+  "session_id" uuid NOT NULL,
+  "token" character varying(255) NOT NULL,
+  "rotated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_refresh_token_history_session" FOREIGN KEY ("session_id") REFERENCES "user_sessions" ("id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create index "idx_refresh_token_history_session_id" to table: "refresh_token_history"
+CREATE INDEX "idx_refresh_token_history_session_id" ON "refresh_token_history" ("session_id");
+-- Create index "idx_refresh_token_history_token" to table: "refresh_token_history"
+CREATE UNIQUE INDEX "idx_refresh_token_history_token" ON "refresh_token_history" ("token");
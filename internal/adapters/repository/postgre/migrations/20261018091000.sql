@@ -0,0 +1,2 @@
+-- Modify "user" table
+ALTER TABLE "user" ADD COLUMN "roles" text[] NOT NULL DEFAULT '{}';
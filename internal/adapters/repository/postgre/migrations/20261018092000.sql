@@ -0,0 +1,9 @@
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'user_verification_purpose') THEN
+        CREATE TYPE user_verification_purpose AS ENUM ('email_verification', 'password_reset');
+    END IF;
+END $$;
+-- Modify "user_verification" table
+ALTER TABLE "user_verification" ADD COLUMN "purpose" "user_verification_purpose" NOT NULL DEFAULT 'email_verification';
+-- Create index "idx_user_verification_user_purpose" to table: "user_verification"
+CREATE INDEX "idx_user_verification_user_purpose" ON "user_verification" ("user_id", "purpose");
@@ -0,0 +1,26 @@
+-- Create "user_mfa_totp" table
+CREATE TABLE "user_mfa_totp" (
+  "user_id" uuid NOT NULL,
+  "secret_ciphertext" bytea NOT NULL,
+  "last_used_step" bigint NOT NULL DEFAULT 0,
+  "confirmed_at" timestamptz NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "updated_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("user_id"),
+  CONSTRAINT "fk_user_mfa_totp_user" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create "mfa_challenge" table
+CREATE TABLE "mfa_challenge" (
+  "id" uuid NOT NULL DEFAULT gen_random_uuid(),
+  "user_id" uuid NOT NULL,
+  "token" character varying(255) NOT NULL,
+  "attempts" integer NOT NULL DEFAULT 0,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_mfa_challenge_user" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create index "idx_mfa_challenge_token" to table: "mfa_challenge"
+CREATE UNIQUE INDEX "idx_mfa_challenge_token" ON "mfa_challenge" ("token");
+-- Create index "idx_mfa_challenge_user_id" to table: "mfa_challenge"
+CREATE INDEX "idx_mfa_challenge_user_id" ON "mfa_challenge" ("user_id");
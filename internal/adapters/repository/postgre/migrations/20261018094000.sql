@@ -0,0 +1,14 @@
+-- Add value to enum type: "audit_event_type"
+ALTER TYPE "audit_event_type" ADD VALUE IF NOT EXISTS 'MFA_RECOVERY_CODE_USED';
+-- Create "user_mfa_recovery_code" table
+CREATE TABLE "user_mfa_recovery_code" (
+  "id" uuid NOT NULL DEFAULT gen_random_uuid(),
+  "user_id" uuid NOT NULL,
+  "code_hash" character varying(255) NOT NULL,
+  "used_at" timestamptz NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_user_mfa_recovery_code_user" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create index "idx_user_mfa_recovery_code_user_id" to table: "user_mfa_recovery_code"
+CREATE INDEX "idx_user_mfa_recovery_code_user_id" ON "user_mfa_recovery_code" ("user_id");
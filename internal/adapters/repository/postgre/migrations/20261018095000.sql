@@ -0,0 +1,20 @@
+-- Create "webauthn_credential" table
+CREATE TABLE "webauthn_credential" (
+  "id" uuid NOT NULL DEFAULT gen_random_uuid(),
+  "user_id" uuid NOT NULL,
+  "credential_id" bytea NOT NULL,
+  "public_key" bytea NOT NULL,
+  "algorithm" integer NOT NULL,
+  "sign_count" bigint NOT NULL DEFAULT 0,
+  "aaguid" bytea NULL,
+  "attestation_format" character varying(32) NOT NULL,
+  "name" character varying(64) NOT NULL,
+  "last_used_at" timestamptz NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_webauthn_credential_user" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create index "idx_webauthn_credential_credential_id" to table: "webauthn_credential"
+CREATE UNIQUE INDEX "idx_webauthn_credential_credential_id" ON "webauthn_credential" ("credential_id");
+-- Create index "idx_webauthn_credential_user_id" to table: "webauthn_credential"
+CREATE INDEX "idx_webauthn_credential_user_id" ON "webauthn_credential" ("user_id");
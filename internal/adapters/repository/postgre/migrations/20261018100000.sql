@@ -0,0 +1,2 @@
+-- Add value to enum type: "user_verification_purpose"
+ALTER TYPE "user_verification_purpose" ADD VALUE IF NOT EXISTS 'magic_link';
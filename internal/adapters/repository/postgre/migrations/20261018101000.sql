@@ -0,0 +1,4 @@
+-- Add value to enum type: "user_verification_purpose"
+ALTER TYPE "user_verification_purpose" ADD VALUE IF NOT EXISTS 'email_verification_code';
+-- Modify "user_verification" table
+ALTER TABLE "user_verification" ADD COLUMN "attempts" integer NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Add value to enum type: "audit_event_type"
+ALTER TYPE "audit_event_type" ADD VALUE IF NOT EXISTS 'LOGIN_FAILED';
+-- Add value to enum type: "audit_event_type"
+ALTER TYPE "audit_event_type" ADD VALUE IF NOT EXISTS 'ACCOUNT_LOCKED';
+-- Add value to enum type: "audit_event_type"
+ALTER TYPE "audit_event_type" ADD VALUE IF NOT EXISTS 'ACCOUNT_UNLOCKED';
+-- Modify "user" table
+ALTER TABLE "user" ADD COLUMN "failed_login_attempts" integer NOT NULL DEFAULT 0, ADD COLUMN "locked_until" timestamptz NULL;
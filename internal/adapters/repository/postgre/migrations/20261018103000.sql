@@ -0,0 +1,4 @@
+-- Add value to enum type: "audit_event_type"
+ALTER TYPE "audit_event_type" ADD VALUE IF NOT EXISTS 'ACCOUNT_DELETED';
+-- Create index "idx_audit_user_sessions_user_id_created_at" to table: "audit_user_sessions"
+CREATE INDEX "idx_audit_user_sessions_user_id_created_at" ON "audit_user_sessions" ("user_id", "created_at");
@@ -0,0 +1,21 @@
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'outbox_event_status') THEN
+        CREATE TYPE outbox_event_status AS ENUM ('pending', 'dispatched', 'dead');
+    END IF;
+END $$;
+-- Create "outbox_event" table
+CREATE TABLE "outbox_event" (
+  "id" uuid NOT NULL DEFAULT gen_random_uuid(),
+  "event_type" character varying(100) NOT NULL,
+  "payload" jsonb NULL,
+  "status" "outbox_event_status" NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL DEFAULT now(),
+  "lease_id" uuid NULL,
+  "last_error" text NULL,
+  "created_at" timestamptz NOT NULL DEFAULT now(),
+  "dispatched_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_outbox_event_status_next_attempt_at" to table: "outbox_event"
+CREATE INDEX "idx_outbox_event_status_next_attempt_at" ON "outbox_event" ("status", "next_attempt_at");
@@ -0,0 +1,2 @@
+-- Modify "webauthn_credential" table
+ALTER TABLE "webauthn_credential" ADD COLUMN "backup_eligible" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Modify "user_sessions" table
+ALTER TABLE "user_sessions" ADD COLUMN "anomaly_alerted_at" timestamptz NULL;
@@ -0,0 +1,5 @@
+-- Payloads are sealed by the application from now on. Plaintext ones still
+-- pending can't be opened by the relay and are dead-lettered here instead
+UPDATE "outbox_event" SET "status" = 'dead', "lease_id" = NULL, "last_error" = 'payload dropped when outbox encryption was introduced' WHERE "status" = 'pending';
+-- Modify "outbox_event" table
+ALTER TABLE "outbox_event" ALTER COLUMN "payload" TYPE bytea USING NULL;
@@ -0,0 +1,24 @@
+package repooutbox
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEvent is a domain event waiting for the relay. It is written in the
+// same transaction as the change that raised it, so an event exists if and
+// only if the change was committed. The payload carries raw tokens, so it is
+// stored sealed and cleared once the event is dispatched or dead-lettered.
+type OutboxEvent struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	EventType     string     `gorm:"type:varchar(100);not null"`
+	Payload       []byte     `gorm:"type:bytea"`
+	Status        string     `gorm:"type:outbox_event_status;default:pending;not null;index:idx_outbox_event_status_next_attempt_at,priority:1"`
+	Attempts      int        `gorm:"type:integer;default:0;not null"`
+	NextAttemptAt time.Time  `gorm:"type:timestamptz;default:now();not null;index:idx_outbox_event_status_next_attempt_at,priority:2"`
+	LeaseID       *uuid.UUID `gorm:"type:uuid"` // set by the relay instance that claimed the event
+	LastError     *string    `gorm:"type:text"`
+	CreatedAt     time.Time  `gorm:"type:timestamptz;default:now();not null"`
+	DispatchedAt  *time.Time `gorm:"type:timestamptz"`
+}
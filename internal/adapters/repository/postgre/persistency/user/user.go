@@ -5,14 +5,21 @@ import (
 
 	domain_user "github.com/golang-auth/internal/core/domain/user"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Email        string    `gorm:"type:varchar(255);uniqueIndex:idx_email_active,where:deleted_at IS NULL;not null"`
-	UserStatus   string    `gorm:"type:user_status;default:pending_verification;not null"`
-	IsMFAEnabled bool      `gorm:"type:boolean;default:false;not null"`
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Email        string         `gorm:"type:varchar(255);uniqueIndex:idx_email_active,where:deleted_at IS NULL;not null"`
+	UserStatus   string         `gorm:"type:user_status;default:pending_verification;not null"`
+	IsMFAEnabled bool           `gorm:"type:boolean;default:false;not null"`
+	Roles        pq.StringArray `gorm:"type:text[];default:'{}';not null"`
+
+	// Failed password logins since the last success, and until when the
+	// account has to wait before the next attempt.
+	FailedLoginAttempts int        `gorm:"type:integer;default:0;not null"`
+	LockedUntil         *time.Time `gorm:"type:timestamptz"`
 
 	CreatedAt time.Time      `gorm:"type:timestamptz;default:now();not null"`
 	UpdatedAt time.Time      `gorm:"type:timestamptz;default:now();not null"`
@@ -31,13 +38,16 @@ type UserCredentials struct {
 
 func MapToDomain(u User, c UserCredentials) domain_user.User {
 	return domain_user.User{
-		ID:           u.ID,
-		Email:        u.Email,
-		UserStatus:   u.UserStatus,
-		IsMFAEnabled: u.IsMFAEnabled,
-		CreatedAt:    u.CreatedAt,
-		UpdatedAt:    u.UpdatedAt,
-		DeletedAt:    u.DeletedAt.Time, // Zero value if NULL
+		ID:                  u.ID,
+		Email:               u.Email,
+		UserStatus:          u.UserStatus,
+		IsMFAEnabled:        u.IsMFAEnabled,
+		Roles:               u.Roles,
+		FailedLoginAttempts: u.FailedLoginAttempts,
+		LockedUntil:         u.LockedUntil,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+		DeletedAt:           u.DeletedAt.Time, // Zero value if NULL
 		Credentials: domain_user.UserCredentials{
 			PasswordHash:       c.PasswordHash,
 			LastPasswordChange: c.LastPasswordChange,
@@ -53,12 +63,15 @@ func MapToORM(d domain_user.User) User {
 	}
 
 	return User{
-		ID:           d.ID,
-		Email:        d.Email,
-		UserStatus:   d.UserStatus,
-		IsMFAEnabled: d.IsMFAEnabled,
-		CreatedAt:    d.CreatedAt,
-		UpdatedAt:    d.UpdatedAt,
-		DeletedAt:    gDeletedAt,
+		ID:                  d.ID,
+		Email:               d.Email,
+		UserStatus:          d.UserStatus,
+		IsMFAEnabled:        d.IsMFAEnabled,
+		Roles:               d.Roles,
+		FailedLoginAttempts: d.FailedLoginAttempts,
+		LockedUntil:         d.LockedUntil,
+		CreatedAt:           d.CreatedAt,
+		UpdatedAt:           d.UpdatedAt,
+		DeletedAt:           gDeletedAt,
 	}
 }
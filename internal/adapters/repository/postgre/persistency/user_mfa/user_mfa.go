@@ -0,0 +1,52 @@
+package repousermfa
+
+import (
+	"time"
+
+	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	"github.com/google/uuid"
+)
+
+// UserMFATOTP is the TOTP factor of a user. The secret is AES-GCM encrypted;
+// LastUsedStep is the time step of the last accepted code, so a code can
+// never be used twice.
+type UserMFATOTP struct {
+	UserID           uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	SecretCiphertext []byte     `gorm:"type:bytea;not null"`
+	LastUsedStep     int64      `gorm:"type:bigint;default:0;not null"`
+	ConfirmedAt      *time.Time `gorm:"type:timestamptz"` // NULL until the first code was confirmed
+	CreatedAt        time.Time  `gorm:"type:timestamptz;default:now();not null"`
+	UpdatedAt        time.Time  `gorm:"type:timestamptz;default:now();not null"`
+
+	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (UserMFATOTP) TableName() string {
+	return "user_mfa_totp"
+}
+
+// MFAChallenge is handed out by a password login of an MFA user and traded
+// for a session once the second factor checks out. Only the token hash is stored.
+type MFAChallenge struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Token     string    `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Attempts  int       `gorm:"type:integer;default:0;not null"`
+	ExpiresAt time.Time `gorm:"type:timestamptz;not null"`
+	CreatedAt time.Time `gorm:"type:timestamptz;default:now();not null"`
+
+	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// UserMFARecoveryCode is one of a batch of single-use codes that stand in for
+// the TOTP factor. Codes are stored as their HMAC-SHA256 under a key derived
+// from the MFA key.
+type UserMFARecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CodeHash  string     `gorm:"type:varchar(255);not null"`
+	UsedAt    *time.Time `gorm:"type:timestamptz"`
+	CreatedAt time.Time  `gorm:"type:timestamptz;default:now();not null"`
+
+	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
@@ -23,15 +23,20 @@ CREATE TABLE audit_user_sessions (
 type AuditUserSessions struct {
 	ID        uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	SessionID uuid.UUID `gorm:"type:uuid;not null"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_audit_user_sessions_user_id_created_at,priority:1"`
 	EventType string    `gorm:"type:audit_event_type;not null"`
+	OldValue  *string   `gorm:"type:text"`
 	NewValue  *string   `gorm:"type:text"`
-	CreatedAt time.Time `gorm:"type:timestamptz;default:now();not null"`
+	CreatedAt time.Time `gorm:"type:timestamptz;default:now();not null;index:idx_audit_user_sessions_user_id_created_at,priority:2"`
 
 	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 
 func MapAuditToDomain(orm AuditUserSessions) domainusersessions.AuditUserSessions {
+	oldVal := ""
+	if orm.OldValue != nil {
+		oldVal = *orm.OldValue
+	}
 	newVal := ""
 	if orm.NewValue != nil {
 		newVal = *orm.NewValue
@@ -42,12 +47,17 @@ func MapAuditToDomain(orm AuditUserSessions) domainusersessions.AuditUserSession
 		SessionID: orm.SessionID,
 		UserID:    orm.UserID,
 		EventType: orm.EventType,
+		OldValue:  oldVal,
 		NewValue:  newVal,
 		CreatedAt: orm.CreatedAt,
 	}
 }
 
 func MapAuditToORM(d domainusersessions.AuditUserSessions) AuditUserSessions {
+	var oldPtr *string
+	if d.OldValue != "" {
+		oldPtr = &d.OldValue
+	}
 	var newPtr *string
 	if d.NewValue != "" {
 		newPtr = &d.NewValue
@@ -58,6 +68,7 @@ func MapAuditToORM(d domainusersessions.AuditUserSessions) AuditUserSessions {
 		SessionID: d.SessionID,
 		UserID:    d.UserID,
 		EventType: d.EventType,
+		OldValue:  oldPtr,
 		NewValue:  newPtr,
 		CreatedAt: d.CreatedAt,
 	}
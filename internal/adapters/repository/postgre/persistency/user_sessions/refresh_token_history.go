@@ -0,0 +1,18 @@
+package repousersessions
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshTokenHistory keeps the hashes of refresh tokens that have already been
+// rotated out of a session. Seeing one of them again means the token leaked.
+type RefreshTokenHistory struct {
+	ID        uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Token     string    `gorm:"type:varchar(255);not null;uniqueIndex"`
+	RotatedAt time.Time `gorm:"type:timestamptz;default:now();not null"`
+
+	Session UserSessions `gorm:"foreignKey:SessionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
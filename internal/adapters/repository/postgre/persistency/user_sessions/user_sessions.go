@@ -11,7 +11,7 @@ import (
 type UserSessions struct {
 	ID         uuid.UUID `gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	UserID     uuid.UUID `gorm:"type:uuid;not null"`
-	Token      string    `gorm:"type:varchar(255);not null"`
+	Token      string    `gorm:"type:varchar(255);not null;uniqueIndex"`
 	IPAddress  string    `gorm:"type:inet;not null"`
 	UserAgent  string    `gorm:"type:text;not null"`
 	Device     *string   `gorm:"type:text"`
@@ -19,6 +19,9 @@ type UserSessions struct {
 	LastActive time.Time `gorm:"type:timestamptz;default:now();not null"`
 	ExpiresAt  time.Time `gorm:"type:timestamptz;not null"`
 
+	// When the owner was last alerted about the session changing clients
+	AnomalyAlertedAt *time.Time `gorm:"type:timestamptz"`
+
 	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 
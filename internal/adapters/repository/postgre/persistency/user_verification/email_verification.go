@@ -10,9 +10,11 @@ import (
 
 type UserVerification struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index;index:idx_user_verification_user_purpose,priority:1"`
 	Token     string    `gorm:"type:varchar(255);not null;uniqueIndex"`
 	Status    string    `gorm:"type:user_verification_status;default:pending;not null"`
+	Purpose   string    `gorm:"type:user_verification_purpose;default:email_verification;not null;index:idx_user_verification_user_purpose,priority:2"`
+	Attempts  int       `gorm:"type:integer;default:0;not null"`
 	ExpiresAt time.Time `gorm:"type:timestamptz;not null"`
 	CreatedAt time.Time `gorm:"type:timestamptz;default:now();not null"`
 
@@ -25,6 +27,8 @@ func (s *UserVerification) MapToDomain() *domainuserverification.UserVerificatio
 		UserID:    s.UserID,
 		Token:     s.Token,
 		Status:    s.Status,
+		Purpose:   s.Purpose,
+		Attempts:  s.Attempts,
 		ExpiresAt: s.ExpiresAt,
 		CreatedAt: s.CreatedAt,
 	}
@@ -0,0 +1,33 @@
+package repouserwebauthn
+
+import (
+	"time"
+
+	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a passkey registered by a user. PublicKey is the
+// COSE_Key exactly as the authenticator returned it; SignCount is the last
+// signature counter seen, used to spot cloned authenticators. BackupEligible
+// is fixed at registration and must not change in later assertions.
+type WebAuthnCredential struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CredentialID      []byte     `gorm:"type:bytea;not null;uniqueIndex"`
+	PublicKey         []byte     `gorm:"type:bytea;not null"`
+	Algorithm         int64      `gorm:"type:integer;not null"`
+	SignCount         int64      `gorm:"type:bigint;default:0;not null"`
+	AAGUID            []byte     `gorm:"column:aaguid;type:bytea"`
+	AttestationFormat string     `gorm:"type:varchar(32);not null"`
+	BackupEligible    bool       `gorm:"default:false;not null"`
+	Name              string     `gorm:"type:varchar(64);not null"`
+	LastUsedAt        *time.Time `gorm:"type:timestamptz"`
+	CreatedAt         time.Time  `gorm:"type:timestamptz;default:now();not null"`
+
+	User repouser.User `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credential"
+}
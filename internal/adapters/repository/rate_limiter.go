@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/redis/go-redis/v9"
+)
+
+const rateLimitKeyPrefix = "rl:"
+
+// rateLimitScript checks every limit of a request and only counts the
+// request when all of them allow it. ARGV holds the algorithm, limit and
+// window in ms of each key, then a value that keeps sliding window members
+// unique. It reads the clock of Redis rather than of the caller, so every
+// instance of the service agrees on the window, and returns {allowed,
+// remaining, reset in ms, retry after in ms} for each key.
+//
+// A sliding window keeps a sorted set of request times and drops the ones
+// older than the window before counting. A token bucket stores the tokens
+// left and when they were counted, and adds the tokens earned since.
+var rateLimitScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local member = time[1] .. time[2] .. ARGV[#ARGV]
+
+local limits = {}
+local all = true
+for i, key in ipairs(KEYS) do
+	local l = {algorithm = ARGV[i * 3 - 2], limit = tonumber(ARGV[i * 3 - 1]), window = tonumber(ARGV[i * 3])}
+	if l.algorithm == 'sliding_window' then
+		redis.call('ZREMRANGEBYSCORE', key, '-inf', now - l.window)
+		l.count = redis.call('ZCARD', key)
+		l.allowed = l.count < l.limit
+	else
+		local state = redis.call('HMGET', key, 'tokens', 'ts')
+		local tokens = tonumber(state[1]) or l.limit
+		local ts = tonumber(state[2]) or now
+		l.rate = l.limit / l.window
+		l.tokens = math.min(l.limit, tokens + math.max(0, now - ts) * l.rate)
+		l.allowed = l.tokens >= 1
+	end
+	all = all and l.allowed
+	limits[i] = l
+end
+
+local reply = {}
+for i, key in ipairs(KEYS) do
+	local l = limits[i]
+	local allowed, retry = 0, 0
+	if l.allowed then
+		allowed = 1
+	end
+	if l.algorithm == 'sliding_window' then
+		if all then
+			redis.call('ZADD', key, now, member)
+			redis.call('PEXPIRE', key, l.window)
+			l.count = l.count + 1
+		end
+		-- A slot frees up when the oldest request leaves the window
+		local reset = 0
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		if oldest[2] then
+			reset = tonumber(oldest[2]) + l.window - now
+		end
+		if not l.allowed then
+			retry = reset
+		end
+		table.insert(reply, allowed)
+		table.insert(reply, math.max(0, l.limit - l.count))
+		table.insert(reply, reset)
+		table.insert(reply, retry)
+	else
+		if all then
+			l.tokens = l.tokens - 1
+		end
+		redis.call('HSET', key, 'tokens', tostring(l.tokens), 'ts', now)
+		redis.call('PEXPIRE', key, l.window)
+		if not l.allowed then
+			retry = math.ceil((1 - l.tokens) / l.rate)
+		end
+		table.insert(reply, allowed)
+		table.insert(reply, math.floor(l.tokens))
+		table.insert(reply, math.ceil((l.limit - l.tokens) / l.rate))
+		table.insert(reply, retry)
+	end
+end
+return reply
+`)
+
+// RedisRateLimiter is a ports.RateLimiter backed by Lua scripts, which Redis
+// runs atomically.
+type RedisRateLimiter struct {
+	rdb    *redis.Client
+	logger ports.Logger
+}
+
+func NewRedisRateLimiter(rdb *redis.Client, logger ports.Logger) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		rdb:    rdb,
+		logger: logger,
+	}
+}
+
+// Allow runs all checks in one script. Every key of a request has to live on
+// the same Redis node, which holds for a single server.
+func (limiter *RedisRateLimiter) Allow(ctx context.Context, checks []ports.RateLimitCheck) ([]ports.RateLimitResult, error) {
+	keys := make([]string, 0, len(checks))
+	args := make([]interface{}, 0, len(checks)*3+1)
+	for _, check := range checks {
+		window := check.Limit.Window.Milliseconds()
+		if check.Limit.Limit <= 0 || window <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %+v", check.Limit)
+		}
+		switch check.Limit.Algorithm {
+		case ports.RateLimitSlidingWindow, ports.RateLimitTokenBucket:
+		default:
+			return nil, fmt.Errorf("unknown rate limit algorithm %q", check.Limit.Algorithm)
+		}
+		keys = append(keys, rateLimitKeyPrefix+check.Key)
+		args = append(args, check.Limit.Algorithm, check.Limit.Limit, window)
+	}
+
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return nil, err
+	}
+	args = append(args, hex.EncodeToString(member))
+
+	values, err := rateLimitScript.Run(ctx, limiter.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		limiter.logger.Error(domain.LogRepository, "Failed to run rate limit script", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	if len(values) != len(checks)*4 {
+		limiter.logger.Error(domain.LogRepository, "Unexpected rate limit script reply", "reply", values)
+		return nil, domain.ErrDatabaseInternalError
+	}
+
+	results := make([]ports.RateLimitResult, len(checks))
+	for i, check := range checks {
+		v := values[i*4 : i*4+4]
+		results[i] = ports.RateLimitResult{
+			Allowed:    v[0] == 1,
+			Limit:      check.Limit.Limit,
+			Remaining:  int(v[1]),
+			Reset:      time.Duration(v[2]) * time.Millisecond,
+			RetryAfter: time.Duration(v[3]) * time.Millisecond,
+		}
+	}
+	return results, nil
+}
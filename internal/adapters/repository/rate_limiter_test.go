@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/golang-auth/internal/testutil"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	limiter := NewRedisRateLimiter(testutil.SetupTestRedis(t), &testutil.NoopLogger{})
+	ctx := context.Background()
+
+	allow := func(t *testing.T, checks ...ports.RateLimitCheck) []ports.RateLimitResult {
+		t.Helper()
+		results, err := limiter.Allow(ctx, checks)
+		if err != nil {
+			t.Fatalf("Allow() error: %v", err)
+		}
+		return results
+	}
+	check := func(key, algorithm string, limit int, window time.Duration) ports.RateLimitCheck {
+		return ports.RateLimitCheck{Key: key, Limit: ports.RateLimit{Algorithm: algorithm, Limit: limit, Window: window}}
+	}
+
+	t.Run("Sliding window frees up as requests leave it", func(t *testing.T) {
+		window := check("sliding-expiry", ports.RateLimitSlidingWindow, 2, time.Second)
+		for i := 0; i < 2; i++ {
+			if res := allow(t, window)[0]; !res.Allowed || res.Remaining != 1-i {
+				t.Fatalf("request %d: unexpected result %+v", i+1, res)
+			}
+		}
+		res := allow(t, window)[0]
+		if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Second {
+			t.Fatalf("expected a refusal with a wait of up to a second, got %+v", res)
+		}
+
+		time.Sleep(res.RetryAfter + 50*time.Millisecond)
+		if res := allow(t, window)[0]; !res.Allowed {
+			t.Errorf("expected a slot once the window moved on, got %+v", res)
+		}
+	})
+
+	t.Run("Token bucket allows a burst and refills", func(t *testing.T) {
+		// 4 tokens, one back every 500ms
+		bucket := check("bucket-refill", ports.RateLimitTokenBucket, 4, 2*time.Second)
+		for i := 0; i < 4; i++ {
+			if res := allow(t, bucket)[0]; !res.Allowed {
+				t.Fatalf("burst request %d refused: %+v", i+1, res)
+			}
+		}
+		res := allow(t, bucket)[0]
+		if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 500*time.Millisecond {
+			t.Fatalf("expected a refusal with a wait of up to 500ms, got %+v", res)
+		}
+
+		time.Sleep(res.RetryAfter + 50*time.Millisecond)
+		if res := allow(t, bucket)[0]; !res.Allowed {
+			t.Errorf("expected a refilled token, got %+v", res)
+		}
+		if res := allow(t, bucket)[0]; res.Allowed {
+			t.Errorf("expected only one token refilled, got %+v", res)
+		}
+	})
+
+	t.Run("Concurrent callers can't pass the limit", func(t *testing.T) {
+		for _, algorithm := range []string{ports.RateLimitSlidingWindow, ports.RateLimitTokenBucket} {
+			limit := check("concurrent-"+algorithm, algorithm, 10, time.Minute)
+			var wg sync.WaitGroup
+			var allowed atomic.Int32
+			for range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results, err := limiter.Allow(ctx, []ports.RateLimitCheck{limit})
+					if err != nil {
+						t.Errorf("Allow() error: %v", err)
+						return
+					}
+					if results[0].Allowed {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if allowed.Load() != 10 {
+				t.Errorf("%s: expected 10 allowed, got %d", algorithm, allowed.Load())
+			}
+		}
+	})
+
+	t.Run("A refusal counts against no limit", func(t *testing.T) {
+		wide := check("all-or-nothing-ip", ports.RateLimitSlidingWindow, 5, time.Minute)
+		narrow := check("all-or-nothing-email", ports.RateLimitTokenBucket, 1, time.Minute)
+
+		allow(t, wide, narrow)
+		results := allow(t, wide, narrow)
+		if !results[0].Allowed || results[1].Allowed {
+			t.Fatalf("expected only the narrow limit to refuse, got %+v", results)
+		}
+		if res := allow(t, wide)[0]; !res.Allowed || res.Remaining != 3 {
+			t.Errorf("expected the refused request not to be counted, got %+v", res)
+		}
+	})
+}
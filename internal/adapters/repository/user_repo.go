@@ -3,27 +3,39 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
 	"time"
 
 	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	repousermfa "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_mfa"
 	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
 	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
 	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainusersessions "github.com/golang-auth/internal/core/domain/user_sessions"
+	domainuserverification "github.com/golang-auth/internal/core/domain/user_verification"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
 	db     *gorm.DB
 	logger ports.Logger
+	sealer ports.OutboxSealer
 }
 
-func NewUserRepository(db *gorm.DB, logger ports.Logger) *UserRepository {
+// NewUserRepository returns a repository that seals outbox payloads with sealer.
+func NewUserRepository(db *gorm.DB, logger ports.Logger, sealer ports.OutboxSealer) *UserRepository {
 	return &UserRepository{
 		db:     db,
 		logger: logger,
+		sealer: sealer,
 	}
 }
 
@@ -39,8 +51,21 @@ func (repo *UserRepository) GetUserByEmail(ctx context.Context, email string) (*
 	return &userRecord, nil
 }
 
+func (repo *UserRepository) GetUserByID(ctx context.Context, userID uuid.UUID) (*repouser.User, error) {
+	userRecord, err := gorm.G[repouser.User](repo.db).Where("id = ?", userID).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrUserNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Error while querying user by id", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &userRecord, nil
+}
+
 func (repo *UserRepository) CreateUserWithCredentials(ctx context.Context, req ports.UserAndCredentialsRequest) error {
 	repoUser := repouser.User{
+		ID:           req.UserID,
 		Email:        req.Email,
 		UserStatus:   req.UserStatus,
 		IsMFAEnabled: req.IsMFAEnabled,
@@ -64,6 +89,7 @@ func (repo *UserRepository) CreateUserWithCredentials(ctx context.Context, req p
 		repoVerify := userverification.UserVerification{
 			UserID:    repoUser.ID,
 			Token:     req.EmailVerificationToken,
+			Purpose:   req.EmailVerificationPurpose,
 			ExpiresAt: req.TokenExpiration,
 		}
 		if err := gorm.G[userverification.UserVerification](tx).Create(ctx, &repoVerify); err != nil {
@@ -76,6 +102,11 @@ func (repo *UserRepository) CreateUserWithCredentials(ctx context.Context, req p
 			repo.logger.Error("Repository", "Failed to create verification record", "error", err)
 			return domain.ErrDatabaseInternalError
 		}
+
+		if err := repo.createOutboxEvent(ctx, tx, req.Event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", repoUser.ID)
+			return domain.ErrDatabaseInternalError
+		}
 		return nil
 	}); err != nil {
 		repo.logger.Error("Repository", "Error from transaction | CreateUSerWithCredentials", "error", err)
@@ -135,7 +166,7 @@ func (repo *UserRepository) GetVerificationByToken(ctx context.Context, token st
 	return &record, nil
 }
 
-func (repo *UserRepository) ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID) error {
+func (repo *UserRepository) ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, event *domainevents.Event) error {
 	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Update Token to consumed
 		if err := tx.Model(&userverification.UserVerification{}).Where("id = ?", verificationID).Update("status", "consumed").Error; err != nil {
@@ -145,12 +176,16 @@ func (repo *UserRepository) ConfirmVerification(ctx context.Context, userID uuid
 		if err := tx.Model(&repouser.User{}).Where("id = ?", userID).Update("user_status", "active").Error; err != nil {
 			return domain.ErrRepositoryInternalError
 		}
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", userID)
+			return domain.ErrRepositoryInternalError
+		}
 		return nil
 	})
 }
 
-func (repo *UserRepository) GetVerificationByUserID(ctx context.Context, userID uuid.UUID) (*userverification.UserVerification, error) {
-	record, err := gorm.G[userverification.UserVerification](repo.db).Where("user_id = ?", userID).Order("created_at DESC").Take(ctx)
+func (repo *UserRepository) GetVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error) {
+	record, err := gorm.G[userverification.UserVerification](repo.db).Where("user_id = ? AND purpose = ?", userID, purpose).Order("created_at DESC").Take(ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			repo.logger.Error(domain.LogRepository, "Error for resend verification not found existing token record by user_id", "error", err, "user_id", userID)
@@ -163,9 +198,9 @@ func (repo *UserRepository) GetVerificationByUserID(ctx context.Context, userID
 }
 
 // Bug the old ones are becoming in pedning state: p, i, p, p should be p, i, i, i
-func (repo *UserRepository) RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification) error {
+func (repo *UserRepository) RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification, event *domainevents.Event) error {
 	if err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		_, err := gorm.G[userverification.UserVerification](repo.db).Where("ID = ?", recordID).Update(ctx, "status", status)
+		_, err := gorm.G[userverification.UserVerification](tx).Where("ID = ?", recordID).Update(ctx, "status", status)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				repo.logger.Error(domain.LogRepository, "Error not found user email validation record by id", "error", err, "ID", recordID)
@@ -186,6 +221,10 @@ func (repo *UserRepository) RotateVerificationToken(ctx context.Context, recordI
 			return domain.ErrDatabaseInternalError
 		}
 
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", req.UserID)
+			return domain.ErrDatabaseInternalError
+		}
 		return nil
 	}); err != nil {
 		return domain.ErrDatabaseInternalError
@@ -193,8 +232,8 @@ func (repo *UserRepository) RotateVerificationToken(ctx context.Context, recordI
 	return nil
 }
 
-func (repo *UserRepository) GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, timeDuration time.Time) (int64, error) {
-	count, err := gorm.G[userverification.UserVerification](repo.db).Where("user_id = ? AND created_at >= ?", user_id, timeDuration).Count(ctx, "ID")
+func (repo *UserRepository) GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, purpose string, timeDuration time.Time) (int64, error) {
+	count, err := gorm.G[userverification.UserVerification](repo.db).Where("user_id = ? AND purpose = ? AND created_at >= ?", user_id, purpose, timeDuration).Count(ctx, "ID")
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			repo.logger.Error(domain.LogRepository, "Error not found user verification records", "error", err, "ID", user_id)
@@ -215,66 +254,654 @@ func (repo *UserRepository) UpdateUserVerificationTokenStatus(ctx context.Contex
 	return nil
 }
 
-// func (repo *UserRepository) CreateUserSession(ctx context.Context, session *repousersessions.UserSessions) error {
-// 	if err := gorm.G[repousersessions.UserSessions](repo.db).Create(ctx, session); err != nil {
-// 		repo.logger.Error(domain.LogRepository, "Error while creating a user session", "error", err, "user_id", session.UserID)
-// 		return domain.ErrDatabaseInternalError
-// 	}
-// 	return nil
-// }
+// CreatePasswordResetToken invalidates the user's pending reset tokens and
+// stores the new one, so only the latest emailed link works.
+func (repo *UserRepository) CreatePasswordResetToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	req.Purpose = domainuserverification.PurposePasswordReset
+	return repo.replacePendingToken(ctx, req, event)
+}
+
+// CreateEmailVerificationCode replaces the user's pending verification code.
+func (repo *UserRepository) CreateEmailVerificationCode(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	req.Purpose = domainuserverification.PurposeEmailVerificationCode
+	return repo.replacePendingToken(ctx, req, event)
+}
 
-func (repo *UserRepository) GetUserSessionCountByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
-	count, err := gorm.G[repousersessions.UserSessions](repo.db).Where("user_id = ?", userID).Count(ctx, "id")
+func (repo *UserRepository) GetPendingVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error) {
+	record, err := gorm.G[userverification.UserVerification](repo.db).
+		Where("user_id = ? AND purpose = ? AND status = ?", userID, purpose, "pending").
+		Order("created_at DESC").
+		Take(ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			repo.logger.Debug(domain.LogRepository, "User session not found", "error", err, "user_id", userID)
-			return 0, nil
+			return nil, domain.ErrNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Failed to get pending verification record", "error", err, "user_id", userID, "purpose", purpose)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &record, nil
+}
+
+// CountVerificationAttempt books one guess against a verification code before
+// it is checked, so concurrent guesses can't slip past the limit. Once
+// maxAttempts are booked the code is locked.
+func (repo *UserRepository) CountVerificationAttempt(ctx context.Context, verificationID uuid.UUID, maxAttempts int) error {
+	result := repo.db.WithContext(ctx).Model(&userverification.UserVerification{}).
+		Where("id = ? AND status = ? AND attempts < ?", verificationID, "pending", maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to count verification attempt", "error", result.Error, "verification_id", verificationID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrVerificationCodeLocked
+	}
+	return nil
+}
+
+func (repo *UserRepository) CreateMagicLinkToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	req.Purpose = domainuserverification.PurposeMagicLink
+	return repo.replacePendingToken(ctx, req, event)
+}
+
+// replacePendingToken invalidates the user's pending tokens of req.Purpose and
+// stores req along with the event that emails it, so only the latest emailed
+// link works.
+func (repo *UserRepository) replacePendingToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := gorm.G[userverification.UserVerification](tx).
+			Where("user_id = ? AND purpose = ? AND status = ?", req.UserID, req.Purpose, "pending").
+			Update(ctx, "status", "invalidated")
+		if err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to invalidate pending tokens", "error", err, "user_id", req.UserID, "purpose", req.Purpose)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if err := gorm.G[userverification.UserVerification](tx).Create(ctx, req); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				repo.logger.Warn(domain.LogRepository, "Token collision detected, retrying...", "user_id", req.UserID)
+				return domain.ErrTokenCollision
+			}
+			repo.logger.Error(domain.LogRepository, "Failed to create verification record", "error", err, "user_id", req.UserID, "purpose", req.Purpose)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", req.UserID, "purpose", req.Purpose)
+			return domain.ErrDatabaseInternalError
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenCollision) {
+			return err
+		}
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// ConsumeVerificationToken flips a pending token to consumed. Only one caller
+// can win; the others get ErrUsedToken.
+func (repo *UserRepository) ConsumeVerificationToken(ctx context.Context, verificationID uuid.UUID) error {
+	result := repo.db.WithContext(ctx).Model(&userverification.UserVerification{}).
+		Where("id = ? AND status = ?", verificationID, "pending").
+		Update("status", "consumed")
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to consume verification token", "error", result.Error, "verification_id", verificationID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUsedToken
+	}
+	return nil
+}
+
+// ResetUserPassword consumes the reset token, stores the new password hash,
+// signs the user out of every device and stores event, all in one
+// transaction.
+func (repo *UserRepository) ResetUserPassword(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, passwordHash string, event *domainevents.Event) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only a pending token can be consumed, so two concurrent resets with
+		// the same link cannot both succeed.
+		result := tx.Model(&userverification.UserVerification{}).
+			Where("id = ? AND status = ?", verificationID, "pending").
+			Update("status", "consumed")
+		if result.Error != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to consume password reset token", "error", result.Error, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrUsedToken
+		}
+
+		if err := repo.updatePasswordHash(ctx, tx, userID, passwordHash); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&repousersessions.UserSessions{}).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to revoke sessions after password reset", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrUsedToken) || errors.Is(err, domain.ErrUserNotFound) {
+			return err
+		}
+		repo.logger.Error(domain.LogRepository, "Error from transaction | ResetUserPassword", "error", err)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+func (repo *UserRepository) GetUserCredentialsByUserID(ctx context.Context, userID uuid.UUID) (*repouser.UserCredentials, error) {
+	creds, err := gorm.G[repouser.UserCredentials](repo.db).Where("user_id = ?", userID).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrUserNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Error while querying user credentials", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &creds, nil
+}
+
+// ChangeUserPassword stores the new password hash and event, and revokes every
+// session of the user except keepSessionID. Pass uuid.Nil to revoke them all.
+func (repo *UserRepository) ChangeUserPassword(ctx context.Context, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID, event *domainevents.Event) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repo.updatePasswordHash(ctx, tx, userID, passwordHash); err != nil {
+			return err
+		}
+
+		if _, err := deleteSessions(tx, domainusersessions.LogoutReasonPasswordChange, "user_id = ? AND id <> ?", userID, keepSessionID); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to revoke sessions after password change", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return err
+		}
+		repo.logger.Error(domain.LogRepository, "Error from transaction | ChangeUserPassword", "error", err)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+func (repo *UserRepository) updatePasswordHash(ctx context.Context, tx *gorm.DB, userID uuid.UUID, passwordHash string) error {
+	now := time.Now().UTC()
+	result := tx.WithContext(ctx).Model(&repouser.UserCredentials{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{
+			"password_hash":           passwordHash,
+			"last_password_change_at": now,
+			"updated_at":              now,
+		})
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to update user credentials", "error", result.Error, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// BookLoginAttempt counts a login against the account before its password is
+// checked. The user row is locked while the wait is checked and the next one
+// set, so concurrent guesses queue up behind each other instead of all
+// getting through before the first failure lands. The wait the account would
+// owe if this attempt fails is set right away; a successful login clears it
+// with UnlockUser.
+func (repo *UserRepository) BookLoginAttempt(ctx context.Context, userID uuid.UUID, delay ports.LoginDelay) (int, error) {
+	var attempts int
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user repouser.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "failed_login_attempts", "locked_until").
+			Where("id = ?", userID).
+			Take(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrUserNotFound
+			}
+			repo.logger.Error(domain.LogRepository, "Failed to lock user for login attempt", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+
+		now := time.Now()
+		if user.LockedUntil != nil && user.LockedUntil.After(now) {
+			return &domain.RetryAfterError{Err: domain.ErrLoginThrottled, RetryAfter: user.LockedUntil.Sub(now)}
+		}
+
+		attempts = user.FailedLoginAttempts + 1
+		updates := map[string]interface{}{"failed_login_attempts": attempts}
+		if wait := delay(attempts); wait > 0 {
+			updates["locked_until"] = now.Add(wait)
+		}
+		if err := tx.Model(&user).UpdateColumns(updates).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to book login attempt", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrLoginThrottled) {
+			return 0, err
 		}
-		repo.logger.Error(domain.LogRepository, "Error while Getting the User session count by ID", "error", err, "user_id", userID)
 		return 0, domain.ErrDatabaseInternalError
 	}
-	return count, nil
+	return attempts, nil
+}
+
+// RecordFailedLogin audits a wrong password, booked earlier as the given
+// attempt. The lock audit is optional, for the attempt that locked the account.
+func (repo *UserRepository) RecordFailedLogin(ctx context.Context, userID uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error {
+	newValue := fmt.Sprintf("attempts=%d", attempts)
+	audits := []*repousersessions.AuditUserSessions{{
+		UserID:    userID,
+		EventType: domainusersessions.AuditEventLoginFailed,
+		NewValue:  &newValue,
+	}}
+	if lockAudit != nil {
+		audits = append(audits, lockAudit)
+	}
+	if err := repo.db.WithContext(ctx).Create(audits).Error; err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to write failed login audit record", "error", err, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// UnlockUser clears the failed login count and any lock. The audit record is
+// optional: a successful login resets quietly, an admin unlock is audited.
+func (repo *UserRepository) UnlockUser(ctx context.Context, userID uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+	return repo.updateUserLock(ctx, userID, map[string]interface{}{
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
+	}, audit)
+}
+
+func (repo *UserRepository) updateUserLock(ctx context.Context, userID uuid.UUID, updates map[string]interface{}, audit *repousersessions.AuditUserSessions) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&repouser.User{}).Where("id = ?", userID).UpdateColumns(updates)
+		if result.Error != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to update account lock", "error", result.Error, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+
+		if audit != nil {
+			if err := tx.Create(audit).Error; err != nil {
+				repo.logger.Error(domain.LogRepository, "Failed to write account lock audit record", "error", err, "user_id", userID)
+				return domain.ErrDatabaseInternalError
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return err
+		}
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// UpsertTOTPEnrollment stores a new, unconfirmed TOTP secret. Enrolling again
+// before confirming replaces the previous secret.
+func (repo *UserRepository) UpsertTOTPEnrollment(ctx context.Context, userID uuid.UUID, secretCiphertext []byte) error {
+	record := repousermfa.UserMFATOTP{
+		UserID:           userID,
+		SecretCiphertext: secretCiphertext,
+	}
+	err := repo.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"secret_ciphertext": secretCiphertext,
+			"last_used_step":    0,
+			"confirmed_at":      nil,
+			"updated_at":        time.Now().UTC(),
+		}),
+	}).Create(&record).Error
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to store TOTP enrollment", "error", err, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
 }
 
-func (repo *UserRepository) CreateAndDeleteOldUserSession(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error) {
-	const MaxSessions = 5
+func (repo *UserRepository) GetTOTPByUserID(ctx context.Context, userID uuid.UUID) (*repousermfa.UserMFATOTP, error) {
+	record, err := gorm.G[repousermfa.UserMFATOTP](repo.db).Where("user_id = ?", userID).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrMFANotEnrolled
+		}
+		repo.logger.Error(domain.LogRepository, "Error while querying TOTP factor", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &record, nil
+}
+
+// ConfirmTOTPEnrollment marks the pending secret as confirmed, turns MFA on
+// for the user and stores the first batch of recovery codes.
+func (repo *UserRepository) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		result := tx.Model(&repousermfa.UserMFATOTP{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{"confirmed_at": now, "last_used_step": step, "updated_at": now})
+		if result.Error != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to confirm TOTP enrollment", "error", result.Error, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		if result.RowsAffected == 0 {
+			return domain.ErrMFAAlreadyEnabled
+		}
+
+		if err := tx.Model(&repouser.User{}).Where("id = ?", userID).Update("is_mfa_enabled", true).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to enable MFA on user", "error", err, "user_id", userID)
+			return domain.ErrDatabaseInternalError
+		}
+		return repo.replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+			return err
+		}
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// ConsumeTOTPStep records step as used. It fails with ErrMFACodeReused when a
+// code of the same or a later step was already accepted.
+func (repo *UserRepository) ConsumeTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	result := repo.db.WithContext(ctx).Model(&repousermfa.UserMFATOTP{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?", userID, step).
+		Updates(map[string]interface{}{"last_used_step": step, "updated_at": time.Now().UTC()})
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to record TOTP step", "error", result.Error, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrMFACodeReused
+	}
+	return nil
+}
+
+func (repo *UserRepository) CreateMFAChallenge(ctx context.Context, challenge *repousermfa.MFAChallenge) error {
+	if err := gorm.G[repousermfa.MFAChallenge](repo.db).Create(ctx, challenge); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return domain.ErrTokenCollision
+		}
+		repo.logger.Error(domain.LogRepository, "Failed to create MFA challenge", "error", err, "user_id", challenge.UserID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+func (repo *UserRepository) GetMFAChallengeByToken(ctx context.Context, token string) (*repousermfa.MFAChallenge, error) {
+	challenge, err := gorm.G[repousermfa.MFAChallenge](repo.db).Where("token = ?", token).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrInvalidMFAChallenge
+		}
+		repo.logger.Error(domain.LogRepository, "Error while querying MFA challenge", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &challenge, nil
+}
+
+// CountMFAChallengeAttempt books one guess against a challenge before the code
+// is checked, so concurrent guesses can't slip past the limit. Once
+// maxAttempts are booked the challenge is spent.
+func (repo *UserRepository) CountMFAChallengeAttempt(ctx context.Context, challengeID uuid.UUID, maxAttempts int) error {
+	result := repo.db.WithContext(ctx).Model(&repousermfa.MFAChallenge{}).
+		Where("id = ? AND attempts < ?", challengeID, maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to count MFA challenge attempt", "error", result.Error, "challenge_id", challengeID)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrInvalidMFAChallenge
+	}
+	return nil
+}
+
+// DeleteMFAChallenge consumes a challenge. Only one caller can delete it, so a
+// challenge never yields two sessions.
+func (repo *UserRepository) DeleteMFAChallenge(ctx context.Context, challengeID uuid.UUID) error {
+	rows, err := gorm.G[repousermfa.MFAChallenge](repo.db).Where("id = ?", challengeID).Delete(ctx)
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to delete MFA challenge", "error", err, "challenge_id", challengeID)
+		return domain.ErrDatabaseInternalError
+	}
+	if rows == 0 {
+		return domain.ErrInvalidMFAChallenge
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes drops the user's whole previous batch, used or not.
+func (repo *UserRepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return repo.replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+func (repo *UserRepository) replaceRecoveryCodes(ctx context.Context, tx *gorm.DB, userID uuid.UUID, codeHashes []string) error {
+	if err := tx.WithContext(ctx).Where("user_id = ?", userID).Delete(&repousermfa.UserMFARecoveryCode{}).Error; err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to delete old recovery codes", "error", err, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	codes := make([]repousermfa.UserMFARecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, repousermfa.UserMFARecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if err := tx.WithContext(ctx).Create(&codes).Error; err != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to store recovery codes", "error", err, "user_id", userID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+func (repo *UserRepository) GetUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error) {
+	codes, err := gorm.G[repousermfa.UserMFARecoveryCode](repo.db).Where("user_id = ? AND used_at IS NULL", userID).Find(ctx)
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Error while querying recovery codes", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return codes, nil
+}
+
+func (repo *UserRepository) CreateWebAuthnCredential(ctx context.Context, credential *repouserwebauthn.WebAuthnCredential) error {
+	if err := gorm.G[repouserwebauthn.WebAuthnCredential](repo.db).Create(ctx, credential); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return domain.ErrPasskeyAlreadyRegistered
+		}
+		repo.logger.Error(domain.LogRepository, "Failed to store passkey", "error", err, "user_id", credential.UserID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+func (repo *UserRepository) GetWebAuthnCredentialsByUserID(ctx context.Context, userID uuid.UUID) ([]repouserwebauthn.WebAuthnCredential, error) {
+	credentials, err := gorm.G[repouserwebauthn.WebAuthnCredential](repo.db).Where("user_id = ?", userID).Find(ctx)
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Error while querying passkeys", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return credentials, nil
+}
+
+func (repo *UserRepository) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (*repouserwebauthn.WebAuthnCredential, error) {
+	credential, err := gorm.G[repouserwebauthn.WebAuthnCredential](repo.db).Where("credential_id = ?", credentialID).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Error while querying passkey", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &credential, nil
+}
+
+// UpdateWebAuthnSignCount stores the counter of the last assertion. The counter
+// may only move forward, checked in the UPDATE itself so that of two
+// concurrent logins with the same counter only one wins; authenticators that
+// don't keep one report 0 every time. ErrPasskeyCloned means no row moved.
+func (repo *UserRepository) UpdateWebAuthnSignCount(ctx context.Context, id uuid.UUID, signCount int64) error {
+	result := repo.db.WithContext(ctx).Model(&repouserwebauthn.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", id, signCount, signCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": time.Now().UTC()})
+	if result.Error != nil {
+		repo.logger.Error(domain.LogRepository, "Failed to update passkey sign count", "error", result.Error, "credential_id", id)
+		return domain.ErrDatabaseInternalError
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrPasskeyCloned
+	}
+	return nil
+}
+
+// CreateUserSessionWithinLimit creates a session unless the user already holds
+// limit.Max of them, in which case the strategy decides: the login is refused
+// with ErrTooManyUserSessions or older sessions are evicted to make room.
+// The new session is audited as LOGIN and evictions as
+// CONCURRENCY_LIMIT_REACHED. The user row is locked
+// for the whole transaction, so concurrent logins can't both see a free slot.
+// A recovery code the login spends is used up and audited in the same
+// transaction.
+func (repo *UserRepository) CreateUserSessionWithinLimit(ctx context.Context, sessionReq *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
 	var newSession repousersessions.UserSessions
 
 	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var count int64
-		// 1. Count existing sessions
-		if err := tx.Model(&repousersessions.UserSessions{}).Where("user_id = ?", sessionReq.UserID).Count(&count).Error; err != nil {
+		var user repouser.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", sessionReq.UserID).Take(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrUserNotFound
+			}
 			return err
 		}
 
-		// 2. If at limit, delete the oldest
-		if count >= MaxSessions {
-			var oldestSession repousersessions.UserSessions
-			// Find the oldest based on LastActive (or CreatedAt)
-			if err := tx.Where("user_id = ?", sessionReq.UserID).Order("last_active ASC").First(&oldestSession).Error; err != nil {
-				return err
+		now := time.Now().UTC()
+		if sessionReq.RecoveryCodeID != uuid.Nil {
+			result := tx.Model(&repousermfa.UserMFARecoveryCode{}).
+				Where("id = ? AND user_id = ? AND used_at IS NULL", sessionReq.RecoveryCodeID, sessionReq.UserID).
+				Update("used_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return domain.ErrMFACodeReused
+			}
+		}
+
+		if err := tx.Where("user_id = ? AND expires_at < ?", sessionReq.UserID, now).Delete(&repousersessions.UserSessions{}).Error; err != nil {
+			return err
+		}
+
+		var sessions []repousersessions.UserSessions
+		if err := tx.Select("id", "last_active").Where("user_id = ?", sessionReq.UserID).Order("last_active ASC").Find(&sessions).Error; err != nil {
+			return err
+		}
+
+		evict, err := sessionsToEvict(sessions, limit, now)
+		if err != nil {
+			return err
+		}
+		if len(evict) > 0 {
+			ids := make([]uuid.UUID, 0, len(evict))
+			for _, session := range evict {
+				ids = append(ids, session.ID)
 			}
-			// Delete ONLY the oldest record by its primary key
-			if err := tx.Delete(&oldestSession).Error; err != nil {
+			if err := tx.Where("id IN ?", ids).Delete(&repousersessions.UserSessions{}).Error; err != nil {
 				return err
 			}
 		}
 
-		// 3. Create the new session
 		newSession = repousersessions.UserSessions{
+			ID:        sessionReq.ID,
 			UserID:    sessionReq.UserID,
 			IPAddress: sessionReq.IPAddress,
 			UserAgent: sessionReq.UserAgent,
-			Device:    &sessionReq.Device,
+			Device:    deviceOrNil(sessionReq.Device),
 			Token:     sessionReq.Token,
 			ExpiresAt: sessionReq.ExpiresAt,
 		}
+		if err := tx.Create(&newSession).Error; err != nil {
+			return err
+		}
 
-		return tx.Create(&newSession).Error
-	})
+		loginValue := "ip=" + sessionReq.IPAddress
+		if sessionReq.Device != "" {
+			loginValue += ";device=" + sessionReq.Device
+		}
+		login := repousersessions.AuditUserSessions{
+			SessionID: newSession.ID,
+			UserID:    sessionReq.UserID,
+			EventType: domainusersessions.AuditEventLogin,
+			NewValue:  &loginValue,
+		}
+		if err := tx.Create(&login).Error; err != nil {
+			return err
+		}
+		if sessionReq.RecoveryCodeID != uuid.Nil {
+			remaining := fmt.Sprintf("remaining=%d", sessionReq.RecoveryCodesLeft)
+			audit := repousersessions.AuditUserSessions{
+				SessionID: newSession.ID,
+				UserID:    sessionReq.UserID,
+				EventType: domainusersessions.AuditEventMFARecoveryCodeUsed,
+				NewValue:  &remaining,
+			}
+			if err := tx.Create(&audit).Error; err != nil {
+				return err
+			}
+		}
 
+		for _, session := range evict {
+			newValue := fmt.Sprintf("strategy=%s;replaced_by=%s", limit.Strategy, newSession.ID)
+			audit := repousersessions.AuditUserSessions{
+				SessionID: session.ID,
+				UserID:    sessionReq.UserID,
+				EventType: domainusersessions.AuditEventConcurrencyLimitReached,
+				NewValue:  &newValue,
+			}
+			if err := tx.Create(&audit).Error; err != nil {
+				return err
+			}
+		}
+		return repo.createOutboxEvent(ctx, tx, sessionReq.Event)
+	})
 	if err != nil {
-		repo.logger.Error(domain.LogRepository, "Failed to manage session limit", "error", err)
+		if errors.Is(err, domain.ErrTooManyUserSessions) || errors.Is(err, domain.ErrUserNotFound) || errors.Is(err, domain.ErrMFACodeReused) {
+			return nil, err
+		}
+		repo.logger.Error(domain.LogRepository, "Failed to create session within limit", "error", err, "user_id", sessionReq.UserID)
 		return nil, domain.ErrDatabaseInternalError
 	}
 
@@ -287,45 +914,44 @@ func (repo *UserRepository) CreateAndDeleteOldUserSession(ctx context.Context, s
 	}, nil
 }
 
-func (repo *UserRepository) CreateUserSession(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error) {
-	newSession := repousersessions.UserSessions{
-		UserID:    sessionReq.UserID,
-		IPAddress: sessionReq.IPAddress,
-		UserAgent: sessionReq.UserAgent,
-		Device:    &sessionReq.Device,
-		Token:     sessionReq.Token,
-		ExpiresAt: sessionReq.ExpiresAt,
-	}
-	err := gorm.G[repousersessions.UserSessions](repo.db).Create(ctx, &newSession)
-	if err != nil {
-		repo.logger.Error(domain.LogRepository, "Database error while creating new session", "error", err)
-		return nil, domain.ErrDatabaseInternalError
+// sessionsToEvict picks the sessions to sign out so one more fits under the
+// limit. sessions must be ordered by last activity, oldest first.
+func sessionsToEvict(sessions []repousersessions.UserSessions, limit ports.SessionLimit, now time.Time) ([]repousersessions.UserSessions, error) {
+	excess := len(sessions) - limit.Max + 1
+	if excess <= 0 {
+		return nil, nil
 	}
 
-	return &ports.CreateUserSessionResponse{
-		ID:         newSession.ID,
-		UserID:     newSession.UserID,
-		Token:      newSession.Token,
-		ExpiresAt:  newSession.ExpiresAt,
-		LastActive: newSession.LastActive,
-	}, nil
+	switch limit.Strategy {
+	case ports.SessionLimitEvictOldest:
+		return sessions[:excess], nil
+	case ports.SessionLimitEvictIdle:
+		idleSince := now.Add(-limit.IdleTimeout)
+		idle := 0
+		for idle < len(sessions) && sessions[idle].LastActive.Before(idleSince) {
+			idle++
+		}
+		if idle >= excess {
+			return sessions[:excess], nil
+		}
+	}
+	return nil, domain.ErrTooManyUserSessions
 }
 
-func (repo *UserRepository) DeleteUserSession(ctx context.Context, session_id uuid.UUID) error {
-	RowsAffected, err := gorm.G[repousersessions.UserSessions](repo.db).
-		Where("id = ?", session_id).
-		Delete(ctx)
-
+// DeleteUserSession ends one session and audits it as LOGOUT with the reason.
+func (repo *UserRepository) DeleteUserSession(ctx context.Context, session_id uuid.UUID, reason string) error {
+	var deleted []repousersessions.UserSessions
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = deleteSessions(tx, reason, "id = ?", session_id)
+		return err
+	})
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			repo.logger.Debug(domain.LogRepository, "Error while deleting a user session", "error", err)
-			return domain.ErrRepositoryInternalError
-		}
 		repo.logger.Error(domain.LogRepository, "Database error while deleting a session", "error", err)
 		return domain.ErrDatabaseInternalError
 	}
 
-	if RowsAffected == 0 {
+	if len(deleted) == 0 {
 		repo.logger.Debug(domain.LogRepository, "No session found to delete", "session_id", session_id)
 		return domain.ErrRepositoryInternalError
 	}
@@ -333,11 +959,14 @@ func (repo *UserRepository) DeleteUserSession(ctx context.Context, session_id uu
 	return nil
 }
 
-func (repo *UserRepository) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+// DeleteUser signs the user out everywhere, soft deletes the user and stores
+// event.
+func (repo *UserRepository) DeleteUser(ctx context.Context, userID uuid.UUID, event *domainevents.Event) error {
 	return repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Manually wipe all sessions for this user first
 		// This ensures they are logged out of all devices
-		if err := tx.Where("user_id = ?", userID).Delete(&repousersessions.UserSessions{}).Error; err != nil {
+		deleted, err := deleteSessions(tx, domainusersessions.LogoutReasonAccountDeleted, "user_id = ?", userID)
+		if err != nil {
 			repo.logger.Error(domain.LogRepository, "Failed to clear sessions during user deletion", "user_id", userID, "error", err)
 			return domain.ErrDatabaseInternalError
 		}
@@ -352,19 +981,335 @@ func (repo *UserRepository) DeleteUser(ctx context.Context, userID uuid.UUID) er
 			return domain.ErrUserNotFound
 		}
 
+		// The user row is soft deleted, so its audit trail stays behind
+		newValue := fmt.Sprintf("sessions=%d", len(deleted))
+		audit := repousersessions.AuditUserSessions{
+			UserID:    userID,
+			EventType: domainusersessions.AuditEventAccountDeleted,
+			NewValue:  &newValue,
+		}
+		if err := tx.Create(&audit).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to write account deletion audit record", "user_id", userID, "error", err)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if err := repo.createOutboxEvent(ctx, tx, event); err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to create outbox event", "user_id", userID, "error", err)
+			return domain.ErrDatabaseInternalError
+		}
 		return nil
 	})
 }
 
-func (repo *UserRepository) DeleteUserDeadSessions(ctx context.Context, userID uuid.UUID) error {
-	_, err := gorm.G[repousersessions.UserSessions](repo.db).Where("user_id = ? AND expires_at < ?", userID, time.Now().UTC()).Delete(ctx)
+// GetUserSessionsByUserID returns the unexpired sessions of a user, most
+// recently used first.
+func (repo *UserRepository) GetUserSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]repousersessions.UserSessions, error) {
+	sessions, err := gorm.G[repousersessions.UserSessions](repo.db).
+		Where("user_id = ? AND expires_at > ?", userID, time.Now().UTC()).
+		Order("last_active DESC").
+		Find(ctx)
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Database error while listing user sessions", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return sessions, nil
+}
+
+// DeleteUserSessionOfUser deletes a session only if it belongs to userID, so
+// one user can't revoke another's session by guessing its ID. event is only
+// stored when the session was deleted.
+func (repo *UserRepository) DeleteUserSessionOfUser(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, event *domainevents.Event) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted, err := deleteSessions(tx, domainusersessions.LogoutReasonRevoked, "id = ? AND user_id = ?", sessionID, userID)
+		if err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return domain.ErrSessionNotFound
+		}
+		return repo.createOutboxEvent(ctx, tx, event)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return err
+		}
+		repo.logger.Error(domain.LogRepository, "Database error while revoking a session", "error", err, "session_id", sessionID)
+		return domain.ErrDatabaseInternalError
+	}
+	return nil
+}
+
+// DeleteOtherUserSessions deletes every session of userID but keepSessionID
+// and returns how many were deleted. event is only stored when there were
+// any.
+func (repo *UserRepository) DeleteOtherUserSessions(ctx context.Context, userID uuid.UUID, keepSessionID uuid.UUID, event *domainevents.Event) (int64, error) {
+	var deleted []repousersessions.UserSessions
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		deleted, err = deleteSessions(tx, domainusersessions.LogoutReasonRevoked, "user_id = ? AND id <> ?", userID, keepSessionID)
+		if err != nil || len(deleted) == 0 {
+			return err
+		}
+		return repo.createOutboxEvent(ctx, tx, event)
+	})
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Database error while revoking other sessions", "error", err, "user_id", userID)
+		return 0, domain.ErrDatabaseInternalError
+	}
+	return int64(len(deleted)), nil
+}
+
+// deleteSessions deletes the sessions matching the condition and writes a
+// LOGOUT audit record for each of them, both on tx.
+func deleteSessions(tx *gorm.DB, reason string, query interface{}, args ...interface{}) ([]repousersessions.UserSessions, error) {
+	var deleted []repousersessions.UserSessions
+	err := tx.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "user_id"}}}).
+		Where(query, args...).
+		Delete(&deleted).Error
+	if err != nil || len(deleted) == 0 {
+		return nil, err
+	}
+
+	newValue := "reason=" + reason
+	audits := make([]repousersessions.AuditUserSessions, 0, len(deleted))
+	for _, session := range deleted {
+		audits = append(audits, repousersessions.AuditUserSessions{
+			SessionID: session.ID,
+			UserID:    session.UserID,
+			EventType: domainusersessions.AuditEventLogout,
+			NewValue:  &newValue,
+		})
+	}
+	if err := tx.Create(&audits).Error; err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func (repo *UserRepository) GetUserSessionByToken(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+	session, err := gorm.G[repousersessions.UserSessions](repo.db).Where("token = ?", token).Take(ctx)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			repo.logger.Debug(domain.LogRepository, "Error while deleting dead user session(s)", "error", err)
-			return domain.ErrRepositoryInternalError
+			return nil, domain.ErrSessionNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Database error while querying session by token", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &session, nil
+}
+
+func (repo *UserRepository) GetUserSessionByID(ctx context.Context, sessionID uuid.UUID) (*repousersessions.UserSessions, error) {
+	session, err := gorm.G[repousersessions.UserSessions](repo.db).Where("id = ?", sessionID).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrSessionNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Database error while querying session by id", "error", err, "session_id", sessionID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return &session, nil
+}
+
+func (repo *UserRepository) GetSessionIDByRotatedToken(ctx context.Context, token string) (uuid.UUID, error) {
+	record, err := gorm.G[repousersessions.RefreshTokenHistory](repo.db).Where("token = ?", token).Take(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, domain.ErrSessionNotFound
+		}
+		repo.logger.Error(domain.LogRepository, "Database error while querying refresh token history", "error", err)
+		return uuid.Nil, domain.ErrDatabaseInternalError
+	}
+	return record.SessionID, nil
+}
+
+// RotateUserSessionToken swaps the refresh token of a session and keeps the
+// old one in the history for reuse detection. The session follows the client:
+// a new IP or user agent is stored and audited as IP_CHANGE / UA_CHANGE.
+func (repo *UserRepository) RotateUserSessionToken(ctx context.Context, sessionID uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error) {
+	var session repousersessions.UserSessions
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the row and compare-and-swap on the old token, so two concurrent
+		// refreshes with the same token cannot both succeed.
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND token = ?", sessionID, oldToken).
+			Take(&session).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.ErrRefreshTokenReused
+			}
+			return err
+		}
+
+		now := time.Now().UTC()
+		updates := map[string]interface{}{"token": newToken, "last_active": now}
+		var audits []repousersessions.AuditUserSessions
+		if ipAddress != "" && !sameIP(session.IPAddress, ipAddress) {
+			updates["ip_address"] = ipAddress
+			audits = append(audits, sessionChangeAudit(session.ID, session.UserID, domainusersessions.AuditEventIPChange, session.IPAddress, ipAddress))
+			session.IPAddress = ipAddress
+		}
+		if userAgent != "" && session.UserAgent != userAgent {
+			updates["user_agent"] = userAgent
+			audits = append(audits, sessionChangeAudit(session.ID, session.UserID, domainusersessions.AuditEventUAChange, session.UserAgent, userAgent))
+			session.UserAgent = userAgent
+		}
+
+		if err := tx.Model(&repousersessions.UserSessions{}).Where("id = ?", sessionID).Updates(updates).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to rotate session token", "error", err, "session_id", sessionID)
+			return domain.ErrDatabaseInternalError
+		}
+		session.Token = newToken
+		session.LastActive = now
+
+		history := repousersessions.RefreshTokenHistory{
+			SessionID: sessionID,
+			Token:     oldToken,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			repo.logger.Error(domain.LogRepository, "Failed to store rotated refresh token", "error", err, "session_id", sessionID)
+			return domain.ErrDatabaseInternalError
+		}
+
+		if len(audits) > 0 {
+			if err := tx.Create(&audits).Error; err != nil {
+				repo.logger.Error(domain.LogRepository, "Failed to write session change audit records", "error", err, "session_id", sessionID)
+				return domain.ErrDatabaseInternalError
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			return nil, err
+		}
+		repo.logger.Error(domain.LogRepository, "Error from transaction | RotateUserSessionToken", "error", err)
+		return nil, domain.ErrDatabaseInternalError
+	}
+
+	return &ports.CreateUserSessionResponse{
+		ID:         session.ID,
+		UserID:     session.UserID,
+		Token:      session.Token,
+		ExpiresAt:  session.ExpiresAt,
+		LastActive: session.LastActive,
+	}, nil
+}
+
+// ResolveSessionAnomaly audits the changed IP and user agent of a session and
+// applies the action in the same transaction: "log" moves the session to the
+// new client, "reauth" leaves it alone and "revoke" deletes it. The audit
+// and the alert event, if any, are stored with it, at most once per
+// AlertInterval while the session lives on.
+func (repo *UserRepository) ResolveSessionAnomaly(ctx context.Context, anomaly *ports.SessionAnomaly, event *domainevents.Event) error {
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var audits []repousersessions.AuditUserSessions
+		updates := map[string]interface{}{}
+		if anomaly.IPChanged {
+			audits = append(audits, sessionChangeAudit(anomaly.SessionID, anomaly.UserID, domainusersessions.AuditEventIPChange, anomaly.PreviousIP, anomaly.IPAddress))
+			updates["ip_address"] = anomaly.IPAddress
+		}
+		if anomaly.UAChanged {
+			audits = append(audits, sessionChangeAudit(anomaly.SessionID, anomaly.UserID, domainusersessions.AuditEventUAChange, anomaly.PreviousUserAgent, anomaly.UserAgent))
+			updates["user_agent"] = anomaly.UserAgent
+		}
+
+		switch anomaly.Action {
+		case ports.SessionAnomalyLog:
+			if len(updates) > 0 {
+				result := tx.Model(&repousersessions.UserSessions{}).Where("id = ?", anomaly.SessionID).Updates(updates)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return domain.ErrSessionNotFound
+				}
+			}
+		case ports.SessionAnomalyRevoke:
+			deleted, err := deleteSessions(tx, domainusersessions.LogoutReasonAnomaly, "id = ?", anomaly.SessionID)
+			if err != nil {
+				return err
+			}
+			if len(deleted) == 0 {
+				return domain.ErrSessionNotFound
+			}
 		}
-		repo.logger.Error(domain.LogRepository, "Database error while deleting dead user session(s)", "error", err)
+
+		// A session that keeps running is audited and alerted about once per
+		// AlertInterval; anomalies in between only move it to the new client
+		if anomaly.Action != ports.SessionAnomalyRevoke {
+			now := time.Now()
+			result := tx.Model(&repousersessions.UserSessions{}).
+				Where("id = ? AND (anomaly_alerted_at IS NULL OR anomaly_alerted_at <= ?)", anomaly.SessionID, now.Add(-anomaly.AlertInterval)).
+				UpdateColumn("anomaly_alerted_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+		}
+
+		if len(audits) > 0 {
+			if err := tx.Create(&audits).Error; err != nil {
+				return err
+			}
+		}
+		return repo.createOutboxEvent(ctx, tx, event)
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return err
+		}
+		repo.logger.Error(domain.LogRepository, "Error from transaction | ResolveSessionAnomaly", "error", err, "session_id", anomaly.SessionID)
 		return domain.ErrDatabaseInternalError
 	}
 	return nil
 }
+
+// sessionChangeAudit records a session attribute changing between requests.
+func sessionChangeAudit(sessionID, userID uuid.UUID, eventType, oldValue, newValue string) repousersessions.AuditUserSessions {
+	return repousersessions.AuditUserSessions{
+		SessionID: sessionID,
+		UserID:    userID,
+		EventType: eventType,
+		OldValue:  &oldValue,
+		NewValue:  &newValue,
+	}
+}
+
+// sameIP compares addresses as IPs where possible, since an inet value may
+// come back with a /32 or /128 suffix or in another notation.
+func sameIP(a, b string) bool {
+	hostA, _, _ := strings.Cut(a, "/")
+	hostB, _, _ := strings.Cut(b, "/")
+	ipA, errA := netip.ParseAddr(hostA)
+	ipB, errB := netip.ParseAddr(hostB)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ipA.Unmap() == ipB.Unmap()
+}
+
+// GetAuditEventsByUserID returns up to limit audit events of a user, newest
+// first, starting after the given cursor (nil for the first page).
+func (repo *UserRepository) GetAuditEventsByUserID(ctx context.Context, userID uuid.UUID, after *ports.AuditCursor, limit int) ([]repousersessions.AuditUserSessions, error) {
+	query := gorm.G[repousersessions.AuditUserSessions](repo.db).Where("user_id = ?", userID)
+	if after != nil {
+		query = query.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID)
+	}
+	events, err := query.Order("created_at DESC, id DESC").Limit(limit).Find(ctx)
+	if err != nil {
+		repo.logger.Error(domain.LogRepository, "Database error while listing audit events", "error", err, "user_id", userID)
+		return nil, domain.ErrDatabaseInternalError
+	}
+	return events, nil
+}
+
+// deviceOrNil stores an unknown device as NULL rather than "".
+func deviceOrNil(device string) *string {
+	if device == "" {
+		return nil
+	}
+	return &device
+}
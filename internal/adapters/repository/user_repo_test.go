@@ -1,14 +1,22 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
 	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainusersessions "github.com/golang-auth/internal/core/domain/user_sessions"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -29,7 +37,7 @@ func TestMain(m *testing.M) {
 
 func TestUserRepository_GetUserByEmail(t *testing.T) {
 	testutil.TruncateAllTables(testDB)
-	repo := NewUserRepository(testDB, &testutil.NoopLogger{})
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
 	ctx := context.Background()
 
 	t.Run("Should return ErrNotFound when user doesn't exist", func(t *testing.T) {
@@ -60,7 +68,7 @@ func TestUserRepository_GetUserByEmail(t *testing.T) {
 }
 
 func TestUserRepository_CreateUserWithCredentials(t *testing.T) {
-	repo := NewUserRepository(testDB, &testutil.NoopLogger{})
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
 	ctx := context.Background()
 
 	t.Run("Should successfully create user and credentials", func(t *testing.T) {
@@ -117,3 +125,296 @@ func TestUserRepository_CreateUserWithCredentials(t *testing.T) {
 		}
 	})
 }
+
+func TestUserRepository_BookLoginAttempt(t *testing.T) {
+	testutil.TruncateAllTables(testDB)
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+	ctx := context.Background()
+
+	email := "guessed@test.com"
+	if err := repo.CreateUserWithCredentials(ctx, ports.UserAndCredentialsRequest{Email: email, PasswordHash: "hashed_pass"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	user, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Three free attempts, then a minute's wait
+	delay := func(failures int) time.Duration {
+		if failures <= 3 {
+			return 0
+		}
+		return time.Minute
+	}
+
+	t.Run("Concurrent guesses stop at the first wait", func(t *testing.T) {
+		const guesses = 10
+		var wg sync.WaitGroup
+		var booked, throttled atomic.Int32
+		for range guesses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.BookLoginAttempt(ctx, user.ID, delay)
+				switch {
+				case err == nil:
+					booked.Add(1)
+				case errors.Is(err, domain.ErrLoginThrottled):
+					throttled.Add(1)
+				default:
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if booked.Load() != 4 || throttled.Load() != guesses-4 {
+			t.Errorf("Expected 4 booked and %d throttled, got %d and %d", guesses-4, booked.Load(), throttled.Load())
+		}
+	})
+
+	t.Run("Unlock lets the next attempt through", func(t *testing.T) {
+		if err := repo.UnlockUser(ctx, user.ID, nil); err != nil {
+			t.Fatalf("UnlockUser() error: %v", err)
+		}
+		attempts, err := repo.BookLoginAttempt(ctx, user.ID, delay)
+		if err != nil || attempts != 1 {
+			t.Errorf("Expected attempt 1, got %d (%v)", attempts, err)
+		}
+	})
+}
+
+func TestUserRepository_ResolveSessionAnomaly(t *testing.T) {
+	testutil.TruncateAllTables(testDB)
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+	ctx := context.Background()
+
+	email := "moving@test.com"
+	if err := repo.CreateUserWithCredentials(ctx, ports.UserAndCredentialsRequest{Email: email, PasswordHash: "hashed_pass"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	user, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	session, err := repo.CreateUserSessionWithinLimit(ctx, &ports.CreateUserSessionRequest{
+		UserID:    user.ID,
+		IPAddress: "198.51.100.1",
+		UserAgent: "ua",
+		Token:     "session-token",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}, ports.SessionLimit{Max: 5, Strategy: ports.SessionLimitReject})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// A client flipping between two networks
+	moveTo := func(from, to string) {
+		t.Helper()
+		anomaly := &ports.SessionAnomaly{
+			SessionID:     session.ID,
+			UserID:        user.ID,
+			Action:        ports.SessionAnomalyLog,
+			AlertInterval: time.Hour,
+			IPChanged:     true,
+			PreviousIP:    from,
+			IPAddress:     to,
+		}
+		event := domainevents.New(ctx, user.ID, domainevents.SessionAnomalyDetected{Email: email, SessionID: session.ID})
+		if err := repo.ResolveSessionAnomaly(ctx, anomaly, event); err != nil {
+			t.Fatalf("ResolveSessionAnomaly() error: %v", err)
+		}
+	}
+	moveTo("198.51.100.1", "203.0.113.1")
+	moveTo("203.0.113.1", "198.51.100.1")
+	moveTo("198.51.100.1", "203.0.113.1")
+
+	var audits, alerts int64
+	testDB.Table("audit_user_sessions").Where("session_id = ? AND event_type = ?", session.ID, domainusersessions.AuditEventIPChange).Count(&audits)
+	testDB.Table("outbox_event").Where("event_type = ?", domainevents.TypeSessionAnomalyDetected).Count(&alerts)
+	if audits != 1 || alerts != 1 {
+		t.Errorf("Expected one audit and one alert within the interval, got %d and %d", audits, alerts)
+	}
+
+	var current repousersessions.UserSessions
+	testDB.Where("id = ?", session.ID).Take(&current)
+	if !sameIP(current.IPAddress, "203.0.113.1") {
+		t.Errorf("Expected the session to follow the client, got %s", current.IPAddress)
+	}
+}
+
+func TestUserRepository_CreateUserSessionWithRecoveryCode(t *testing.T) {
+	testutil.TruncateAllTables(testDB)
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+	ctx := context.Background()
+
+	email := "recovery@test.com"
+	if err := repo.CreateUserWithCredentials(ctx, ports.UserAndCredentialsRequest{Email: email, PasswordHash: "hashed_pass"}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	user, err := repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.ReplaceRecoveryCodes(ctx, user.ID, []string{"code-hash"}); err != nil {
+		t.Fatalf("Failed to store recovery codes: %v", err)
+	}
+	codes, err := repo.GetUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil || len(codes) != 1 {
+		t.Fatalf("GetUnusedRecoveryCodes() = %d codes, %v", len(codes), err)
+	}
+
+	login := func() error {
+		sessionID := uuid.New()
+		_, err := repo.CreateUserSessionWithinLimit(ctx, &ports.CreateUserSessionRequest{
+			ID:             sessionID,
+			UserID:         user.ID,
+			IPAddress:      "198.51.100.1",
+			UserAgent:      "ua",
+			Token:          uuid.NewString(),
+			ExpiresAt:      time.Now().Add(time.Hour),
+			Event:          domainevents.New(ctx, user.ID, domainevents.LoggedIn{SessionID: sessionID, Method: domainevents.LoginMethodRecoveryCode}),
+			RecoveryCodeID: codes[0].ID,
+		}, ports.SessionLimit{Max: 5, Strategy: ports.SessionLimitReject})
+		return err
+	}
+	count := func(table string) int64 {
+		var n int64
+		testDB.Table(table).Where("user_id = ?", user.ID).Count(&n)
+		return n
+	}
+
+	if err := login(); err != nil {
+		t.Fatalf("CreateUserSessionWithinLimit() error: %v", err)
+	}
+	var used int64
+	testDB.Table("audit_user_sessions").Where("user_id = ? AND event_type = ?", user.ID, domainusersessions.AuditEventMFARecoveryCodeUsed).Count(&used)
+	if used != 1 {
+		t.Errorf("Expected one recovery code audit, got %d", used)
+	}
+
+	sessions, audits, events := count("user_sessions"), count("audit_user_sessions"), int64(0)
+	testDB.Table("outbox_event").Count(&events)
+	if err := login(); !errors.Is(err, domain.ErrMFACodeReused) {
+		t.Fatalf("Expected ErrMFACodeReused for a spent code, got %v", err)
+	}
+	var eventsAfter int64
+	testDB.Table("outbox_event").Count(&eventsAfter)
+	if count("user_sessions") != sessions || count("audit_user_sessions") != audits || eventsAfter != events {
+		t.Error("Expected nothing written for a spent code")
+	}
+}
+
+func TestSessionsToEvict(t *testing.T) {
+	now := time.Now()
+	sessions := []repousersessions.UserSessions{
+		{ID: uuid.New(), LastActive: now.Add(-48 * time.Hour)},
+		{ID: uuid.New(), LastActive: now.Add(-30 * time.Hour)},
+		{ID: uuid.New(), LastActive: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name      string
+		limit     ports.SessionLimit
+		wantEvict int
+		wantErr   error
+	}{
+		{"Room left", ports.SessionLimit{Max: 4, Strategy: ports.SessionLimitReject}, 0, nil},
+		{"Reject at the limit", ports.SessionLimit{Max: 3, Strategy: ports.SessionLimitReject}, 0, domain.ErrTooManyUserSessions},
+		{"Evict the oldest", ports.SessionLimit{Max: 3, Strategy: ports.SessionLimitEvictOldest}, 1, nil},
+		{"Evict down to a lowered limit", ports.SessionLimit{Max: 1, Strategy: ports.SessionLimitEvictOldest}, 3, nil},
+		{"Evict idle sessions", ports.SessionLimit{Max: 2, Strategy: ports.SessionLimitEvictIdle, IdleTimeout: 24 * time.Hour}, 2, nil},
+		{"Not enough idle sessions", ports.SessionLimit{Max: 1, Strategy: ports.SessionLimitEvictIdle, IdleTimeout: 24 * time.Hour}, 0, domain.ErrTooManyUserSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evict, err := sessionsToEvict(sessions, tt.limit, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if len(evict) != tt.wantEvict {
+				t.Fatalf("expected %d evictions, got %d", tt.wantEvict, len(evict))
+			}
+			for i := range evict {
+				if evict[i].ID != sessions[i].ID {
+					t.Errorf("eviction %d is not the least recently active session", i)
+				}
+			}
+		})
+	}
+}
+
+func TestUserRepository_OutboxPayload(t *testing.T) {
+	testutil.TruncateAllTables(testDB)
+	repo := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+	ctx := context.Background()
+
+	email := "sealed@test.com"
+	event := domainevents.New(ctx, uuid.Nil, domainevents.UserRegistered{Email: email, Token: "raw-verification-token"})
+	if err := repo.CreateUserWithCredentials(ctx, ports.UserAndCredentialsRequest{Email: email, PasswordHash: "hashed_pass", Event: event}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+
+	var stored []byte
+	testDB.Table("outbox_event").Select("payload").Where("id = ?", event.ID).Scan(&stored)
+	if len(stored) == 0 || bytes.Contains(stored, []byte("raw-verification-token")) || bytes.Contains(stored, []byte(email)) {
+		t.Fatalf("Expected a sealed payload, got %q", stored)
+	}
+
+	claimed, err := repo.ClaimOutboxEvents(ctx, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("ClaimOutboxEvents() = %d events, %v", len(claimed), err)
+	}
+	data, ok := claimed[0].Data.(domainevents.UserRegistered)
+	if claimed[0].ID != event.ID || !ok || data.Token != "raw-verification-token" {
+		t.Fatalf("Expected the event back, got %+v", claimed[0])
+	}
+
+	if err := repo.DeadLetterOutboxEvent(ctx, event.ID, claimed[0].LeaseID, "rejected"); err != nil {
+		t.Fatalf("DeadLetterOutboxEvent() error: %v", err)
+	}
+	stored = nil
+	testDB.Table("outbox_event").Select("payload").Where("id = ?", event.ID).Scan(&stored)
+	if stored != nil {
+		t.Errorf("Expected the payload dropped with the dead letter, got %q", stored)
+	}
+
+	t.Run("Payload sealed with another key", func(t *testing.T) {
+		testutil.TruncateAllTables(testDB)
+		other := NewUserRepository(testDB, &testutil.NoopLogger{}, testutil.NewTestOutboxConfig(t))
+		event := domainevents.New(ctx, uuid.Nil, domainevents.UserRegistered{Email: email, Token: "raw-verification-token"})
+		if err := other.CreateUserWithCredentials(ctx, ports.UserAndCredentialsRequest{Email: email, PasswordHash: "hashed_pass", Event: event}); err != nil {
+			t.Fatalf("Failed to create: %v", err)
+		}
+
+		claimed, err := repo.ClaimOutboxEvents(ctx, 10, time.Minute)
+		if err != nil || len(claimed) != 1 {
+			t.Fatalf("ClaimOutboxEvents() = %d events, %v", len(claimed), err)
+		}
+		if claimed[0].ID != event.ID || claimed[0].Data != nil {
+			t.Errorf("Expected the event without data, got %+v", claimed[0])
+		}
+	})
+}
+
+func TestSameIP(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"198.51.100.1", "198.51.100.1", true},
+		{"198.51.100.1/32", "198.51.100.1", true},
+		{"::ffff:198.51.100.1", "198.51.100.1", true},
+		{"2001:db8::1", "2001:0db8:0:0:0:0:0:1", true},
+		{"198.51.100.1", "198.51.100.2", false},
+		{"unknown", "unknown", true},
+	}
+
+	for _, tt := range tests {
+		if got := sameIP(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameIP(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -4,4 +4,5 @@ const (
 	LogRepository  = "Repository"
 	LogService     = "Service"
 	LogHttpHandler = "HttpHandler"
+	LogMessaging   = "Messaging"
 )
@@ -1,6 +1,9 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// General
@@ -19,6 +22,10 @@ var (
 	ErrUserAccountSuspended    = errors.New("User account suspended")
 	ErrTooManyUserSessions     = errors.New("Too many user sessions")
 	ErrSessionNotFound         = errors.New("Session not found")
+	ErrSessionExpired          = errors.New("Session expired")
+	ErrInvalidRefreshToken     = errors.New("Invalid refresh token")
+	ErrRefreshTokenReused      = errors.New("Refresh token reuse detected, session revoked")
+	ErrSessionAnomaly          = errors.New("Session used from an unrecognized client, sign in again")
 
 	// Repository
 	ErrUserAlreadyExists     = errors.New("There is no user with such email")
@@ -33,4 +40,63 @@ var (
 	ErrBrokerInternalError = errors.New("Borker Internal Error")
 	ErrUserNotFound        = errors.New("User is not registered")
 	ErrUserAlreadyVerified = errors.New("Email already verified/consumed")
+
+	// Email Verification Code
+	ErrInvalidVerificationCode = errors.New("Invalid or expired verification code")
+	ErrVerificationCodeLocked  = errors.New("Too many wrong codes, request a new one")
+	ErrInvalidVerificationMode = errors.New("Verification mode must be link or code")
+
+	// Password Reset
+	ErrInvalidResetToken = errors.New("Invalid password reset token")
+
+	// Change Password
+	ErrIncorrectPassword = errors.New("Current password is incorrect")
+	ErrPasswordUnchanged = errors.New("New password must differ from the current one")
+
+	// Login
+	ErrInvalidCredentials = errors.New("Invalid email or password")
+	ErrInvalidMagicLink   = errors.New("Invalid or expired login link")
+	ErrLoginThrottled     = errors.New("Too many failed login attempts, try again later")
+
+	// MFA
+	ErrMFAAlreadyEnabled   = errors.New("MFA is already enabled")
+	ErrMFANotEnrolled      = errors.New("No pending MFA enrollment")
+	ErrMFANotEnabled       = errors.New("MFA is not enabled")
+	ErrInvalidMFACode      = errors.New("Invalid MFA code")
+	ErrMFACodeReused       = errors.New("MFA code already used")
+	ErrInvalidMFAChallenge = errors.New("Invalid MFA challenge")
+	ErrMFAChallengeExpired = errors.New("MFA challenge expired")
+
+	// Passkeys
+	ErrPasskeyAlreadyRegistered  = errors.New("Passkey is already registered")
+	ErrInvalidPasskeyChallenge   = errors.New("Invalid or expired passkey challenge")
+	ErrInvalidPasskeyAttestation = errors.New("Invalid passkey registration")
+	ErrUnsupportedPasskey        = errors.New("Passkey algorithm is not supported")
+	ErrInvalidPasskeyAssertion   = errors.New("Invalid passkey")
+	ErrPasskeyCloned             = errors.New("Passkey signature counter went backwards")
+
+	// Activity
+	ErrInvalidActivityCursor = errors.New("Invalid activity cursor")
+
+	// Outbox
+	ErrOutboxLeaseLost = errors.New("Outbox event was claimed by another relay")
+	ErrEventRejected   = errors.New("Event rejected by the message broker")
+
+	// Events
+	ErrUnknownEventType = errors.New("Unknown event type")
 )
+
+// RetryAfterError tells the caller how long to wait before trying again. It
+// wraps one of the errors above, so errors.Is still matches it.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,153 @@
+package domainevents
+
+import "github.com/google/uuid"
+
+// Event types.
+const (
+	TypeUserRegistered            = "user.registered"
+	TypeUserVerified              = "user.verified"
+	TypeVerificationCodeRequested = "user.verification_code_requested"
+	TypePasswordResetRequested    = "user.password_reset_requested"
+	TypeMagicLinkRequested        = "user.magic_link_requested"
+	TypeLoggedIn                  = "user.logged_in"
+	TypePasswordChanged           = "user.password_changed"
+	TypeSessionRevoked            = "user.session_revoked"
+	TypeSessionAnomalyDetected    = "user.session_anomaly_detected"
+	TypeAccountDeleted            = "user.account_deleted"
+)
+
+// Ways to sign in, see LoggedIn.
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodTOTP         = "totp"
+	LoginMethodRecoveryCode = "recovery_code"
+	LoginMethodPasskey      = "passkey"
+	LoginMethodMagicLink    = "magic_link"
+)
+
+// Why a password changed, see PasswordChanged.
+const (
+	PasswordChangedByUser  = "change"
+	PasswordChangedByReset = "reset"
+)
+
+// catalog lists every payload type. The events that were sent before the
+// envelope existed start at version 2; version 1 was the flat string map of
+// the SQS publisher. api/events/MIGRATION.md tells consumers how to move over.
+var catalog = []Payload{
+	UserRegistered{},
+	UserVerified{},
+	VerificationCodeRequested{},
+	PasswordResetRequested{},
+	MagicLinkRequested{},
+	LoggedIn{},
+	PasswordChanged{},
+	SessionRevoked{},
+	SessionAnomalyDetected{},
+	AccountDeleted{},
+}
+
+// UserRegistered asks for the verification link of a new account, or a new
+// link for an account that is still pending. Token goes into the link.
+type UserRegistered struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func (UserRegistered) EventType() string  { return TypeUserRegistered }
+func (UserRegistered) SchemaVersion() int { return 2 }
+
+// UserVerified is an account whose email was confirmed, by link or by code.
+type UserVerified struct {
+	Method string `json:"method"`
+}
+
+func (UserVerified) EventType() string  { return TypeUserVerified }
+func (UserVerified) SchemaVersion() int { return 1 }
+
+// VerificationCodeRequested asks for a numeric email verification code to be
+// sent.
+type VerificationCodeRequested struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+func (VerificationCodeRequested) EventType() string  { return TypeVerificationCodeRequested }
+func (VerificationCodeRequested) SchemaVersion() int { return 2 }
+
+// PasswordResetRequested asks for a password reset link to be sent.
+type PasswordResetRequested struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func (PasswordResetRequested) EventType() string  { return TypePasswordResetRequested }
+func (PasswordResetRequested) SchemaVersion() int { return 2 }
+
+// MagicLinkRequested asks for a sign-in link to be sent.
+type MagicLinkRequested struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func (MagicLinkRequested) EventType() string  { return TypeMagicLinkRequested }
+func (MagicLinkRequested) SchemaVersion() int { return 2 }
+
+// LoggedIn is a new session. Method is the last factor the user passed.
+type LoggedIn struct {
+	SessionID uuid.UUID `json:"session_id"`
+	Method    string    `json:"method"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Device    string    `json:"device,omitempty"`
+}
+
+func (LoggedIn) EventType() string  { return TypeLoggedIn }
+func (LoggedIn) SchemaVersion() int { return 1 }
+
+// PasswordChanged is a new password, set by the user or through a reset.
+// Both sign out the user's other sessions.
+type PasswordChanged struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+func (PasswordChanged) EventType() string  { return TypePasswordChanged }
+func (PasswordChanged) SchemaVersion() int { return 1 }
+
+// SessionRevoked is a user signing out their sessions from the sessions
+// list: either SessionID, or every session but KeptSessionID.
+type SessionRevoked struct {
+	SessionID     *uuid.UUID `json:"session_id,omitempty"`
+	KeptSessionID *uuid.UUID `json:"kept_session_id,omitempty"`
+}
+
+func (SessionRevoked) EventType() string  { return TypeSessionRevoked }
+func (SessionRevoked) SchemaVersion() int { return 1 }
+
+// SessionAnomalyDetected alerts a user that one of their sessions was used
+// from another network or user agent. Action is what the service did about
+// it: log, reauth or revoke.
+type SessionAnomalyDetected struct {
+	Email             string    `json:"email"`
+	SessionID         uuid.UUID `json:"session_id"`
+	Action            string    `json:"action"`
+	IPChanged         bool      `json:"ip_changed"`
+	PreviousIP        string    `json:"previous_ip"`
+	IPAddress         string    `json:"ip_address"`
+	UAChanged         bool      `json:"ua_changed"`
+	PreviousUserAgent string    `json:"previous_user_agent"`
+	UserAgent         string    `json:"user_agent"`
+}
+
+func (SessionAnomalyDetected) EventType() string  { return TypeSessionAnomalyDetected }
+func (SessionAnomalyDetected) SchemaVersion() int { return 2 }
+
+// AccountDeleted is an account its owner deleted. Email is where the account
+// was registered, for a last confirmation.
+type AccountDeleted struct {
+	Email string `json:"email"`
+}
+
+func (AccountDeleted) EventType() string  { return TypeAccountDeleted }
+func (AccountDeleted) SchemaVersion() int { return 1 }
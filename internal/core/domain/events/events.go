@@ -0,0 +1,103 @@
+// Package domainevents is the catalog of events the service publishes. Every
+// event travels in the same envelope; its data is one of the payload types
+// of catalog.go. The JSON schemas under api/events are generated from them.
+package domainevents
+
+//go:generate go run ../../../../cmd/eventschema -out ../../../../api/events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+// Payload is the type specific part of an event. Any change to a payload type
+// gets it a new SchemaVersion: the schemas don't allow unknown fields.
+type Payload interface {
+	EventType() string
+	SchemaVersion() int
+}
+
+// Event is the envelope every event is published in. ID is unique per event
+// and stays the same across redeliveries, so consumers can deduplicate on it.
+type Event struct {
+	ID            uuid.UUID `json:"id"`
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	TraceID       string    `json:"trace_id,omitempty"`
+	UserID        uuid.UUID `json:"user_id"`
+	Data          Payload   `json:"data"`
+}
+
+// New wraps data in an envelope for userID, traced to the request in ctx.
+func New(ctx context.Context, userID uuid.UUID, data Payload) *Event {
+	return &Event{
+		ID:            uuid.New(),
+		Type:          data.EventType(),
+		SchemaVersion: data.SchemaVersion(),
+		OccurredAt:    time.Now().UTC(),
+		TraceID:       TraceIDFrom(ctx),
+		UserID:        userID,
+		Data:          data,
+	}
+}
+
+// UnmarshalJSON decodes data into the payload type registered for the
+// event's type, and fails with ErrUnknownEventType for any other type.
+func (e *Event) UnmarshalJSON(raw []byte) error {
+	type envelope Event
+	var decoded struct {
+		envelope
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return err
+	}
+
+	payloadType, ok := payloadTypes[decoded.Type]
+	if !ok {
+		return fmt.Errorf("%w: %q", domain.ErrUnknownEventType, decoded.Type)
+	}
+	data := reflect.New(payloadType)
+	if err := json.Unmarshal(decoded.Data, data.Interface()); err != nil {
+		return fmt.Errorf("invalid %s data: %w", decoded.Type, err)
+	}
+
+	*e = Event(decoded.envelope)
+	e.Data = data.Elem().Interface().(Payload)
+	return nil
+}
+
+// payloadTypes maps every event type of the catalog to its payload type.
+var payloadTypes = func() map[string]reflect.Type {
+	types := make(map[string]reflect.Type, len(catalog))
+	for _, payload := range catalog {
+		types[payload.EventType()] = reflect.TypeOf(payload)
+	}
+	return types
+}()
+
+// Catalog returns a zero value of every payload type.
+func Catalog() []Payload {
+	return append([]Payload(nil), catalog...)
+}
+
+type traceIDKey struct{}
+
+// WithTraceID stores the trace ID of a request in ctx for the events it
+// raises.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceIDFrom returns the trace ID stored by WithTraceID, or "".
+func TraceIDFrom(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
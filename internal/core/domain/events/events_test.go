@@ -0,0 +1,90 @@
+package domainevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/google/uuid"
+)
+
+func TestEvent_JSONRoundTrip(t *testing.T) {
+	ctx := WithTraceID(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736")
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	for _, data := range []Payload{
+		UserRegistered{Email: "user@example.com", Token: "token"},
+		LoggedIn{SessionID: sessionID, Method: LoginMethodPasskey, IPAddress: "203.0.113.7", UserAgent: "curl/8.0"},
+		SessionRevoked{KeptSessionID: &sessionID},
+		SessionAnomalyDetected{Email: "user@example.com", SessionID: sessionID, Action: "log", IPChanged: true},
+	} {
+		t.Run(data.EventType(), func(t *testing.T) {
+			event := New(ctx, userID, data)
+			if event.Type != data.EventType() || event.SchemaVersion != data.SchemaVersion() {
+				t.Errorf("envelope doesn't match the payload: %s v%d", event.Type, event.SchemaVersion)
+			}
+			if event.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || event.UserID != userID {
+				t.Errorf("unexpected envelope: %+v", event)
+			}
+
+			raw, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+			var decoded Event
+			if err := json.Unmarshal(raw, &decoded); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !decoded.OccurredAt.Equal(event.OccurredAt) {
+				t.Errorf("occurred_at = %v, want %v", decoded.OccurredAt, event.OccurredAt)
+			}
+			decoded.OccurredAt = event.OccurredAt
+			if !reflect.DeepEqual(decoded, *event) {
+				t.Errorf("decoded %+v, want %+v", decoded, *event)
+			}
+		})
+	}
+}
+
+func TestEvent_UnmarshalUnknownType(t *testing.T) {
+	var event Event
+	err := json.Unmarshal([]byte(`{"id":"`+uuid.NewString()+`","type":"user.teleported","schema_version":1,"data":{}}`), &event)
+	if !errors.Is(err, domain.ErrUnknownEventType) {
+		t.Errorf("expected ErrUnknownEventType, got %v", err)
+	}
+}
+
+// The checked-in schemas are what consumers validate against; a payload
+// change without go generate would leave them behind. Schemas of older
+// versions stay for the consumers still reading them.
+func TestSchemas_UpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..", "..", "..", "api", "events")
+	seen := make(map[string]bool)
+	for _, payload := range Catalog() {
+		name := SchemaFileName(payload)
+		if seen[payload.EventType()] {
+			t.Errorf("%s is in the catalog twice", payload.EventType())
+		}
+		seen[payload.EventType()] = true
+
+		want, err := Schema(payload)
+		if err != nil {
+			t.Fatalf("Schema(%s) error: %v", name, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v, run go generate ./internal/core/domain/events", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date, run go generate ./internal/core/domain/events", name)
+		}
+	}
+}
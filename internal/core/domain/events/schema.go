@@ -0,0 +1,94 @@
+package domainevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaFileName is the name of the schema file of a payload type.
+func SchemaFileName(payload Payload) string {
+	return fmt.Sprintf("%s.v%d.schema.json", payload.EventType(), payload.SchemaVersion())
+}
+
+// Schema renders the JSON schema of a whole event, envelope included, whose
+// data is payload. Fields without omitempty are required and nothing else is
+// allowed, so a consumer validating against it notices a producer that is
+// ahead of it.
+func Schema(payload Payload) ([]byte, error) {
+	envelope := schemaOf(reflect.TypeOf(Event{}))
+	properties := envelope["properties"].(map[string]any)
+	properties["type"] = map[string]any{"const": payload.EventType()}
+	properties["schema_version"] = map[string]any{"const": payload.SchemaVersion()}
+	properties["data"] = schemaOf(reflect.TypeOf(payload))
+
+	envelope["$schema"] = jsonSchemaDialect
+	envelope["$id"] = SchemaFileName(payload)
+	envelope["title"] = payload.EventType()
+
+	schema, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(schema, '\n'), nil
+}
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// schemaOf maps the Go types the catalog uses to their JSON schema.
+func schemaOf(t reflect.Type) map[string]any {
+	switch t {
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.Interface:
+		return map[string]any{}
+	}
+	panic(fmt.Sprintf("domainevents: no JSON schema for %s", t))
+}
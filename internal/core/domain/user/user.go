@@ -7,12 +7,15 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID
-	Email        string
-	UserStatus   string
-	IsMFAEnabled bool
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID                  uuid.UUID
+	Email               string
+	UserStatus          string
+	IsMFAEnabled        bool
+	Roles               []string
+	FailedLoginAttempts int
+	LockedUntil         *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 	// If DeletedAt.IsZero() == true, the user is not deleted.
 	DeletedAt   time.Time
 	Credentials UserCredentials
@@ -6,11 +6,37 @@ import (
 	"github.com/google/uuid"
 )
 
+// Values of the audit_event_type enum.
+const (
+	AuditEventIPChange                = "IP_CHANGE"
+	AuditEventUAChange                = "UA_CHANGE"
+	AuditEventLogin                   = "LOGIN"
+	AuditEventLogout                  = "LOGOUT"
+	AuditEventConcurrencyLimitReached = "CONCURRENCY_LIMIT_REACHED"
+	AuditEventMFARecoveryCodeUsed     = "MFA_RECOVERY_CODE_USED"
+	AuditEventLoginFailed             = "LOGIN_FAILED"
+	AuditEventAccountLocked           = "ACCOUNT_LOCKED"
+	AuditEventAccountUnlocked         = "ACCOUNT_UNLOCKED"
+	AuditEventAccountDeleted          = "ACCOUNT_DELETED"
+)
+
+// Why a session ended, stored with its LOGOUT event.
+const (
+	LogoutReasonUser           = "logout"
+	LogoutReasonExpired        = "expired"
+	LogoutReasonTokenReuse     = "refresh_token_reused"
+	LogoutReasonRevoked        = "revoked"
+	LogoutReasonPasswordChange = "password_changed"
+	LogoutReasonAccountDeleted = "account_deleted"
+	LogoutReasonAnomaly        = "anomaly"
+)
+
 type AuditUserSessions struct {
 	ID        uuid.UUID
 	SessionID uuid.UUID
 	UserID    uuid.UUID
 	EventType string
+	OldValue  string // "" if null
 	NewValue  string // "" if null
 	CreatedAt time.Time
 }
@@ -7,11 +7,27 @@ import (
 	"github.com/google/uuid"
 )
 
+// Purposes of a verification token. Each flow only accepts its own tokens.
+const (
+	PurposeEmailVerification     = "email_verification"
+	PurposePasswordReset         = "password_reset"
+	PurposeMagicLink             = "magic_link"
+	PurposeEmailVerificationCode = "email_verification_code"
+)
+
+// Ways an email address can be verified.
+const (
+	ModeLink = "link"
+	ModeCode = "code"
+)
+
 type UserVerification struct {
 	ID        uuid.UUID
 	UserID    uuid.UUID
 	Token     string
 	Status    string
+	Purpose   string
+	Attempts  int
 	ExpiresAt time.Time
 	CreatedAt time.Time
 
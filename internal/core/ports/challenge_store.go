@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// ChallengeStore keeps short lived, single-use challenges such as the ones of
+// a WebAuthn ceremony.
+type ChallengeStore interface {
+	Save(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Take returns the value and deletes it, so a challenge can only be
+	// redeemed once. A missing or expired key is domain.ErrNotFound.
+	Take(ctx context.Context, key string) ([]byte, error)
+}
@@ -3,25 +3,42 @@ package ports
 import (
 	"time"
 
+	domainevents "github.com/golang-auth/internal/core/domain/events"
 	"github.com/google/uuid"
 )
 
 type UserAndCredentialsRequest struct {
+	// ID of the new user, generated by the database when Nil
+	UserID                 uuid.UUID
 	Email                  string
 	UserStatus             string
 	IsMFAEnabled           bool
 	PasswordHash           string
 	EmailVerificationToken string
-	TokenExpiration        time.Time
+	// Purpose of the verification record, email_verification when empty
+	EmailVerificationPurpose string
+	TokenExpiration          time.Time
+	// Event goes out once the user is committed
+	Event *domainevents.Event
 }
 
 type CreateUserSessionRequest struct {
+	// ID of the new session, generated by the database when Nil
+	ID        uuid.UUID
 	UserID    uuid.UUID
 	IPAddress string
 	UserAgent string
 	Device    string
 	Token     string
 	ExpiresAt time.Time
+	// Event goes out once the session is committed
+	Event *domainevents.Event
+	// MFA recovery code the login spends, Nil for none. It is used up in the
+	// same transaction; a code that is already used fails the login with
+	// domain.ErrMFACodeReused and nothing is written.
+	RecoveryCodeID uuid.UUID
+	// Unused recovery codes after this one, for the audit record
+	RecoveryCodesLeft int
 }
 
 type CreateUserSessionResponse struct {
@@ -32,6 +49,96 @@ type CreateUserSessionResponse struct {
 	LastActive time.Time
 }
 
+// Strategies for a login that would go past the session limit
+const (
+	SessionLimitReject      = "reject"       // refuse the login
+	SessionLimitEvictOldest = "evict_oldest" // sign out the least recently active session
+	SessionLimitEvictIdle   = "evict_idle"   // sign out sessions idle for IdleTimeout, refuse if there are none
+)
+
+// SessionLimit is how many sessions a user may hold and what happens to a
+// login beyond that.
+type SessionLimit struct {
+	Max         int
+	Strategy    string
+	IdleTimeout time.Duration
+}
+
+// LoginDelay is how long an account has to wait before the next login once
+// it has the given number of failed logins in a row.
+type LoginDelay func(failures int) time.Duration
+
+// Responses to a session used from another network or user agent
+const (
+	SessionAnomalyLog    = "log"    // record it, the session follows the new client
+	SessionAnomalyReauth = "reauth" // refuse the new client, the session stays
+	SessionAnomalyRevoke = "revoke" // end the session for every client
+)
+
+// SessionAnomaly is a session seen from a client other than the one it was
+// last used from. AlertInterval is how long after an alert further anomalies
+// of a session that keeps running are not audited or alerted again.
+type SessionAnomaly struct {
+	SessionID         uuid.UUID
+	UserID            uuid.UUID
+	Action            string
+	AlertInterval     time.Duration
+	IPChanged         bool
+	PreviousIP        string
+	IPAddress         string
+	UAChanged         bool
+	PreviousUserAgent string
+	UserAgent         string
+}
+
+// SessionClientCheck is an authenticated request to compare against its
+// session. TokenNetworkHash and TokenUserAgentHash describe the client the
+// access token was issued to; they are empty for tokens issued without them.
+type SessionClientCheck struct {
+	UserID             uuid.UUID
+	SessionID          uuid.UUID
+	TokenNetworkHash   string
+	TokenUserAgentHash string
+	IPAddress          string
+	UserAgent          string
+}
+
+// SessionInfo describes one of a user's sessions for the active devices list.
+type SessionInfo struct {
+	ID         uuid.UUID
+	IPAddress  string
+	UserAgent  string
+	Device     string
+	CreatedAt  time.Time
+	LastActive time.Time
+	ExpiresAt  time.Time
+	Current    bool
+}
+
+// AuditCursor points at the last audit event of a page; the next page starts
+// right after it.
+type AuditCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// ActivityEvent is one entry of a user's security history.
+type ActivityEvent struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID // uuid.Nil for events not tied to a session
+	EventType string
+	OldValue  string
+	NewValue  string
+	CreatedAt time.Time
+}
+
+// ActivityPage is one page of a user's security history, newest first.
+// NextCursor is empty on the last page.
+type ActivityPage struct {
+	Events     []ActivityEvent
+	NextCursor string
+}
+
 type LoginRequest struct {
 	Email     string
 	Password  string
@@ -48,4 +155,70 @@ type LoginResponse struct {
 
 	RefreshTokenExpiresAt time.Time
 	AccessTokenExpiresAt  time.Time
+
+	// Set instead of the tokens when the user has MFA enabled: the challenge
+	// is exchanged for a session by LoginWithMFA.
+	MFAChallenge          string
+	MFAChallengeExpiresAt time.Time
+}
+
+type MagicLinkLoginRequest struct {
+	Token     string
+	IPAddress string
+	UserAgent string
+	Device    string
+}
+
+// MFALoginRequest carries either a TOTP Code or a one-time RecoveryCode.
+type MFALoginRequest struct {
+	Challenge    string
+	Code         string
+	RecoveryCode string
+	IPAddress    string
+	UserAgent    string
+	Device       string
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// PasskeyCreationOptions are the parameters of navigator.credentials.create().
+// UserHandle is the opaque user ID stored on the authenticator.
+type PasskeyCreationOptions struct {
+	Challenge            []byte
+	RPID                 string
+	RPName               string
+	UserHandle           []byte
+	UserName             string
+	Algorithms           []int64
+	ExcludeCredentialIDs [][]byte
+	Timeout              time.Duration
+}
+
+type PasskeyRegistration struct {
+	Name              string
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// PasskeyRequestOptions are the parameters of navigator.credentials.get().
+// No credentials are listed: the passkey itself tells who the user is.
+type PasskeyRequestOptions struct {
+	Challenge []byte
+	RPID      string
+	Timeout   time.Duration
+}
+
+type PasskeyLoginRequest struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+	IPAddress         string
+	UserAgent         string
+	Device            string
 }
@@ -2,8 +2,20 @@ package ports
 
 import (
 	"context"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
 )
 
+// EventPublisher sends domain events to the message broker. An error that
+// wraps domain.ErrEventRejected means the event itself was refused and
+// sending it again won't help; any other error is worth a retry.
 type EventPublisher interface {
-	PublishUserRegistered(ctx context.Context, email string, token string) error
+	Publish(ctx context.Context, event domainevents.Event) error
+}
+
+// BatchEventPublisher is implemented by publishers that can send several
+// events in one round trip. The result holds one error per event, nil for the
+// ones that were sent.
+type BatchEventPublisher interface {
+	PublishBatch(ctx context.Context, events []domainevents.Event) []error
 }
@@ -0,0 +1,36 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/google/uuid"
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the state
+// change behind it and relayed to the EventPublisher after commit. The
+// outbox row shares the ID of the event. Data is nil when the stored event
+// could not be opened or decoded.
+type OutboxEvent struct {
+	domainevents.Event
+
+	LeaseID  uuid.UUID
+	Attempts int
+}
+
+// OutboxSealer encrypts outbox payloads at rest, bound to the event ID.
+type OutboxSealer interface {
+	SealPayload(eventID uuid.UUID, payload []byte) ([]byte, error)
+	OpenPayload(eventID uuid.UUID, sealed []byte) ([]byte, error)
+}
+
+// OutboxRepo is the side of the outbox the relay works on. A claim leases
+// the events to one relay instance; only the holder of the lease can mark
+// them, anyone else gets domain.ErrOutboxLeaseLost.
+type OutboxRepo interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]OutboxEvent, error)
+	MarkOutboxEventDispatched(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID) error
+	RescheduleOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, retryAt time.Time, lastError string) error
+	DeadLetterOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, lastError string) error
+}
@@ -0,0 +1,48 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// Rate limiting algorithms
+const (
+	// RateLimitSlidingWindow allows Limit requests in any Window long span.
+	RateLimitSlidingWindow = "sliding_window"
+	// RateLimitTokenBucket holds up to Limit tokens and refills all of them
+	// over Window, so bursts are allowed after a quiet period.
+	RateLimitTokenBucket = "token_bucket"
+)
+
+// RateLimit is a single limit: Limit requests per Window, counted with Algorithm.
+type RateLimit struct {
+	Algorithm string        `mapstructure:"algorithm"`
+	Limit     int           `mapstructure:"limit"`
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// RateLimitResult is what a limiter decided for one request. Reset is how
+// long until the limit is fully available again, RetryAfter how long a
+// refused caller must wait.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitCheck is one limit a request is counted against, under Key.
+type RateLimitCheck struct {
+	Key   string
+	Limit RateLimit
+}
+
+// RateLimiter counts requests per key. All the checks of a request are one
+// atomic step: the request is counted against every limit, or against none
+// when one of them refuses it. Concurrent requests can't slip past a limit,
+// and a refused request doesn't use up the others. Results are in the order
+// of the checks, each telling whether its own limit lets the request through.
+type RateLimiter interface {
+	Allow(ctx context.Context, checks []RateLimitCheck) ([]RateLimitResult, error)
+}
@@ -5,26 +5,87 @@ import (
 	"time"
 
 	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	repousermfa "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_mfa"
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
 	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
 	"github.com/google/uuid"
 )
 
 type UserRepoPorts interface {
 	GetUserByEmail(ctx context.Context, email string) (*repouser.User, error)
+	GetUserByID(ctx context.Context, userID uuid.UUID) (*repouser.User, error)
 	CreateUserWithCredentials(ctx context.Context, req UserAndCredentialsRequest) error
 	GetVerificationByToken(ctx context.Context, token string) (*userverification.UserVerification, error)
-	ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID) error
-	GetVerificationByUserID(ctx context.Context, userID uuid.UUID) (*userverification.UserVerification, error)
-	RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification) error
-	GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, timeDuration time.Time) (int64, error)
+	ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, event *domainevents.Event) error
+	GetVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error)
+	RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification, event *domainevents.Event) error
+	GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, purpose string, timeDuration time.Time) (int64, error)
 	UpdateUserVerificationTokenStatus(ctx context.Context, tokenID uuid.UUID, status string) error
 
+	// Password reset
+	CreatePasswordResetToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	ResetUserPassword(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, passwordHash string, event *domainevents.Event) error
+
+	// Email verification code
+	CreateEmailVerificationCode(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	GetPendingVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error)
+	CountVerificationAttempt(ctx context.Context, verificationID uuid.UUID, maxAttempts int) error
+
+	// Magic link
+	CreateMagicLinkToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	ConsumeVerificationToken(ctx context.Context, verificationID uuid.UUID) error
+
+	// Login throttling
+	BookLoginAttempt(ctx context.Context, userID uuid.UUID, delay LoginDelay) (int, error)
+	RecordFailedLogin(ctx context.Context, userID uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error
+	UnlockUser(ctx context.Context, userID uuid.UUID, audit *repousersessions.AuditUserSessions) error
+
+	// Change password
+	GetUserCredentialsByUserID(ctx context.Context, userID uuid.UUID) (*repouser.UserCredentials, error)
+	ChangeUserPassword(ctx context.Context, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID, event *domainevents.Event) error
+
+	// MFA
+	UpsertTOTPEnrollment(ctx context.Context, userID uuid.UUID, secretCiphertext []byte) error
+	GetTOTPByUserID(ctx context.Context, userID uuid.UUID) (*repousermfa.UserMFATOTP, error)
+	ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	ConsumeTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	CreateMFAChallenge(ctx context.Context, challenge *repousermfa.MFAChallenge) error
+	GetMFAChallengeByToken(ctx context.Context, token string) (*repousermfa.MFAChallenge, error)
+	CountMFAChallengeAttempt(ctx context.Context, challengeID uuid.UUID, maxAttempts int) error
+	DeleteMFAChallenge(ctx context.Context, challengeID uuid.UUID) error
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	GetUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error)
+
+	// Passkeys
+	CreateWebAuthnCredential(ctx context.Context, credential *repouserwebauthn.WebAuthnCredential) error
+	GetWebAuthnCredentialsByUserID(ctx context.Context, userID uuid.UUID) ([]repouserwebauthn.WebAuthnCredential, error)
+	GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (*repouserwebauthn.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id uuid.UUID, signCount int64) error
+
 	// Login
-	// CreateUserSession(ctx context.Context, session *repousersessions.UserSessions) error
-	GetUserSessionCountByUserID(ctx context.Context, userID uuid.UUID) (int64, error)
-	CreateAndDeleteOldUserSession(ctx context.Context, sessionReq *CreateUserSessionRequest) (*CreateUserSessionResponse, error)
-	CreateUserSession(ctx context.Context, sessionReq *CreateUserSessionRequest) (*CreateUserSessionResponse, error)
-	DeleteUserSession(ctx context.Context, session_id uuid.UUID) error
-	DeleteUser(ctx context.Context, userID uuid.UUID) error
-	DeleteUserDeadSessions(ctx context.Context, userID uuid.UUID) error
+	CreateUserSessionWithinLimit(ctx context.Context, sessionReq *CreateUserSessionRequest, limit SessionLimit) (*CreateUserSessionResponse, error)
+	DeleteUserSession(ctx context.Context, session_id uuid.UUID, reason string) error
+	DeleteUser(ctx context.Context, userID uuid.UUID, event *domainevents.Event) error
+
+	// Active sessions
+	GetUserSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]repousersessions.UserSessions, error)
+	DeleteUserSessionOfUser(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, event *domainevents.Event) error
+	DeleteOtherUserSessions(ctx context.Context, userID uuid.UUID, keepSessionID uuid.UUID, event *domainevents.Event) (int64, error)
+
+	// Refresh
+	GetUserSessionByToken(ctx context.Context, token string) (*repousersessions.UserSessions, error)
+	GetUserSessionByID(ctx context.Context, sessionID uuid.UUID) (*repousersessions.UserSessions, error)
+	GetSessionIDByRotatedToken(ctx context.Context, token string) (uuid.UUID, error)
+	RotateUserSessionToken(ctx context.Context, sessionID uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*CreateUserSessionResponse, error)
+
+	// Session anomalies
+	ResolveSessionAnomaly(ctx context.Context, anomaly *SessionAnomaly, event *domainevents.Event) error
+
+	// Activity
+	GetAuditEventsByUserID(ctx context.Context, userID uuid.UUID, after *AuditCursor, limit int) ([]repousersessions.AuditUserSessions, error)
+
+	// Outbox
+	OutboxRepo
 }
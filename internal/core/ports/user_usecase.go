@@ -7,10 +7,38 @@ import (
 )
 
 type UserUseCase interface {
-	Register(ctx context.Context, email, password string) error
+	SessionGuard
+
+	Register(ctx context.Context, email, password, mode string) error
 	VerifyUserEmail(ctx context.Context, token string) error
-	ResendEmailVerificationToken(ctx context.Context, email string) error
+	VerifyEmailCode(ctx context.Context, email, code string) error
+	ResendEmailVerificationToken(ctx context.Context, email, mode string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
 	Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error)
+	LoginWithMFA(ctx context.Context, req *MFALoginRequest) (*LoginResponse, error)
+	RequestMagicLink(ctx context.Context, email string) error
+	LoginWithMagicLink(ctx context.Context, req *MagicLinkLoginRequest) (*LoginResponse, error)
+	RefreshSession(ctx context.Context, refreshToken, ipAddress, userAgent string) (*LoginResponse, error)
 	Logout(ctx context.Context, session_id uuid.UUID) error
+	EnrollTOTP(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error)
+	BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*PasskeyCreationOptions, error)
+	FinishPasskeyRegistration(ctx context.Context, userID uuid.UUID, req *PasskeyRegistration) error
+	BeginPasskeyLogin(ctx context.Context) (*PasskeyRequestOptions, error)
+	FinishPasskeyLogin(ctx context.Context, req *PasskeyLoginRequest) (*LoginResponse, error)
+	ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]SessionInfo, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error)
+	ListActivity(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ActivityPage, error)
+	ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error
 	DeleteAccount(ctx context.Context, user_id uuid.UUID) error
+	UnlockAccount(ctx context.Context, adminID, userID uuid.UUID) error
+}
+
+// SessionGuard checks that an authenticated request comes from the client its
+// session belongs to, applying the anomaly policy when it doesn't.
+type SessionGuard interface {
+	CheckSessionClient(ctx context.Context, check *SessionClientCheck) error
 }
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultActivityPageSize = 20
+	MaxActivityPageSize     = 100
+)
+
+// ListActivity returns one page of a user's security history, newest first.
+// cursor is the NextCursor of the previous page, or empty for the first one.
+// limit is clamped to MaxActivityPageSize; zero or less means the default.
+func (s *UserSerivce) ListActivity(ctx context.Context, userID uuid.UUID, cursor string, limit int) (*ports.ActivityPage, error) {
+	if limit <= 0 {
+		limit = DefaultActivityPageSize
+	}
+	limit = min(limit, MaxActivityPageSize)
+
+	var after *ports.AuditCursor
+	if cursor != "" {
+		decoded, err := decodeActivityCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = decoded
+	}
+
+	// One extra row tells whether another page follows
+	records, err := s.repo.GetAuditEventsByUserID(ctx, userID, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ports.ActivityPage{Events: make([]ports.ActivityEvent, 0, min(len(records), limit))}
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[limit-1]
+		page.NextCursor = encodeActivityCursor(ports.AuditCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, orm := range records {
+		event := repousersessions.MapAuditToDomain(orm)
+		page.Events = append(page.Events, ports.ActivityEvent{
+			ID:        event.ID,
+			SessionID: event.SessionID,
+			EventType: event.EventType,
+			OldValue:  event.OldValue,
+			NewValue:  event.NewValue,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return page, nil
+}
+
+// The cursor is opaque to clients: base64url of "<unix nanos>.<event id>".
+func encodeActivityCursor(c ports.AuditCursor) string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "." + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeActivityCursor(cursor string) (*ports.AuditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, domain.ErrInvalidActivityCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, domain.ErrInvalidActivityCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, domain.ErrInvalidActivityCursor
+	}
+	eventID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, domain.ErrInvalidActivityCursor
+	}
+	return &ports.AuditCursor{CreatedAt: time.Unix(0, unixNano).UTC(), ID: eventID}, nil
+}
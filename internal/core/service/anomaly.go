@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// CheckSessionClient guards an authenticated request against session
+// hijacking. The access token names the client it was issued to, so the
+// session is only loaded when the caller looks different from that; the
+// anomaly policy then decides whether the request goes through.
+func (s *UserSerivce) CheckSessionClient(ctx context.Context, check *ports.SessionClientCheck) error {
+	if check.TokenNetworkHash != "" &&
+		check.TokenNetworkHash == s.authConfig.SessionAnomaly.NetworkHash(check.IPAddress) &&
+		check.TokenUserAgentHash == HashToken(check.UserAgent) {
+		return nil
+	}
+
+	session, err := s.repo.GetUserSessionByID(ctx, check.SessionID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.ErrSessionExpired
+		}
+		return err
+	}
+	if session.UserID != check.UserID {
+		return domain.ErrSessionExpired
+	}
+
+	anomaly := s.detectSessionAnomaly(session, check.IPAddress, check.UserAgent)
+	if anomaly == nil {
+		return nil
+	}
+	return s.resolveSessionAnomaly(ctx, anomaly)
+}
+
+// detectSessionAnomaly compares a client with the one the session was last
+// used from and returns nil when nothing that matters changed.
+func (s *UserSerivce) detectSessionAnomaly(session *repousersessions.UserSessions, ipAddress, userAgent string) *ports.SessionAnomaly {
+	// inet values may come back with their /32 or /128 mask
+	previousIP, _, _ := strings.Cut(session.IPAddress, "/")
+	ipChanged := ipAddress != "" && !s.authConfig.SessionAnomaly.SameNetwork(previousIP, ipAddress)
+	uaChanged := session.UserAgent != userAgent
+	if !ipChanged && !uaChanged {
+		return nil
+	}
+
+	return &ports.SessionAnomaly{
+		SessionID:         session.ID,
+		UserID:            session.UserID,
+		Action:            s.authConfig.SessionAnomaly.Action,
+		AlertInterval:     s.authConfig.SessionAnomaly.AlertInterval,
+		IPChanged:         ipChanged,
+		PreviousIP:        previousIP,
+		IPAddress:         ipAddress,
+		UAChanged:         uaChanged,
+		PreviousUserAgent: session.UserAgent,
+		UserAgent:         userAgent,
+	}
+}
+
+// resolveSessionAnomaly records the anomaly, applies its action and queues
+// an alert for the user. Unless the action is only to log it, the caller is
+// refused with ErrSessionAnomaly.
+func (s *UserSerivce) resolveSessionAnomaly(ctx context.Context, anomaly *ports.SessionAnomaly) error {
+	s.logger.Warn(domain.LogService, "Session used from a different client",
+		"session_id", anomaly.SessionID, "user_id", anomaly.UserID, "action", anomaly.Action,
+		"ip_changed", anomaly.IPChanged, "ua_changed", anomaly.UAChanged)
+
+	if err := s.repo.ResolveSessionAnomaly(ctx, anomaly, s.sessionAnomalyEvent(ctx, anomaly)); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.ErrSessionExpired
+		}
+		return err
+	}
+
+	if anomaly.Action == ports.SessionAnomalyLog {
+		return nil
+	}
+	return domain.ErrSessionAnomaly
+}
+
+// sessionAnomalyEvent is the alert for the owner of the session. Without the
+// owner's email there is nobody to alert; the anomaly is still recorded.
+func (s *UserSerivce) sessionAnomalyEvent(ctx context.Context, anomaly *ports.SessionAnomaly) *domainevents.Event {
+	userRecord, err := s.repo.GetUserByID(ctx, anomaly.UserID)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Failed to load user for session anomaly alert", "error", err, "user_id", anomaly.UserID)
+		return nil
+	}
+	return domainevents.New(ctx, anomaly.UserID, domainevents.SessionAnomalyDetected{
+		Email:             userRecord.Email,
+		SessionID:         anomaly.SessionID,
+		Action:            anomaly.Action,
+		IPChanged:         anomaly.IPChanged,
+		PreviousIP:        anomaly.PreviousIP,
+		IPAddress:         anomaly.IPAddress,
+		UAChanged:         anomaly.UAChanged,
+		PreviousUserAgent: anomaly.PreviousUserAgent,
+		UserAgent:         anomaly.UserAgent,
+	})
+}
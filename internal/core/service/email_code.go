@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainuserverification "github.com/golang-auth/internal/core/domain/user_verification"
+	"github.com/google/uuid"
+)
+
+const maxVerificationCodesPerHour = 3
+
+// VerifyEmailCode activates an account with the code emailed at registration.
+// Each guess is booked before the code is checked; after MaxCodeAttempts the
+// code is locked and a new one has to be requested.
+//
+// Every way a code can fail answers ErrInvalidVerificationCode, so the
+// endpoint can't be used to tell registered, verified and unknown emails
+// apart.
+func (s *UserSerivce) VerifyEmailCode(ctx context.Context, email, code string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	userRecord, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrInvalidVerificationCode
+		}
+		return err
+	}
+	if userRecord.UserStatus == "active" {
+		return domain.ErrInvalidVerificationCode
+	}
+
+	record, err := s.repo.GetPendingVerificationByUserID(ctx, userRecord.ID, domainuserverification.PurposeEmailVerificationCode)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrInvalidVerificationCode
+		}
+		return err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		if err := s.repo.UpdateUserVerificationTokenStatus(ctx, record.ID, "expired"); err != nil {
+			return domain.ErrRepositoryInternalError
+		}
+		return domain.ErrInvalidVerificationCode
+	}
+
+	if err := s.repo.CountVerificationAttempt(ctx, record.ID, s.authConfig.EmailVerification.MaxCodeAttempts); err != nil {
+		if errors.Is(err, domain.ErrVerificationCodeLocked) {
+			s.logger.Warn(domain.LogService, "Email verification code locked after too many attempts", "user_id", userRecord.ID)
+			return domain.ErrInvalidVerificationCode
+		}
+		return err
+	}
+	if !CheckPasswordHash(code, record.Token) {
+		return domain.ErrInvalidVerificationCode
+	}
+
+	event := domainevents.New(ctx, userRecord.ID, domainevents.UserVerified{Method: domainuserverification.ModeCode})
+	if err := s.repo.ConfirmVerification(ctx, userRecord.ID, record.ID, event); err != nil {
+		s.logger.Error(domain.LogService, "Failed to confirm verification", "error", err)
+		return err
+	}
+	return nil
+}
+
+// resendVerificationCode replaces the user's code, with the same limits as
+// resending a link: one a minute and three an hour.
+func (s *UserSerivce) resendVerificationCode(ctx context.Context, userID uuid.UUID, email string) error {
+	lastMinute, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userID, domainuserverification.PurposeEmailVerificationCode, time.Now().Add(-60*time.Second))
+	if err != nil {
+		return err
+	}
+	lastHour, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userID, domainuserverification.PurposeEmailVerificationCode, time.Now().Add(-1*time.Hour))
+	if err != nil {
+		return err
+	}
+	if lastMinute > 0 || lastHour >= maxVerificationCodesPerHour {
+		return domain.ErrTooManyRequests
+	}
+
+	code, codeHash, err := s.newVerificationCode()
+	if err != nil {
+		return err
+	}
+	return s.repo.CreateEmailVerificationCode(ctx, &userverification.UserVerification{
+		UserID:    userID,
+		Token:     codeHash,
+		Status:    "pending",
+		Purpose:   domainuserverification.PurposeEmailVerificationCode,
+		ExpiresAt: time.Now().Add(s.authConfig.EmailVerification.CodeTTL),
+	}, domainevents.New(ctx, userID, domainevents.VerificationCodeRequested{Email: email, Code: code}))
+}
+
+// newVerificationCode returns a code and the bcrypt hash stored in its place.
+// A salted hash keeps equal codes of different users apart in the unique
+// token column, and makes a leaked row slow to brute force.
+func (s *UserSerivce) newVerificationCode() (string, string, error) {
+	code, err := GenerateVerificationCode()
+	if err != nil {
+		s.logger.Error(domain.LogService, "Verification code generation failed", "error", err)
+		return "", "", domain.ErrDomainInternalError
+	}
+	codeHash, err := HashPassword(code)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while hashing verification code", "error", err)
+		return "", "", domain.ErrHashingError
+	}
+	return code, codeHash, nil
+}
+
+func (s *UserSerivce) verificationMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return s.authConfig.EmailVerification.DefaultMode, nil
+	case domainuserverification.ModeLink, domainuserverification.ModeCode:
+		return mode, nil
+	}
+	return "", domain.ErrInvalidVerificationMode
+}
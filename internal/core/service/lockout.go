@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
+	"github.com/golang-auth/internal/core/domain"
+	domainusersessions "github.com/golang-auth/internal/core/domain/user_sessions"
+	"github.com/google/uuid"
+)
+
+// UnlockAccount lifts a lockout before it runs out and clears the failed
+// login count. It is meant for admins; the unlock is audited with their ID.
+func (s *UserSerivce) UnlockAccount(ctx context.Context, adminID, userID uuid.UUID) error {
+	unlockedBy := "by=" + adminID.String()
+	audit := repousersessions.AuditUserSessions{
+		UserID:    userID,
+		EventType: domainusersessions.AuditEventAccountUnlocked,
+		NewValue:  &unlockedBy,
+	}
+	if err := s.repo.UnlockUser(ctx, userID, &audit); err != nil {
+		return err
+	}
+	s.logger.Info(domain.LogService, "Account unlocked by admin", "user_id", userID, "admin_id", adminID)
+	return nil
+}
+
+// bookLoginAttempt counts a login before its password or code is checked. It fails
+// with a RetryAfterError while the account waits out a delay or lock, so
+// waiting guesses cost nothing.
+func (s *UserSerivce) bookLoginAttempt(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.repo.BookLoginAttempt(ctx, userID, func(failures int) time.Duration {
+		delay, _ := loginDelay(s.authConfig.Lockout, failures)
+		return delay
+	})
+}
+
+// recordFailedLogin audits a wrong password or second factor code. The wait it costs was already
+// set when the attempt was booked.
+func (s *UserSerivce) recordFailedLogin(ctx context.Context, userID uuid.UUID, failures int) error {
+	delay, locked := loginDelay(s.authConfig.Lockout, failures)
+	var audit *repousersessions.AuditUserSessions
+	if locked {
+		s.logger.Warn(domain.LogService, "Account locked after too many failed logins", "user_id", userID, "attempts", failures)
+		lockedUntil := "until=" + time.Now().Add(delay).UTC().Format(time.RFC3339)
+		audit = &repousersessions.AuditUserSessions{
+			UserID:    userID,
+			EventType: domainusersessions.AuditEventAccountLocked,
+			NewValue:  &lockedUntil,
+		}
+	}
+	return s.repo.RecordFailedLogin(ctx, userID, failures, audit)
+}
+
+// loginDelay is how long an account waits after its n-th failed login in a
+// row, and whether that wait is a full lock.
+func loginDelay(cfg *config.LockoutConfig, failures int) (time.Duration, bool) {
+	if failures >= cfg.Threshold {
+		return cfg.LockDuration, true
+	}
+	if failures <= cfg.FreeAttempts {
+		return 0, false
+	}
+	delay := cfg.BaseDelay
+	for i := cfg.FreeAttempts + 1; i < failures && delay < cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, cfg.MaxDelay), false
+}
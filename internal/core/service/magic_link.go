@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainuserverification "github.com/golang-auth/internal/core/domain/user_verification"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+const (
+	magicLinkTokenTTL    = 15 * time.Minute
+	maxMagicLinksPerHour = 5
+)
+
+// RequestMagicLink emails a single-use login link to an active account. Like
+// ForgotPassword it never tells the caller whether the account exists.
+func (s *UserSerivce) RequestMagicLink(ctx context.Context, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	userRecord, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			s.logger.Debug(domain.LogService, "Magic link requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+	if userRecord.UserStatus != "active" {
+		s.logger.Info(domain.LogService, "Magic link requested for an inactive account", "user_id", userRecord.ID, "status", userRecord.UserStatus)
+		return nil
+	}
+
+	oneHourAgo := time.Now().Add(-1 * time.Hour)
+	count, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userRecord.ID, domainuserverification.PurposeMagicLink, oneHourAgo)
+	if err != nil {
+		return err
+	}
+	if count >= maxMagicLinksPerHour {
+		s.logger.Warn(domain.LogService, "Magic link rate limit reached", "user_id", userRecord.ID)
+		return nil
+	}
+
+	payload := func(token string) domainevents.Payload {
+		return domainevents.MagicLinkRequested{Email: email, Token: token}
+	}
+	_, err = s.issueEmailToken(ctx, userRecord.ID, domainuserverification.PurposeMagicLink, magicLinkTokenTTL, payload, s.repo.CreateMagicLinkToken)
+	return err
+}
+
+// LoginWithMagicLink consumes a token from RequestMagicLink and signs the user
+// in the same way Login does, MFA challenge included. Every kind of bad link
+// gets the same error.
+func (s *UserSerivce) LoginWithMagicLink(ctx context.Context, req *ports.MagicLinkLoginRequest) (*ports.LoginResponse, error) {
+	if req.Token == "" {
+		return nil, domain.ErrInvalidMagicLink
+	}
+
+	record, err := s.repo.GetVerificationByToken(ctx, HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			return nil, domain.ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+	if record.Purpose != domainuserverification.PurposeMagicLink || record.Status != "pending" {
+		return nil, domain.ErrInvalidMagicLink
+	}
+	if time.Now().After(record.ExpiresAt) {
+		if err := s.repo.UpdateUserVerificationTokenStatus(ctx, record.ID, "expired"); err != nil {
+			return nil, domain.ErrRepositoryInternalError
+		}
+		return nil, domain.ErrInvalidMagicLink
+	}
+
+	if err := s.repo.ConsumeVerificationToken(ctx, record.ID); err != nil {
+		if errors.Is(err, domain.ErrUsedToken) {
+			return nil, domain.ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserStatus(userRecord); err != nil {
+		return nil, err
+	}
+
+	// The link proves access to the inbox, which is one factor like a password.
+	if userRecord.IsMFAEnabled {
+		return s.issueMFAChallenge(ctx, userRecord.ID)
+	}
+	return s.startSession(ctx, userRecord, domainevents.LoginMethodMagicLink, ports.CreateUserSessionRequest{IPAddress: req.IPAddress, UserAgent: req.UserAgent, Device: req.Device})
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"time"
+
+	repousermfa "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_mfa"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// EnrollTOTP starts a TOTP enrollment. The secret is stored encrypted and
+// stays inactive until ConfirmTOTP sees a first valid code.
+func (s *UserSerivce) EnrollTOTP(ctx context.Context, userID uuid.UUID) (*ports.TOTPEnrollment, error) {
+	userRecord, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if userRecord.IsMFAEnabled {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while generating TOTP secret", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	defer scrubBytes(secret)
+
+	ciphertext, err := s.authConfig.MFA.EncryptSecret(userID, secret)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while encrypting TOTP secret", "error", err, "user_id", userID)
+		return nil, domain.ErrDomainInternalError
+	}
+	if err := s.repo.UpsertTOTPEnrollment(ctx, userID, ciphertext); err != nil {
+		return nil, err
+	}
+
+	return &ports.TOTPEnrollment{
+		Secret: totpEncoding.EncodeToString(secret),
+		URI:    totpURI(s.authConfig.MFA.Issuer, userRecord.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP activates a pending enrollment, turns MFA on for the user and
+// returns the first batch of recovery codes. They are only shown this once.
+func (s *UserSerivce) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	factor, err := s.repo.GetTOTPByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, domain.ErrMFAAlreadyEnabled
+	}
+
+	step, err := s.checkTOTPCode(factor, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConfirmTOTPEnrollment(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	s.logger.Info(domain.LogService, "TOTP enrolled, MFA enabled", "user_id", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new batch.
+// Every code of the previous batch stops working.
+func (s *UserSerivce) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	userRecord, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !userRecord.IsMFAEnabled {
+		return nil, domain.ErrMFANotEnabled
+	}
+
+	codes, hashes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	s.logger.Info(domain.LogService, "MFA recovery codes regenerated", "user_id", userID)
+	return codes, nil
+}
+
+// LoginWithMFA trades the challenge from Login plus a TOTP code, or one of the
+// user's recovery codes, for a session.
+func (s *UserSerivce) LoginWithMFA(ctx context.Context, req *ports.MFALoginRequest) (*ports.LoginResponse, error) {
+	if req.Challenge == "" {
+		return nil, domain.ErrInvalidMFAChallenge
+	}
+
+	challenge, err := s.repo.GetMFAChallengeByToken(ctx, HashToken(req.Challenge))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		s.discardMFAChallenge(ctx, challenge.ID)
+		return nil, domain.ErrMFAChallengeExpired
+	}
+
+	// The attempt is booked before the code is checked, so parallel guesses
+	// can't all read the same count and slip past the limit
+	if err := s.repo.CountMFAChallengeAttempt(ctx, challenge.ID, s.authConfig.MFA.MaxChallengeAttempts); err != nil {
+		if errors.Is(err, domain.ErrInvalidMFAChallenge) {
+			s.discardMFAChallenge(ctx, challenge.ID)
+		}
+		return nil, err
+	}
+	// Codes count against the account lockout like passwords do, so a new
+	// challenge per password login doesn't buy an attacker more guesses
+	failures, err := s.bookLoginAttempt(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RecoveryCode != "" {
+		return s.loginWithRecoveryCode(ctx, challenge, req, failures)
+	}
+
+	factor, err := s.repo.GetTOTPByUserID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if factor.ConfirmedAt == nil {
+		return nil, domain.ErrMFANotEnrolled
+	}
+	step, err := s.checkTOTPCode(factor, req.Code)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidMFACode) {
+			if err := s.recordFailedLogin(ctx, challenge.UserID, failures); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	// Consume the challenge before the code, so neither can be used twice
+	if err := s.repo.DeleteMFAChallenge(ctx, challenge.ID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConsumeTOTPStep(ctx, challenge.UserID, step); err != nil {
+		if errors.Is(err, domain.ErrMFACodeReused) {
+			s.logger.Warn(domain.LogService, "Replayed TOTP code rejected", "user_id", challenge.UserID)
+		}
+		return nil, err
+	}
+
+	if err := s.repo.UnlockUser(ctx, challenge.UserID, nil); err != nil {
+		return nil, err
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, userRecord, domainevents.LoginMethodTOTP, ports.CreateUserSessionRequest{IPAddress: req.IPAddress, UserAgent: req.UserAgent, Device: req.Device})
+}
+
+func (s *UserSerivce) loginWithRecoveryCode(ctx context.Context, challenge *repousermfa.MFAChallenge, req *ports.MFALoginRequest, failures int) (*ports.LoginResponse, error) {
+	codes, err := s.repo.GetUnusedRecoveryCodes(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.authConfig.MFA.HashRecoveryCode(challenge.UserID, normalizeRecoveryCode(req.RecoveryCode))
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while hashing recovery code", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	match := -1
+	for i := range codes {
+		if hmac.Equal([]byte(hash), []byte(codes[i].CodeHash)) {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		if err := s.recordFailedLogin(ctx, challenge.UserID, failures); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidMFACode
+	}
+
+	if err := s.repo.DeleteMFAChallenge(ctx, challenge.ID); err != nil {
+		return nil, err
+	}
+	userRecord, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// The code is spent in the transaction that creates the session, so a
+	// lost race leaves neither a session nor its audit and login event
+	response, err := s.startSession(ctx, userRecord, domainevents.LoginMethodRecoveryCode, ports.CreateUserSessionRequest{
+		IPAddress:         req.IPAddress,
+		UserAgent:         req.UserAgent,
+		Device:            req.Device,
+		RecoveryCodeID:    codes[match].ID,
+		RecoveryCodesLeft: len(codes) - 1,
+	})
+	if err != nil {
+		if errors.Is(err, domain.ErrMFACodeReused) {
+			s.logger.Warn(domain.LogService, "Replayed MFA recovery code rejected", "user_id", challenge.UserID)
+		}
+		return nil, err
+	}
+	if err := s.repo.UnlockUser(ctx, challenge.UserID, nil); err != nil {
+		return nil, err
+	}
+	s.logger.Info(domain.LogService, "MFA recovery code used", "user_id", challenge.UserID, "remaining", len(codes)-1)
+	return response, nil
+}
+
+func (s *UserSerivce) issueMFAChallenge(ctx context.Context, userID uuid.UUID) (*ports.LoginResponse, error) {
+	const maxRetries = 3
+	for i := 0; i < maxRetries; i++ {
+		token, err := GenerateSecureToken()
+		if err != nil {
+			s.logger.Error(domain.LogService, "Error while generating MFA challenge", "error", err)
+			return nil, domain.ErrDomainInternalError
+		}
+
+		challenge := repousermfa.MFAChallenge{
+			UserID:    userID,
+			Token:     HashToken(token),
+			ExpiresAt: time.Now().Add(s.authConfig.MFA.ChallengeTTL),
+		}
+		err = s.repo.CreateMFAChallenge(ctx, &challenge)
+		if err == nil {
+			return &ports.LoginResponse{
+				UserID:                userID,
+				MFAChallenge:          token,
+				MFAChallengeExpiresAt: challenge.ExpiresAt,
+			}, nil
+		}
+		if !errors.Is(err, domain.ErrTokenCollision) {
+			return nil, err
+		}
+	}
+	s.logger.Error(domain.LogService, "Max retries reached for MFA challenge collisions")
+	return nil, domain.ErrDatabaseInternalError
+}
+
+// checkTOTPCode returns the time step of a valid code. The step has to be newer
+// than the last accepted one, which rules out replays inside the skew window.
+func (s *UserSerivce) checkTOTPCode(factor *repousermfa.UserMFATOTP, code string) (int64, error) {
+	secret, err := s.authConfig.MFA.DecryptSecret(factor.UserID, factor.SecretCiphertext)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while decrypting TOTP secret", "error", err, "user_id", factor.UserID)
+		return 0, domain.ErrDomainInternalError
+	}
+	defer scrubBytes(secret)
+
+	step, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return 0, domain.ErrInvalidMFACode
+	}
+	if step <= factor.LastUsedStep {
+		return 0, domain.ErrMFACodeReused
+	}
+	return step, nil
+}
+
+// newRecoveryCodes returns a fresh batch of recovery codes and their keyed
+// hashes. Only the hashes are stored.
+func (s *UserSerivce) newRecoveryCodes(userID uuid.UUID) ([]string, []string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while generating recovery codes", "error", err)
+		return nil, nil, domain.ErrDomainInternalError
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i], err = s.authConfig.MFA.HashRecoveryCode(userID, normalizeRecoveryCode(code))
+		if err != nil {
+			s.logger.Error(domain.LogService, "Error while hashing recovery code", "error", err)
+			return nil, nil, domain.ErrDomainInternalError
+		}
+	}
+	return codes, hashes, nil
+}
+
+func (s *UserSerivce) discardMFAChallenge(ctx context.Context, challengeID uuid.UUID) {
+	if err := s.repo.DeleteMFAChallenge(ctx, challengeID); err != nil && !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+		s.logger.Error(domain.LogService, "Failed to delete MFA challenge", "error", err, "challenge_id", challengeID)
+	}
+}
+
+func scrubBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
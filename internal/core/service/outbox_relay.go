@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// OutboxRelay hands the events the service committed to the outbox over to
+// the message broker. Delivery is at least once: an event is marked
+// dispatched only after the publisher accepted it, so a crash in between
+// sends it again. Failed events are retried with backoff and dead-lettered
+// after MaxAttempts; events the publisher rejects are dead-lettered at once.
+type OutboxRelay struct {
+	repo      ports.OutboxRepo
+	publisher ports.EventPublisher
+	logger    ports.Logger
+	config    *config.OutboxConfig
+}
+
+func NewOutboxRelay(repo ports.OutboxRepo, publisher ports.EventPublisher, logger ports.Logger, cfg *config.OutboxConfig) *OutboxRelay {
+	return &OutboxRelay{
+		repo:      repo,
+		publisher: publisher,
+		logger:    logger,
+		config:    cfg,
+	}
+}
+
+// Run dispatches due events every PollInterval until ctx is done. A full
+// batch is followed by the next one right away.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for ctx.Err() == nil {
+				n, err := r.DispatchPending(ctx)
+				if err != nil || n < r.config.BatchSize {
+					break
+				}
+			}
+		}
+	}
+}
+
+// DispatchPending claims one batch of due events and publishes them. It
+// returns how many events were claimed.
+func (r *OutboxRelay) DispatchPending(ctx context.Context) (int, error) {
+	events, err := r.repo.ClaimOutboxEvents(ctx, r.config.BatchSize, r.config.Lease)
+	if err != nil {
+		r.logger.Error(domain.LogService, "Failed to claim outbox events", "error", err)
+		return 0, err
+	}
+
+	results := r.publishAll(ctx, events)
+	for i, event := range events {
+		if err := results[i]; err != nil {
+			r.fail(ctx, event, err)
+			continue
+		}
+		if err := r.repo.MarkOutboxEventDispatched(ctx, event.ID, event.LeaseID); err != nil {
+			// The lease ran out mid-publish; whoever holds it now sends a duplicate
+			r.logger.Warn(domain.LogService, "Could not mark outbox event dispatched", "error", err, "event_id", event.ID, "type", event.Type)
+		}
+	}
+	return len(events), nil
+}
+
+// fail reschedules an event after a failed publish, or dead-letters it once
+// it is out of attempts.
+func (r *OutboxRelay) fail(ctx context.Context, event ports.OutboxEvent, cause error) {
+	if event.Attempts >= r.config.MaxAttempts || errors.Is(cause, domain.ErrEventRejected) {
+		r.logger.Error(domain.LogService, "Outbox event dead-lettered", "error", cause, "event_id", event.ID, "type", event.Type, "attempts", event.Attempts)
+		if err := r.repo.DeadLetterOutboxEvent(ctx, event.ID, event.LeaseID, cause.Error()); err != nil {
+			r.logger.Warn(domain.LogService, "Could not dead-letter outbox event", "error", err, "event_id", event.ID)
+		}
+		return
+	}
+
+	retryAt := time.Now().Add(r.config.Backoff(event.Attempts))
+	r.logger.Warn(domain.LogService, "Outbox event publish failed, retrying", "error", cause, "event_id", event.ID, "type", event.Type, "attempts", event.Attempts, "retry_at", retryAt)
+	if err := r.repo.RescheduleOutboxEvent(ctx, event.ID, event.LeaseID, retryAt, cause.Error()); err != nil {
+		r.logger.Warn(domain.LogService, "Could not reschedule outbox event", "error", err, "event_id", event.ID)
+	}
+}
+
+// publishAll publishes events in one go when the publisher can batch them,
+// one by one otherwise. Events whose data could not be decoded are rejected
+// without reaching the publisher.
+func (r *OutboxRelay) publishAll(ctx context.Context, events []ports.OutboxEvent) []error {
+	errs := make([]error, len(events))
+	pending := make([]domainevents.Event, 0, len(events))
+	index := make([]int, 0, len(events))
+	for i, event := range events {
+		if event.Data == nil {
+			errs[i] = fmt.Errorf("%w: undecodable %q event", domain.ErrEventRejected, event.Type)
+			continue
+		}
+		pending = append(pending, event.Event)
+		index = append(index, i)
+	}
+
+	if batch, ok := r.publisher.(ports.BatchEventPublisher); ok && len(pending) > 0 {
+		for j, err := range batch.PublishBatch(ctx, pending) {
+			errs[index[j]] = err
+		}
+		return errs
+	}
+	for j, event := range pending {
+		errs[index[j]] = r.publisher.Publish(ctx, event)
+	}
+	return errs
+}
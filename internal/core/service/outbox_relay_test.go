@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.OutboxConfig{BatchSize: 10, MaxAttempts: 3, BaseBackoff: time.Minute, MaxBackoff: time.Hour, Lease: time.Minute}
+
+	newRelay := func() (*OutboxRelay, *testutil.MemoryOutbox, *testutil.MemoryPublisher) {
+		outbox, publisher := testutil.NewMemoryOutbox(), &testutil.MemoryPublisher{}
+		return NewOutboxRelay(outbox, publisher, &testutil.NoopLogger{}, cfg), outbox, publisher
+	}
+
+	t.Run("Publishes every event once", func(t *testing.T) {
+		relay, outbox, publisher := newRelay()
+		userID := uuid.New()
+		events := []*domainevents.Event{
+			domainevents.New(ctx, userID, domainevents.UserRegistered{Email: "a@example.com", Token: "link"}),
+			domainevents.New(ctx, userID, domainevents.VerificationCodeRequested{Email: "b@example.com", Code: "123456"}),
+			domainevents.New(ctx, userID, domainevents.PasswordResetRequested{Email: "c@example.com", Token: "reset"}),
+			domainevents.New(ctx, userID, domainevents.MagicLinkRequested{Email: "d@example.com", Token: "magic"}),
+			domainevents.New(ctx, userID, domainevents.SessionAnomalyDetected{Email: "e@example.com", SessionID: uuid.New(), IPChanged: true, IPAddress: "203.0.113.5"}),
+		}
+		var ids []uuid.UUID
+		for _, event := range events {
+			ids = append(ids, outbox.Add(*event))
+		}
+
+		n, err := relay.DispatchPending(ctx)
+		if err != nil || n != len(events) {
+			t.Fatalf("DispatchPending() = %d, %v", n, err)
+		}
+		published := publisher.Events()
+		if len(published) != len(events) {
+			t.Fatalf("expected %d published events, got %d", len(events), len(published))
+		}
+		for i, event := range events {
+			if got := published[i]; got.ID != event.ID || got.Data != event.Data {
+				t.Errorf("event %d: got %+v, want %+v", i, got, event)
+			}
+			if entry := outbox.Entry(ids[i]); entry.Status != "dispatched" {
+				t.Errorf("event %d: status %q, want dispatched", i, entry.Status)
+			}
+		}
+
+		outbox.MakeDue()
+		if n, _ := relay.DispatchPending(ctx); n != 0 || len(publisher.Events()) != len(events) {
+			t.Errorf("dispatched events went out again: claimed %d", n)
+		}
+	})
+
+	t.Run("Failed publish is retried with backoff", func(t *testing.T) {
+		relay, outbox, publisher := newRelay()
+		id := outbox.Add(*domainevents.New(ctx, uuid.New(), domainevents.PasswordResetRequested{Email: "a@example.com", Token: "reset"}))
+		publisher.FailNext(2)
+
+		before := time.Now()
+		relay.DispatchPending(ctx)
+		entry := outbox.Entry(id)
+		if entry.Status != "pending" || entry.Attempts != 1 || entry.LastError == "" {
+			t.Fatalf("unexpected entry after a failure: %+v", entry)
+		}
+		if wait := entry.NextAttemptAt.Sub(before); wait < time.Minute || wait > time.Minute+time.Second {
+			t.Errorf("first retry after %v, want 1m", wait)
+		}
+
+		// Not due yet
+		if n, _ := relay.DispatchPending(ctx); n != 0 {
+			t.Fatalf("claimed %d events before the backoff ran out", n)
+		}
+
+		outbox.MakeDue()
+		before = time.Now()
+		relay.DispatchPending(ctx)
+		if wait := outbox.Entry(id).NextAttemptAt.Sub(before); wait < 2*time.Minute || wait > 2*time.Minute+time.Second {
+			t.Errorf("second retry after %v, want 2m", wait)
+		}
+
+		outbox.MakeDue()
+		relay.DispatchPending(ctx)
+		if entry := outbox.Entry(id); entry.Status != "dispatched" || len(publisher.Events()) != 1 {
+			t.Errorf("expected the event to go out on the third attempt, got %+v", entry)
+		}
+	})
+
+	t.Run("Dead-letters after MaxAttempts", func(t *testing.T) {
+		relay, outbox, publisher := newRelay()
+		id := outbox.Add(*domainevents.New(ctx, uuid.New(), domainevents.MagicLinkRequested{Email: "a@example.com", Token: "magic"}))
+		publisher.FailNext(cfg.MaxAttempts)
+
+		for i := 0; i < cfg.MaxAttempts; i++ {
+			outbox.MakeDue()
+			relay.DispatchPending(ctx)
+		}
+		entry := outbox.Entry(id)
+		if entry.Status != "dead" || entry.Attempts != cfg.MaxAttempts {
+			t.Fatalf("expected a dead event after %d attempts, got %+v", cfg.MaxAttempts, entry)
+		}
+
+		outbox.MakeDue()
+		if n, _ := relay.DispatchPending(ctx); n != 0 {
+			t.Errorf("dead event was claimed again")
+		}
+	})
+
+	t.Run("Undecodable event is dead-lettered right away", func(t *testing.T) {
+		relay, outbox, publisher := newRelay()
+		// What ClaimOutboxEvents returns for a payload it could not decode
+		id := outbox.Add(domainevents.Event{Type: "user.unknown"})
+
+		relay.DispatchPending(ctx)
+		if entry := outbox.Entry(id); entry.Status != "dead" || entry.Attempts != 1 {
+			t.Errorf("unexpected entry: %+v", entry)
+		}
+		if len(publisher.Events()) != 0 {
+			t.Error("undecodable event was published")
+		}
+	})
+}
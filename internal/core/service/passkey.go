@@ -0,0 +1,340 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+const (
+	passkeyRegisterKeyPrefix = "webauthn:register:"
+	passkeyLoginKeyPrefix    = "webauthn:login:"
+	passkeyDefaultName       = "Passkey"
+
+	// RSA keys below 2048 bits are refused like any other unsupported key
+	passkeyMinRSAModulusSize = 256
+)
+
+// COSE algorithms accepted for passkeys, in order of preference.
+var webauthnAlgorithms = []webauthncose.COSEAlgorithmIdentifier{
+	webauthncose.AlgES256,
+	webauthncose.AlgEdDSA,
+	webauthncose.AlgRS256,
+}
+
+// passkeyUser adapts a user and the passkeys of theirs that matter to a
+// ceremony to go-webauthn. The user handle is the user ID.
+type passkeyUser struct {
+	id          uuid.UUID
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.id[:] }
+func (u *passkeyUser) WebAuthnName() string                       { return u.name }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.name }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// BeginPasskeyRegistration issues the options for navigator.credentials.create().
+// One registration per user can be pending; starting another replaces it.
+func (s *UserSerivce) BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*ports.PasskeyCreationOptions, error) {
+	userRecord, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserStatus(userRecord); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([]protocol.CredentialDescriptor, 0, len(existing))
+	for _, credential := range existing {
+		exclude = append(exclude, protocol.CredentialDescriptor{Type: protocol.PublicKeyCredentialType, CredentialID: credential.CredentialID})
+	}
+
+	params := make([]protocol.CredentialParameter, 0, len(webauthnAlgorithms))
+	for _, alg := range webauthnAlgorithms {
+		params = append(params, protocol.CredentialParameter{Type: protocol.PublicKeyCredentialType, Algorithm: alg})
+	}
+
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	user := &passkeyUser{id: userID, name: userRecord.Email}
+	creation, session, err := relyingParty.BeginRegistration(user, webauthn.WithExclusions(exclude), webauthn.WithCredentialParameters(params))
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while starting passkey registration", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	if err := s.savePasskeySession(ctx, passkeyRegisterKeyPrefix+userID.String(), session); err != nil {
+		return nil, err
+	}
+
+	cfg := s.authConfig.WebAuthn
+	options := &ports.PasskeyCreationOptions{
+		Challenge:            creation.Response.Challenge,
+		RPID:                 cfg.RPID,
+		RPName:               cfg.RPName,
+		UserHandle:           user.WebAuthnID(),
+		UserName:             userRecord.Email,
+		ExcludeCredentialIDs: make([][]byte, 0, len(exclude)),
+		Timeout:              cfg.ChallengeTTL,
+	}
+	for _, param := range creation.Response.Parameters {
+		options.Algorithms = append(options.Algorithms, int64(param.Algorithm))
+	}
+	for _, descriptor := range exclude {
+		options.ExcludeCredentialIDs = append(options.ExcludeCredentialIDs, descriptor.CredentialID)
+	}
+	return options, nil
+}
+
+// FinishPasskeyRegistration checks the attestation returned by the browser and
+// stores the new credential.
+func (s *UserSerivce) FinishPasskeyRegistration(ctx context.Context, userID uuid.UUID, req *ports.PasskeyRegistration) error {
+	session, err := s.takePasskeySession(ctx, passkeyRegisterKeyPrefix+userID.String())
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.CredentialCreationResponse{
+		PublicKeyCredential: publicKeyCredential(req.CredentialID),
+		AttestationResponse: protocol.AuthenticatorAttestationResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: req.ClientDataJSON},
+			AttestationObject:     req.AttestationObject,
+		},
+	}.Parse()
+	if err != nil {
+		return domain.ErrInvalidPasskeyAttestation
+	}
+	alg, err := passkeyAlgorithm(parsed.Response.AttestationObject.AuthData.AttData.CredentialPublicKey)
+	if err != nil {
+		return err
+	}
+
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return err
+	}
+	credential, err := relyingParty.CreateCredential(&passkeyUser{id: userID}, *session, parsed)
+	if err != nil {
+		s.logger.Debug(domain.LogService, "Passkey attestation rejected", "error", err, "user_id", userID)
+		return domain.ErrInvalidPasskeyAttestation
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = passkeyDefaultName
+	}
+
+	record := repouserwebauthn.WebAuthnCredential{
+		UserID:            userID,
+		CredentialID:      credential.ID,
+		PublicKey:         credential.PublicKey,
+		Algorithm:         alg,
+		SignCount:         int64(credential.Authenticator.SignCount),
+		AAGUID:            credential.Authenticator.AAGUID,
+		AttestationFormat: credential.AttestationType,
+		BackupEligible:    credential.Flags.BackupEligible,
+		Name:              name,
+	}
+	if err := s.repo.CreateWebAuthnCredential(ctx, &record); err != nil {
+		return err
+	}
+	s.logger.Info(domain.LogService, "Passkey registered", "user_id", userID, "alg", alg)
+	return nil
+}
+
+// BeginPasskeyLogin issues the options for navigator.credentials.get(). The
+// challenge is its own lookup key, so no state is tied to the caller yet.
+func (s *UserSerivce) BeginPasskeyLogin(ctx context.Context) (*ports.PasskeyRequestOptions, error) {
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	assertion, session, err := relyingParty.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while starting passkey login", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	if err := s.savePasskeySession(ctx, passkeyLoginKeyPrefix+session.Challenge, session); err != nil {
+		return nil, err
+	}
+
+	cfg := s.authConfig.WebAuthn
+	return &ports.PasskeyRequestOptions{
+		Challenge: assertion.Response.Challenge,
+		RPID:      cfg.RPID,
+		Timeout:   cfg.ChallengeTTL,
+	}, nil
+}
+
+// FinishPasskeyLogin verifies an assertion and starts a session. A passkey
+// always requires user verification, so it stands in for both factors.
+func (s *UserSerivce) FinishPasskeyLogin(ctx context.Context, req *ports.PasskeyLoginRequest) (*ports.LoginResponse, error) {
+	parsed, err := protocol.CredentialAssertionResponse{
+		PublicKeyCredential: publicKeyCredential(req.CredentialID),
+		AssertionResponse: protocol.AuthenticatorAssertionResponse{
+			AuthenticatorResponse: protocol.AuthenticatorResponse{ClientDataJSON: req.ClientDataJSON},
+			AuthenticatorData:     req.AuthenticatorData,
+			Signature:             req.Signature,
+			UserHandle:            req.UserHandle,
+		},
+	}.Parse()
+	if err != nil {
+		return nil, domain.ErrInvalidPasskeyAssertion
+	}
+	session, err := s.takePasskeySession(ctx, passkeyLoginKeyPrefix+parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	var record *repouserwebauthn.WebAuthnCredential
+	var lookupErr error
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		record, lookupErr = s.repo.GetWebAuthnCredentialByCredentialID(ctx, rawID)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if !bytes.Equal(userHandle, record.UserID[:]) {
+			return nil, domain.ErrInvalidPasskeyAssertion
+		}
+		return &passkeyUser{id: record.UserID, credentials: []webauthn.Credential{storedCredential(record)}}, nil
+	}
+
+	relyingParty, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := relyingParty.ValidatePasskeyLogin(lookup, *session, parsed); err != nil {
+		if errors.Is(lookupErr, domain.ErrDatabaseInternalError) {
+			return nil, lookupErr
+		}
+		return nil, domain.ErrInvalidPasskeyAssertion
+	}
+
+	// Only the update that moves the counter forward wins, so a cloned
+	// authenticator can't race the genuine one past the check
+	signCount := int64(parsed.Response.AuthenticatorData.Counter)
+	if err := s.repo.UpdateWebAuthnSignCount(ctx, record.ID, signCount); err != nil {
+		if errors.Is(err, domain.ErrPasskeyCloned) {
+			s.logger.Warn(domain.LogService, "Passkey counter went backwards, possible clone", "user_id", record.UserID, "credential_id", record.ID)
+		}
+		return nil, err
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserStatus(userRecord); err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, userRecord, domainevents.LoginMethodPasskey, ports.CreateUserSessionRequest{IPAddress: req.IPAddress, UserAgent: req.UserAgent, Device: req.Device})
+}
+
+func (s *UserSerivce) relyingParty() (*webauthn.WebAuthn, error) {
+	relyingParty, err := s.authConfig.WebAuthn.RelyingParty()
+	if err != nil {
+		s.logger.Error(domain.LogService, "Invalid WebAuthn settings", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	return relyingParty, nil
+}
+
+// savePasskeySession stores the ceremony state until the browser answers.
+func (s *UserSerivce) savePasskeySession(ctx context.Context, key string, session *webauthn.SessionData) error {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while encoding passkey session", "error", err)
+		return domain.ErrDomainInternalError
+	}
+	return s.challenges.Save(ctx, key, raw, s.authConfig.WebAuthn.ChallengeTTL)
+}
+
+// takePasskeySession redeems the ceremony state stored under key; it can only
+// be taken once.
+func (s *UserSerivce) takePasskeySession(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	raw, err := s.challenges.Take(ctx, key)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrInvalidPasskeyChallenge
+		}
+		return nil, err
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		s.logger.Error(domain.LogService, "Error while decoding passkey session", "error", err)
+		return nil, domain.ErrDomainInternalError
+	}
+	return &session, nil
+}
+
+func publicKeyCredential(rawID []byte) protocol.PublicKeyCredential {
+	return protocol.PublicKeyCredential{
+		Credential: protocol.Credential{
+			ID:   base64.RawURLEncoding.EncodeToString(rawID),
+			Type: string(protocol.PublicKeyCredentialType),
+		},
+		RawID: rawID,
+	}
+}
+
+// passkeyAlgorithm returns the COSE algorithm of a credential public key, or
+// ErrUnsupportedPasskey for keys outside webauthnAlgorithms.
+func passkeyAlgorithm(publicKey []byte) (int64, error) {
+	key, err := webauthncose.ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, domain.ErrInvalidPasskeyAttestation
+	}
+	var data webauthncose.PublicKeyData
+	switch key := key.(type) {
+	case webauthncose.EC2PublicKeyData:
+		data = key.PublicKeyData
+	case webauthncose.OKPPublicKeyData:
+		data = key.PublicKeyData
+	case webauthncose.RSAPublicKeyData:
+		if len(key.Modulus) < passkeyMinRSAModulusSize {
+			return 0, domain.ErrUnsupportedPasskey
+		}
+		data = key.PublicKeyData
+	default:
+		return 0, domain.ErrUnsupportedPasskey
+	}
+	if !slices.Contains(webauthnAlgorithms, webauthncose.COSEAlgorithmIdentifier(data.Algorithm)) {
+		return 0, domain.ErrUnsupportedPasskey
+	}
+	return data.Algorithm, nil
+}
+
+// storedCredential turns a stored passkey into the credential record
+// go-webauthn checks an assertion against.
+func storedCredential(record *repouserwebauthn.WebAuthnCredential) webauthn.Credential {
+	return webauthn.Credential{
+		ID:              record.CredentialID,
+		PublicKey:       record.PublicKey,
+		AttestationType: record.AttestationFormat,
+		Flags:           webauthn.CredentialFlags{BackupEligible: record.BackupEligible},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    record.AAGUID,
+			SignCount: uint32(record.SignCount),
+		},
+	}
+}
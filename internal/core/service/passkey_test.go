@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
+	"github.com/golang-auth/internal/core/domain"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/golang-auth/internal/testutil"
+	"github.com/google/uuid"
+)
+
+// newPasskeyTestService wires the service to an in-memory credential table.
+func newPasskeyTestService(t *testing.T, user *repouser.User) (*UserSerivce, *[]repouserwebauthn.WebAuthnCredential) {
+	t.Helper()
+
+	credentials := &[]repouserwebauthn.WebAuthnCredential{}
+	mockRepo := &mockUserRepo{
+		getUserByIDFn: func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+			if id != user.ID {
+				return nil, domain.ErrUserNotFound
+			}
+			return user, nil
+		},
+		getWebAuthnCredentialsByUserID: func(ctx context.Context, id uuid.UUID) ([]repouserwebauthn.WebAuthnCredential, error) {
+			var owned []repouserwebauthn.WebAuthnCredential
+			for _, c := range *credentials {
+				if c.UserID == id {
+					owned = append(owned, c)
+				}
+			}
+			return owned, nil
+		},
+		createWebAuthnCredential: func(ctx context.Context, c *repouserwebauthn.WebAuthnCredential) error {
+			for _, existing := range *credentials {
+				if bytes.Equal(existing.CredentialID, c.CredentialID) {
+					return domain.ErrPasskeyAlreadyRegistered
+				}
+			}
+			c.ID = uuid.New()
+			*credentials = append(*credentials, *c)
+			return nil
+		},
+		getWebAuthnCredentialByCredentialID: func(ctx context.Context, id []byte) (*repouserwebauthn.WebAuthnCredential, error) {
+			for _, c := range *credentials {
+				if bytes.Equal(c.CredentialID, id) {
+					return &c, nil
+				}
+			}
+			return nil, domain.ErrNotFound
+		},
+		updateWebAuthnSignCount: func(ctx context.Context, id uuid.UUID, signCount int64) error {
+			for i := range *credentials {
+				stored := &(*credentials)[i]
+				if stored.ID == id && (stored.SignCount < signCount || stored.SignCount == 0 && signCount == 0) {
+					stored.SignCount = signCount
+					return nil
+				}
+			}
+			return domain.ErrPasskeyCloned
+		},
+		createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+			return &ports.CreateUserSessionResponse{ID: uuid.New(), UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+		},
+	}
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), testutil.NewMemoryChallengeStore())
+	return svc, credentials
+}
+
+// registerPasskey runs a full registration ceremony with the authenticator.
+func registerPasskey(t *testing.T, svc *UserSerivce, userID uuid.UUID, authenticator *testutil.SoftAuthenticator) error {
+	t.Helper()
+
+	ctx := context.Background()
+	options, err := svc.BeginPasskeyRegistration(ctx, userID)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration() error: %v", err)
+	}
+	clientData, attestation := authenticator.Register(t, options.Challenge, options.UserHandle)
+	return svc.FinishPasskeyRegistration(ctx, userID, &ports.PasskeyRegistration{
+		Name:              "Laptop",
+		CredentialID:      authenticator.CredentialID,
+		ClientDataJSON:    clientData,
+		AttestationObject: attestation,
+	})
+}
+
+func passkeyAssertion(t *testing.T, svc *UserSerivce, authenticator *testutil.SoftAuthenticator) *ports.PasskeyLoginRequest {
+	t.Helper()
+
+	options, err := svc.BeginPasskeyLogin(context.Background())
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin() error: %v", err)
+	}
+	clientData, authData, signature := authenticator.Assert(t, options.Challenge)
+	return &ports.PasskeyLoginRequest{
+		CredentialID:      authenticator.CredentialID,
+		ClientDataJSON:    clientData,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        authenticator.UserHandle,
+	}
+}
+
+func TestUserService_Passkeys(t *testing.T) {
+	user := &repouser.User{ID: uuid.New(), Email: "user@gmail.com", UserStatus: "active"}
+	ctx := context.Background()
+
+	authenticators := map[string]func(t *testing.T, rpID, origin string) *testutil.SoftAuthenticator{
+		"ES256": testutil.NewSoftAuthenticator,
+		"EdDSA": testutil.NewSoftEd25519Authenticator,
+	}
+	for name, newAuthenticator := range authenticators {
+		t.Run(name+" register and log in", func(t *testing.T) {
+			svc, credentials := newPasskeyTestService(t, user)
+			authenticator := newAuthenticator(t, "localhost", "https://localhost")
+
+			if err := registerPasskey(t, svc, user.ID, authenticator); err != nil {
+				t.Fatalf("FinishPasskeyRegistration() error: %v", err)
+			}
+			if len(*credentials) != 1 || (*credentials)[0].Name != "Laptop" {
+				t.Fatalf("expected one stored credential, got %+v", *credentials)
+			}
+
+			res, err := svc.FinishPasskeyLogin(ctx, passkeyAssertion(t, svc, authenticator))
+			if err != nil {
+				t.Fatalf("FinishPasskeyLogin() error: %v", err)
+			}
+			if res.UserID != user.ID || res.AccessToken == "" || res.RefreshToken == "" {
+				t.Errorf("expected a session for the user, got %+v", res)
+			}
+			if (*credentials)[0].SignCount != int64(authenticator.SignCount) {
+				t.Errorf("expected sign count %d to be stored, got %d", authenticator.SignCount, (*credentials)[0].SignCount)
+			}
+		})
+	}
+
+	t.Run("Same authenticator cannot register twice", func(t *testing.T) {
+		svc, _ := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://localhost")
+		if err := registerPasskey(t, svc, user.ID, authenticator); err != nil {
+			t.Fatalf("FinishPasskeyRegistration() error: %v", err)
+		}
+
+		options, err := svc.BeginPasskeyRegistration(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("BeginPasskeyRegistration() error: %v", err)
+		}
+		if len(options.ExcludeCredentialIDs) != 1 || !bytes.Equal(options.ExcludeCredentialIDs[0], authenticator.CredentialID) {
+			t.Errorf("expected the registered credential to be excluded, got %v", options.ExcludeCredentialIDs)
+		}
+		if err := registerPasskey(t, svc, user.ID, authenticator); !errors.Is(err, domain.ErrPasskeyAlreadyRegistered) {
+			t.Errorf("got %v, want ErrPasskeyAlreadyRegistered", err)
+		}
+	})
+
+	t.Run("Unverified user cannot register", func(t *testing.T) {
+		pending := &repouser.User{ID: uuid.New(), Email: "pending@gmail.com", UserStatus: "pending_verification"}
+		svc, _ := newPasskeyTestService(t, pending)
+		if _, err := svc.BeginPasskeyRegistration(ctx, pending.ID); !errors.Is(err, domain.ErrUserNotVerified) {
+			t.Errorf("got %v, want ErrUserNotVerified", err)
+		}
+	})
+
+	t.Run("Registration from another origin is rejected", func(t *testing.T) {
+		svc, credentials := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://evil.example")
+		if err := registerPasskey(t, svc, user.ID, authenticator); !errors.Is(err, domain.ErrInvalidPasskeyAttestation) {
+			t.Errorf("got %v, want ErrInvalidPasskeyAttestation", err)
+		}
+		if len(*credentials) != 0 {
+			t.Error("expected nothing to be stored")
+		}
+	})
+
+	t.Run("Registration without user verification is rejected", func(t *testing.T) {
+		svc, _ := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://localhost")
+		authenticator.Flags = testutil.AuthFlagUserPresent
+		if err := registerPasskey(t, svc, user.ID, authenticator); !errors.Is(err, domain.ErrInvalidPasskeyAttestation) {
+			t.Errorf("got %v, want ErrInvalidPasskeyAttestation", err)
+		}
+	})
+
+	t.Run("Login rejects bad assertions", func(t *testing.T) {
+		svc, _ := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://localhost")
+		if err := registerPasskey(t, svc, user.ID, authenticator); err != nil {
+			t.Fatalf("FinishPasskeyRegistration() error: %v", err)
+		}
+
+		tests := []struct {
+			name    string
+			tamper  func(req *ports.PasskeyLoginRequest)
+			wantErr error
+		}{
+			{"Tampered signature", func(req *ports.PasskeyLoginRequest) { req.Signature[len(req.Signature)-1] ^= 0xff }, domain.ErrInvalidPasskeyAssertion},
+			{"Tampered authenticator data", func(req *ports.PasskeyLoginRequest) { req.AuthenticatorData[36] ^= 0x01 }, domain.ErrInvalidPasskeyAssertion},
+			{"Unknown credential", func(req *ports.PasskeyLoginRequest) { req.CredentialID = []byte("unknown") }, domain.ErrInvalidPasskeyAssertion},
+			{"Wrong user handle", func(req *ports.PasskeyLoginRequest) { other := uuid.New(); req.UserHandle = other[:] }, domain.ErrInvalidPasskeyAssertion},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := passkeyAssertion(t, svc, authenticator)
+				tt.tamper(req)
+				if _, err := svc.FinishPasskeyLogin(ctx, req); !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("Challenge can only be used once", func(t *testing.T) {
+		svc, _ := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://localhost")
+		if err := registerPasskey(t, svc, user.ID, authenticator); err != nil {
+			t.Fatalf("FinishPasskeyRegistration() error: %v", err)
+		}
+
+		req := passkeyAssertion(t, svc, authenticator)
+		if _, err := svc.FinishPasskeyLogin(ctx, req); err != nil {
+			t.Fatalf("FinishPasskeyLogin() error: %v", err)
+		}
+		if _, err := svc.FinishPasskeyLogin(ctx, req); !errors.Is(err, domain.ErrInvalidPasskeyChallenge) {
+			t.Errorf("got %v, want ErrInvalidPasskeyChallenge", err)
+		}
+	})
+
+	t.Run("Counter going backwards is treated as a clone", func(t *testing.T) {
+		svc, _ := newPasskeyTestService(t, user)
+		authenticator := testutil.NewSoftAuthenticator(t, "localhost", "https://localhost")
+		if err := registerPasskey(t, svc, user.ID, authenticator); err != nil {
+			t.Fatalf("FinishPasskeyRegistration() error: %v", err)
+		}
+		authenticator.SignCount = 10
+		if _, err := svc.FinishPasskeyLogin(ctx, passkeyAssertion(t, svc, authenticator)); err != nil {
+			t.Fatalf("FinishPasskeyLogin() error: %v", err)
+		}
+
+		authenticator.SignCount = 3
+		if _, err := svc.FinishPasskeyLogin(ctx, passkeyAssertion(t, svc, authenticator)); !errors.Is(err, domain.ErrPasskeyCloned) {
+			t.Errorf("got %v, want ErrPasskeyCloned", err)
+		}
+	})
+}
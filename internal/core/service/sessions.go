@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// ListSessions returns the active sessions of a user and marks the one the
+// request came from.
+func (s *UserSerivce) ListSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]ports.SessionInfo, error) {
+	sessions, err := s.repo.GetUserSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ports.SessionInfo, 0, len(sessions))
+	for _, orm := range sessions {
+		session := repousersessions.MapSessionToDomain(orm)
+		infos = append(infos, ports.SessionInfo{
+			ID:         session.ID,
+			IPAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			Device:     session.Device,
+			CreatedAt:  session.CreatedAt,
+			LastActive: session.LastActive,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		})
+	}
+	return infos, nil
+}
+
+// RevokeSession signs one of the user's sessions out. Its refresh token stops
+// working at once; access tokens already issued run until they expire.
+func (s *UserSerivce) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	event := domainevents.New(ctx, userID, domainevents.SessionRevoked{SessionID: &sessionID})
+	if err := s.repo.DeleteUserSessionOfUser(ctx, userID, sessionID, event); err != nil {
+		return err
+	}
+	s.logger.Info(domain.LogService, "Session revoked", "user_id", userID, "session_id", sessionID)
+	return nil
+}
+
+// RevokeOtherSessions signs out every session but the current one and returns
+// how many there were.
+func (s *UserSerivce) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int64, error) {
+	event := domainevents.New(ctx, userID, domainevents.SessionRevoked{KeptSessionID: &currentSessionID})
+	revoked, err := s.repo.DeleteOtherUserSessions(ctx, userID, currentSessionID, event)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info(domain.LogService, "Other sessions revoked", "user_id", userID, "revoked", revoked)
+	return revoked, nil
+}
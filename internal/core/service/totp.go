@@ -0,0 +1,120 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters. These are the defaults every authenticator app supports.
+const (
+	totpPeriod     = 30
+	totpDigits     = 6
+	totpSecretSize = 20 // 160 bits, as recommended by RFC 4226
+	// Accept the previous and next step to tolerate clock drift
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// totpCode is the HOTP value (RFC 4226) for the given time step.
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// validateTOTP returns the time step the code belongs to. Callers must store
+// the step and refuse any code whose step is not newer, or a code could be
+// replayed while it is still inside the skew window.
+func validateTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI builds the otpauth:// URI authenticator apps read from a QR code.
+func totpURI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", totpEncoding.EncodeToString(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Recovery codes are two groups of five base32 characters, e.g. "k7q2m-x4dpa".
+const (
+	recoveryCodeCount      = 10
+	recoveryCodeGroupSize  = 5
+	recoveryCodeRandomSize = 7 // 56 bits, enough for 10 base32 characters
+)
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	buf := make([]byte, recoveryCodeRandomSize)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := recoveryCodeEncoding.EncodeToString(buf)[:2*recoveryCodeGroupSize]
+		codes[i] = raw[:recoveryCodeGroupSize] + "-" + raw[recoveryCodeGroupSize:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes the check forgiving about case, spaces and the
+// dash, since users often type the codes from a printout.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 Appendix B (SHA1), truncated to 6 digits.
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	for _, offset := range []int64{-1, 0, 1} {
+		step, ok := validateTOTP(secret, totpCode(secret, current+offset), now)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d: got step %d ok=%v", offset, step, ok)
+		}
+	}
+	if _, ok := validateTOTP(secret, totpCode(secret, current+2), now); ok {
+		t.Error("expected a code outside the skew window to be rejected")
+	}
+	if _, ok := validateTOTP(secret, "12345", now); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("golang-auth", "user@gmail.com", []byte("12345678901234567890"))
+	if !strings.HasPrefix(uri, "otpauth://totp/golang-auth:user@gmail.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	if !strings.Contains(uri, "secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ") || !strings.Contains(uri, "issuer=golang-auth") {
+		t.Errorf("unexpected query in %s", uri)
+	}
+}
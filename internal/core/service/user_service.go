@@ -7,32 +7,45 @@ import (
 	"time"
 
 	"github.com/golang-auth/internal/adapters/config"
+	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
 	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
 	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainusersessions "github.com/golang-auth/internal/core/domain/user_sessions"
+	domainuserverification "github.com/golang-auth/internal/core/domain/user_verification"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type UserSerivce struct {
-	repo      ports.UserRepoPorts
-	logger    ports.Logger
-	publisher ports.EventPublisher
-	jwtConfig *config.JWTTokenKeys
+	repo       ports.UserRepoPorts
+	logger     ports.Logger
+	jwtConfig  *config.JWTTokenKeys
+	authConfig *config.AuthConfig
+	challenges ports.ChallengeStore
 }
 
-func NewUserService(repo ports.UserRepoPorts, logger ports.Logger, publisher ports.EventPublisher, jwtConfig *config.JWTTokenKeys) *UserSerivce {
+func NewUserService(repo ports.UserRepoPorts, logger ports.Logger, jwtConfig *config.JWTTokenKeys, authConfig *config.AuthConfig, challenges ports.ChallengeStore) *UserSerivce {
 	return &UserSerivce{
-		repo:      repo,
-		logger:    logger,
-		publisher: publisher,
-		jwtConfig: jwtConfig,
+		repo:       repo,
+		logger:     logger,
+		jwtConfig:  jwtConfig,
+		authConfig: authConfig,
+		challenges: challenges,
 	}
 }
 
-func (s *UserSerivce) Register(ctx context.Context, email, password string) error {
+// Register creates a pending account and emails it either a verification link
+// or a numeric code, per mode. An empty mode uses the configured default.
+func (s *UserSerivce) Register(ctx context.Context, email, password, mode string) error {
 	email = strings.ToLower(strings.TrimSpace(email))
 
+	mode, err := s.verificationMode(mode)
+	if err != nil {
+		return err
+	}
+
 	// Initial Validations
 	if err := isValidEmail(email); err != nil {
 		if errors.Is(err, domain.ErrInvalidEmail) {
@@ -58,27 +71,42 @@ func (s *UserSerivce) Register(ctx context.Context, email, password string) erro
 	}
 
 	// Persistence Loop (Retry on Token Collision)
-	var finalToken string
 	const maxRetries = 3
 	committed := false
+	// Generated here so the event can carry it
+	userID := uuid.New()
 
 	for i := 0; i < maxRetries; i++ {
-		token, err := GenerateSecureToken()
-		if err != nil {
-			s.logger.Error(domain.LogService, "Token generation failed", "error", err)
-			return domain.ErrDomainInternalError
+		repoReq := ports.UserAndCredentialsRequest{
+			UserID:       userID,
+			Email:        email,
+			PasswordHash: hashedPassword,
 		}
 
-		repoReq := ports.UserAndCredentialsRequest{
-			Email:                  email,
-			PasswordHash:           hashedPassword,
-			EmailVerificationToken: token,
-			TokenExpiration:        time.Now().Add(15 * time.Minute),
+		if mode == domainuserverification.ModeCode {
+			code, codeHash, err := s.newVerificationCode()
+			if err != nil {
+				return err
+			}
+			repoReq.EmailVerificationToken = codeHash
+			repoReq.EmailVerificationPurpose = domainuserverification.PurposeEmailVerificationCode
+			repoReq.TokenExpiration = time.Now().Add(s.authConfig.EmailVerification.CodeTTL)
+			repoReq.Event = domainevents.New(ctx, userID, domainevents.VerificationCodeRequested{Email: email, Code: code})
+		} else {
+			token, err := GenerateSecureToken()
+			if err != nil {
+				s.logger.Error(domain.LogService, "Token generation failed", "error", err)
+				return domain.ErrDomainInternalError
+			}
+			repoReq.EmailVerificationToken = token
+			repoReq.TokenExpiration = time.Now().Add(15 * time.Minute)
+			repoReq.Event = domainevents.New(ctx, userID, domainevents.UserRegistered{Email: email, Token: token})
 		}
 
+		// The email event is committed with the user and relayed to the
+		// broker from the outbox
 		err = s.repo.CreateUserWithCredentials(ctx, repoReq)
 		if err == nil {
-			finalToken = token
 			committed = true
 			break
 		}
@@ -94,14 +122,6 @@ func (s *UserSerivce) Register(ctx context.Context, email, password string) erro
 		s.logger.Error(domain.LogService, "Max retries reached for registration collisions")
 		return domain.ErrDatabaseInternalError
 	}
-
-	// Publish to Broker (ONLY after successful DB commit)
-	if err := s.publisher.PublishUserRegistered(ctx, email, finalToken); err != nil {
-		s.logger.Error(domain.LogService, "Broker error after DB commit", "error", err, "email", email)
-		// We return an error here, but note that the user is already created in the DB.
-		return domain.ErrBrokerInternalError
-	}
-
 	return nil
 }
 
@@ -111,6 +131,9 @@ func (s *UserSerivce) VerifyUserEmail(ctx context.Context, token string) error {
 	if err != nil {
 		return domain.ErrTokenNotFound
 	}
+	if record.Purpose != domainuserverification.PurposeEmailVerification {
+		return domain.ErrTokenNotFound
+	}
 	if record.Status == "consumed" {
 		s.logger.Info("Service", "Token already used", "token", token)
 		return domain.ErrUsedToken
@@ -126,7 +149,8 @@ func (s *UserSerivce) VerifyUserEmail(ctx context.Context, token string) error {
 	}
 
 	// State verification
-	err = s.repo.ConfirmVerification(ctx, record.UserID, record.ID)
+	event := domainevents.New(ctx, record.UserID, domainevents.UserVerified{Method: domainuserverification.ModeLink})
+	err = s.repo.ConfirmVerification(ctx, record.UserID, record.ID, event)
 	if err != nil {
 		s.logger.Error("Service", "Failed to confirm verification", "error", err)
 		return err
@@ -135,9 +159,14 @@ func (s *UserSerivce) VerifyUserEmail(ctx context.Context, token string) error {
 	return nil
 }
 
-func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email string) error {
+func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email, mode string) error {
 	email = strings.ToLower(strings.TrimSpace(email))
 
+	mode, err := s.verificationMode(mode)
+	if err != nil {
+		return err
+	}
+
 	// Fetch User
 	userRecord, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
@@ -150,9 +179,12 @@ func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email st
 	if userRecord.UserStatus == "active" {
 		return domain.ErrUserAlreadyVerified
 	}
+	if mode == domainuserverification.ModeCode {
+		return s.resendVerificationCode(ctx, userRecord.ID, email)
+	}
 
 	// Fetch Latest Verification Record
-	verRecord, err := s.repo.GetVerificationByUserID(ctx, userRecord.ID)
+	verRecord, err := s.repo.GetVerificationByUserID(ctx, userRecord.ID, domainuserverification.PurposeEmailVerification)
 	if err != nil { // && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return err
 	}
@@ -171,7 +203,7 @@ func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email st
 
 	// Hourly Limit Check (Max 3 per hour)
 	oneHourAgo := time.Now().Add(-1 * time.Hour)
-	count, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userRecord.ID, oneHourAgo)
+	count, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userRecord.ID, domainuserverification.PurposeEmailVerification, oneHourAgo)
 	if err != nil {
 		return err
 	}
@@ -191,6 +223,7 @@ func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email st
 		Token:     token,
 		ExpiresAt: time.Now().Add(15 * time.Minute),
 		Status:    "pending",
+		Purpose:   domainuserverification.PurposeEmailVerification,
 	}
 
 	// Transactional Update
@@ -200,7 +233,130 @@ func (s *UserSerivce) ResendEmailVerificationToken(ctx context.Context, email st
 		oldID = &verRecord.ID
 	}
 
-	return s.repo.RotateVerificationToken(ctx, *oldID, "invalidated", &newVer)
+	event := domainevents.New(ctx, userRecord.ID, domainevents.UserRegistered{Email: email, Token: token})
+	return s.repo.RotateVerificationToken(ctx, *oldID, "invalidated", &newVer, event)
+}
+
+const (
+	passwordResetTokenTTL    = 30 * time.Minute
+	maxPasswordResetsPerHour = 3
+)
+
+// ForgotPassword emails a single-use reset link to an active account. It never
+// tells the caller whether the account exists: unknown emails, inactive
+// accounts and rate limited requests all succeed silently.
+func (s *UserSerivce) ForgotPassword(ctx context.Context, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	userRecord, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			s.logger.Debug(domain.LogService, "Password reset requested for an unknown email")
+			return nil
+		}
+		return err
+	}
+	if userRecord.UserStatus != "active" {
+		s.logger.Info(domain.LogService, "Password reset requested for an inactive account", "user_id", userRecord.ID, "status", userRecord.UserStatus)
+		return nil
+	}
+
+	oneHourAgo := time.Now().Add(-1 * time.Hour)
+	count, err := s.repo.GetCountsOfVerificationRecordsByUserID(ctx, userRecord.ID, domainuserverification.PurposePasswordReset, oneHourAgo)
+	if err != nil {
+		return err
+	}
+	if count >= maxPasswordResetsPerHour {
+		s.logger.Warn(domain.LogService, "Password reset rate limit reached", "user_id", userRecord.ID)
+		return nil
+	}
+
+	payload := func(token string) domainevents.Payload {
+		return domainevents.PasswordResetRequested{Email: email, Token: token}
+	}
+	_, err = s.issueEmailToken(ctx, userRecord.ID, domainuserverification.PurposePasswordReset, passwordResetTokenTTL, payload, s.repo.CreatePasswordResetToken)
+	return err
+}
+
+// issueEmailToken stores the hash of a fresh single-use token through create,
+// along with the event whose payload carries the raw token, and returns the
+// raw token. It retries on the rare hash collision.
+func (s *UserSerivce) issueEmailToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration, payload func(token string) domainevents.Payload, create func(context.Context, *userverification.UserVerification, *domainevents.Event) error) (string, error) {
+	const maxRetries = 3
+	for i := 0; i < maxRetries; i++ {
+		token, err := GenerateSecureToken()
+		if err != nil {
+			s.logger.Error(domain.LogService, "Token generation failed", "error", err)
+			return "", domain.ErrDomainInternalError
+		}
+
+		// Only the hash is kept, the raw token only lives in the event
+		// until it goes out by email.
+		err = create(ctx, &userverification.UserVerification{
+			UserID:    userID,
+			Token:     HashToken(token),
+			Status:    "pending",
+			Purpose:   purpose,
+			ExpiresAt: time.Now().Add(ttl),
+		}, domainevents.New(ctx, userID, payload(token)))
+		if err == nil {
+			return token, nil
+		}
+		if !errors.Is(err, domain.ErrTokenCollision) {
+			return "", err
+		}
+		s.logger.Warn(domain.LogService, "Token collision detected, retrying...", "attempt", i+1)
+	}
+	s.logger.Error(domain.LogService, "Max retries reached for token collisions")
+	return "", domain.ErrDatabaseInternalError
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword. The
+// token is consumed and every session of the user is revoked.
+func (s *UserSerivce) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if token == "" {
+		return domain.ErrInvalidResetToken
+	}
+
+	record, err := s.repo.GetVerificationByToken(ctx, HashToken(token))
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			return domain.ErrInvalidResetToken
+		}
+		return err
+	}
+	if record.Purpose != domainuserverification.PurposePasswordReset {
+		return domain.ErrInvalidResetToken
+	}
+	if record.Status == "consumed" {
+		return domain.ErrUsedToken
+	}
+	if record.Status != "pending" {
+		return domain.ErrInvalidResetToken
+	}
+	if time.Now().After(record.ExpiresAt) {
+		if err := s.repo.UpdateUserVerificationTokenStatus(ctx, record.ID, "expired"); err != nil {
+			return domain.ErrRepositoryInternalError
+		}
+		return domain.ErrTokenExpired
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while trying to hash password", "error", err)
+		return domain.ErrHashingError
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, record.UserID)
+	if err != nil {
+		return err
+	}
+	event := domainevents.New(ctx, record.UserID, domainevents.PasswordChanged{Email: userRecord.Email, Reason: domainevents.PasswordChangedByReset})
+	if err := s.repo.ResetUserPassword(ctx, record.UserID, record.ID, hashedPassword, event); err != nil {
+		return err
+	}
+	s.logger.Info(domain.LogService, "Password reset, all sessions revoked", "user_id", record.UserID)
+	return nil
 }
 
 func (s *UserSerivce) Login(ctx context.Context, req *ports.LoginRequest) (*ports.LoginResponse, error) {
@@ -213,28 +369,63 @@ func (s *UserSerivce) Login(ctx context.Context, req *ports.LoginRequest) (*port
 	}
 
 	userRecord, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	failures, err := s.bookLoginAttempt(ctx, userRecord.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	switch {
-	case userRecord.UserStatus == "pending_verification":
-		return nil, domain.ErrUserNotVerified
-	case userRecord.UserStatus == "banned":
-		return nil, domain.ErrUserAccountBanned
-	case userRecord.UserStatus == "suspended":
-		return nil, domain.ErrUserAccountSuspended
+	creds, err := s.repo.GetUserCredentialsByUserID(ctx, userRecord.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPasswordHash(req.Password, creds.PasswordHash) {
+		if err := s.recordFailedLogin(ctx, userRecord.ID, failures); err != nil {
+			return nil, err
+		}
+		return nil, domain.ErrInvalidCredentials
 	}
 
-	// Lazy delete user dead sessions.
-	if err := s.repo.DeleteUserDeadSessions(ctx, userRecord.ID); err != nil {
+	if err := checkUserStatus(userRecord); err != nil {
 		return nil, err
 	}
 
-	sessoinCount, err := s.repo.GetUserSessionCountByUserID(ctx, userRecord.ID)
-	if err != nil {
+	// The password alone is not enough: hand out a challenge for the second
+	// factor. The attempt stays booked until that factor is passed too, so
+	// the lockout also bounds guessing codes.
+	if userRecord.IsMFAEnabled {
+		return s.issueMFAChallenge(ctx, userRecord.ID)
+	}
+	if err := s.repo.UnlockUser(ctx, userRecord.ID, nil); err != nil {
 		return nil, err
 	}
+
+	return s.startSession(ctx, userRecord, domainevents.LoginMethodPassword, ports.CreateUserSessionRequest{IPAddress: req.IPAddress, UserAgent: req.UserAgent, Device: req.Device})
+}
+
+// checkUserStatus rejects accounts that may not sign in.
+func checkUserStatus(userRecord *repouser.User) error {
+	switch {
+	case userRecord.UserStatus == "pending_verification":
+		return domain.ErrUserNotVerified
+	case userRecord.UserStatus == "banned":
+		return domain.ErrUserAccountBanned
+	case userRecord.UserStatus == "suspended":
+		return domain.ErrUserAccountSuspended
+	}
+	return nil
+}
+
+// startSession creates a user_sessions row and signs the first access token.
+// method is the last factor the user passed, for the login event. sessionReq
+// brings the client details and any recovery code the login spends; the rest
+// is filled in here.
+func (s *UserSerivce) startSession(ctx context.Context, userRecord *repouser.User, method string, sessionReq ports.CreateUserSessionRequest) (*ports.LoginResponse, error) {
 	expirationTime := time.Now().Add(8 * time.Hour)
 	token, err := GenerateSecureToken()
 	if err != nil {
@@ -242,60 +433,201 @@ func (s *UserSerivce) Login(ctx context.Context, req *ports.LoginRequest) (*port
 		return nil, domain.ErrDomainInternalError
 	}
 
-	sessionReq := ports.CreateUserSessionRequest{
-		UserID:    userRecord.ID,
-		IPAddress: req.IPAddress,
-		UserAgent: req.UserAgent,
-		Device:    req.Device,
-		Token:     token,
-		ExpiresAt: expirationTime,
+	// Only the hash is persisted, the raw token goes back to the client.
+	sessionReq.ID = uuid.New()
+	sessionReq.UserID = userRecord.ID
+	sessionReq.Token = HashToken(token)
+	sessionReq.ExpiresAt = expirationTime
+	sessionReq.Event = domainevents.New(ctx, userRecord.ID, domainevents.LoggedIn{
+		SessionID: sessionReq.ID,
+		Method:    method,
+		IPAddress: sessionReq.IPAddress,
+		UserAgent: sessionReq.UserAgent,
+		Device:    sessionReq.Device,
+	})
+	newSession, err := s.repo.CreateUserSessionWithinLimit(ctx, &sessionReq, s.authConfig.Sessions.LimitFor(userRecord.Roles))
+	if err != nil {
+		return nil, err
 	}
-	var newSession *ports.CreateUserSessionResponse
 
-	switch {
-	case sessoinCount < 0:
-		s.logger.Debug(domain.LogService, "User cannot have a negative amount of active sessions", "error", err, "user_id", userRecord.ID)
-		return nil, domain.ErrDomainInternalError
-	case sessoinCount > 5:
-		s.logger.Debug(domain.LogService, "User cannot have more than 5 active sessions", "error", err, "user_id", userRecord.ID)
-		return nil, domain.ErrDomainInternalError
+	// Generate JWT token
+	jwtToken, err := s.issueAccessToken(userRecord, newSession.ID, sessionReq.IPAddress, sessionReq.UserAgent)
+	if err != nil {
+		return nil, err
 	}
 
-	if sessoinCount == 5 {
-		return nil, domain.ErrTooManyUserSessions
-	} else {
-		sessionReq.Token = HashToken(sessionReq.Token)
-		newSession, err = s.repo.CreateUserSession(ctx, &sessionReq)
-		if err != nil {
+	response := ports.LoginResponse{
+		SessionID:    newSession.ID,
+		UserID:       newSession.UserID,
+		RefreshToken: token,
+		AccessToken:  jwtToken,
+
+		RefreshTokenExpiresAt: newSession.ExpiresAt,
+		AccessTokenExpiresAt:  time.Now().Add(s.jwtConfig.Duration),
+	}
+
+	return &response, nil
+}
+
+// RefreshSession exchanges a refresh token for a new access/refresh token pair.
+// Every refresh token is single use: presenting one that was already rotated
+// out means it was stolen (or replayed), so the whole session is revoked.
+// The session takes over the caller's IP and user agent.
+func (s *UserSerivce) RefreshSession(ctx context.Context, refreshToken, ipAddress, userAgent string) (*ports.LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, domain.ErrInvalidRefreshToken
+	}
+	hashedToken := HashToken(refreshToken)
+
+	session, err := s.repo.GetUserSessionByToken(ctx, hashedToken)
+	if err != nil {
+		if !errors.Is(err, domain.ErrSessionNotFound) {
 			return nil, err
 		}
+		return nil, s.handleUnknownRefreshToken(ctx, hashedToken)
 	}
 
-	// Generate JWT token
-	jti, err := GenerateSecureToken()
+	if time.Now().After(session.ExpiresAt) {
+		if err := s.repo.DeleteUserSession(ctx, session.ID, domainusersessions.LogoutReasonExpired); err != nil {
+			s.logger.Error(domain.LogService, "Failed to delete expired session", "error", err, "session_id", session.ID)
+		}
+		return nil, domain.ErrSessionExpired
+	}
+
+	// A refresh from another client is refused unless the policy only logs
+	// it; in that case the session has moved to the new client already.
+	if anomaly := s.detectSessionAnomaly(session, ipAddress, userAgent); anomaly != nil {
+		if err := s.resolveSessionAnomaly(ctx, anomaly); err != nil {
+			return nil, err
+		}
+	}
+
+	newToken, err := GenerateSecureToken()
 	if err != nil {
-		s.logger.Error(domain.LogService, "Error while generating a random token", "error", err)
+		s.logger.Error(domain.LogService, "Error while generating session token", "error", err)
 		return nil, domain.ErrDomainInternalError
 	}
-	jwtToken, err := s.jwtConfig.SignToken(jti)
 
-	response := ports.LoginResponse{
-		SessionID:    newSession.ID,
-		UserID:       newSession.UserID,
-		RefreshToken: newSession.Token,
+	rotated, err := s.repo.RotateUserSessionToken(ctx, session.ID, hashedToken, HashToken(newToken), ipAddress, userAgent)
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			// Lost the race against another refresh with the same token.
+			return nil, s.revokeSessionFamily(ctx, session.ID)
+		}
+		return nil, err
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, rotated.UserID)
+	if err != nil {
+		return nil, err
+	}
+	jwtToken, err := s.issueAccessToken(userRecord, rotated.ID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ports.LoginResponse{
+		SessionID:    rotated.ID,
+		UserID:       rotated.UserID,
+		RefreshToken: newToken,
 		AccessToken:  jwtToken,
 
-		RefreshTokenExpiresAt: newSession.ExpiresAt,
+		RefreshTokenExpiresAt: rotated.ExpiresAt,
 		AccessTokenExpiresAt:  time.Now().Add(s.jwtConfig.Duration),
+	}, nil
+}
+
+// issueAccessToken signs an access token for the session, bound to the client
+// it is issued to for CheckSessionClient.
+func (s *UserSerivce) issueAccessToken(user *repouser.User, sessionID uuid.UUID, ipAddress, userAgent string) (string, error) {
+	jti, err := GenerateSecureToken()
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while generating a random token", "error", err)
+		return "", domain.ErrDomainInternalError
 	}
 
-	return &response, nil
+	jwtToken, err := s.jwtConfig.SignToken(config.TokenClaims{
+		TokenID:   jti,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Roles:     user.Roles,
+
+		ClientNetworkHash:   s.authConfig.SessionAnomaly.NetworkHash(ipAddress),
+		ClientUserAgentHash: HashToken(userAgent),
+	})
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while signing access token", "error", err)
+		return "", domain.ErrDomainInternalError
+	}
+	return jwtToken, nil
+}
+
+func (s *UserSerivce) handleUnknownRefreshToken(ctx context.Context, hashedToken string) error {
+	sessionID, err := s.repo.GetSessionIDByRotatedToken(ctx, hashedToken)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return s.revokeSessionFamily(ctx, sessionID)
+}
+
+func (s *UserSerivce) revokeSessionFamily(ctx context.Context, sessionID uuid.UUID) error {
+	s.logger.Warn(domain.LogService, "Refresh token reuse detected, revoking session", "session_id", sessionID)
+	if err := s.repo.DeleteUserSession(ctx, sessionID, domainusersessions.LogoutReasonTokenReuse); err != nil {
+		s.logger.Error(domain.LogService, "Failed to revoke session after refresh token reuse", "error", err, "session_id", sessionID)
+		return err
+	}
+	return domain.ErrRefreshTokenReused
 }
 
 func (s *UserSerivce) Logout(ctx context.Context, session_id uuid.UUID) error {
-	return s.repo.DeleteUserSession(ctx, session_id)
+	return s.repo.DeleteUserSession(ctx, session_id, domainusersessions.LogoutReasonUser)
+}
+
+// ChangePassword replaces the password of an authenticated user after checking
+// the current one. Every other session is revoked; keepSessionID (usually the
+// caller's own session) survives unless it is uuid.Nil.
+func (s *UserSerivce) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string, keepSessionID uuid.UUID) error {
+	if currentPassword == "" || newPassword == "" {
+		return domain.ErrInvaidPassword
+	}
+	if currentPassword == newPassword {
+		return domain.ErrPasswordUnchanged
+	}
+
+	creds, err := s.repo.GetUserCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !CheckPasswordHash(currentPassword, creds.PasswordHash) {
+		s.logger.Info(domain.LogService, "Password change rejected, current password mismatch", "user_id", userID)
+		return domain.ErrIncorrectPassword
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		s.logger.Error(domain.LogService, "Error while trying to hash password", "error", err)
+		return domain.ErrHashingError
+	}
+
+	userRecord, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	event := domainevents.New(ctx, userID, domainevents.PasswordChanged{Email: userRecord.Email, Reason: domainevents.PasswordChangedByUser})
+	if err := s.repo.ChangeUserPassword(ctx, userID, hashedPassword, keepSessionID, event); err != nil {
+		return err
+	}
+	s.logger.Info(domain.LogService, "Password changed", "user_id", userID, "kept_session", keepSessionID != uuid.Nil)
+	return nil
 }
 
 func (s *UserSerivce) DeleteAccount(ctx context.Context, user_id uuid.UUID) error {
-	return s.repo.DeleteUser(ctx, user_id)
+	userRecord, err := s.repo.GetUserByID(ctx, user_id)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteUser(ctx, user_id, domainevents.New(ctx, user_id, domainevents.AccountDeleted{Email: userRecord.Email}))
 }
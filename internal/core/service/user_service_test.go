@@ -3,13 +3,22 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-auth/internal/adapters/config"
 	repouser "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user"
+	repousermfa "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_mfa"
+	repousersessions "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_sessions"
 	userverification "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_verification"
+	repouserwebauthn "github.com/golang-auth/internal/adapters/repository/postgre/persistency/user_webauthn"
 	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	domainusersessions "github.com/golang-auth/internal/core/domain/user_sessions"
+	domainuserverification "github.com/golang-auth/internal/core/domain/user_verification"
 	"github.com/golang-auth/internal/core/ports"
 	"github.com/golang-auth/internal/testutil"
 	"github.com/google/uuid"
@@ -18,26 +27,66 @@ import (
 // Mock Implementation
 type mockUserRepo struct {
 	getUserByEmailFn                       func(ctx context.Context, email string) (*repouser.User, error)
+	getUserByIDFn                          func(ctx context.Context, userID uuid.UUID) (*repouser.User, error)
 	createUserFn                           func(ctx context.Context, req ports.UserAndCredentialsRequest) error
 	verifyUserEmail                        func(ctx context.Context, token string) error
 	getVerificationByToken                 func(ctx context.Context, token string) (*userverification.UserVerification, error)
-	confirmVerification                    func(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID) error
-	getVerificationByUserID                func(ctx context.Context, userID uuid.UUID) (*userverification.UserVerification, error)
-	rotateVerificationToken                func(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification) error
-	getCountsOfVerificationRecordsByUserID func(ctx context.Context, user_id uuid.UUID, timeDuration time.Time) (int64, error)
+	confirmVerification                    func(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, event *domainevents.Event) error
+	getVerificationByUserID                func(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error)
+	rotateVerificationToken                func(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification, event *domainevents.Event) error
+	getCountsOfVerificationRecordsByUserID func(ctx context.Context, user_id uuid.UUID, purpose string, timeDuration time.Time) (int64, error)
 	updateUserVerificationTokenStatus      func(ctx context.Context, tokenID uuid.UUID, status string) error
-	getUserSessionCountByUserID            func(ctx context.Context, userID uuid.UUID) (int64, error)
-	createAndDeleteOldUserSession          func(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error)
-	createUserSession                      func(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error)
-	deleteUserSession                      func(ctx context.Context, session_id uuid.UUID) error
-	deleteUser                             func(ctx context.Context, userID uuid.UUID) error
-	deleteUserDeadSessions                 func(ctx context.Context, userID uuid.UUID) error
+	createPasswordResetToken               func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	createMagicLinkToken                   func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	createEmailVerificationCode            func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error
+	getPendingVerificationByUserID         func(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error)
+	countVerificationAttempt               func(ctx context.Context, verificationID uuid.UUID, maxAttempts int) error
+	consumeVerificationToken               func(ctx context.Context, verificationID uuid.UUID) error
+	resetUserPassword                      func(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, passwordHash string, event *domainevents.Event) error
+	getUserCredentialsByUserID             func(ctx context.Context, userID uuid.UUID) (*repouser.UserCredentials, error)
+	changeUserPassword                     func(ctx context.Context, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID, event *domainevents.Event) error
+	upsertTOTPEnrollment                   func(ctx context.Context, userID uuid.UUID, secretCiphertext []byte) error
+	getTOTPByUserID                        func(ctx context.Context, userID uuid.UUID) (*repousermfa.UserMFATOTP, error)
+	confirmTOTPEnrollment                  func(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error
+	consumeTOTPStep                        func(ctx context.Context, userID uuid.UUID, step int64) error
+	createMFAChallenge                     func(ctx context.Context, challenge *repousermfa.MFAChallenge) error
+	getMFAChallengeByToken                 func(ctx context.Context, token string) (*repousermfa.MFAChallenge, error)
+	countMFAChallengeAttempt               func(ctx context.Context, challengeID uuid.UUID, maxAttempts int) error
+	deleteMFAChallenge                     func(ctx context.Context, challengeID uuid.UUID) error
+	replaceRecoveryCodes                   func(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	getUnusedRecoveryCodes                 func(ctx context.Context, userID uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error)
+	createWebAuthnCredential               func(ctx context.Context, credential *repouserwebauthn.WebAuthnCredential) error
+	getWebAuthnCredentialsByUserID         func(ctx context.Context, userID uuid.UUID) ([]repouserwebauthn.WebAuthnCredential, error)
+	getWebAuthnCredentialByCredentialID    func(ctx context.Context, credentialID []byte) (*repouserwebauthn.WebAuthnCredential, error)
+	updateWebAuthnSignCount                func(ctx context.Context, id uuid.UUID, signCount int64) error
+	getUserSessionsByUserID                func(ctx context.Context, userID uuid.UUID) ([]repousersessions.UserSessions, error)
+	deleteUserSessionOfUser                func(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, event *domainevents.Event) error
+	deleteOtherUserSessions                func(ctx context.Context, userID uuid.UUID, keepSessionID uuid.UUID, event *domainevents.Event) (int64, error)
+	bookLoginAttempt                       func(ctx context.Context, userID uuid.UUID, delay ports.LoginDelay) (int, error)
+	recordFailedLogin                      func(ctx context.Context, userID uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error
+	unlockUser                             func(ctx context.Context, userID uuid.UUID, audit *repousersessions.AuditUserSessions) error
+	createUserSessionWithinLimit           func(ctx context.Context, sessionReq *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error)
+	deleteUserSession                      func(ctx context.Context, session_id uuid.UUID, reason string) error
+	deleteUser                             func(ctx context.Context, userID uuid.UUID, event *domainevents.Event) error
+	getUserSessionByToken                  func(ctx context.Context, token string) (*repousersessions.UserSessions, error)
+	getSessionIDByRotatedToken             func(ctx context.Context, token string) (uuid.UUID, error)
+	rotateUserSessionToken                 func(ctx context.Context, sessionID uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error)
+	getAuditEventsByUserID                 func(ctx context.Context, userID uuid.UUID, after *ports.AuditCursor, limit int) ([]repousersessions.AuditUserSessions, error)
+	getUserSessionByID                     func(ctx context.Context, sessionID uuid.UUID) (*repousersessions.UserSessions, error)
+	resolveSessionAnomaly                  func(ctx context.Context, anomaly *ports.SessionAnomaly, event *domainevents.Event) error
+
+	// The relay is tested against testutil.MemoryOutbox
+	ports.OutboxRepo
 }
 
 func (m *mockUserRepo) GetUserByEmail(ctx context.Context, email string) (*repouser.User, error) {
 	return m.getUserByEmailFn(ctx, email)
 }
 
+func (m *mockUserRepo) GetUserByID(ctx context.Context, userID uuid.UUID) (*repouser.User, error) {
+	return m.getUserByIDFn(ctx, userID)
+}
+
 func (m *mockUserRepo) CreateUserWithCredentials(ctx context.Context, req ports.UserAndCredentialsRequest) error {
 	return m.createUserFn(ctx, req)
 }
@@ -46,52 +95,218 @@ func (m *mockUserRepo) VerifyUserEmail(ctx context.Context, token string) error
 	return m.verifyUserEmail(ctx, token)
 }
 
-func (m *mockUserRepo) ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID) error {
-	return m.confirmVerification(ctx, userID, verificationID)
+func (m *mockUserRepo) ConfirmVerification(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, event *domainevents.Event) error {
+	return m.confirmVerification(ctx, userID, verificationID, event)
 }
 
 func (m *mockUserRepo) GetVerificationByToken(ctx context.Context, token string) (*userverification.UserVerification, error) {
 	return m.getVerificationByToken(ctx, token)
 }
 
-func (m *mockUserRepo) GetVerificationByUserID(ctx context.Context, userID uuid.UUID) (*userverification.UserVerification, error) {
-	return m.getVerificationByUserID(ctx, userID)
+func (m *mockUserRepo) GetVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error) {
+	return m.getVerificationByUserID(ctx, userID, purpose)
 }
 
-func (m *mockUserRepo) RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification) error {
-	return m.rotateVerificationToken(ctx, recordID, status, req)
+func (m *mockUserRepo) RotateVerificationToken(ctx context.Context, recordID uuid.UUID, status string, req *userverification.UserVerification, event *domainevents.Event) error {
+	return m.rotateVerificationToken(ctx, recordID, status, req, event)
 }
 
-func (m *mockUserRepo) GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, timeDuration time.Time) (int64, error) {
-	return m.getCountsOfVerificationRecordsByUserID(ctx, user_id, timeDuration)
+func (m *mockUserRepo) GetCountsOfVerificationRecordsByUserID(ctx context.Context, user_id uuid.UUID, purpose string, timeDuration time.Time) (int64, error) {
+	return m.getCountsOfVerificationRecordsByUserID(ctx, user_id, purpose, timeDuration)
 }
 
 func (m *mockUserRepo) UpdateUserVerificationTokenStatus(ctx context.Context, tokenID uuid.UUID, status string) error {
 	return m.updateUserVerificationTokenStatus(ctx, tokenID, status)
 }
 
-func (m *mockUserRepo) GetUserSessionCountByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
-	return m.getUserSessionCountByUserID(ctx, userID)
+func (m *mockUserRepo) CreatePasswordResetToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	return m.createPasswordResetToken(ctx, req, event)
+}
+
+func (m *mockUserRepo) CreateEmailVerificationCode(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	return m.createEmailVerificationCode(ctx, req, event)
+}
+
+func (m *mockUserRepo) GetPendingVerificationByUserID(ctx context.Context, userID uuid.UUID, purpose string) (*userverification.UserVerification, error) {
+	return m.getPendingVerificationByUserID(ctx, userID, purpose)
+}
+
+func (m *mockUserRepo) CountVerificationAttempt(ctx context.Context, verificationID uuid.UUID, maxAttempts int) error {
+	return m.countVerificationAttempt(ctx, verificationID, maxAttempts)
+}
+
+func (m *mockUserRepo) CreateMagicLinkToken(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+	return m.createMagicLinkToken(ctx, req, event)
+}
+
+func (m *mockUserRepo) ConsumeVerificationToken(ctx context.Context, verificationID uuid.UUID) error {
+	return m.consumeVerificationToken(ctx, verificationID)
+}
+
+func (m *mockUserRepo) ResetUserPassword(ctx context.Context, userID uuid.UUID, verificationID uuid.UUID, passwordHash string, event *domainevents.Event) error {
+	return m.resetUserPassword(ctx, userID, verificationID, passwordHash, event)
+}
+
+func (m *mockUserRepo) GetUserCredentialsByUserID(ctx context.Context, userID uuid.UUID) (*repouser.UserCredentials, error) {
+	return m.getUserCredentialsByUserID(ctx, userID)
+}
+
+func (m *mockUserRepo) ChangeUserPassword(ctx context.Context, userID uuid.UUID, passwordHash string, keepSessionID uuid.UUID, event *domainevents.Event) error {
+	return m.changeUserPassword(ctx, userID, passwordHash, keepSessionID, event)
+}
+
+func (m *mockUserRepo) UpsertTOTPEnrollment(ctx context.Context, userID uuid.UUID, secretCiphertext []byte) error {
+	return m.upsertTOTPEnrollment(ctx, userID, secretCiphertext)
+}
+
+func (m *mockUserRepo) GetTOTPByUserID(ctx context.Context, userID uuid.UUID) (*repousermfa.UserMFATOTP, error) {
+	return m.getTOTPByUserID(ctx, userID)
+}
+
+func (m *mockUserRepo) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, step int64, recoveryCodeHashes []string) error {
+	return m.confirmTOTPEnrollment(ctx, userID, step, recoveryCodeHashes)
+}
+
+func (m *mockUserRepo) ConsumeTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	return m.consumeTOTPStep(ctx, userID, step)
+}
+
+func (m *mockUserRepo) CreateMFAChallenge(ctx context.Context, challenge *repousermfa.MFAChallenge) error {
+	return m.createMFAChallenge(ctx, challenge)
+}
+
+func (m *mockUserRepo) GetMFAChallengeByToken(ctx context.Context, token string) (*repousermfa.MFAChallenge, error) {
+	return m.getMFAChallengeByToken(ctx, token)
+}
+
+func (m *mockUserRepo) CountMFAChallengeAttempt(ctx context.Context, challengeID uuid.UUID, maxAttempts int) error {
+	return m.countMFAChallengeAttempt(ctx, challengeID, maxAttempts)
+}
+
+func (m *mockUserRepo) DeleteMFAChallenge(ctx context.Context, challengeID uuid.UUID) error {
+	return m.deleteMFAChallenge(ctx, challengeID)
+}
+
+func (m *mockUserRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return m.replaceRecoveryCodes(ctx, userID, codeHashes)
+}
+
+func (m *mockUserRepo) GetUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error) {
+	return m.getUnusedRecoveryCodes(ctx, userID)
+}
+
+func (m *mockUserRepo) CreateWebAuthnCredential(ctx context.Context, credential *repouserwebauthn.WebAuthnCredential) error {
+	return m.createWebAuthnCredential(ctx, credential)
+}
+
+func (m *mockUserRepo) GetWebAuthnCredentialsByUserID(ctx context.Context, userID uuid.UUID) ([]repouserwebauthn.WebAuthnCredential, error) {
+	return m.getWebAuthnCredentialsByUserID(ctx, userID)
+}
+
+func (m *mockUserRepo) GetWebAuthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (*repouserwebauthn.WebAuthnCredential, error) {
+	return m.getWebAuthnCredentialByCredentialID(ctx, credentialID)
+}
+
+func (m *mockUserRepo) UpdateWebAuthnSignCount(ctx context.Context, id uuid.UUID, signCount int64) error {
+	return m.updateWebAuthnSignCount(ctx, id, signCount)
+}
+
+func (m *mockUserRepo) GetUserSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]repousersessions.UserSessions, error) {
+	return m.getUserSessionsByUserID(ctx, userID)
+}
+
+func (m *mockUserRepo) DeleteUserSessionOfUser(ctx context.Context, userID uuid.UUID, sessionID uuid.UUID, event *domainevents.Event) error {
+	return m.deleteUserSessionOfUser(ctx, userID, sessionID, event)
+}
+
+func (m *mockUserRepo) DeleteOtherUserSessions(ctx context.Context, userID uuid.UUID, keepSessionID uuid.UUID, event *domainevents.Event) (int64, error) {
+	return m.deleteOtherUserSessions(ctx, userID, keepSessionID, event)
+}
+
+func (m *mockUserRepo) BookLoginAttempt(ctx context.Context, userID uuid.UUID, delay ports.LoginDelay) (int, error) {
+	return m.bookLoginAttempt(ctx, userID, delay)
+}
+
+func (m *mockUserRepo) RecordFailedLogin(ctx context.Context, userID uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error {
+	return m.recordFailedLogin(ctx, userID, attempts, lockAudit)
+}
+
+func (m *mockUserRepo) UnlockUser(ctx context.Context, userID uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+	return m.unlockUser(ctx, userID, audit)
+}
+
+func (m *mockUserRepo) CreateUserSessionWithinLimit(ctx context.Context, sessionReq *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+	return m.createUserSessionWithinLimit(ctx, sessionReq, limit)
+}
+
+func (m *mockUserRepo) DeleteUserSession(ctx context.Context, session_id uuid.UUID, reason string) error {
+	return m.deleteUserSession(ctx, session_id, reason)
+}
+
+func (m *mockUserRepo) DeleteUser(ctx context.Context, userID uuid.UUID, event *domainevents.Event) error {
+	return m.deleteUser(ctx, userID, event)
+}
+
+func (m *mockUserRepo) GetUserSessionByToken(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+	return m.getUserSessionByToken(ctx, token)
+}
+
+func (m *mockUserRepo) GetSessionIDByRotatedToken(ctx context.Context, token string) (uuid.UUID, error) {
+	return m.getSessionIDByRotatedToken(ctx, token)
+}
+
+func (m *mockUserRepo) RotateUserSessionToken(ctx context.Context, sessionID uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error) {
+	return m.rotateUserSessionToken(ctx, sessionID, oldToken, newToken, ipAddress, userAgent)
+}
+
+func (m *mockUserRepo) GetAuditEventsByUserID(ctx context.Context, userID uuid.UUID, after *ports.AuditCursor, limit int) ([]repousersessions.AuditUserSessions, error) {
+	return m.getAuditEventsByUserID(ctx, userID, after, limit)
 }
 
-func (m *mockUserRepo) CreateAndDeleteOldUserSession(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error) {
-	return m.createAndDeleteOldUserSession(ctx, sessionReq)
+func (m *mockUserRepo) GetUserSessionByID(ctx context.Context, sessionID uuid.UUID) (*repousersessions.UserSessions, error) {
+	return m.getUserSessionByID(ctx, sessionID)
 }
 
-func (m *mockUserRepo) CreateUserSession(ctx context.Context, sessionReq *ports.CreateUserSessionRequest) (*ports.CreateUserSessionResponse, error) {
-	return m.createUserSession(ctx, sessionReq)
+func (m *mockUserRepo) ResolveSessionAnomaly(ctx context.Context, anomaly *ports.SessionAnomaly, event *domainevents.Event) error {
+	return m.resolveSessionAnomaly(ctx, anomaly, event)
 }
 
-func (m *mockUserRepo) DeleteUserSession(ctx context.Context, session_id uuid.UUID) error {
-	return m.deleteUserSession(ctx, session_id)
+// recordingPublisher keeps the last verification code, password reset and
+// magic link tokens it was asked to send, and every session anomaly. Mock
+// repos hand it the events they store through deliver.
+type recordingPublisher struct {
+	verificationCode string
+	resetToken       string
+	magicLinkToken   string
+	anomalies        []domainevents.SessionAnomalyDetected
 }
 
-func (m *mockUserRepo) DeleteUser(ctx context.Context, userID uuid.UUID) error {
-	return m.deleteUser(ctx, userID)
+func (p *recordingPublisher) Publish(ctx context.Context, event domainevents.Event) error {
+	switch data := event.Data.(type) {
+	case domainevents.VerificationCodeRequested:
+		p.verificationCode = data.Code
+	case domainevents.MagicLinkRequested:
+		p.magicLinkToken = data.Token
+	case domainevents.PasswordResetRequested:
+		p.resetToken = data.Token
+	case domainevents.SessionAnomalyDetected:
+		p.anomalies = append(p.anomalies, data)
+	}
+	return nil
 }
 
-func (m *mockUserRepo) DeleteUserDeadSessions(ctx context.Context, userID uuid.UUID) error {
-	return m.deleteUserDeadSessions(ctx, userID)
+// deliver publishes an outbox event to p the way the relay would.
+func (p *recordingPublisher) deliver(t *testing.T, event *domainevents.Event) {
+	t.Helper()
+	if event == nil {
+		return
+	}
+	if event.UserID == uuid.Nil || event.Type != event.Data.EventType() {
+		t.Fatalf("malformed %s event: %+v", event.Type, event)
+	}
+	if err := p.Publish(context.Background(), *event); err != nil {
+		t.Fatalf("failed to deliver %s event: %v", event.Type, err)
+	}
 }
 
 func TestUserService_Register(t *testing.T) {
@@ -134,8 +349,14 @@ func TestUserService_Register(t *testing.T) {
 				m.getUserByEmailFn = func(ctx context.Context, email string) (*repouser.User, error) {
 					return nil, domain.ErrNotFound
 				}
-				// Simulate: Successful creation
+				// Simulate: Successful creation, the email event has to be
+				// stored with the user
 				m.createUserFn = func(ctx context.Context, req ports.UserAndCredentialsRequest) error {
+					if req.Event == nil || req.Event.UserID != req.UserID || req.Event.Data != (domainevents.UserRegistered{
+						Email: "newuser@gmail.com", Token: req.EmailVerificationToken,
+					}) {
+						return fmt.Errorf("unexpected registration event: %+v", req.Event)
+					}
 					return nil
 				}
 			},
@@ -191,10 +412,10 @@ func TestUserService_Register(t *testing.T) {
 				tt.setupMock(mockRepo)
 			}
 
-			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, &testutil.NoPublisher{}, &config.JWTTokenKeys{})
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, &config.JWTTokenKeys{}, testutil.NewTestAuthConfig(t), nil)
 
 			// Execute
-			err := svc.Register(context.Background(), tt.email, tt.password)
+			err := svc.Register(context.Background(), tt.email, tt.password, "")
 
 			// Assert
 			if (err != nil) != tt.wantErr {
@@ -206,3 +427,1530 @@ func TestUserService_Register(t *testing.T) {
 		})
 	}
 }
+
+func TestUserService_RefreshSession(t *testing.T) {
+	sessionID := uuid.New()
+	userID := uuid.New()
+	const refreshToken = "raw-refresh-token"
+
+	tests := []struct {
+		name        string
+		token       string
+		setupMock   func(m *mockUserRepo, revoked *uuid.UUID)
+		wantRevoked bool
+		expectedErr error
+	}{
+		{
+			name:        "Empty token",
+			token:       "",
+			expectedErr: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name:  "Unknown token",
+			token: refreshToken,
+			setupMock: func(m *mockUserRepo, revoked *uuid.UUID) {
+				m.getUserSessionByToken = func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					return nil, domain.ErrSessionNotFound
+				}
+				m.getSessionIDByRotatedToken = func(ctx context.Context, token string) (uuid.UUID, error) {
+					return uuid.Nil, domain.ErrSessionNotFound
+				}
+			},
+			expectedErr: domain.ErrInvalidRefreshToken,
+		},
+		{
+			name:  "Replayed token revokes the session",
+			token: refreshToken,
+			setupMock: func(m *mockUserRepo, revoked *uuid.UUID) {
+				m.getUserSessionByToken = func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					return nil, domain.ErrSessionNotFound
+				}
+				m.getSessionIDByRotatedToken = func(ctx context.Context, token string) (uuid.UUID, error) {
+					return sessionID, nil
+				}
+				m.deleteUserSession = func(ctx context.Context, id uuid.UUID, reason string) error {
+					if reason != domainusersessions.LogoutReasonTokenReuse {
+						t.Errorf("expected logout reason %q, got %q", domainusersessions.LogoutReasonTokenReuse, reason)
+					}
+					*revoked = id
+					return nil
+				}
+			},
+			wantRevoked: true,
+			expectedErr: domain.ErrRefreshTokenReused,
+		},
+		{
+			name:  "Expired session",
+			token: refreshToken,
+			setupMock: func(m *mockUserRepo, revoked *uuid.UUID) {
+				m.getUserSessionByToken = func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					return &repousersessions.UserSessions{ID: sessionID, UserID: userID, ExpiresAt: time.Now().Add(-time.Minute)}, nil
+				}
+				m.deleteUserSession = func(ctx context.Context, id uuid.UUID, reason string) error {
+					return nil
+				}
+			},
+			expectedErr: domain.ErrSessionExpired,
+		},
+		{
+			name:  "Concurrent rotation revokes the session",
+			token: refreshToken,
+			setupMock: func(m *mockUserRepo, revoked *uuid.UUID) {
+				m.getUserSessionByToken = func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					return &repousersessions.UserSessions{ID: sessionID, UserID: userID, IPAddress: "203.0.113.7", UserAgent: "test-agent", ExpiresAt: time.Now().Add(time.Hour)}, nil
+				}
+				m.rotateUserSessionToken = func(ctx context.Context, id uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error) {
+					return nil, domain.ErrRefreshTokenReused
+				}
+				m.deleteUserSession = func(ctx context.Context, id uuid.UUID, reason string) error {
+					*revoked = id
+					return nil
+				}
+			},
+			wantRevoked: true,
+			expectedErr: domain.ErrRefreshTokenReused,
+		},
+		{
+			name:  "Successful rotation",
+			token: refreshToken,
+			setupMock: func(m *mockUserRepo, revoked *uuid.UUID) {
+				m.getUserSessionByToken = func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					if token != HashToken(refreshToken) {
+						t.Errorf("expected lookup by hashed token, got %s", token)
+					}
+					return &repousersessions.UserSessions{ID: sessionID, UserID: userID, IPAddress: "203.0.113.7", UserAgent: "test-agent", ExpiresAt: time.Now().Add(time.Hour)}, nil
+				}
+				m.rotateUserSessionToken = func(ctx context.Context, id uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error) {
+					if oldToken != HashToken(refreshToken) || newToken == oldToken {
+						t.Errorf("unexpected rotation %s -> %s", oldToken, newToken)
+					}
+					if ipAddress != "203.0.113.7" || userAgent != "test-agent" {
+						t.Errorf("expected the caller's IP and user agent, got %s / %s", ipAddress, userAgent)
+					}
+					return &ports.CreateUserSessionResponse{ID: id, UserID: userID, Token: newToken, ExpiresAt: time.Now().Add(time.Hour)}, nil
+				}
+				m.getUserByIDFn = func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+					return &repouser.User{ID: id, Roles: []string{"user"}}, nil
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var revoked uuid.UUID
+			mockRepo := &mockUserRepo{}
+			if tt.setupMock != nil {
+				tt.setupMock(mockRepo, &revoked)
+			}
+
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+
+			res, err := svc.RefreshSession(context.Background(), tt.token, "203.0.113.7", "test-agent")
+
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("RefreshSession() got = %v, want %v", err, tt.expectedErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("RefreshSession() unexpected error: %v", err)
+				}
+				if res.RefreshToken == "" || res.RefreshToken == tt.token || res.AccessToken == "" {
+					t.Errorf("RefreshSession() returned unexpected tokens: %+v", res)
+				}
+			}
+			if tt.wantRevoked && revoked != sessionID {
+				t.Errorf("expected session %s to be revoked, got %s", sessionID, revoked)
+			}
+		})
+	}
+}
+
+func TestUserService_EmailVerificationCode(t *testing.T) {
+	userID := uuid.New()
+	ctx := context.Background()
+
+	var record *userverification.UserVerification
+	var confirmed bool
+	publisher := &recordingPublisher{}
+	mockRepo := &mockUserRepo{
+		getUserByEmailFn: func(ctx context.Context, email string) (*repouser.User, error) {
+			if email != "user@gmail.com" {
+				return nil, domain.ErrNotFound
+			}
+			status := "pending_verification"
+			if confirmed {
+				status = "active"
+			}
+			return &repouser.User{ID: userID, Email: email, UserStatus: status}, nil
+		},
+		getCountsOfVerificationRecordsByUserID: func(ctx context.Context, id uuid.UUID, purpose string, since time.Time) (int64, error) {
+			return 0, nil
+		},
+		createUserFn: func(ctx context.Context, req ports.UserAndCredentialsRequest) error {
+			record = &userverification.UserVerification{
+				ID: uuid.New(), UserID: userID, Token: req.EmailVerificationToken, Status: "pending",
+				Purpose: req.EmailVerificationPurpose, ExpiresAt: req.TokenExpiration,
+			}
+			publisher.deliver(t, req.Event)
+			return nil
+		},
+		createEmailVerificationCode: func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+			req.ID = uuid.New()
+			record = req
+			publisher.deliver(t, event)
+			return nil
+		},
+		getPendingVerificationByUserID: func(ctx context.Context, id uuid.UUID, purpose string) (*userverification.UserVerification, error) {
+			if record == nil || record.Purpose != purpose || record.Status != "pending" {
+				return nil, domain.ErrNotFound
+			}
+			copied := *record
+			return &copied, nil
+		},
+		countVerificationAttempt: func(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+			if record.Attempts >= maxAttempts {
+				return domain.ErrVerificationCodeLocked
+			}
+			record.Attempts++
+			return nil
+		},
+		updateUserVerificationTokenStatus: func(ctx context.Context, id uuid.UUID, status string) error {
+			record.Status = status
+			return nil
+		},
+		confirmVerification: func(ctx context.Context, id uuid.UUID, verificationID uuid.UUID, event *domainevents.Event) error {
+			if id != userID || verificationID != record.ID {
+				t.Errorf("unexpected confirmation %s %s", id, verificationID)
+			}
+			if event == nil || event.UserID != userID || event.Data != (domainevents.UserVerified{Method: domainuserverification.ModeCode}) {
+				t.Errorf("unexpected verified event: %+v", event)
+			}
+			record.Status, confirmed = "consumed", true
+			return nil
+		},
+	}
+	authConfig := testutil.NewTestAuthConfig(t)
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+
+	resend := func(t *testing.T) string {
+		t.Helper()
+		record, confirmed = nil, false
+		if err := svc.ResendEmailVerificationToken(ctx, "user@gmail.com", domainuserverification.ModeCode); err != nil {
+			t.Fatalf("ResendEmailVerificationToken() error: %v", err)
+		}
+		if len(publisher.verificationCode) != 6 {
+			t.Fatalf("expected a 6-digit code, got %q", publisher.verificationCode)
+		}
+		if record.Token == publisher.verificationCode || !CheckPasswordHash(publisher.verificationCode, record.Token) {
+			t.Fatal("expected the code to be stored hashed")
+		}
+		return publisher.verificationCode
+	}
+	wrongCode := func(code string) string {
+		if code == "000000" {
+			return "000001"
+		}
+		return "000000"
+	}
+
+	t.Run("Registration in code mode emails a code", func(t *testing.T) {
+		record, confirmed = nil, false
+		if err := svc.Register(ctx, "new@gmail.com", "password123", domainuserverification.ModeCode); err != nil {
+			t.Fatalf("Register() error: %v", err)
+		}
+		if record.Purpose != domainuserverification.PurposeEmailVerificationCode || !CheckPasswordHash(publisher.verificationCode, record.Token) {
+			t.Errorf("unexpected verification record: %+v", record)
+		}
+	})
+
+	t.Run("Correct code verifies the account", func(t *testing.T) {
+		code := resend(t)
+		if err := svc.VerifyEmailCode(ctx, " User@Gmail.com ", code); err != nil {
+			t.Fatalf("VerifyEmailCode() error: %v", err)
+		}
+		if !confirmed {
+			t.Error("expected the account to be confirmed")
+		}
+		if err := svc.VerifyEmailCode(ctx, "user@gmail.com", code); !errors.Is(err, domain.ErrInvalidVerificationCode) {
+			t.Errorf("second verification got = %v, want %v", err, domain.ErrInvalidVerificationCode)
+		}
+	})
+
+	t.Run("Code locks after too many wrong guesses", func(t *testing.T) {
+		code := resend(t)
+		for i := 0; i < authConfig.EmailVerification.MaxCodeAttempts; i++ {
+			if err := svc.VerifyEmailCode(ctx, "user@gmail.com", wrongCode(code)); !errors.Is(err, domain.ErrInvalidVerificationCode) {
+				t.Fatalf("guess %d got = %v, want %v", i+1, err, domain.ErrInvalidVerificationCode)
+			}
+		}
+		if err := svc.VerifyEmailCode(ctx, "user@gmail.com", code); !errors.Is(err, domain.ErrInvalidVerificationCode) {
+			t.Errorf("correct code after lockout got = %v, want %v", err, domain.ErrInvalidVerificationCode)
+		}
+		if confirmed {
+			t.Error("expected a locked code not to verify the account")
+		}
+	})
+
+	t.Run("Expired code", func(t *testing.T) {
+		code := resend(t)
+		record.ExpiresAt = time.Now().Add(-time.Minute)
+		if err := svc.VerifyEmailCode(ctx, "user@gmail.com", code); !errors.Is(err, domain.ErrInvalidVerificationCode) {
+			t.Errorf("got = %v, want %v", err, domain.ErrInvalidVerificationCode)
+		}
+	})
+
+	t.Run("Unknown email", func(t *testing.T) {
+		if err := svc.VerifyEmailCode(ctx, "nobody@gmail.com", "123456"); !errors.Is(err, domain.ErrInvalidVerificationCode) {
+			t.Errorf("got = %v, want %v", err, domain.ErrInvalidVerificationCode)
+		}
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		if err := svc.ResendEmailVerificationToken(ctx, "user@gmail.com", "sms"); !errors.Is(err, domain.ErrInvalidVerificationMode) {
+			t.Errorf("got = %v, want %v", err, domain.ErrInvalidVerificationMode)
+		}
+	})
+}
+
+func TestUserService_ForgotPassword(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name        string
+		setupMock   func(m *mockUserRepo, stored *userverification.UserVerification)
+		wantEmail   bool
+		expectedErr error
+	}{
+		{
+			name: "Unknown email succeeds silently",
+			setupMock: func(m *mockUserRepo, stored *userverification.UserVerification) {
+				m.getUserByEmailFn = func(ctx context.Context, email string) (*repouser.User, error) {
+					return nil, domain.ErrNotFound
+				}
+			},
+		},
+		{
+			name: "Unverified account gets no email",
+			setupMock: func(m *mockUserRepo, stored *userverification.UserVerification) {
+				m.getUserByEmailFn = func(ctx context.Context, email string) (*repouser.User, error) {
+					return &repouser.User{ID: userID, UserStatus: "pending_verification"}, nil
+				}
+			},
+		},
+		{
+			name: "Rate limited",
+			setupMock: func(m *mockUserRepo, stored *userverification.UserVerification) {
+				m.getUserByEmailFn = func(ctx context.Context, email string) (*repouser.User, error) {
+					return &repouser.User{ID: userID, UserStatus: "active"}, nil
+				}
+				m.getCountsOfVerificationRecordsByUserID = func(ctx context.Context, id uuid.UUID, purpose string, since time.Time) (int64, error) {
+					return 3, nil
+				}
+			},
+		},
+		{
+			name: "Token is stored hashed and emailed raw",
+			setupMock: func(m *mockUserRepo, stored *userverification.UserVerification) {
+				m.getUserByEmailFn = func(ctx context.Context, email string) (*repouser.User, error) {
+					return &repouser.User{ID: userID, UserStatus: "active"}, nil
+				}
+				m.getCountsOfVerificationRecordsByUserID = func(ctx context.Context, id uuid.UUID, purpose string, since time.Time) (int64, error) {
+					if purpose != domainuserverification.PurposePasswordReset {
+						t.Errorf("expected reset tokens to be counted, got %s", purpose)
+					}
+					return 0, nil
+				}
+				m.createPasswordResetToken = func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+					*stored = *req
+					return nil
+				}
+			},
+			wantEmail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored userverification.UserVerification
+			mockRepo := &mockUserRepo{}
+			tt.setupMock(mockRepo, &stored)
+			publisher := &recordingPublisher{}
+			if create := mockRepo.createPasswordResetToken; create != nil {
+				mockRepo.createPasswordResetToken = func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+					if err := create(ctx, req, event); err != nil {
+						return err
+					}
+					publisher.deliver(t, event)
+					return nil
+				}
+			}
+
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+
+			err := svc.ForgotPassword(context.Background(), " User@Example.com ")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("ForgotPassword() got = %v, want %v", err, tt.expectedErr)
+			}
+			if !tt.wantEmail {
+				if publisher.resetToken != "" {
+					t.Error("expected no reset email to be sent")
+				}
+				return
+			}
+			if publisher.resetToken == "" {
+				t.Fatal("expected a reset email to be sent")
+			}
+			if stored.Token != HashToken(publisher.resetToken) || stored.Purpose != domainuserverification.PurposePasswordReset {
+				t.Errorf("unexpected stored token: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestUserService_ResetPassword(t *testing.T) {
+	userID, verificationID := uuid.New(), uuid.New()
+	const resetToken = "raw-reset-token"
+
+	record := func(purpose, status string, expiresIn time.Duration) *userverification.UserVerification {
+		return &userverification.UserVerification{
+			ID: verificationID, UserID: userID, Token: HashToken(resetToken),
+			Purpose: purpose, Status: status, ExpiresAt: time.Now().Add(expiresIn),
+		}
+	}
+
+	tests := []struct {
+		name        string
+		setupMock   func(m *mockUserRepo, reset *bool)
+		wantReset   bool
+		expectedErr error
+	}{
+		{
+			name: "Unknown token",
+			setupMock: func(m *mockUserRepo, reset *bool) {
+				m.getVerificationByToken = func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+					return nil, domain.ErrTokenNotFound
+				}
+			},
+			expectedErr: domain.ErrInvalidResetToken,
+		},
+		{
+			name: "Email verification token is rejected",
+			setupMock: func(m *mockUserRepo, reset *bool) {
+				m.getVerificationByToken = func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+					return record(domainuserverification.PurposeEmailVerification, "pending", time.Hour), nil
+				}
+			},
+			expectedErr: domain.ErrInvalidResetToken,
+		},
+		{
+			name: "Consumed token",
+			setupMock: func(m *mockUserRepo, reset *bool) {
+				m.getVerificationByToken = func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+					return record(domainuserverification.PurposePasswordReset, "consumed", time.Hour), nil
+				}
+			},
+			expectedErr: domain.ErrUsedToken,
+		},
+		{
+			name: "Expired token",
+			setupMock: func(m *mockUserRepo, reset *bool) {
+				m.getVerificationByToken = func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+					return record(domainuserverification.PurposePasswordReset, "pending", -time.Minute), nil
+				}
+				m.updateUserVerificationTokenStatus = func(ctx context.Context, id uuid.UUID, status string) error {
+					return nil
+				}
+			},
+			expectedErr: domain.ErrTokenExpired,
+		},
+		{
+			name: "Successful reset",
+			setupMock: func(m *mockUserRepo, reset *bool) {
+				m.getVerificationByToken = func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+					if token != HashToken(resetToken) {
+						t.Errorf("expected lookup by hashed token, got %s", token)
+					}
+					return record(domainuserverification.PurposePasswordReset, "pending", time.Hour), nil
+				}
+				m.getUserByIDFn = func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+					return &repouser.User{ID: id, Email: "user@example.com"}, nil
+				}
+				m.resetUserPassword = func(ctx context.Context, id uuid.UUID, vid uuid.UUID, hash string, event *domainevents.Event) error {
+					if id != userID || vid != verificationID || !CheckPasswordHash("new-password", hash) {
+						t.Errorf("unexpected reset call: %s %s", id, vid)
+					}
+					if event == nil || event.Data != (domainevents.PasswordChanged{Email: "user@example.com", Reason: domainevents.PasswordChangedByReset}) {
+						t.Errorf("unexpected password changed event: %+v", event)
+					}
+					*reset = true
+					return nil
+				}
+			},
+			wantReset: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reset bool
+			mockRepo := &mockUserRepo{}
+			tt.setupMock(mockRepo, &reset)
+
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+
+			err := svc.ResetPassword(context.Background(), resetToken, "new-password")
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("ResetPassword() got = %v, want %v", err, tt.expectedErr)
+			}
+			if reset != tt.wantReset {
+				t.Errorf("ResetUserPassword called = %v, want %v", reset, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestUserService_MagicLink(t *testing.T) {
+	userID, verificationID := uuid.New(), uuid.New()
+	ctx := context.Background()
+
+	newService := func(user *repouser.User, record **userverification.UserVerification) (*UserSerivce, *recordingPublisher) {
+		publisher := &recordingPublisher{}
+		mockRepo := &mockUserRepo{
+			getUserByEmailFn: func(ctx context.Context, email string) (*repouser.User, error) {
+				if email != user.Email {
+					return nil, domain.ErrNotFound
+				}
+				return user, nil
+			},
+			getUserByIDFn: func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+				return user, nil
+			},
+			getCountsOfVerificationRecordsByUserID: func(ctx context.Context, id uuid.UUID, purpose string, since time.Time) (int64, error) {
+				if purpose != domainuserverification.PurposeMagicLink {
+					t.Errorf("expected magic links to be counted, got %s", purpose)
+				}
+				return 0, nil
+			},
+			createMagicLinkToken: func(ctx context.Context, req *userverification.UserVerification, event *domainevents.Event) error {
+				req.ID = verificationID
+				*record = req
+				publisher.deliver(t, event)
+				return nil
+			},
+			getVerificationByToken: func(ctx context.Context, token string) (*userverification.UserVerification, error) {
+				if *record == nil || (*record).Token != token {
+					return nil, domain.ErrTokenNotFound
+				}
+				copied := **record
+				return &copied, nil
+			},
+			updateUserVerificationTokenStatus: func(ctx context.Context, id uuid.UUID, status string) error {
+				(*record).Status = status
+				return nil
+			},
+			consumeVerificationToken: func(ctx context.Context, id uuid.UUID) error {
+				if (*record).Status != "pending" {
+					return domain.ErrUsedToken
+				}
+				(*record).Status = "consumed"
+				return nil
+			},
+			createMFAChallenge: func(ctx context.Context, c *repousermfa.MFAChallenge) error {
+				return nil
+			},
+			createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+				return &ports.CreateUserSessionResponse{ID: uuid.New(), UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+			},
+		}
+		return NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil), publisher
+	}
+
+	t.Run("Unknown email succeeds silently", func(t *testing.T) {
+		var record *userverification.UserVerification
+		svc, publisher := newService(&repouser.User{ID: userID, Email: "user@gmail.com", UserStatus: "active"}, &record)
+
+		if err := svc.RequestMagicLink(ctx, "nobody@gmail.com"); err != nil {
+			t.Fatalf("RequestMagicLink() error: %v", err)
+		}
+		if publisher.magicLinkToken != "" || record != nil {
+			t.Error("expected no link to be issued")
+		}
+	})
+
+	t.Run("Link logs in once", func(t *testing.T) {
+		var record *userverification.UserVerification
+		svc, publisher := newService(&repouser.User{ID: userID, Email: "user@gmail.com", UserStatus: "active"}, &record)
+
+		if err := svc.RequestMagicLink(ctx, " User@Gmail.com "); err != nil {
+			t.Fatalf("RequestMagicLink() error: %v", err)
+		}
+		if publisher.magicLinkToken == "" {
+			t.Fatal("expected a magic link email to be sent")
+		}
+		if record.Token != HashToken(publisher.magicLinkToken) || record.Purpose != domainuserverification.PurposeMagicLink {
+			t.Errorf("unexpected stored token: %+v", record)
+		}
+
+		resp, err := svc.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{Token: publisher.magicLinkToken})
+		if err != nil {
+			t.Fatalf("LoginWithMagicLink() error: %v", err)
+		}
+		if resp.AccessToken == "" || resp.RefreshToken == "" || resp.UserID != userID {
+			t.Errorf("expected a session for the user, got %+v", resp)
+		}
+
+		if _, err := svc.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{Token: publisher.magicLinkToken}); !errors.Is(err, domain.ErrInvalidMagicLink) {
+			t.Errorf("reused link got = %v, want %v", err, domain.ErrInvalidMagicLink)
+		}
+	})
+
+	t.Run("MFA user gets a challenge", func(t *testing.T) {
+		var record *userverification.UserVerification
+		svc, publisher := newService(&repouser.User{ID: userID, Email: "user@gmail.com", UserStatus: "active", IsMFAEnabled: true}, &record)
+
+		if err := svc.RequestMagicLink(ctx, "user@gmail.com"); err != nil {
+			t.Fatalf("RequestMagicLink() error: %v", err)
+		}
+		resp, err := svc.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{Token: publisher.magicLinkToken})
+		if err != nil {
+			t.Fatalf("LoginWithMagicLink() error: %v", err)
+		}
+		if resp.MFAChallenge == "" || resp.AccessToken != "" {
+			t.Errorf("expected only an MFA challenge, got %+v", resp)
+		}
+	})
+
+	t.Run("Bad links are rejected alike", func(t *testing.T) {
+		links := map[string]*userverification.UserVerification{
+			"password reset token": {ID: verificationID, UserID: userID, Purpose: domainuserverification.PurposePasswordReset, Status: "pending", ExpiresAt: time.Now().Add(time.Hour)},
+			"expired":              {ID: verificationID, UserID: userID, Purpose: domainuserverification.PurposeMagicLink, Status: "pending", ExpiresAt: time.Now().Add(-time.Minute)},
+			"invalidated":          {ID: verificationID, UserID: userID, Purpose: domainuserverification.PurposeMagicLink, Status: "invalidated", ExpiresAt: time.Now().Add(time.Hour)},
+			"unknown":              nil,
+		}
+		for name, link := range links {
+			if link != nil {
+				link.Token = HashToken("raw-link-token")
+			}
+			record := link
+			svc, _ := newService(&repouser.User{ID: userID, Email: "user@gmail.com", UserStatus: "active"}, &record)
+
+			_, err := svc.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{Token: "raw-link-token"})
+			if !errors.Is(err, domain.ErrInvalidMagicLink) {
+				t.Errorf("%s: got = %v, want %v", name, err, domain.ErrInvalidMagicLink)
+			}
+		}
+	})
+
+	t.Run("Suspended account cannot log in", func(t *testing.T) {
+		var record *userverification.UserVerification
+		user := &repouser.User{ID: userID, Email: "user@gmail.com", UserStatus: "active"}
+		svc, publisher := newService(user, &record)
+
+		if err := svc.RequestMagicLink(ctx, "user@gmail.com"); err != nil {
+			t.Fatalf("RequestMagicLink() error: %v", err)
+		}
+		user.UserStatus = "suspended"
+		if _, err := svc.LoginWithMagicLink(ctx, &ports.MagicLinkLoginRequest{Token: publisher.magicLinkToken}); !errors.Is(err, domain.ErrUserAccountSuspended) {
+			t.Errorf("got = %v, want %v", err, domain.ErrUserAccountSuspended)
+		}
+	})
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	userID, sessionID := uuid.New(), uuid.New()
+	currentHash, err := HashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		current     string
+		newPassword string
+		keepSession uuid.UUID
+		expectedErr error
+	}{
+		{"Wrong current password", "not-my-password", "new-password", uuid.Nil, domain.ErrIncorrectPassword},
+		{"Same password", "old-password", "old-password", uuid.Nil, domain.ErrPasswordUnchanged},
+		{"Revoke every session", "old-password", "new-password", uuid.Nil, nil},
+		{"Keep the current session", "old-password", "new-password", sessionID, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := false
+			mockRepo := &mockUserRepo{
+				getUserCredentialsByUserID: func(ctx context.Context, id uuid.UUID) (*repouser.UserCredentials, error) {
+					return &repouser.UserCredentials{UserID: id, PasswordHash: currentHash}, nil
+				},
+				getUserByIDFn: func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+					return &repouser.User{ID: id, Email: "user@example.com"}, nil
+				},
+				changeUserPassword: func(ctx context.Context, id uuid.UUID, hash string, keep uuid.UUID, event *domainevents.Event) error {
+					if id != userID || keep != tt.keepSession || !CheckPasswordHash(tt.newPassword, hash) {
+						t.Errorf("unexpected change call: %s keep=%s", id, keep)
+					}
+					if event == nil || event.UserID != userID || event.Data != (domainevents.PasswordChanged{Email: "user@example.com", Reason: domainevents.PasswordChangedByUser}) {
+						t.Errorf("unexpected password changed event: %+v", event)
+					}
+					changed = true
+					return nil
+				},
+			}
+
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+
+			err := svc.ChangePassword(context.Background(), userID, tt.current, tt.newPassword, tt.keepSession)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("ChangePassword() got = %v, want %v", err, tt.expectedErr)
+			}
+			if changed != (tt.expectedErr == nil) {
+				t.Errorf("ChangeUserPassword called = %v", changed)
+			}
+		})
+	}
+}
+
+func TestUserService_Login(t *testing.T) {
+	userID := uuid.New()
+	passwordHash, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		mfaEnabled  bool
+		wantMFA     bool
+		expectedErr error
+	}{
+		{name: "Wrong password", password: "wrong-password", expectedErr: domain.ErrInvalidCredentials},
+		{name: "Session without MFA", password: "correct-password"},
+		{name: "Challenge when MFA is enabled", password: "correct-password", mfaEnabled: true, wantMFA: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionCreated, unlocked := false, false
+			mockRepo := &mockUserRepo{
+				getUserByEmailFn: func(ctx context.Context, email string) (*repouser.User, error) {
+					return &repouser.User{ID: userID, UserStatus: "active", IsMFAEnabled: tt.mfaEnabled}, nil
+				},
+				getUserCredentialsByUserID: func(ctx context.Context, id uuid.UUID) (*repouser.UserCredentials, error) {
+					return &repouser.UserCredentials{UserID: id, PasswordHash: passwordHash}, nil
+				},
+				createMFAChallenge: func(ctx context.Context, challenge *repousermfa.MFAChallenge) error {
+					return nil
+				},
+				bookLoginAttempt: func(ctx context.Context, id uuid.UUID, delay ports.LoginDelay) (int, error) {
+					return 1, nil
+				},
+				recordFailedLogin: func(ctx context.Context, id uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error {
+					return nil
+				},
+				unlockUser: func(ctx context.Context, id uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+					unlocked = true
+					return nil
+				},
+				createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+					sessionCreated = true
+					return &ports.CreateUserSessionResponse{ID: uuid.New(), UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+				},
+			}
+
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+
+			res, err := svc.Login(context.Background(), &ports.LoginRequest{Email: "user@gmail.com", Password: tt.password})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Login() got = %v, want %v", err, tt.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantMFA {
+				if res.MFAChallenge == "" || res.AccessToken != "" || sessionCreated {
+					t.Errorf("expected only an MFA challenge, got %+v (session=%v)", res, sessionCreated)
+				}
+				if unlocked {
+					t.Error("expected the failed login count to stay until the second factor passes")
+				}
+				return
+			}
+			if res.AccessToken == "" || !sessionCreated || !unlocked {
+				t.Errorf("expected a session and the failed login count reset, got %+v (unlocked=%v)", res, unlocked)
+			}
+		})
+	}
+}
+
+func TestUserService_LoginLockout(t *testing.T) {
+	userID := uuid.New()
+	passwordHash, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user repouser.User
+	var audits []*repousersessions.AuditUserSessions
+	mockRepo := &mockUserRepo{
+		getUserByEmailFn: func(ctx context.Context, email string) (*repouser.User, error) {
+			copied := user
+			return &copied, nil
+		},
+		getUserCredentialsByUserID: func(ctx context.Context, id uuid.UUID) (*repouser.UserCredentials, error) {
+			return &repouser.UserCredentials{UserID: id, PasswordHash: passwordHash}, nil
+		},
+		// Stands in for the row lock: the wait is checked and the next one set
+		// in one step
+		bookLoginAttempt: func(ctx context.Context, id uuid.UUID, delay ports.LoginDelay) (int, error) {
+			if user.LockedUntil != nil && time.Until(*user.LockedUntil) > 0 {
+				return 0, &domain.RetryAfterError{Err: domain.ErrLoginThrottled, RetryAfter: time.Until(*user.LockedUntil)}
+			}
+			user.FailedLoginAttempts++
+			if wait := delay(user.FailedLoginAttempts); wait > 0 {
+				until := time.Now().Add(wait)
+				user.LockedUntil = &until
+			}
+			return user.FailedLoginAttempts, nil
+		},
+		recordFailedLogin: func(ctx context.Context, id uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error {
+			if attempts != user.FailedLoginAttempts {
+				t.Errorf("audited attempt %d, booked %d", attempts, user.FailedLoginAttempts)
+			}
+			if lockAudit != nil {
+				audits = append(audits, lockAudit)
+			}
+			return nil
+		},
+		unlockUser: func(ctx context.Context, id uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+			user.FailedLoginAttempts, user.LockedUntil = 0, nil
+			if audit != nil {
+				audits = append(audits, audit)
+			}
+			return nil
+		},
+		createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+			return &ports.CreateUserSessionResponse{ID: uuid.New(), UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+		},
+	}
+	authConfig := testutil.NewTestAuthConfig(t)
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+	login := func(password string) error {
+		_, err := svc.Login(context.Background(), &ports.LoginRequest{Email: "user@gmail.com", Password: password})
+		return err
+	}
+	// Lets the next attempt through as if the wait had run out
+	elapse := func() {
+		past := time.Now().Add(-time.Second)
+		user.LockedUntil = &past
+	}
+
+	t.Run("Free attempts are not delayed", func(t *testing.T) {
+		user = repouser.User{ID: userID, UserStatus: "active"}
+		for i := 0; i < authConfig.Lockout.FreeAttempts; i++ {
+			if err := login("wrong-password"); !errors.Is(err, domain.ErrInvalidCredentials) {
+				t.Fatalf("attempt %d: got %v, want ErrInvalidCredentials", i+1, err)
+			}
+		}
+		if user.LockedUntil != nil {
+			t.Error("expected no delay within the free attempts")
+		}
+	})
+
+	t.Run("Delayed account is throttled even with the right password", func(t *testing.T) {
+		if err := login("wrong-password"); !errors.Is(err, domain.ErrInvalidCredentials) {
+			t.Fatalf("got %v, want ErrInvalidCredentials", err)
+		}
+		err := login("correct-password")
+		var retry *domain.RetryAfterError
+		if !errors.Is(err, domain.ErrLoginThrottled) || !errors.As(err, &retry) {
+			t.Fatalf("got %v, want a RetryAfterError wrapping ErrLoginThrottled", err)
+		}
+		if retry.RetryAfter <= 0 || retry.RetryAfter > authConfig.Lockout.BaseDelay {
+			t.Errorf("RetryAfter = %v, want up to %v", retry.RetryAfter, authConfig.Lockout.BaseDelay)
+		}
+	})
+
+	t.Run("Success resets the counter", func(t *testing.T) {
+		elapse()
+		if err := login("correct-password"); err != nil {
+			t.Fatalf("Login() error: %v", err)
+		}
+		if user.FailedLoginAttempts != 0 || user.LockedUntil != nil {
+			t.Errorf("expected the counter reset, got %d attempts, locked until %v", user.FailedLoginAttempts, user.LockedUntil)
+		}
+	})
+
+	t.Run("Threshold locks the account", func(t *testing.T) {
+		audits = nil
+		for i := 0; i < authConfig.Lockout.Threshold; i++ {
+			elapse()
+			login("wrong-password")
+		}
+		if wait := time.Until(*user.LockedUntil); wait < authConfig.Lockout.LockDuration-time.Minute {
+			t.Errorf("expected a lock of %v, got %v", authConfig.Lockout.LockDuration, wait)
+		}
+		if len(audits) != 1 || audits[0].EventType != domainusersessions.AuditEventAccountLocked {
+			t.Errorf("expected one ACCOUNT_LOCKED audit, got %+v", audits)
+		}
+	})
+
+	t.Run("Admin unlock", func(t *testing.T) {
+		audits = nil
+		adminID := uuid.New()
+		if err := svc.UnlockAccount(context.Background(), adminID, userID); err != nil {
+			t.Fatalf("UnlockAccount() error: %v", err)
+		}
+		if len(audits) != 1 || audits[0].EventType != domainusersessions.AuditEventAccountUnlocked || *audits[0].NewValue != "by="+adminID.String() {
+			t.Errorf("expected an ACCOUNT_UNLOCKED audit naming the admin, got %+v", audits)
+		}
+		if err := login("correct-password"); err != nil {
+			t.Errorf("Login() after unlock error: %v", err)
+		}
+	})
+}
+
+func TestUserService_SessionLimit(t *testing.T) {
+	passwordHash, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authConfig := testutil.NewTestAuthConfig(t)
+	authConfig.Sessions.RoleMaxSessions = map[string]int{"admin": 2}
+
+	tests := []struct {
+		name        string
+		roles       []string
+		repoErr     error
+		wantMax     int
+		expectedErr error
+	}{
+		{name: "Default limit", wantMax: 5},
+		{name: "Role limit", roles: []string{"admin"}, wantMax: 2},
+		{name: "Limit reached", wantMax: 5, repoErr: domain.ErrTooManyUserSessions, expectedErr: domain.ErrTooManyUserSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockUserRepo{
+				getUserByEmailFn: func(ctx context.Context, email string) (*repouser.User, error) {
+					return &repouser.User{ID: uuid.New(), UserStatus: "active", Roles: tt.roles}, nil
+				},
+				getUserCredentialsByUserID: func(ctx context.Context, id uuid.UUID) (*repouser.UserCredentials, error) {
+					return &repouser.UserCredentials{UserID: id, PasswordHash: passwordHash}, nil
+				},
+				bookLoginAttempt: func(ctx context.Context, id uuid.UUID, delay ports.LoginDelay) (int, error) {
+					return 1, nil
+				},
+				unlockUser: func(ctx context.Context, id uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+					return nil
+				},
+				createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+					if limit.Max != tt.wantMax || limit.Strategy != ports.SessionLimitReject {
+						t.Errorf("unexpected limit %+v, want max %d", limit, tt.wantMax)
+					}
+					if tt.repoErr != nil {
+						return nil, tt.repoErr
+					}
+					return &ports.CreateUserSessionResponse{ID: uuid.New(), UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+				},
+			}
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+
+			_, err := svc.Login(context.Background(), &ports.LoginRequest{Email: "user@gmail.com", Password: "correct-password"})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("Login() got = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestUserService_Sessions(t *testing.T) {
+	userID, otherUserID := uuid.New(), uuid.New()
+	device := "Chrome on macOS"
+	sessions := []repousersessions.UserSessions{
+		{ID: uuid.New(), UserID: userID, IPAddress: "198.51.100.1", UserAgent: "Mozilla/5.0", Device: &device},
+		{ID: uuid.New(), UserID: userID, IPAddress: "198.51.100.2", UserAgent: "curl/8.5.0"},
+		{ID: uuid.New(), UserID: otherUserID, IPAddress: "198.51.100.3", UserAgent: "curl/8.5.0"},
+	}
+	current := sessions[0].ID
+
+	mockRepo := &mockUserRepo{
+		getUserSessionsByUserID: func(ctx context.Context, id uuid.UUID) ([]repousersessions.UserSessions, error) {
+			var owned []repousersessions.UserSessions
+			for _, session := range sessions {
+				if session.UserID == id {
+					owned = append(owned, session)
+				}
+			}
+			return owned, nil
+		},
+		deleteUserSessionOfUser: func(ctx context.Context, id, sessionID uuid.UUID, event *domainevents.Event) error {
+			if revoked := event.Data.(domainevents.SessionRevoked); revoked.SessionID == nil || *revoked.SessionID != sessionID {
+				t.Errorf("unexpected session revoked event: %+v", event)
+			}
+			for i, session := range sessions {
+				if session.ID == sessionID && session.UserID == id {
+					sessions = append(sessions[:i], sessions[i+1:]...)
+					return nil
+				}
+			}
+			return domain.ErrSessionNotFound
+		},
+		deleteOtherUserSessions: func(ctx context.Context, id, keep uuid.UUID, event *domainevents.Event) (int64, error) {
+			if revoked := event.Data.(domainevents.SessionRevoked); revoked.KeptSessionID == nil || *revoked.KeptSessionID != keep {
+				t.Errorf("unexpected session revoked event: %+v", event)
+			}
+			var kept []repousersessions.UserSessions
+			for _, session := range sessions {
+				if session.UserID != id || session.ID == keep {
+					kept = append(kept, session)
+				}
+			}
+			revoked := int64(len(sessions) - len(kept))
+			sessions = kept
+			return revoked, nil
+		},
+	}
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+	ctx := context.Background()
+
+	infos, err := svc.ListSessions(ctx, userID, current)
+	if err != nil {
+		t.Fatalf("ListSessions() error: %v", err)
+	}
+	if len(infos) != 2 || !infos[0].Current || infos[1].Current || infos[0].Device != device || infos[1].Device != "" {
+		t.Errorf("unexpected sessions: %+v", infos)
+	}
+
+	if err := svc.RevokeSession(ctx, userID, sessions[2].ID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("revoking another user's session: got %v, want ErrSessionNotFound", err)
+	}
+
+	sessions = append(sessions, repousersessions.UserSessions{ID: uuid.New(), UserID: userID})
+	revoked, err := svc.RevokeOtherSessions(ctx, userID, current)
+	if err != nil || revoked != 2 {
+		t.Fatalf("RevokeOtherSessions() = %d, %v; want 2", revoked, err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != current || sessions[1].UserID != otherUserID {
+		t.Errorf("expected only the current session and the other user's to remain, got %+v", sessions)
+	}
+
+	if err := svc.RevokeSession(ctx, userID, current); err != nil {
+		t.Errorf("RevokeSession() error: %v", err)
+	}
+}
+
+func TestUserService_Activity(t *testing.T) {
+	userID := uuid.New()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	// Newest first, as the repository returns them
+	var events []repousersessions.AuditUserSessions
+	for i := 4; i >= 0; i-- {
+		ip := fmt.Sprintf("198.51.100.%d", i)
+		events = append(events, repousersessions.AuditUserSessions{
+			ID:        uuid.New(),
+			SessionID: uuid.New(),
+			UserID:    userID,
+			EventType: domainusersessions.AuditEventLogin,
+			NewValue:  &ip,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	mockRepo := &mockUserRepo{
+		getAuditEventsByUserID: func(ctx context.Context, id uuid.UUID, after *ports.AuditCursor, limit int) ([]repousersessions.AuditUserSessions, error) {
+			var page []repousersessions.AuditUserSessions
+			for _, event := range events {
+				if after != nil && !event.CreatedAt.Before(after.CreatedAt) {
+					continue
+				}
+				if len(page) < limit {
+					page = append(page, event)
+				}
+			}
+			return page, nil
+		},
+	}
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+	ctx := context.Background()
+
+	var seen []uuid.UUID
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := svc.ListActivity(ctx, userID, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListActivity() error: %v", err)
+		}
+		for _, event := range page.Events {
+			seen = append(seen, event.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != len(events) {
+		t.Fatalf("expected %d events over all pages, got %d", len(events), len(seen))
+	}
+	for i := range events {
+		if seen[i] != events[i].ID {
+			t.Errorf("event %d out of order", i)
+		}
+	}
+
+	page, err := svc.ListActivity(ctx, userID, "", 0)
+	if err != nil || len(page.Events) != len(events) || page.NextCursor != "" {
+		t.Errorf("default page size: got %+v, %v", page, err)
+	}
+	if page.Events[0].NewValue != "198.51.100.4" || page.Events[0].EventType != domainusersessions.AuditEventLogin {
+		t.Errorf("unexpected event: %+v", page.Events[0])
+	}
+
+	if _, err := svc.ListActivity(ctx, userID, "not-a-cursor", 2); !errors.Is(err, domain.ErrInvalidActivityCursor) {
+		t.Errorf("bad cursor: got %v, want ErrInvalidActivityCursor", err)
+	}
+}
+
+func TestUserService_SessionAnomaly(t *testing.T) {
+	userID, sessionID := uuid.New(), uuid.New()
+	const userAgent = "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+	session := repousersessions.UserSessions{
+		ID:        sessionID,
+		UserID:    userID,
+		IPAddress: "198.51.100.10/32",
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name        string
+		action      string
+		ipAddress   string
+		userAgent   string
+		wantAnomaly bool
+		wantErr     error
+	}{
+		{"Same client", ports.SessionAnomalyRevoke, "198.51.100.10", userAgent, false, nil},
+		{"Same network", ports.SessionAnomalyRevoke, "198.51.100.99", userAgent, false, nil},
+		{"New network is logged", ports.SessionAnomalyLog, "203.0.113.5", userAgent, true, nil},
+		{"New user agent needs reauth", ports.SessionAnomalyReauth, "198.51.100.10", "curl/8.5.0", true, domain.ErrSessionAnomaly},
+		{"New network revokes", ports.SessionAnomalyRevoke, "203.0.113.5", userAgent, true, domain.ErrSessionAnomaly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resolved []*ports.SessionAnomaly
+			publisher := &recordingPublisher{}
+			mockRepo := &mockUserRepo{
+				getUserSessionByID: func(ctx context.Context, id uuid.UUID) (*repousersessions.UserSessions, error) {
+					copied := session
+					return &copied, nil
+				},
+				getUserSessionByToken: func(ctx context.Context, token string) (*repousersessions.UserSessions, error) {
+					copied := session
+					return &copied, nil
+				},
+				resolveSessionAnomaly: func(ctx context.Context, anomaly *ports.SessionAnomaly, event *domainevents.Event) error {
+					resolved = append(resolved, anomaly)
+					publisher.deliver(t, event)
+					return nil
+				},
+				rotateUserSessionToken: func(ctx context.Context, id uuid.UUID, oldToken string, newToken string, ipAddress string, userAgent string) (*ports.CreateUserSessionResponse, error) {
+					return &ports.CreateUserSessionResponse{ID: id, UserID: userID, Token: newToken, ExpiresAt: session.ExpiresAt}, nil
+				},
+				getUserByIDFn: func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+					return &repouser.User{ID: id, Email: "user@example.com"}, nil
+				},
+			}
+			authConfig := testutil.NewTestAuthConfig(t)
+			authConfig.SessionAnomaly.Action = tt.action
+			svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+			ctx := context.Background()
+
+			// A token issued to another client makes the request check the session
+			err := svc.CheckSessionClient(ctx, &ports.SessionClientCheck{
+				UserID:             userID,
+				SessionID:          sessionID,
+				TokenNetworkHash:   authConfig.SessionAnomaly.NetworkHash("192.0.2.1"),
+				TokenUserAgentHash: HashToken("old"),
+				IPAddress:          tt.ipAddress,
+				UserAgent:          tt.userAgent,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckSessionClient() got = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantAnomaly != (len(resolved) == 1) || tt.wantAnomaly != (len(publisher.anomalies) == 1) {
+				t.Fatalf("expected anomaly = %v, got %d resolved and %d published", tt.wantAnomaly, len(resolved), len(publisher.anomalies))
+			}
+			if tt.wantAnomaly {
+				anomaly := resolved[0]
+				if anomaly.Action != tt.action || anomaly.PreviousIP != "198.51.100.10" || anomaly.IPAddress != tt.ipAddress || anomaly.AlertInterval != authConfig.SessionAnomaly.AlertInterval {
+					t.Errorf("unexpected anomaly: %+v", anomaly)
+				}
+			}
+
+			// Refreshing from the same client runs into the same policy
+			resolved, publisher.anomalies = nil, nil
+			_, err = svc.RefreshSession(ctx, "refresh-token", tt.ipAddress, tt.userAgent)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshSession() got = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantAnomaly != (len(resolved) == 1) || tt.wantAnomaly != (len(publisher.anomalies) == 1) {
+				t.Errorf("expected anomaly = %v on refresh, got %d resolved and %d published", tt.wantAnomaly, len(resolved), len(publisher.anomalies))
+			}
+		})
+	}
+
+	t.Run("Matching token skips the lookup", func(t *testing.T) {
+		authConfig := testutil.NewTestAuthConfig(t)
+		svc := NewUserService(&mockUserRepo{}, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+		err := svc.CheckSessionClient(context.Background(), &ports.SessionClientCheck{
+			UserID:             userID,
+			SessionID:          sessionID,
+			TokenNetworkHash:   authConfig.SessionAnomaly.NetworkHash("198.51.100.10"),
+			TokenUserAgentHash: HashToken(userAgent),
+			IPAddress:          "198.51.100.99",
+			UserAgent:          userAgent,
+		})
+		if err != nil {
+			t.Errorf("CheckSessionClient() error: %v", err)
+		}
+	})
+
+	t.Run("Revoked session", func(t *testing.T) {
+		mockRepo := &mockUserRepo{
+			getUserSessionByID: func(ctx context.Context, id uuid.UUID) (*repousersessions.UserSessions, error) {
+				return nil, domain.ErrSessionNotFound
+			},
+		}
+		svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), testutil.NewTestAuthConfig(t), nil)
+		err := svc.CheckSessionClient(context.Background(), &ports.SessionClientCheck{UserID: userID, SessionID: sessionID, IPAddress: "203.0.113.5"})
+		if !errors.Is(err, domain.ErrSessionExpired) {
+			t.Errorf("got %v, want ErrSessionExpired", err)
+		}
+	})
+}
+
+func TestLoginDelay(t *testing.T) {
+	cfg := &config.LockoutConfig{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Threshold: 10, LockDuration: 15 * time.Minute}
+
+	tests := []struct {
+		failures   int
+		wantDelay  time.Duration
+		wantLocked bool
+	}{
+		{1, 0, false},
+		{3, 0, false},
+		{4, time.Second, false},
+		{5, 2 * time.Second, false},
+		{7, 8 * time.Second, false},
+		{8, 10 * time.Second, false},
+		{9, 10 * time.Second, false},
+		{10, 15 * time.Minute, true},
+		{25, 15 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		delay, locked := loginDelay(cfg, tt.failures)
+		if delay != tt.wantDelay || locked != tt.wantLocked {
+			t.Errorf("loginDelay(%d) = %v, %v; want %v, %v", tt.failures, delay, locked, tt.wantDelay, tt.wantLocked)
+		}
+	}
+}
+
+func TestUserService_TOTP(t *testing.T) {
+	userID := uuid.New()
+	authConfig := testutil.NewTestAuthConfig(t)
+
+	var factor *repousermfa.UserMFATOTP
+	var challenge *repousermfa.MFAChallenge
+	var recoveryCodes []repousermfa.UserMFARecoveryCode
+	var audits []*repousersessions.AuditUserSessions
+	var sessions []uuid.UUID
+	// The delays themselves are covered by TestUserService_LoginLockout; here
+	// only what reaches the lockout counts
+	var booked, failed, unlocks int
+	var throttled error
+	storeRecoveryCodes := func(hashes []string) {
+		recoveryCodes = nil
+		for _, hash := range hashes {
+			recoveryCodes = append(recoveryCodes, repousermfa.UserMFARecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hash})
+		}
+	}
+	mockRepo := &mockUserRepo{
+		getUserByIDFn: func(ctx context.Context, id uuid.UUID) (*repouser.User, error) {
+			return &repouser.User{ID: id, Email: "user@gmail.com", UserStatus: "active", IsMFAEnabled: factor != nil && factor.ConfirmedAt != nil}, nil
+		},
+		upsertTOTPEnrollment: func(ctx context.Context, id uuid.UUID, ciphertext []byte) error {
+			factor = &repousermfa.UserMFATOTP{UserID: id, SecretCiphertext: ciphertext}
+			return nil
+		},
+		getTOTPByUserID: func(ctx context.Context, id uuid.UUID) (*repousermfa.UserMFATOTP, error) {
+			if factor == nil {
+				return nil, domain.ErrMFANotEnrolled
+			}
+			copied := *factor
+			return &copied, nil
+		},
+		confirmTOTPEnrollment: func(ctx context.Context, id uuid.UUID, step int64, hashes []string) error {
+			now := time.Now()
+			factor.ConfirmedAt, factor.LastUsedStep = &now, step
+			storeRecoveryCodes(hashes)
+			return nil
+		},
+		replaceRecoveryCodes: func(ctx context.Context, id uuid.UUID, hashes []string) error {
+			storeRecoveryCodes(hashes)
+			return nil
+		},
+		getUnusedRecoveryCodes: func(ctx context.Context, id uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error) {
+			var unused []repousermfa.UserMFARecoveryCode
+			for _, code := range recoveryCodes {
+				if code.UsedAt == nil {
+					unused = append(unused, code)
+				}
+			}
+			return unused, nil
+		},
+		consumeTOTPStep: func(ctx context.Context, id uuid.UUID, step int64) error {
+			if step <= factor.LastUsedStep {
+				return domain.ErrMFACodeReused
+			}
+			factor.LastUsedStep = step
+			return nil
+		},
+		createMFAChallenge: func(ctx context.Context, c *repousermfa.MFAChallenge) error {
+			c.ID = uuid.New()
+			challenge = c
+			return nil
+		},
+		getMFAChallengeByToken: func(ctx context.Context, token string) (*repousermfa.MFAChallenge, error) {
+			if challenge == nil || challenge.Token != token {
+				return nil, domain.ErrInvalidMFAChallenge
+			}
+			return challenge, nil
+		},
+		countMFAChallengeAttempt: func(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+			if challenge == nil || challenge.Attempts >= maxAttempts {
+				return domain.ErrInvalidMFAChallenge
+			}
+			challenge.Attempts++
+			return nil
+		},
+		deleteMFAChallenge: func(ctx context.Context, id uuid.UUID) error {
+			if challenge == nil {
+				return domain.ErrInvalidMFAChallenge
+			}
+			challenge = nil
+			return nil
+		},
+		// Spends the recovery code with the session, like the transaction does
+		createUserSessionWithinLimit: func(ctx context.Context, req *ports.CreateUserSessionRequest, limit ports.SessionLimit) (*ports.CreateUserSessionResponse, error) {
+			if req.RecoveryCodeID != uuid.Nil {
+				i := slices.IndexFunc(recoveryCodes, func(code repousermfa.UserMFARecoveryCode) bool { return code.ID == req.RecoveryCodeID })
+				if i < 0 || recoveryCodes[i].UsedAt != nil {
+					return nil, domain.ErrMFACodeReused
+				}
+				now := time.Now()
+				recoveryCodes[i].UsedAt = &now
+				remaining := fmt.Sprintf("remaining=%d", req.RecoveryCodesLeft)
+				audits = append(audits, &repousersessions.AuditUserSessions{SessionID: req.ID, UserID: req.UserID, EventType: domainusersessions.AuditEventMFARecoveryCodeUsed, NewValue: &remaining})
+			}
+			sessions = append(sessions, req.ID)
+			return &ports.CreateUserSessionResponse{ID: req.ID, UserID: req.UserID, ExpiresAt: req.ExpiresAt}, nil
+		},
+		bookLoginAttempt: func(ctx context.Context, id uuid.UUID, delay ports.LoginDelay) (int, error) {
+			if throttled != nil {
+				return 0, throttled
+			}
+			booked++
+			return booked, nil
+		},
+		recordFailedLogin: func(ctx context.Context, id uuid.UUID, attempts int, lockAudit *repousersessions.AuditUserSessions) error {
+			failed++
+			return nil
+		},
+		unlockUser: func(ctx context.Context, id uuid.UUID, audit *repousersessions.AuditUserSessions) error {
+			booked, unlocks = 0, unlocks+1
+			return nil
+		},
+	}
+	svc := NewUserService(mockRepo, &testutil.NoopLogger{}, testutil.NewTestJWTKeys(t), authConfig, nil)
+	ctx := context.Background()
+
+	enrollment, err := svc.EnrollTOTP(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() error: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("secret is not base32: %v", err)
+	}
+	if stored, _ := authConfig.MFA.DecryptSecret(userID, factor.SecretCiphertext); string(stored) != string(secret) {
+		t.Fatal("expected the stored secret to decrypt to the enrolled one")
+	}
+	if string(factor.SecretCiphertext) == string(secret) {
+		t.Fatal("expected the secret to be stored encrypted")
+	}
+
+	now := time.Now()
+	previousCode := totpCode(secret, totpStep(now)-1)
+	currentCode := totpCode(secret, totpStep(now))
+	wrongCode := totpCode(secret, totpStep(now)+5)
+
+	if _, err := svc.ConfirmTOTP(ctx, userID, wrongCode); !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Fatalf("ConfirmTOTP() with a wrong code got = %v", err)
+	}
+	firstBatch, err := svc.ConfirmTOTP(ctx, userID, previousCode)
+	if err != nil {
+		t.Fatalf("ConfirmTOTP() error: %v", err)
+	}
+	if len(firstBatch) != recoveryCodeCount || len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d returned and %d stored", recoveryCodeCount, len(firstBatch), len(recoveryCodes))
+	}
+	if recoveryCodes[0].CodeHash == firstBatch[0] {
+		t.Fatal("expected recovery codes to be stored hashed")
+	}
+	if _, err := svc.EnrollTOTP(ctx, userID); !errors.Is(err, domain.ErrMFAAlreadyEnabled) {
+		t.Fatalf("expected ErrMFAAlreadyEnabled, got %v", err)
+	}
+
+	newChallenge := func() string {
+		res, err := svc.issueMFAChallenge(ctx, userID)
+		if err != nil {
+			t.Fatalf("issueMFAChallenge() error: %v", err)
+		}
+		return res.MFAChallenge
+	}
+
+	t.Run("Code used for enrollment cannot be replayed", func(t *testing.T) {
+		_, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), Code: previousCode})
+		if !errors.Is(err, domain.ErrMFACodeReused) {
+			t.Fatalf("LoginWithMFA() got = %v, want ErrMFACodeReused", err)
+		}
+	})
+
+	t.Run("Valid code creates a session", func(t *testing.T) {
+		token := newChallenge()
+		res, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: currentCode})
+		if err != nil {
+			t.Fatalf("LoginWithMFA() error: %v", err)
+		}
+		if res.AccessToken == "" || res.RefreshToken == "" {
+			t.Errorf("expected tokens, got %+v", res)
+		}
+		if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: currentCode}); !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+			t.Errorf("expected a used challenge to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Recovery code creates a session once", func(t *testing.T) {
+		// Users retype codes from a printout, so case and dashes don't matter
+		typed := strings.ToUpper(strings.ReplaceAll(firstBatch[3], "-", " "))
+		res, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), RecoveryCode: typed})
+		if err != nil {
+			t.Fatalf("LoginWithMFA() error: %v", err)
+		}
+		if len(audits) != 1 || audits[0].SessionID != res.SessionID || audits[0].EventType != domainusersessions.AuditEventMFARecoveryCodeUsed {
+			t.Fatalf("expected one audit record for the new session, got %+v", audits)
+		}
+
+		_, err = svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), RecoveryCode: firstBatch[3]})
+		if !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a used recovery code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Recovery code spent concurrently writes nothing", func(t *testing.T) {
+		// The code is read as unused, then used by a parallel login before
+		// this one commits
+		getUnused := mockRepo.getUnusedRecoveryCodes
+		defer func() { mockRepo.getUnusedRecoveryCodes = getUnused }()
+		mockRepo.getUnusedRecoveryCodes = func(ctx context.Context, id uuid.UUID) ([]repousermfa.UserMFARecoveryCode, error) {
+			unused, err := getUnused(ctx, id)
+			now := time.Now()
+			recoveryCodes[4].UsedAt = &now
+			return unused, err
+		}
+
+		sessions, audits = nil, nil
+		_, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), RecoveryCode: firstBatch[4]})
+		if !errors.Is(err, domain.ErrMFACodeReused) {
+			t.Fatalf("LoginWithMFA() got = %v, want ErrMFACodeReused", err)
+		}
+		if len(sessions) != 0 || len(audits) != 0 {
+			t.Errorf("expected no session and no audit, got %v and %+v", sessions, audits)
+		}
+	})
+
+	t.Run("Regenerating invalidates the old batch", func(t *testing.T) {
+		secondBatch, err := svc.RegenerateRecoveryCodes(ctx, userID)
+		if err != nil {
+			t.Fatalf("RegenerateRecoveryCodes() error: %v", err)
+		}
+		if len(secondBatch) != recoveryCodeCount {
+			t.Fatalf("expected %d codes, got %d", recoveryCodeCount, len(secondBatch))
+		}
+		_, err = svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), RecoveryCode: firstBatch[5]})
+		if !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Errorf("expected a code of the old batch to be rejected, got %v", err)
+		}
+		if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: newChallenge(), RecoveryCode: secondBatch[0]}); err != nil {
+			t.Errorf("LoginWithMFA() with a new code error: %v", err)
+		}
+	})
+
+	t.Run("Too many wrong codes burn the challenge", func(t *testing.T) {
+		token := newChallenge()
+		for i := 0; i < authConfig.MFA.MaxChallengeAttempts; i++ {
+			if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: wrongCode}); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Fatalf("attempt %d: got %v, want ErrInvalidMFACode", i, err)
+			}
+		}
+		if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: wrongCode}); !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+			t.Errorf("expected the challenge to be burnt, got %v", err)
+		}
+	})
+
+	t.Run("Wrong codes count against the account lockout", func(t *testing.T) {
+		failed, unlocks = 0, 0
+		token := newChallenge()
+		svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: wrongCode})
+		svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, RecoveryCode: "not-a-recovery-code"})
+		if failed != 2 || unlocks != 0 {
+			t.Fatalf("expected 2 failed logins and no unlock, got %d and %d", failed, unlocks)
+		}
+
+		throttled = &domain.RetryAfterError{Err: domain.ErrLoginThrottled, RetryAfter: time.Minute}
+		_, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: totpCode(secret, totpStep(time.Now()))})
+		throttled = nil
+		if !errors.Is(err, domain.ErrLoginThrottled) {
+			t.Fatalf("expected a locked account to be refused before the code is checked, got %v", err)
+		}
+
+		if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, Code: totpCode(secret, totpStep(time.Now())+1)}); err != nil {
+			t.Fatalf("LoginWithMFA() error: %v", err)
+		}
+		if unlocks != 1 {
+			t.Errorf("expected the second factor to reset the failed login count, got %d unlocks", unlocks)
+		}
+	})
+
+	t.Run("Wrong recovery codes count against the challenge", func(t *testing.T) {
+		token := newChallenge()
+		for i := 0; i < authConfig.MFA.MaxChallengeAttempts; i++ {
+			if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, RecoveryCode: firstBatch[6]}); !errors.Is(err, domain.ErrInvalidMFACode) {
+				t.Fatalf("attempt %d: got %v, want ErrInvalidMFACode", i, err)
+			}
+		}
+		if _, err := svc.LoginWithMFA(ctx, &ports.MFALoginRequest{Challenge: token, RecoveryCode: firstBatch[6]}); !errors.Is(err, domain.ErrInvalidMFAChallenge) {
+			t.Errorf("expected the challenge to be burnt, got %v", err)
+		}
+	})
+}
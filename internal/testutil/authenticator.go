@@ -0,0 +1,233 @@
+package testutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/core/domain"
+)
+
+// Authenticator flags set by SoftAuthenticator.
+const (
+	AuthFlagUserPresent  byte = 0x01
+	AuthFlagUserVerified byte = 0x04
+	authFlagAttested     byte = 0x40
+)
+
+// SoftAuthenticator is a WebAuthn authenticator in memory, so passkey flows
+// can be tested without a device. It signs with ES256 unless built with an
+// Ed25519 key, and produces "none" attestations.
+type SoftAuthenticator struct {
+	RPID   string
+	Origin string
+	// Flags go into every response; clear AuthFlagUserVerified to act like
+	// a security key without a PIN.
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	UserHandle   []byte
+
+	key crypto.Signer
+}
+
+func NewSoftAuthenticator(t *testing.T, rpID, origin string) *SoftAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate authenticator key: %v", err)
+	}
+	return newSoftAuthenticator(t, rpID, origin, key)
+}
+
+func NewSoftEd25519Authenticator(t *testing.T, rpID, origin string) *SoftAuthenticator {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate authenticator key: %v", err)
+	}
+	return newSoftAuthenticator(t, rpID, origin, key)
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string, key crypto.Signer) *SoftAuthenticator {
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("failed to generate credential id: %v", err)
+	}
+	return &SoftAuthenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		Flags:        AuthFlagUserPresent | AuthFlagUserVerified,
+		CredentialID: credentialID,
+		key:          key,
+	}
+}
+
+// Register answers navigator.credentials.create() and returns the
+// clientDataJSON and attestationObject.
+func (a *SoftAuthenticator) Register(t *testing.T, challenge, userHandle []byte) ([]byte, []byte) {
+	t.Helper()
+
+	a.UserHandle = userHandle
+	clientData := a.clientData("webauthn.create", challenge)
+
+	var credential []byte
+	credential = append(credential, make([]byte, 16)...) // AAGUID
+	credential = binary.BigEndian.AppendUint16(credential, uint16(len(a.CredentialID)))
+	credential = append(credential, a.CredentialID...)
+	credential = append(credential, a.coseKey()...)
+
+	authData := append(a.authData(authFlagAttested), credential...)
+	attestation := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+	return clientData, attestation
+}
+
+// Assert answers navigator.credentials.get() and returns the clientDataJSON,
+// authenticatorData and signature. Every assertion bumps the sign counter.
+func (a *SoftAuthenticator) Assert(t *testing.T, challenge []byte) ([]byte, []byte, []byte) {
+	t.Helper()
+
+	a.SignCount++
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(0)
+
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), authData...), clientDataHash[:]...)
+
+	var signature []byte
+	var err error
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, signed)
+	default:
+		digest := sha256.Sum256(signed)
+		signature, err = a.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+	return clientData, authData, signature
+}
+
+func (a *SoftAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	clientData, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return clientData
+}
+
+func (a *SoftAuthenticator) authData(extraFlags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, a.Flags|extraFlags)
+	return binary.BigEndian.AppendUint32(authData, a.SignCount)
+}
+
+func (a *SoftAuthenticator) coseKey() []byte {
+	switch key := a.key.(type) {
+	case ed25519.PrivateKey:
+		return encodeCBOR(cborMap{
+			{1, 1},  // kty: OKP
+			{3, -8}, // alg: EdDSA
+			{-1, 6}, // crv: Ed25519
+			{-2, []byte(key.Public().(ed25519.PublicKey))},
+		})
+	case *ecdsa.PrivateKey:
+		point, _ := key.PublicKey.Bytes() // 0x04 || X || Y
+		return encodeCBOR(cborMap{
+			{1, 2},  // kty: EC2
+			{3, -7}, // alg: ES256
+			{-1, 1}, // crv: P-256
+			{-2, point[1:33]},
+			{-3, point[33:]},
+		})
+	}
+	panic("unsupported authenticator key")
+}
+
+// cborMap keeps the key order, which CTAP2 canonical encoding cares about.
+type cborMap []struct {
+	key   interface{}
+	value interface{}
+}
+
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case cborMap:
+		out := cborHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	}
+	panic("unsupported CBOR value")
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+}
+
+// MemoryChallengeStore is an in-memory ports.ChallengeStore.
+type MemoryChallengeStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func NewMemoryChallengeStore() *MemoryChallengeStore {
+	return &MemoryChallengeStore{values: make(map[string][]byte)}
+}
+
+func (s *MemoryChallengeStore) Save(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *MemoryChallengeStore) Take(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	delete(s.values, key)
+	return value, nil
+}
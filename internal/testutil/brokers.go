@@ -0,0 +1,84 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/kafka"
+	"github.com/testcontainers/testcontainers-go/modules/nats"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// SetupTestKafka starts a single node Kafka broker for the test and returns
+// its addresses. The test is skipped when Docker isn't available.
+func SetupTestKafka(t *testing.T) []string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	kafkaContainer, err := kafka.Run(ctx,
+		"confluentinc/confluent-local:7.5.0",
+		kafka.WithClusterID("golang-auth-test"),
+	)
+	testcontainers.CleanupContainer(t, kafkaContainer)
+	if err != nil {
+		t.Fatalf("failed to start kafka container: %v", err)
+	}
+
+	brokers, err := kafkaContainer.Brokers(ctx)
+	if err != nil {
+		t.Fatalf("failed to get kafka brokers: %v", err)
+	}
+	return brokers
+}
+
+// SetupTestNATS starts a NATS server with JetStream enabled for the test and
+// returns its URL. The test is skipped when Docker isn't available.
+func SetupTestNATS(t *testing.T) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	natsContainer, err := nats.Run(ctx, "nats:2.10-alpine")
+	testcontainers.CleanupContainer(t, natsContainer)
+	if err != nil {
+		t.Fatalf("failed to start nats container: %v", err)
+	}
+
+	url, err := natsContainer.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("failed to get nats url: %v", err)
+	}
+	return url
+}
+
+// SetupTestElasticMQ starts ElasticMQ, an SQS compatible queue server, for the
+// test and returns its endpoint. The test is skipped when Docker isn't
+// available.
+func SetupTestElasticMQ(t *testing.T) string {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	elasticMQContainer, err := testcontainers.Run(ctx,
+		"softwaremill/elasticmq-native:1.6.11",
+		testcontainers.WithExposedPorts("9324/tcp"),
+		testcontainers.WithWaitStrategy(wait.ForListeningPort("9324/tcp")),
+	)
+	testcontainers.CleanupContainer(t, elasticMQContainer)
+	if err != nil {
+		t.Fatalf("failed to start elasticmq container: %v", err)
+	}
+
+	host, err := elasticMQContainer.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to get elasticmq host: %v", err)
+	}
+	port, err := elasticMQContainer.MappedPort(ctx, "9324/tcp")
+	if err != nil {
+		t.Fatalf("failed to get elasticmq port: %v", err)
+	}
+	return fmt.Sprintf("http://%s:%s", host, port.Port())
+}
@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/ports"
+)
+
+// WriteTestJWTKey generates a throwaway RSA key and writes it to dir as
+// <kid>.pem, the layout config.NewJWTTokenKeys expects.
+func WriteTestJWTKey(t *testing.T, dir, kid string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	WriteTestSigningKey(t, dir, kid, key)
+}
+
+// WriteTestSigningKey writes any private key (RSA, ECDSA, Ed25519) to dir as a
+// PKCS#8 <kid>.pem file.
+func WriteTestSigningKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), privPEM, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+}
+
+// NewTestJWTKeys returns a key ring with a single active key.
+func NewTestJWTKeys(t *testing.T) *config.JWTTokenKeys {
+	t.Helper()
+
+	dir := t.TempDir()
+	WriteTestJWTKey(t, dir, "test")
+
+	keys, err := config.NewJWTTokenKeys(dir, func() config.KeyRingSettings { return config.KeyRingSettings{ActiveKID: "test"} }, time.Hour, &NoopLogger{})
+	if err != nil {
+		t.Fatalf("failed to load test keys: %v", err)
+	}
+	keys.Duration = 15 * time.Minute
+	return keys
+}
+
+// NewTestAuthConfig returns an auth config with a random MFA encryption key
+// and a localhost WebAuthn relying party.
+func NewTestAuthConfig(t *testing.T) *config.AuthConfig {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate MFA key: %v", err)
+	}
+	cfg := &config.AuthConfig{
+		MFA: config.NewMFAConfigWithKey(key, "golang-auth-test", 5*time.Minute, 5),
+		WebAuthn: &config.WebAuthnConfig{
+			RPID:         "localhost",
+			RPName:       "golang-auth-test",
+			Origins:      []string{"https://localhost"},
+			ChallengeTTL: 5 * time.Minute,
+		},
+		EmailVerification: &config.EmailVerificationConfig{
+			DefaultMode:     "link",
+			CodeTTL:         10 * time.Minute,
+			MaxCodeAttempts: 5,
+		},
+		Lockout: &config.LockoutConfig{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+			Threshold:    10,
+			LockDuration: 15 * time.Minute,
+		},
+		Sessions: &config.SessionConfig{
+			MaxSessions:     5,
+			RoleMaxSessions: map[string]int{},
+			Strategy:        ports.SessionLimitReject,
+			IdleTimeout:     24 * time.Hour,
+		},
+		SessionAnomaly: &config.SessionAnomalyConfig{
+			Action:        ports.SessionAnomalyLog,
+			IPv4Prefix:    24,
+			IPv6Prefix:    64,
+			AlertInterval: time.Hour,
+		},
+	}
+	if err := cfg.SessionAnomaly.DeriveNetworkKey(cfg.MFA); err != nil {
+		t.Fatalf("failed to derive the network key: %v", err)
+	}
+	return cfg
+}
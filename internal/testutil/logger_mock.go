@@ -1,6 +1,10 @@
 package testutil
 
-import "context"
+import (
+	"context"
+
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+)
 
 type NoopLogger struct{}
 
@@ -12,4 +16,6 @@ func (l *NoopLogger) Fatal(msg string, args ...interface{}) {}
 
 type NoPublisher struct{}
 
-func (p *NoPublisher) PublishUserRegistered(ctx context.Context, email string, token string) error
+func (p *NoPublisher) Publish(ctx context.Context, event domainevents.Event) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// MailHog is a running MailHog SMTP sink. Mails sent to SMTPHost:SMTPPort
+// show up in its API at APIURL + "/api/v2/messages".
+type MailHog struct {
+	SMTPHost string
+	SMTPPort int
+	APIURL   string
+}
+
+// SetupTestMailHog starts a MailHog container for the test. The test is
+// skipped when Docker isn't available.
+func SetupTestMailHog(t *testing.T) MailHog {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	mailhogContainer, err := testcontainers.Run(ctx,
+		"mailhog/mailhog:v1.0.1",
+		testcontainers.WithExposedPorts("1025/tcp", "8025/tcp"),
+		testcontainers.WithWaitStrategy(
+			wait.ForListeningPort("1025/tcp"),
+			wait.ForHTTP("/api/v2/messages").WithPort("8025/tcp"),
+		),
+	)
+	testcontainers.CleanupContainer(t, mailhogContainer)
+	if err != nil {
+		t.Fatalf("failed to start mailhog container: %v", err)
+	}
+
+	host, err := mailhogContainer.Host(ctx)
+	if err != nil {
+		t.Fatalf("failed to get mailhog host: %v", err)
+	}
+	smtpPort, err := mailhogContainer.MappedPort(ctx, "1025/tcp")
+	if err != nil {
+		t.Fatalf("failed to get mailhog SMTP port: %v", err)
+	}
+	apiPort, err := mailhogContainer.MappedPort(ctx, "8025/tcp")
+	if err != nil {
+		t.Fatalf("failed to get mailhog API port: %v", err)
+	}
+	return MailHog{
+		SMTPHost: host,
+		SMTPPort: smtpPort.Int(),
+		APIURL:   fmt.Sprintf("http://%s:%s", host, apiPort.Port()),
+	}
+}
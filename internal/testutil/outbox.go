@@ -0,0 +1,174 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-auth/internal/adapters/config"
+	"github.com/golang-auth/internal/core/domain"
+	domainevents "github.com/golang-auth/internal/core/domain/events"
+	"github.com/golang-auth/internal/core/ports"
+	"github.com/google/uuid"
+)
+
+// NewTestOutboxConfig returns the default outbox config with a random
+// payload encryption key.
+func NewTestOutboxConfig(t *testing.T) *config.OutboxConfig {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate outbox key: %v", err)
+	}
+	return config.NewOutboxConfigWithKey(key)
+}
+
+// MemoryPublisher is an in-memory ports.EventPublisher that records every
+// event it accepts. FailNext makes the next n publishes fail.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	events   []domainevents.Event
+	failNext int
+}
+
+var ErrPublishFailed = errors.New("publish failed")
+
+func (p *MemoryPublisher) FailNext(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failNext = n
+}
+
+// Events returns the accepted events in publish order.
+func (p *MemoryPublisher) Events() []domainevents.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]domainevents.Event(nil), p.events...)
+}
+
+func (p *MemoryPublisher) record(event domainevents.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failNext > 0 {
+		p.failNext--
+		return ErrPublishFailed
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event domainevents.Event) error {
+	return p.record(event)
+}
+
+// OutboxEntry is an event in a MemoryOutbox along with its delivery state.
+type OutboxEntry struct {
+	ports.OutboxEvent
+	Status        string // "pending", "dispatched" or "dead"
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+// MemoryOutbox is an in-memory ports.OutboxRepo with the same lease rules as
+// the Postgres one.
+type MemoryOutbox struct {
+	mu      sync.Mutex
+	entries []*OutboxEntry
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+// Add stores a pending event, as a committed transaction would. An event
+// without an ID gets one.
+func (o *MemoryOutbox) Add(event domainevents.Event) uuid.UUID {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	o.entries = append(o.entries, &OutboxEntry{OutboxEvent: ports.OutboxEvent{Event: event}, Status: "pending", NextAttemptAt: time.Now()})
+	return event.ID
+}
+
+// Entry returns a copy of the event with the given ID, or nil.
+func (o *MemoryOutbox) Entry(eventID uuid.UUID) *OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if entry.ID == eventID {
+			copied := *entry
+			return &copied
+		}
+	}
+	return nil
+}
+
+// MakeDue lets every pending event be claimed right away, as if its backoff
+// or lease had run out.
+func (o *MemoryOutbox) MakeDue() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		entry.NextAttemptAt = time.Now()
+	}
+}
+
+func (o *MemoryOutbox) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]ports.OutboxEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	leaseID := uuid.New()
+	var claimed []ports.OutboxEvent
+	for _, entry := range o.entries {
+		if len(claimed) == limit {
+			break
+		}
+		if entry.Status != "pending" || entry.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		entry.LeaseID = leaseID
+		entry.Attempts++
+		entry.NextAttemptAt = time.Now().Add(lease)
+		claimed = append(claimed, entry.OutboxEvent)
+	}
+	return claimed, nil
+}
+
+func (o *MemoryOutbox) MarkOutboxEventDispatched(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID) error {
+	return o.release(eventID, leaseID, func(entry *OutboxEntry) {
+		entry.Status = "dispatched"
+		entry.LastError = ""
+	})
+}
+
+func (o *MemoryOutbox) RescheduleOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, retryAt time.Time, lastError string) error {
+	return o.release(eventID, leaseID, func(entry *OutboxEntry) {
+		entry.NextAttemptAt = retryAt
+		entry.LastError = lastError
+	})
+}
+
+func (o *MemoryOutbox) DeadLetterOutboxEvent(ctx context.Context, eventID uuid.UUID, leaseID uuid.UUID, lastError string) error {
+	return o.release(eventID, leaseID, func(entry *OutboxEntry) {
+		entry.Status = "dead"
+		entry.LastError = lastError
+	})
+}
+
+func (o *MemoryOutbox) release(eventID uuid.UUID, leaseID uuid.UUID, update func(*OutboxEntry)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if entry.ID == eventID && entry.LeaseID == leaseID && entry.Status == "pending" {
+			update(entry)
+			entry.LeaseID = uuid.Nil
+			return nil
+		}
+	}
+	return domain.ErrOutboxLeaseLost
+}
@@ -0,0 +1,36 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+// SetupTestRedis starts a Redis server for the test and returns a client
+// connected to it. The test is skipped when Docker isn't available.
+func SetupTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	ctx := context.Background()
+
+	redisContainer, err := tcredis.Run(ctx, "redis:7-alpine")
+	testcontainers.CleanupContainer(t, redisContainer)
+	if err != nil {
+		t.Fatalf("failed to start redis container: %v", err)
+	}
+
+	url, err := redisContainer.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("failed to get redis url: %v", err)
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("failed to parse redis url: %v", err)
+	}
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
@@ -1,28 +1,84 @@
 package main
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 )
 
+// Generates a signing key for the JWT key ring:
+//
+//	go run keys/key_gen.go -dir keys -kid 2026q4 -alg ES256
+//
+// <kid>.pem is the private key, <kid>.pub.pem its public half. Copy only the
+// .pub.pem file to services that verify but never sign.
 func main() {
-	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	dir := flag.String("dir", ".", "directory to write the key files to")
+	kid := flag.String("kid", "v1", "key id, used as the file name and the JWT kid header")
+	alg := flag.String("alg", "RS256", "signing algorithm: RS256, PS256, ES256 or EdDSA")
+	flag.Parse()
+
+	var (
+		key     crypto.Signer
+		privPEM *pem.Block
+		err     error
+	)
+	switch *alg {
+	case "RS256", "PS256":
+		var rsaKey *rsa.PrivateKey
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		key = rsaKey
+		if err == nil {
+			privPEM = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+		}
+	case "ES256":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		log.Fatalf("unsupported algorithm %q", *alg)
+	}
+	if err != nil {
+		log.Fatalf("failed to generate %s key: %v", *alg, err)
+	}
 
 	// Private Key
-	privFile, _ := os.Create("private.pem")
-	pem.Encode(privFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
-	})
+	if privPEM == nil {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			log.Fatalf("failed to marshal private key: %v", err)
+		}
+		privPEM = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(*dir, *kid+".pem"), pem.EncodeToMemory(privPEM), 0o600); err != nil {
+		log.Fatalf("failed to write private key: %v", err)
+	}
 
 	// Public Key
-	pubFile, _ := os.Create("public.pem")
-	pubBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
-	pem.Encode(pubFile, &pem.Block{
-		Type:  "RSA PUBLIC KEY",
+	pubBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		log.Fatalf("failed to marshal public key: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
 		Bytes: pubBytes,
 	})
+	if err := os.WriteFile(filepath.Join(*dir, *kid+".pub.pem"), pubPEM, 0o644); err != nil {
+		log.Fatalf("failed to write public key: %v", err)
+	}
+
+	// RSA keys sign with RS256 unless told otherwise
+	if *alg == "PS256" {
+		fmt.Printf("Set jwt.algorithms.%s: PS256 in the config to sign with this key using PS256\n", *kid)
+	}
 }